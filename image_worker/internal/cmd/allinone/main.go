@@ -0,0 +1,106 @@
+// Команда allinone запускает API и воркер в одном процессе без Postgres,
+// Kafka и MinIO: репозиторий и очередь задач хранятся в памяти,
+// объекты - в памяти или в каталоге при STORAGE_DRIVER=filesystem.
+// Подходит для демо, end-to-end тестов и встраивания.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	workermemory "github.com/dontpanicw/ImageProcessor/image_worker/internal/memory"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/worker"
+	brokermemory "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/filesystem"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/scanner/clamav"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/scanner/noop"
+	"github.com/dontpanicw/ImageProcessor/internal/app"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+// Размер буфера очереди
+const queueSize = 100
+
+func main() {
+	log.Println("Starting Image Processor in all-in-one mode...")
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	repo := memory.NewRepository()
+
+	var storage port.ObjectStorage = memory.NewStorage()
+	if cfg.StorageDriver == config.StorageDriverFilesystem {
+		storage = filesystem.NewFileStorage(cfg)
+	}
+	if err := storage.InitMinio(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	var scanner port.Scanner = noop.NewScanner()
+	if cfg.Scanner == config.ScannerClamAV {
+		scanner = clamav.NewScanner(cfg)
+	}
+
+	queue := brokermemory.NewQueue(queueSize)
+	consumer := workermemory.NewConsumer(queue.Tasks(), worker.NewHandler(cfg, storage, repo, scanner), repo, cfg.WorkerConcurrency)
+	srv := app.NewServer(cfg, repo, storage, queue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		if err := consumer.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Consumer error: %v", err)
+		}
+	}()
+
+	errChan := make(chan error, 1)
+	go func() {
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case <-sigChan:
+		log.Println("Received shutdown signal")
+	case err := <-errChan:
+		log.Printf("HTTP server error: %v", err)
+	}
+
+	// Сначала перестаем принимать загрузки, затем даем воркерам
+	// обработать задачи из очереди
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+
+	if err := srv.Stop(shutdownCtx); err != nil {
+		log.Printf("Failed to stop HTTP server: %v", err)
+	}
+	if err := queue.Close(); err != nil {
+		log.Printf("Failed to close queue: %v", err)
+	}
+
+	select {
+	case <-consumerDone:
+		log.Println("All-in-one stopped gracefully")
+	case <-shutdownCtx.Done():
+		cancel()
+		log.Println("Shutdown timeout exceeded")
+	}
+}
@@ -3,16 +3,28 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/kafka"
+	workernats "github.com/dontpanicw/ImageProcessor/image_worker/internal/nats"
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	workerpostgres "github.com/dontpanicw/ImageProcessor/image_worker/internal/postgres"
 	"github.com/dontpanicw/ImageProcessor/image_worker/internal/rabbitmq"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/worker"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/filesystem"
 	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/minio"
 	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/postgres"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/sqlite"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/scanner/clamav"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/scanner/noop"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
 	_ "github.com/lib/pq"
 )
 
@@ -25,23 +37,37 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Подключаемся к PostgreSQL с retry
+	// Подключаемся к базе метаданных. Схему создает API при запуске
 	var db *sql.DB
+	var imageRepo port.RepositoryDB
 
-	for i := 0; i < 10; i++ {
-		db, err = sql.Open("postgres", cfg.MasterDSN)
-		if err == nil {
-			err = db.Ping()
+	switch cfg.DBDriver {
+	case config.DBDriverSQLite:
+		db, err = sqlite.Open(cfg)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		log.Printf("Opened SQLite database %s", cfg.SQLitePath)
+		imageRepo = sqlite.NewImageRepository(db)
+	default:
+		// Подключаемся к PostgreSQL с retry
+		for i := 0; i < 10; i++ {
+			db, err = sql.Open("postgres", cfg.MasterDSN)
 			if err == nil {
-				break
+				err = db.Ping()
+				if err == nil {
+					break
+				}
 			}
+			log.Printf("Waiting for PostgreSQL... (attempt %d/10): %v", i+1, err)
+			time.Sleep(3 * time.Second)
 		}
-		log.Printf("Waiting for PostgreSQL... (attempt %d/10): %v", i+1, err)
-		time.Sleep(3 * time.Second)
-	}
 
-	if err != nil {
-		log.Fatalf("Failed to connect to database after 10 attempts: %v", err)
+		if err != nil {
+			log.Fatalf("Failed to connect to database after 10 attempts: %v", err)
+		}
+		log.Println("Connected to PostgreSQL")
+		imageRepo = postgres.NewImageRepository(cfg)
 	}
 	defer func() {
 		err = db.Close()
@@ -49,25 +75,77 @@ func main() {
 			log.Fatalf("Failed to close database connection: %v", err)
 		}
 	}()
-	log.Println("Connected to PostgreSQL")
 
 	// Инициализируем репозитории
-	imageRepo := postgres.NewImageRepository(cfg)
-	minioClient := minio.NewMinioClient(cfg)
+	var minioClient port.ObjectStorage
+	switch cfg.StorageDriver {
+	case config.StorageDriverFilesystem:
+		minioClient = filesystem.NewFileStorage(cfg)
+	default:
+		minioClient = minio.NewMinioClient(cfg)
+	}
 
-	// Инициализируем MinIO bucket
+	// Инициализируем хранилище объектов
 	if err := minioClient.InitMinio(); err != nil {
-		log.Fatalf("Failed to initialize MinIO bucket: %v", err)
+		log.Fatalf("Failed to initialize %s storage: %v", cfg.StorageDriver, err)
+	}
+	log.Printf("Object storage %s initialized", cfg.StorageDriver)
+
+	// Проверка оригиналов перед обработкой
+	var scanner port.Scanner = noop.NewScanner()
+	if cfg.Scanner == config.ScannerClamAV {
+		scanner = clamav.NewScanner(cfg)
+		log.Printf("Scanning originals with clamd at %s", cfg.ClamAVAddr)
 	}
-	log.Println("MinIO initialized")
 
-	// Даем Kafka время на инициализацию
-	log.Println("Waiting for Kafka to be ready...")
-	time.Sleep(10 * time.Second)
+	// Результаты прошлых версий обработчика больше не используются
+	handler := worker.NewHandler(cfg, minioClient, imageRepo, scanner)
+	handler.PurgeCache(context.Background())
+
+	var consumer workerPort.Consumer
+	switch cfg.QueueDriver {
+	case config.QueueDriverPostgres:
+		consumer = workerpostgres.NewConsumer(db, cfg.MasterDSN, handler, imageRepo, workerpostgres.Options{
+			Workers:           cfg.WorkerConcurrency,
+			VisibilityTimeout: cfg.JobVisibilityTimeout,
+			MaxAttempts:       cfg.JobMaxAttempts,
+			RetryDelay:        time.Second,
+			PollInterval:      5 * time.Second,
+		})
+		log.Println("Postgres job consumer created")
+	case config.QueueDriverRabbitMQ:
+		consumer = rabbitmq.NewConsumer(cfg.AMQPURL, cfg.AMQPQueue, handler, imageRepo, rabbitmq.Options{
+			Prefetch:    cfg.AMQPPrefetch,
+			MaxAttempts: cfg.JobMaxAttempts,
+			RetryDelay:  time.Second,
+		})
+		log.Printf("RabbitMQ consumer created for queue %s", cfg.AMQPQueue)
+	case config.QueueDriverNATS:
+		consumer = workernats.NewConsumer(cfg.NATSURL, handler, imageRepo, workernats.Options{
+			Workers:    cfg.WorkerConcurrency,
+			AckWait:    cfg.JobVisibilityTimeout,
+			MaxDeliver: cfg.JobMaxAttempts,
+			RetryDelay: time.Second,
+		})
+		log.Printf("NATS JetStream consumer created for %s", cfg.NATSURL)
+	default:
+		// Даем Kafka время на инициализацию
+		log.Println("Waiting for Kafka to be ready...")
+		time.Sleep(10 * time.Second)
+
+		consumer = kafka.NewConsumer(cfg, handler, imageRepo)
+		log.Println("Kafka consumer created")
+	}
 
-	// Создаем Kafka consumer
-	consumer := rabbitmq.NewConsumer(cfg, minioClient, imageRepo)
-	log.Println("Kafka consumer created")
+	// Метрики воркера (expvar): /debug/vars
+	if cfg.WorkerMetricsAddr != "" {
+		go func() {
+			log.Printf("Starting metrics server on %s", cfg.WorkerMetricsAddr)
+			if err := http.ListenAndServe(cfg.WorkerMetricsAddr, expvar.Handler()); err != nil {
+				log.Printf("Metrics server error: %v", err)
+			}
+		}()
+	}
 
 	// Создаем контекст с возможностью отмены
 	ctx, cancel := context.WithCancel(context.Background())
@@ -80,7 +158,7 @@ func main() {
 	// Запускаем consumer в отдельной горутине
 	errChan := make(chan error, 1)
 	go func() {
-		log.Println("Starting Kafka consumer...")
+		log.Printf("Starting %s consumer...", cfg.QueueDriver)
 		if err := consumer.Start(ctx); err != nil {
 			log.Printf("Consumer start error: %v", err)
 			errChan <- err
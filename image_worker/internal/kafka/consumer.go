@@ -0,0 +1,233 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/broker"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/segmentio/kafka-go"
+)
+
+// commitTimeout ограничивает коммит смещения и пометку Failed после
+// остановки воркера
+const commitTimeout = 5 * time.Second
+
+// groupID - группа потребителей воркеров
+const groupID = "image-workers"
+
+// defaultRetryDelay - пауза перед повтором, растет с номером попытки
+const defaultRetryDelay = time.Second
+
+// Consumer читает топики задач всех приоритетов и выдает задачи воркерам
+// по весам PriorityWeights, а внутри приоритета - владельцам по очереди
+type Consumer struct {
+	lanes     []*lane
+	scheduler *scheduler
+	handler   workerPort.TaskHandler
+	repo      port.RepositoryDB
+	// workers - сколько задач обрабатывается одновременно
+	workers int
+	// maxAttempts - после стольких неудачных попыток изображение
+	// помечается Failed, а смещение задачи коммитится
+	maxAttempts int
+	retryDelay  time.Duration
+	// wg ждет циклы чтения и воркеров
+	wg sync.WaitGroup
+}
+
+// NewConsumer создает consumer. repo нужен, чтобы пометить Failed
+// изображения, задачи которых исчерпали JobMaxAttempts
+func NewConsumer(cfg *config.Config, handler workerPort.TaskHandler, repo port.RepositoryDB) workerPort.Consumer {
+	return newConsumer(cfg, handler, repo, groupID)
+}
+
+// newConsumer создает consumer группы group. Тесты используют отдельные
+// группы, чтобы не перебалансировать друг друга
+func newConsumer(cfg *config.Config, handler workerPort.TaskHandler, repo port.RepositoryDB, group string) *Consumer {
+	var lanes []*lane
+	for _, priority := range domain.Priorities {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        cfg.KafkaBrokers,
+			Topic:          broker.TaskTopic(cfg, priority),
+			GroupID:        group,
+			MinBytes:       1,
+			MaxBytes:       10e6,
+			CommitInterval: time.Second,
+			StartOffset:    kafka.FirstOffset,
+		})
+		lanes = append(lanes, newLane(priority, cfg.PriorityWeights[priority], reader))
+	}
+
+	limits := tenantLimits{fallback: cfg.TenantConcurrency, byTenant: cfg.TenantConcurrencyLimits}
+	return &Consumer{
+		lanes:       lanes,
+		scheduler:   newScheduler(lanes, cfg.KafkaReadAhead, cfg.KafkaHoldLimit, limits),
+		handler:     handler,
+		repo:        repo,
+		workers:     cfg.WorkerConcurrency,
+		maxAttempts: max(cfg.JobMaxAttempts, 1),
+		retryDelay:  defaultRetryDelay,
+	}
+}
+
+func (c *Consumer) Start(ctx context.Context) error {
+	log.Println("Starting to consume messages from Kafka...")
+
+	// Каждый топик читается отдельно и наперед, чтобы задачи высокого
+	// приоритета не ждали за уже прочитанными задачами низкого, а задачи
+	// владельцев - за массовой загрузкой другого владельца
+	for _, l := range c.lanes {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.fetch(ctx, l)
+		}()
+	}
+
+	// Воркеры берут прочитанные задачи у планировщика, поэтому одновременно
+	// обрабатывается не больше workers задач
+	workers := max(c.workers, 1)
+	for i := 0; i < workers; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.startWorker(ctx, i)
+		}()
+	}
+
+	<-ctx.Done()
+	c.wg.Wait()
+	return ctx.Err()
+}
+
+// fetch читает топик полосы и ставит задачи в очереди владельцев
+func (c *Consumer) fetch(ctx context.Context, l *lane) {
+	for {
+		msg, err := l.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error fetching %s priority message: %v", l.priority, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		j := &job{lane: l, msg: msg, attempt: 1}
+		if err := json.Unmarshal(msg.Value, &j.task); err != nil {
+			j.err = fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		j.tenant = j.task.Tenant
+		if j.tenant == "" {
+			j.tenant = domain.DefaultTenant
+		}
+
+		l.offsets.add(msg)
+		if err := c.scheduler.put(ctx, j); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Consumer) startWorker(ctx context.Context, id int) {
+	log.Printf("Worker %d started and waiting for messages", id)
+
+	for {
+		j, err := c.scheduler.next(ctx)
+		if err != nil {
+			log.Printf("Worker %d stopped", id)
+			return
+		}
+		msg := j.msg
+
+		log.Printf("Worker %d received %s priority message of tenant %s: topic=%s, partition=%d, offset=%d, key=%s",
+			id, j.lane.priority, j.tenant, msg.Topic, msg.Partition, msg.Offset, string(msg.Key))
+
+		// Обрабатываем сообщение
+		err = j.err
+		if err == nil {
+			err = c.handler.Handle(ctx, j.task)
+		}
+		c.scheduler.done(j)
+		if err != nil {
+			// Прерванная остановкой задача не коммитится и будет прочитана
+			// снова
+			if ctx.Err() != nil {
+				log.Printf("Worker %d stopped", id)
+				return
+			}
+			if j.err == nil && j.attempt < c.maxAttempts {
+				log.Printf("Worker %d failed to process image %s (attempt %d/%d): %v",
+					id, j.task.ImageID, j.attempt, c.maxAttempts, err)
+				c.retry(ctx, j)
+				continue
+			}
+			// Упавшая задача не должна задерживать коммит следующих
+			log.Printf("CRITICAL: Worker %d failed to process message, skipping: %v", id, err)
+			if j.err == nil {
+				c.fail(ctx, j.task.ImageID, err)
+			}
+		}
+
+		// Коммитим смещение, когда обработаны все сообщения партиции до него.
+		// Завершенная задача коммитится и после начала остановки
+		commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+		err = j.lane.offsets.done(commitCtx, msg)
+		cancel()
+		if err != nil {
+			log.Printf("Worker %d: failed to commit message: %v", id, err)
+		} else {
+			log.Printf("Worker %d finished message", id)
+		}
+	}
+}
+
+// retry возвращает задачу планировщику после паузы. Смещение задачи до
+// этого не коммитится, а воркер на время паузы свободен
+func (c *Consumer) retry(ctx context.Context, j *job) {
+	delay := c.retryDelay * time.Duration(j.attempt)
+	j.attempt++
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		_ = c.scheduler.put(ctx, j)
+	}()
+}
+
+// fail переводит изображение в статус Failed с последней ошибкой
+func (c *Consumer) fail(ctx context.Context, imageID string, reason error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+	defer cancel()
+
+	if err := c.repo.MarkFailed(ctx, imageID, reason.Error()); err != nil {
+		log.Printf("Failed to mark image %s as failed: %v", imageID, err)
+	}
+}
+
+func (c *Consumer) Close() error {
+	// Читатели закрываются только после того, как воркеры закоммитили
+	// завершенные задачи
+	c.wg.Wait()
+	log.Println("Closing Kafka readers...")
+	var errs []error
+	for _, l := range c.lanes {
+		if err := l.reader.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s reader: %w", l.reader.Config().Topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,246 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/port/porttest"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/broker"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/segmentio/kafka-go"
+)
+
+// testRetryDelay - пауза перед повтором в тестах
+const testRetryDelay = 10 * time.Millisecond
+
+// randomName возвращает имя со случайным суффиксом для топиков и групп
+func randomName(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return "porttest_" + hex.EncodeToString(b)
+}
+
+// openTestTopics возвращает конфигурацию с отдельными топиками задач,
+// чтобы тесты пакетов, которые go test запускает параллельно, не читали
+// задачи друг друга. Топики удаляются после теста
+func openTestTopics(t *testing.T) *config.Config {
+	t.Helper()
+	brokers := os.Getenv("TEST_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("TEST_KAFKA_BROKERS is not set")
+	}
+
+	cfg := &config.Config{
+		KafkaBrokers:      strings.Split(brokers, ","),
+		KafkaTaskTopic:    randomName(t),
+		PriorityWeights:   config.DefaultPriorityWeights,
+		KafkaReadAhead:    100,
+		KafkaHoldLimit:    100,
+		WorkerConcurrency: 3,
+		JobMaxAttempts:    3,
+	}
+
+	conn, err := kafka.Dial("tcp", cfg.KafkaBrokers[0])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var topics []string
+	var topicConfigs []kafka.TopicConfig
+	for _, priority := range domain.Priorities {
+		topics = append(topics, broker.TaskTopic(cfg, priority))
+		topicConfigs = append(topicConfigs, kafka.TopicConfig{
+			Topic:             broker.TaskTopic(cfg, priority),
+			NumPartitions:     3,
+			ReplicationFactor: 1,
+		})
+	}
+	if err := controllerConn.CreateTopics(topicConfigs...); err != nil {
+		_ = controllerConn.Close()
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = controllerConn.DeleteTopics(topics...)
+		_ = controllerConn.Close()
+	})
+	return cfg
+}
+
+func TestConsumer_Contract(t *testing.T) {
+	openTestTopics(t)
+
+	porttest.RunConsumer(t, func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer) {
+		cfg := openTestTopics(t)
+		consumer := newConsumer(cfg, handler, repo, randomName(t))
+		consumer.retryDelay = testRetryDelay
+		producer := broker.NewProducer(cfg)
+		t.Cleanup(func() { _ = producer.Close() })
+		return consumer, producer
+	})
+}
+
+// testConsumer создает consumer без читателей с одним воркером. Задачи
+// ставятся в планировщик напрямую, коммиты смещений запоминаются
+func testConsumer(handler workerPort.TaskHandler, repo port.RepositoryDB, maxAttempts int) (*Consumer, *lane, *[]int64) {
+	s, lanes := testLanes(1, 1, 1, 10, tenantLimits{})
+	l := lanes[domain.PriorityNormal]
+	tracker, committed := testTracker()
+	l.offsets = tracker
+	return &Consumer{
+		scheduler:   s,
+		handler:     handler,
+		repo:        repo,
+		workers:     1,
+		maxAttempts: maxAttempts,
+		retryDelay:  testRetryDelay,
+	}, l, committed
+}
+
+// runWorker запускает воркер, пока не вызвана возвращенная функция
+func runWorker(c *Consumer) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.startWorker(ctx, 0)
+	}()
+	return func() {
+		cancel()
+		c.wg.Wait()
+	}
+}
+
+// putTask ставит задачу изображения id со смещением offset в полосу l
+func putTask(t *testing.T, c *Consumer, l *lane, id string, offset int64) {
+	t.Helper()
+	msg := kafka.Message{Offset: offset}
+	l.offsets.add(msg)
+	j := &job{lane: l, msg: msg, task: domain.TaskMessage{ImageID: id}, tenant: domain.DefaultTenant, attempt: 1}
+	if err := c.scheduler.put(context.Background(), j); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestConsumer_RetriesFailedTask(t *testing.T) {
+	handled := make(chan string, 10)
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		mu.Lock()
+		calls[task.ImageID]++
+		n := calls[task.ImageID]
+		mu.Unlock()
+		if task.ImageID == "flaky" && n == 1 {
+			return errors.New("temporary failure")
+		}
+		handled <- task.ImageID
+		return nil
+	})
+	c, l, committed := testConsumer(handler, memory.NewRepository(), 3)
+	stop := runWorker(c)
+
+	putTask(t, c, l, "flaky", 0)
+	putTask(t, c, l, "next", 1)
+
+	// Пока задача ждет повтора, воркер обрабатывает следующую
+	var order []string
+	for len(order) < 2 {
+		select {
+		case id := <-handled:
+			order = append(order, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected both tasks to be handled, got %v", order)
+		}
+	}
+	stop()
+
+	if order[0] != "next" || order[1] != "flaky" {
+		t.Errorf("Expected next task before the retry, got %v", order)
+	}
+	if calls["flaky"] != 2 {
+		t.Errorf("Expected 2 attempts of flaky task, got %d", calls["flaky"])
+	}
+	// Смещение следующей задачи коммитится только вместе с повторенной
+	if len(*committed) != 1 || (*committed)[0] != 1 {
+		t.Errorf("Expected single commit of offset 1, got %v", *committed)
+	}
+}
+
+func TestConsumer_FailsAfterMaxAttempts(t *testing.T) {
+	repo := memory.NewRepository()
+	if err := repo.SaveObject(context.Background(), domain.Image{Id: "broken", Status: domain.ImageStatusPending}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var mu sync.Mutex
+	calls := 0
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return errors.New("permanent failure")
+	})
+	c, l, committed := testConsumer(handler, repo, 2)
+	stop := runWorker(c)
+	putTask(t, c, l, "broken", 0)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		image, err := repo.GetObjectByID(context.Background(), "broken")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if image.Status == domain.ImageStatusFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Неисправимая задача больше не выдается
+	time.Sleep(100 * time.Millisecond)
+	stop()
+
+	image, err := repo.GetObjectByID(context.Background(), "broken")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusFailed || image.FailureReason != "permanent failure" {
+		t.Errorf("Expected image to be marked failed with the last error, got %s %q", image.Status, image.FailureReason)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 handler calls, got %d", calls)
+	}
+	if len(*committed) != 1 || (*committed)[0] != 0 {
+		t.Errorf("Expected offset 0 to be committed, got %v", *committed)
+	}
+}
+
+type handlerFunc func(ctx context.Context, task domain.TaskMessage) error
+
+func (f handlerFunc) Handle(ctx context.Context, task domain.TaskMessage) error {
+	return f(ctx, task)
+}
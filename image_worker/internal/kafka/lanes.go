@@ -0,0 +1,245 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+// job - прочитанное сообщение и задача из него
+type job struct {
+	lane   *lane
+	msg    kafka.Message
+	task   domain.TaskMessage
+	tenant string
+	// attempt - номер попытки обработки, начиная с 1
+	attempt int
+	// err - ошибка разбора сообщения, такая задача не обрабатывается
+	err error
+}
+
+// lane - топик задач одного приоритета. Прочитанные задачи ждут в
+// очередях своих владельцев
+type lane struct {
+	priority string
+	weight   int
+	// current - текущий вес smooth weighted round-robin
+	current int
+	reader  *kafka.Reader
+	offsets *offsetTracker
+	// tenants - владельцы с задачами в порядке обхода, cursor - следующий
+	tenants []*tenantQueue
+	cursor  int
+}
+
+// tenantQueue - задачи одного владельца в полосе
+type tenantQueue struct {
+	tenant string
+	jobs   []*job
+}
+
+func newLane(priority string, weight int, reader *kafka.Reader) *lane {
+	if weight < 1 {
+		weight = 1
+	}
+	return &lane{
+		priority: priority,
+		weight:   weight,
+		reader:   reader,
+		offsets:  newOffsetTracker(reader.CommitMessages),
+	}
+}
+
+// tenantLimits - сколько задач владельца обрабатывается одновременно,
+// 0 - без ограничения
+type tenantLimits struct {
+	fallback int
+	byTenant map[string]int
+}
+
+func (l tenantLimits) of(tenant string) int {
+	if limit, ok := l.byTenant[tenant]; ok {
+		return limit
+	}
+	return l.fallback
+}
+
+// scheduler выдает воркерам задачи в два шага. Полоса выбирается по smooth
+// weighted round-robin среди полос, где ждет задача, которую можно выдать:
+// когда задачи есть во всех полосах, они выдаются в пропорции весов, пустые
+// полосы пропускаются и не копят вес. В полосе владельцы обходятся по
+// кругу (deficit round-robin с единичной стоимостью задачи), поэтому
+// массовая загрузка одного владельца не занимает все воркеры. Владелец,
+// достигший ограничения одновременных задач, пропускается
+type scheduler struct {
+	mu    sync.Mutex
+	lanes []*lane
+	// readAhead - сколько задач, которые можно выдать, может ждать в
+	// полосе, дальше чтение топика приостанавливается
+	readAhead int
+	// holdLimit - сколько задач владельцев, достигших ограничения, может
+	// ждать в полосе, дальше чтение топика тоже приостанавливается
+	holdLimit int
+	limits    tenantLimits
+	// running - сколько задач владельца сейчас обрабатывается
+	running map[string]int
+	// changed закрывается при каждом изменении очередей и будит всех
+	// ожидающих
+	changed chan struct{}
+}
+
+func newScheduler(lanes []*lane, readAhead, holdLimit int, limits tenantLimits) *scheduler {
+	return &scheduler{
+		lanes:     lanes,
+		readAhead: max(readAhead, 1),
+		holdLimit: max(holdLimit, 1),
+		limits:    limits,
+		running:   make(map[string]int),
+		changed:   make(chan struct{}),
+	}
+}
+
+// put ставит задачу в очередь ее владельца и ждет, пока в полосе
+// освободится место
+func (s *scheduler) put(ctx context.Context, j *job) error {
+	s.mu.Lock()
+	for s.full(j.lane) {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	l := j.lane
+	var queue *tenantQueue
+	for _, q := range l.tenants {
+		if q.tenant == j.tenant {
+			queue = q
+			break
+		}
+	}
+	if queue == nil {
+		queue = &tenantQueue{tenant: j.tenant}
+		l.tenants = append(l.tenants, queue)
+	}
+	queue.jobs = append(queue.jobs, j)
+	s.notify()
+	return nil
+}
+
+// next ждет и возвращает следующую задачу. После обработки воркер
+// вызывает done
+func (s *scheduler) next(ctx context.Context) (*job, error) {
+	for {
+		s.mu.Lock()
+		j := s.pick()
+		changed := s.changed
+		s.mu.Unlock()
+		if j != nil {
+			return j, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// done освобождает место владельца задачи
+func (s *scheduler) done(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[j.tenant]--
+	if s.running[j.tenant] <= 0 {
+		delete(s.running, j.tenant)
+	}
+	s.notify()
+}
+
+// pick выбирает задачу без ожидания, вызывается под блокировкой
+func (s *scheduler) pick() *job {
+	var best *lane
+	total := 0
+	for _, l := range s.lanes {
+		if s.available(l) < 0 {
+			continue
+		}
+		l.current += l.weight
+		total += l.weight
+		if best == nil || l.current > best.current {
+			best = l
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+
+	i := s.available(best)
+	queue := best.tenants[i]
+	j := queue.jobs[0]
+	queue.jobs = queue.jobs[1:]
+	if len(queue.jobs) == 0 {
+		best.tenants = append(best.tenants[:i], best.tenants[i+1:]...)
+	} else {
+		i++
+	}
+	best.cursor = 0
+	if len(best.tenants) > 0 {
+		best.cursor = i % len(best.tenants)
+	}
+	s.running[j.tenant]++
+	s.notify()
+	return j
+}
+
+// available возвращает индекс следующего по кругу владельца полосы,
+// задачу которого можно выдать, или -1
+func (s *scheduler) available(l *lane) int {
+	for n := 0; n < len(l.tenants); n++ {
+		i := (l.cursor + n) % len(l.tenants)
+		if s.allowed(l.tenants[i].tenant) {
+			return i
+		}
+	}
+	return -1
+}
+
+// full проверяет, что в полосе нет места: задач, которые можно выдать
+// сейчас, readAhead, или задач владельцев, достигших ограничения,
+// holdLimit. Задачи владельцев на пределе не занимают окно чтения: иначе
+// владелец с ограничением и большой очередью заполнил бы его, и задачи
+// остальных владельцев за ним не читались бы, пока очередь не разберется.
+// holdLimit не дает такой очереди целиком оказаться в памяти воркера и в
+// незакоммиченных смещениях: в полосе не больше readAhead + holdLimit задач
+func (s *scheduler) full(l *lane) bool {
+	waiting, held := 0, 0
+	for _, q := range l.tenants {
+		if s.allowed(q.tenant) {
+			waiting += len(q.jobs)
+		} else {
+			held += len(q.jobs)
+		}
+	}
+	return waiting >= s.readAhead || held >= s.holdLimit
+}
+
+// allowed проверяет, что задачу владельца можно выдать
+func (s *scheduler) allowed(tenant string) bool {
+	limit := s.limits.of(tenant)
+	return limit == 0 || s.running[tenant] < limit
+}
+
+// notify будит всех, кто ждет изменения очередей
+func (s *scheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
@@ -0,0 +1,317 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+// testLanes создает полосы без читателей с весами high, normal и low и
+// ограничением задач владельцев на пределе по умолчанию
+func testLanes(high, normal, low int, readAhead int, limits tenantLimits) (*scheduler, map[string]*lane) {
+	byPriority := map[string]*lane{
+		domain.PriorityHigh:   newLane(domain.PriorityHigh, high, nil),
+		domain.PriorityNormal: newLane(domain.PriorityNormal, normal, nil),
+		domain.PriorityLow:    newLane(domain.PriorityLow, low, nil),
+	}
+	var lanes []*lane
+	for _, priority := range domain.Priorities {
+		lanes = append(lanes, byPriority[priority])
+	}
+	return newScheduler(lanes, readAhead, config.DefaultKafkaHoldLimit, limits), byPriority
+}
+
+// put ставит задачу владельца tenant со смещением offset в полосу l
+func put(t *testing.T, s *scheduler, l *lane, tenant string, offset int64) {
+	t.Helper()
+	j := &job{lane: l, msg: kafka.Message{Offset: offset}, tenant: tenant}
+	if err := s.put(context.Background(), j); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// next берет задачу, которая уже должна ждать
+func next(t *testing.T, s *scheduler) *job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	j, err := s.next(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return j
+}
+
+func TestScheduler_WeightedShare(t *testing.T) {
+	s, lanes := testLanes(6, 3, 1, 1, tenantLimits{})
+
+	counts := make(map[string]int)
+	var first string
+	for i := 0; i < 100; i++ {
+		// Во всех полосах всегда есть задача
+		for _, l := range lanes {
+			if len(l.tenants) == 0 {
+				put(t, s, l, domain.DefaultTenant, 0)
+			}
+		}
+		j := next(t, s)
+		s.done(j)
+		if i == 0 {
+			first = j.lane.priority
+		}
+		counts[j.lane.priority]++
+	}
+
+	if first != domain.PriorityHigh {
+		t.Errorf("Expected high priority first, got %s", first)
+	}
+	if counts[domain.PriorityHigh] != 60 || counts[domain.PriorityNormal] != 30 || counts[domain.PriorityLow] != 10 {
+		t.Errorf("Expected 60/30/10 split, got %v", counts)
+	}
+}
+
+func TestScheduler_SkipsEmptyLanes(t *testing.T) {
+	s, lanes := testLanes(6, 3, 1, 1, tenantLimits{})
+
+	// Только низкий приоритет: он не ждет пустые полосы
+	for i := 0; i < 3; i++ {
+		put(t, s, lanes[domain.PriorityLow], domain.DefaultTenant, int64(i))
+		j := next(t, s)
+		s.done(j)
+		if j.lane.priority != domain.PriorityLow || j.msg.Offset != int64(i) {
+			t.Errorf("Expected low priority message %d, got %s %d", i, j.lane.priority, j.msg.Offset)
+		}
+	}
+
+	// Вес, не использованный пустыми полосами, не копится: высокий
+	// приоритет после простоя не захватывает все выдачи
+	if lanes[domain.PriorityHigh].current != 0 || lanes[domain.PriorityNormal].current != 0 {
+		t.Errorf("Expected idle lanes not to accumulate weight, got %d %d",
+			lanes[domain.PriorityHigh].current, lanes[domain.PriorityNormal].current)
+	}
+}
+
+func TestScheduler_RoundRobinTenants(t *testing.T) {
+	s, lanes := testLanes(6, 3, 1, 100, tenantLimits{})
+	l := lanes[domain.PriorityNormal]
+
+	// Массовая загрузка прочитана раньше задач других владельцев
+	for i := 0; i < 10; i++ {
+		put(t, s, l, "bulk", int64(i))
+	}
+	put(t, s, l, "acme", 10)
+	put(t, s, l, "acme", 11)
+	put(t, s, l, "solo", 12)
+
+	var got []string
+	for i := 0; i < 8; i++ {
+		got = append(got, next(t, s).tenant)
+	}
+	want := []string{"bulk", "acme", "solo", "bulk", "acme", "bulk", "bulk", "bulk"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected tenants %v, got %v", want, got)
+		}
+	}
+}
+
+func TestScheduler_TenantLimit(t *testing.T) {
+	limits := tenantLimits{fallback: 2, byTenant: map[string]int{"bulk": 1, "acme": 0}}
+	s, lanes := testLanes(6, 3, 1, 100, limits)
+	l := lanes[domain.PriorityNormal]
+	for i := 0; i < 3; i++ {
+		put(t, s, l, "bulk", int64(i))
+	}
+	for i := 3; i < 6; i++ {
+		put(t, s, l, "acme", int64(i))
+	}
+
+	// bulk ограничен одной задачей, acme - без ограничения
+	bulk := next(t, s)
+	for i := 0; i < 3; i++ {
+		if j := next(t, s); j.tenant != "acme" {
+			t.Fatalf("Expected acme while bulk is at its limit, got %s", j.tenant)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.next(ctx); err == nil {
+		t.Fatal("Expected no task while bulk is at its limit")
+	}
+
+	// Завершение задачи освобождает место владельца
+	s.done(bulk)
+	if j := next(t, s); j.tenant != "bulk" || j.msg.Offset != 1 {
+		t.Errorf("Expected next bulk task, got %s %d", j.tenant, j.msg.Offset)
+	}
+}
+
+func TestScheduler_ReadAhead(t *testing.T) {
+	s, lanes := testLanes(6, 3, 1, 2, tenantLimits{})
+	l := lanes[domain.PriorityLow]
+	put(t, s, l, "bulk", 0)
+	put(t, s, l, "bulk", 1)
+
+	// Полоса заполнена: чтение топика ждет, пока задачу не заберут
+	added := make(chan error, 1)
+	go func() {
+		added <- s.put(context.Background(), &job{lane: l, msg: kafka.Message{Offset: 2}, tenant: "bulk"})
+	}()
+	select {
+	case <-added:
+		t.Fatal("Expected put to wait for free space")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	next(t, s)
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected put to finish after a task was taken")
+	}
+}
+
+func TestScheduler_ReadAheadSkipsLimitedTenant(t *testing.T) {
+	limits := tenantLimits{byTenant: map[string]int{"bulk": 1}}
+	s, lanes := testLanes(6, 3, 1, 2, limits)
+	l := lanes[domain.PriorityLow]
+
+	put(t, s, l, "bulk", 0)
+	bulk := next(t, s)
+
+	// bulk на пределе: его очередь больше окна чтения, но не останавливает
+	// чтение задач других владельцев
+	for i := int64(1); i <= 4; i++ {
+		put(t, s, l, "bulk", i)
+	}
+	put(t, s, l, "acme", 5)
+	if j := next(t, s); j.tenant != "acme" {
+		t.Fatalf("Expected acme task, got %s", j.tenant)
+	}
+
+	// Когда bulk освобождает место, его задачи снова занимают окно
+	s.done(bulk)
+	added := make(chan error, 1)
+	go func() {
+		added <- s.put(context.Background(), &job{lane: l, msg: kafka.Message{Offset: 6}, tenant: "acme"})
+	}()
+	select {
+	case <-added:
+		t.Fatal("Expected put to wait while bulk tasks fill the window")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// Выданная задача снова ставит bulk на предел
+	if j := next(t, s); j.tenant != "bulk" {
+		t.Fatalf("Expected bulk task, got %s", j.tenant)
+	}
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected put to finish once bulk is at its limit again")
+	}
+}
+
+// queued возвращает, сколько задач ждет в полосе
+func queued(s *scheduler, l *lane) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, q := range l.tenants {
+		n += len(q.jobs)
+	}
+	return n
+}
+
+// Массовая загрузка владельца на пределе не читается в память целиком:
+// чтение топика останавливается на holdLimit задачах
+func TestScheduler_HoldLimit(t *testing.T) {
+	limits := tenantLimits{byTenant: map[string]int{"bulk": 1}}
+	s, lanes := testLanes(6, 3, 1, 2, limits)
+	s.holdLimit = 3
+	l := lanes[domain.PriorityLow]
+
+	put(t, s, l, "bulk", 0)
+	bulk := next(t, s)
+
+	// Цикл чтения топика с очередью из 100 задач bulk
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	read := make(chan int64, 100)
+	go func() {
+		for offset := int64(1); offset <= 100; offset++ {
+			if err := s.put(ctx, &job{lane: l, msg: kafka.Message{Offset: offset}, tenant: "bulk"}); err != nil {
+				return
+			}
+			read <- offset
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := queued(s, l); n != 3 || len(read) != 3 {
+		t.Fatalf("Expected reading to stop at 3 held tasks, got %d queued, %d read", n, len(read))
+	}
+
+	// Освободившийся bulk снова занимает окно чтения, и в полосе остается
+	// не больше readAhead + holdLimit задач
+	for i := 0; i < 10; i++ {
+		s.done(bulk)
+		bulk = next(t, s)
+		time.Sleep(5 * time.Millisecond)
+		if n := queued(s, l); n > 5 {
+			t.Fatalf("Expected at most 5 queued tasks, got %d", n)
+		}
+	}
+	if n := queued(s, l); n != 3 || len(read) != 13 {
+		t.Errorf("Expected 3 held tasks after 13 reads, got %d queued, %d read", n, len(read))
+	}
+}
+
+func TestScheduler_WaitsForMessage(t *testing.T) {
+	s, lanes := testLanes(6, 3, 1, 1, tenantLimits{})
+
+	got := make(chan string, 1)
+	go func() {
+		j, err := s.next(context.Background())
+		if err == nil {
+			got <- j.lane.priority
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	put(t, s, lanes[domain.PriorityNormal], domain.DefaultTenant, 0)
+
+	select {
+	case priority := <-got:
+		if priority != domain.PriorityNormal {
+			t.Errorf("Expected normal priority, got %s", priority)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected waiting worker to receive message")
+	}
+}
+
+func TestScheduler_Canceled(t *testing.T) {
+	s, lanes := testLanes(6, 3, 1, 1, tenantLimits{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.next(ctx); err == nil {
+		t.Error("Expected error from next with canceled context")
+	}
+
+	// Полоса занята: put не блокируется после отмены
+	put(t, s, lanes[domain.PriorityHigh], domain.DefaultTenant, 0)
+	if err := s.put(ctx, &job{lane: lanes[domain.PriorityHigh], tenant: domain.DefaultTenant}); err == nil {
+		t.Error("Expected error from put with canceled context")
+	}
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker коммитит смещения партиции только подряд. Задачи
+// обрабатываются не в порядке чтения, и коммит смещения задачи означает,
+// что обработаны все до нее: пока задача не завершена, следующие за ней не
+// коммитятся и после падения воркера будут прочитаны снова
+type offsetTracker struct {
+	mu     sync.Mutex
+	commit func(ctx context.Context, msgs ...kafka.Message) error
+	// pending - прочитанные и еще не закоммиченные сообщения партиции в
+	// порядке смещений
+	pending map[int][]*pendingMessage
+}
+
+type pendingMessage struct {
+	msg  kafka.Message
+	done bool
+}
+
+func newOffsetTracker(commit func(ctx context.Context, msgs ...kafka.Message) error) *offsetTracker {
+	return &offsetTracker{
+		commit:  commit,
+		pending: make(map[int][]*pendingMessage),
+	}
+}
+
+// add запоминает прочитанное сообщение
+func (t *offsetTracker) add(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.pending[msg.Partition]
+	// После перебалансировки партиция читается заново с закоммиченного
+	// смещения: задачи в обработке завершатся, но уже не будут закоммичены
+	if n := len(pending); n > 0 && pending[n-1].msg.Offset >= msg.Offset {
+		pending = nil
+	}
+	t.pending[msg.Partition] = append(pending, &pendingMessage{msg: msg})
+}
+
+// done отмечает сообщение завершенным и коммитит все завершенные подряд
+// с начала партиции. Коммит выполняется под блокировкой, чтобы смещения
+// уходили в Kafka по возрастанию
+func (t *offsetTracker) done(ctx context.Context, msg kafka.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.pending[msg.Partition]
+	for _, p := range pending {
+		if p.msg.Offset == msg.Offset {
+			p.done = true
+			break
+		}
+	}
+
+	n := 0
+	for n < len(pending) && pending[n].done {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	last := pending[n-1].msg
+	t.pending[msg.Partition] = pending[n:]
+	return t.commit(ctx, last)
+}
@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// testTracker возвращает трекер, запоминающий закоммиченные смещения
+func testTracker() (*offsetTracker, *[]int64) {
+	var committed []int64
+	tracker := newOffsetTracker(func(ctx context.Context, msgs ...kafka.Message) error {
+		for _, msg := range msgs {
+			committed = append(committed, msg.Offset)
+		}
+		return nil
+	})
+	return tracker, &committed
+}
+
+func TestOffsetTracker_CommitsContiguous(t *testing.T) {
+	tracker, committed := testTracker()
+	ctx := context.Background()
+	for offset := int64(10); offset < 14; offset++ {
+		tracker.add(kafka.Message{Partition: 0, Offset: offset})
+	}
+
+	// Медленная задача 10 задерживает коммит уже обработанных 11 и 12
+	for _, offset := range []int64{11, 12} {
+		if err := tracker.done(ctx, kafka.Message{Partition: 0, Offset: offset}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if len(*committed) != 0 {
+		t.Fatalf("Expected no commits before offset 10 is done, got %v", *committed)
+	}
+
+	if err := tracker.done(ctx, kafka.Message{Partition: 0, Offset: 10}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(*committed) != 1 || (*committed)[0] != 12 {
+		t.Fatalf("Expected commit of offset 12, got %v", *committed)
+	}
+
+	if err := tracker.done(ctx, kafka.Message{Partition: 0, Offset: 13}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(*committed) != 2 || (*committed)[1] != 13 {
+		t.Errorf("Expected commit of offset 13, got %v", *committed)
+	}
+}
+
+func TestOffsetTracker_PartitionsIndependent(t *testing.T) {
+	tracker, committed := testTracker()
+	ctx := context.Background()
+	tracker.add(kafka.Message{Partition: 0, Offset: 5})
+	tracker.add(kafka.Message{Partition: 1, Offset: 7})
+
+	// Незавершенная задача партиции 0 не задерживает партицию 1
+	if err := tracker.done(ctx, kafka.Message{Partition: 1, Offset: 7}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(*committed) != 1 || (*committed)[0] != 7 {
+		t.Errorf("Expected commit of partition 1 offset 7, got %v", *committed)
+	}
+}
+
+func TestOffsetTracker_Rewind(t *testing.T) {
+	tracker, committed := testTracker()
+	ctx := context.Background()
+	tracker.add(kafka.Message{Partition: 0, Offset: 20})
+	tracker.add(kafka.Message{Partition: 0, Offset: 21})
+
+	// Перебалансировка: партиция снова читается с закоммиченного смещения
+	tracker.add(kafka.Message{Partition: 0, Offset: 20})
+
+	// Задача 21 из прошлого чтения не коммитится
+	if err := tracker.done(ctx, kafka.Message{Partition: 0, Offset: 21}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(*committed) != 0 {
+		t.Fatalf("Expected no commits for stale message, got %v", *committed)
+	}
+
+	if err := tracker.done(ctx, kafka.Message{Partition: 0, Offset: 20}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(*committed) != 1 || (*committed)[0] != 20 {
+		t.Errorf("Expected commit of offset 20, got %v", *committed)
+	}
+}
+
+func TestOffsetTracker_ConcurrentCommitsInOrder(t *testing.T) {
+	tracker, committed := testTracker()
+	const total = 1000
+	for offset := int64(0); offset < total; offset++ {
+		tracker.add(kafka.Message{Partition: 0, Offset: offset})
+	}
+
+	// Воркеры завершают задачи в случайном порядке
+	var wg sync.WaitGroup
+	for _, offset := range rand.Perm(total) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tracker.done(context.Background(), kafka.Message{Partition: 0, Offset: int64(offset)}); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Смещения уходят в Kafka только по возрастанию
+	for i := 1; i < len(*committed); i++ {
+		if (*committed)[i] <= (*committed)[i-1] {
+			t.Fatalf("Expected increasing commits, got %d after %d", (*committed)[i], (*committed)[i-1])
+		}
+	}
+	if n := len(*committed); n == 0 || (*committed)[n-1] != total-1 {
+		t.Errorf("Expected last commit of offset %d, got %v", total-1, *committed)
+	}
+}
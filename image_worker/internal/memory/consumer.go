@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ workerPort.Consumer = (*Consumer)(nil)
+
+// Параметры повтора задачи, завершившейся ошибкой
+const (
+	maxAttempts = 3
+	retryDelay  = time.Second
+	failTimeout = 10 * time.Second
+)
+
+// Consumer читает задачи из канала очереди в памяти и передает их
+// обработчику в нескольких горутинах
+type Consumer struct {
+	tasks   <-chan domain.TaskMessage
+	handler workerPort.TaskHandler
+	repo    port.RepositoryDB
+	workers int
+	// retryDelay - пауза перед повтором, растущая с номером попытки
+	retryDelay time.Duration
+}
+
+func NewConsumer(tasks <-chan domain.TaskMessage, handler workerPort.TaskHandler, repo port.RepositoryDB, workers int) *Consumer {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Consumer{
+		tasks:      tasks,
+		handler:    handler,
+		repo:       repo,
+		workers:    workers,
+		retryDelay: retryDelay,
+	}
+}
+
+// Start обрабатывает задачи, пока не отменен контекст или не закрыт
+// канал. Задачи, оставшиеся в закрытом канале, обрабатываются до конца
+func (c *Consumer) Start(ctx context.Context) error {
+	log.Printf("Starting %d in-memory workers", c.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c.startWorker(ctx, id)
+		}(i)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (c *Consumer) startWorker(ctx context.Context, id int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-c.tasks:
+			if !ok {
+				return
+			}
+			c.handle(ctx, id, task)
+		}
+	}
+}
+
+// handle повторяет задачу до maxAttempts раз: в отличие от Kafka,
+// неподтвержденная задача не вернется в очередь. После последней попытки
+// изображение помечается Failed, чтобы оно не осталось в Pending
+func (c *Consumer) handle(ctx context.Context, id int, task domain.TaskMessage) {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := c.handler.Handle(ctx, task)
+		if err == nil {
+			return
+		}
+		log.Printf("Worker %d failed to process image %s (attempt %d/%d): %v",
+			id, task.ImageID, attempt, maxAttempts, err)
+		if attempt == maxAttempts {
+			c.fail(ctx, task.ImageID, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.retryDelay * time.Duration(attempt)):
+		}
+	}
+}
+
+// fail переводит изображение в статус Failed с ошибкой последней попытки.
+// Статус записывается и при остановке воркера: попытки уже исчерпаны
+func (c *Consumer) fail(ctx context.Context, imageID string, reason error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failTimeout)
+	defer cancel()
+
+	if err := c.repo.MarkFailed(ctx, imageID, reason.Error()); err != nil {
+		log.Printf("Failed to mark image %s as failed: %v", imageID, err)
+	}
+}
+
+// Close ничего не делает: канал закрывает владелец очереди
+func (c *Consumer) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/port/porttest"
+	brokermemory "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+type handlerFunc func(ctx context.Context, task domain.TaskMessage) error
+
+func (f handlerFunc) Handle(ctx context.Context, task domain.TaskMessage) error {
+	return f(ctx, task)
+}
+
+func TestConsumer_DrainsClosedChannel(t *testing.T) {
+	tasks := make(chan domain.TaskMessage, 10)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		tasks <- domain.TaskMessage{ImageID: id}
+	}
+	close(tasks)
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[task.ImageID]++
+		return nil
+	})
+
+	if err := NewConsumer(tasks, handler, memory.NewRepository(), 3).Start(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(handled) != 4 {
+		t.Errorf("Expected 4 handled tasks, got %v", handled)
+	}
+	for id, count := range handled {
+		if count != 1 {
+			t.Errorf("Expected task %s to be handled once, got %d", id, count)
+		}
+	}
+}
+
+func TestConsumer_RetriesFailedTask(t *testing.T) {
+	tasks := make(chan domain.TaskMessage, 1)
+	tasks <- domain.TaskMessage{ImageID: "a"}
+	close(tasks)
+
+	attempts := 0
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	if err := NewConsumer(tasks, handler, memory.NewRepository(), 1).Start(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestConsumer_FailsAfterMaxAttempts(t *testing.T) {
+	repo := memory.NewRepository()
+	if err := repo.SaveObject(context.Background(), domain.Image{Id: "broken", Status: domain.ImageStatusPending}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tasks := make(chan domain.TaskMessage, 1)
+	tasks <- domain.TaskMessage{ImageID: "broken"}
+	close(tasks)
+
+	attempts := 0
+	consumer := NewConsumer(tasks, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		attempts++
+		return errors.New("permanent failure")
+	}), repo, 1)
+	consumer.retryDelay = time.Millisecond
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if attempts != maxAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxAttempts, attempts)
+	}
+	image, err := repo.GetObjectByID(context.Background(), "broken")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusFailed || image.FailureReason != "permanent failure" {
+		t.Errorf("Expected image to be marked failed with the last error, got %s %q", image.Status, image.FailureReason)
+	}
+}
+
+func TestConsumer_StopsOnCancel(t *testing.T) {
+	tasks := make(chan domain.TaskMessage)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := NewConsumer(tasks, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		return nil
+	}), memory.NewRepository(), 2).Start(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestConsumer_Contract(t *testing.T) {
+	porttest.RunConsumer(t, func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer) {
+		queue := brokermemory.NewQueue(4)
+		t.Cleanup(func() { _ = queue.Close() })
+		consumer := NewConsumer(queue.Tasks(), handler, repo, 3)
+		consumer.retryDelay = 10 * time.Millisecond
+		return consumer, queue
+	})
+}
@@ -0,0 +1,335 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	brokernats "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/nats"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var _ workerPort.Consumer = (*Consumer)(nil)
+
+// DurableName - имя постоянного consumer: воркеры с одним именем делят
+// задачи, а после перезапуска продолжают с неподтвержденных
+const DurableName = "image-workers"
+
+// ackTimeout ограничивает подтверждение задачи после остановки воркера
+const ackTimeout = 5 * time.Second
+
+// Options - параметры чтения потока задач
+type Options struct {
+	Workers int
+	// AckWait - через сколько задача, взятая упавшим обработчиком,
+	// выдается снова. Пока задача обрабатывается, срок продлевается
+	AckWait time.Duration
+	// MaxDeliver - после стольких выдач задача больше не выдается,
+	// а изображение получает статус Failed
+	MaxDeliver int
+	// RetryDelay - пауза перед повтором, растет с номером попытки
+	RetryDelay time.Duration
+	// ReconnectDelay - пауза перед повторным подключением при запуске
+	ReconnectDelay time.Duration
+}
+
+// maxDeliveriesAdvisory - уведомление JetStream о задаче, исчерпавшей
+// MaxDeliver без подтверждения (например, воркер упал на последней выдаче)
+type maxDeliveriesAdvisory struct {
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries uint64 `json:"deliveries"`
+}
+
+// Consumer читает задачи из потока JetStream постоянным consumer с
+// явным подтверждением. Задача подтверждается после обработки, поэтому
+// гарантия доставки - at-least-once, как у Kafka. О результате
+// обработки публикуется событие в поток событий
+type Consumer struct {
+	url     string
+	handler workerPort.TaskHandler
+	repo    port.RepositoryDB
+	opts    Options
+
+	mu sync.Mutex
+	nc *natsgo.Conn
+}
+
+// NewConsumer создает consumer. repo нужен, чтобы пометить Failed
+// изображения, задачи которых исчерпали MaxDeliver, и узнать итоговый
+// статус для событий
+func NewConsumer(url string, handler workerPort.TaskHandler, repo port.RepositoryDB, opts Options) *Consumer {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxDeliver < 1 {
+		opts.MaxDeliver = 1
+	}
+	if opts.AckWait <= 0 {
+		opts.AckWait = 5 * time.Minute
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 5 * time.Second
+	}
+	return &Consumer{
+		url:     url,
+		handler: handler,
+		repo:    repo,
+		opts:    opts,
+	}
+}
+
+// Start обрабатывает задачи, пока не отменен контекст. Встроенный
+// сервер запускается вместе с API, поэтому подключение повторяется,
+// пока сервер недоступен
+func (c *Consumer) Start(ctx context.Context) error {
+	var nc *natsgo.Conn
+	var js jetstream.JetStream
+	for {
+		var err error
+		nc, js, err = brokernats.Connect(ctx, c.url)
+		if err == nil {
+			break
+		}
+		log.Printf("Waiting for NATS at %s: %v", c.url, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.opts.ReconnectDelay):
+		}
+	}
+	c.mu.Lock()
+	c.nc = nc
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.nc = nil
+		c.mu.Unlock()
+		// Подтверждения отправляются без ожидания ответа
+		if err := nc.FlushTimeout(ackTimeout); err != nil && !errors.Is(err, natsgo.ErrConnectionClosed) {
+			log.Printf("Failed to flush NATS connection: %v", err)
+		}
+		nc.Close()
+	}()
+
+	cons, err := js.CreateOrUpdateConsumer(ctx, brokernats.TaskStream, jetstream.ConsumerConfig{
+		Durable:       DurableName,
+		FilterSubject: brokernats.TaskSubject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.opts.AckWait,
+		MaxDeliver:    c.opts.MaxDeliver,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer %s: %w", DurableName, err)
+	}
+
+	// Advisory получает один воркер группы, иначе каждый воркер пометил бы
+	// изображение Failed и опубликовал событие
+	advisories, err := nc.QueueSubscribe(
+		fmt.Sprintf("$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.%s.%s", brokernats.TaskStream, DurableName),
+		DurableName,
+		func(msg *natsgo.Msg) { c.handleMaxDeliveries(ctx, js, msg) })
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to max deliveries advisories: %w", err)
+	}
+	defer func() {
+		if err := advisories.Unsubscribe(); err != nil && !errors.Is(err, natsgo.ErrConnectionClosed) {
+			log.Printf("Failed to unsubscribe from advisories: %v", err)
+		}
+	}()
+
+	iter, err := cons.Messages(jetstream.PullMaxMessages(c.opts.Workers))
+	if err != nil {
+		return fmt.Errorf("failed to consume stream %s: %w", brokernats.TaskStream, err)
+	}
+	go func() {
+		<-ctx.Done()
+		// Задачи из буфера не выданы обработчикам и будут выданы снова
+		iter.Stop()
+	}()
+
+	log.Printf("Starting %d JetStream workers on %s", c.opts.Workers, brokernats.TaskStream)
+
+	msgs := make(chan jetstream.Msg)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for msg := range msgs {
+				c.process(ctx, id, js, msg)
+			}
+			log.Printf("Worker %d stopped", id)
+		}(i)
+	}
+
+	for {
+		msg, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) || errors.Is(err, natsgo.ErrConnectionClosed) {
+				break
+			}
+			log.Printf("Failed to fetch task: %v", err)
+			continue
+		}
+		msgs <- msg
+	}
+	close(msgs)
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (c *Consumer) process(ctx context.Context, id int, js jetstream.JetStream, msg jetstream.Msg) {
+	var task domain.TaskMessage
+	if err := json.Unmarshal(msg.Data(), &task); err != nil {
+		// Повтор не поможет: задача больше не выдается
+		log.Printf("CRITICAL: Failed to unmarshal message: %v", err)
+		if err := msg.TermWithReason("malformed task"); err != nil {
+			log.Printf("Failed to terminate message: %v", err)
+		}
+		return
+	}
+
+	attempt := 1
+	if md, err := msg.Metadata(); err == nil {
+		attempt = int(md.NumDelivered)
+	}
+	log.Printf("Worker %d received task for image %s (attempt %d/%d)",
+		id, task.ImageID, attempt, c.opts.MaxDeliver)
+
+	// Пока задача обрабатывается, срок подтверждения продлевается,
+	// чтобы долгую обработку не начал второй воркер
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		c.heartbeat(heartbeatCtx, msg)
+	}()
+
+	err := c.handler.Handle(ctx, task)
+	stopHeartbeat()
+	<-heartbeatDone
+
+	ackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	switch {
+	case err == nil:
+		if err := msg.DoubleAck(ackCtx); err != nil {
+			// Задача будет выдана снова: обработчик идемпотентен
+			log.Printf("Worker %d: failed to ack task for image %s: %v", id, task.ImageID, err)
+			return
+		}
+		c.publishResult(ackCtx, js, task.ImageID)
+	case ctx.Err() != nil:
+		// JetStream считает и эту выдачу, но задача выдается снова сразу
+		if err := msg.Nak(); err != nil {
+			log.Printf("Failed to nak task for image %s: %v", task.ImageID, err)
+		}
+	case attempt >= c.opts.MaxDeliver:
+		log.Printf("CRITICAL: Task for image %s failed after %d attempts: %v", task.ImageID, attempt, err)
+		c.fail(ackCtx, js, task.ImageID, err.Error())
+		if err := msg.TermWithReason(err.Error()); err != nil {
+			log.Printf("Failed to terminate task for image %s: %v", task.ImageID, err)
+		}
+	default:
+		log.Printf("Worker %d failed to process image %s (attempt %d/%d): %v",
+			id, task.ImageID, attempt, c.opts.MaxDeliver, err)
+		if err := msg.NakWithDelay(c.opts.RetryDelay * time.Duration(attempt)); err != nil {
+			log.Printf("Failed to nak task for image %s: %v", task.ImageID, err)
+		}
+	}
+}
+
+func (c *Consumer) heartbeat(ctx context.Context, msg jetstream.Msg) {
+	ticker := time.NewTicker(c.opts.AckWait / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := msg.InProgress(); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to extend ack wait: %v", err)
+			}
+		}
+	}
+}
+
+// handleMaxDeliveries помечает Failed изображение, задача которого
+// исчерпала MaxDeliver без ответа воркера, и удаляет задачу из потока
+func (c *Consumer) handleMaxDeliveries(ctx context.Context, js jetstream.JetStream, msg *natsgo.Msg) {
+	var advisory maxDeliveriesAdvisory
+	if err := json.Unmarshal(msg.Data, &advisory); err != nil {
+		log.Printf("Failed to unmarshal max deliveries advisory: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	stream, err := js.Stream(ctx, brokernats.TaskStream)
+	if err != nil {
+		log.Printf("Failed to get stream %s: %v", brokernats.TaskStream, err)
+		return
+	}
+	raw, err := stream.GetMsg(ctx, advisory.StreamSeq)
+	if err != nil {
+		log.Printf("Failed to get task %d: %v", advisory.StreamSeq, err)
+		return
+	}
+
+	var task domain.TaskMessage
+	if err := json.Unmarshal(raw.Data, &task); err == nil {
+		log.Printf("CRITICAL: Task for image %s was not acknowledged after %d deliveries", task.ImageID, advisory.Deliveries)
+		c.fail(ctx, js, task.ImageID, fmt.Sprintf("task was not acknowledged after %d deliveries", advisory.Deliveries))
+	}
+	if err := stream.DeleteMsg(ctx, advisory.StreamSeq); err != nil {
+		log.Printf("Failed to delete task %d: %v", advisory.StreamSeq, err)
+	}
+}
+
+// fail переводит изображение в статус Failed и публикует событие
+func (c *Consumer) fail(ctx context.Context, js jetstream.JetStream, imageID, reason string) {
+	if err := c.repo.MarkFailed(ctx, imageID, reason); err != nil {
+		log.Printf("Failed to mark image %s as failed: %v", imageID, err)
+	}
+	event := domain.ResultEvent{ImageID: imageID, Status: domain.ImageStatusFailed, Error: reason}
+	if err := brokernats.PublishEvent(ctx, js, event); err != nil {
+		log.Printf("Failed to publish result of image %s: %v", imageID, err)
+	}
+}
+
+// publishResult публикует событие с итоговым статусом изображения:
+// обработчик мог сам завершить задачу статусом Failed или Quarantined
+func (c *Consumer) publishResult(ctx context.Context, js jetstream.JetStream, imageID string) {
+	image, err := c.repo.GetObjectByID(ctx, imageID)
+	if err != nil {
+		log.Printf("Failed to get status of image %s: %v", imageID, err)
+		return
+	}
+	event := domain.ResultEvent{ImageID: imageID, Status: image.Status, Error: image.FailureReason}
+	if err := brokernats.PublishEvent(ctx, js, event); err != nil {
+		log.Printf("Failed to publish result of image %s: %v", imageID, err)
+	}
+}
+
+// Close закрывает соединение, если Start еще не завершился
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.nc != nil {
+		c.nc.Close()
+	}
+	return nil
+}
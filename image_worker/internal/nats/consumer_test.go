@@ -0,0 +1,277 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/port/porttest"
+	brokernats "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/nats"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// startTestServer запускает встроенный сервер на свободном порту и
+// возвращает его адрес и подключение к нему
+func startTestServer(t *testing.T) (string, jetstream.JetStream) {
+	t.Helper()
+	ns, err := brokernats.StartServer("127.0.0.1:-1", t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+
+	nc, js, err := brokernats.Connect(context.Background(), ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return ns.ClientURL(), js
+}
+
+// savePending сохраняет изображение, ожидающее обработки
+func savePending(t *testing.T, repo port.RepositoryDB, id string) {
+	t.Helper()
+	err := repo.SaveObject(context.Background(), domain.Image{Id: id, Status: domain.ImageStatusPending})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+// waitEvent ждет событие о результате обработки imageID
+func waitEvent(t *testing.T, js jetstream.JetStream, status, imageID string) domain.ResultEvent {
+	t.Helper()
+	ctx := context.Background()
+	stream, err := js.Stream(ctx, brokernats.EventStream)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		msg, err := stream.GetLastMsgForSubject(ctx, brokernats.EventSubject(status))
+		if err == nil {
+			var event domain.ResultEvent
+			if err := json.Unmarshal(msg.Data, &event); err == nil && event.ImageID == imageID {
+				return event
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s event for image %s", status, imageID)
+	return domain.ResultEvent{}
+}
+
+// crash забирает единственную выдачу задачи без подтверждения, как
+// воркер, упавший на обработке
+func crash(t *testing.T, js jetstream.JetStream, opts Options) {
+	t.Helper()
+	crashed, err := js.CreateOrUpdateConsumer(context.Background(), brokernats.TaskStream, jetstream.ConsumerConfig{
+		Durable:       DurableName,
+		FilterSubject: brokernats.TaskSubject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       opts.AckWait,
+		MaxDeliver:    opts.MaxDeliver,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	batch, err := crashed.Fetch(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for range batch.Messages() {
+	}
+}
+
+// countingRepository считает вызовы MarkFailed
+type countingRepository struct {
+	port.RepositoryDB
+	failed atomic.Int32
+}
+
+func (r *countingRepository) MarkFailed(ctx context.Context, id, reason string) error {
+	r.failed.Add(1)
+	return r.RepositoryDB.MarkFailed(ctx, id, reason)
+}
+
+// run запускает consumer и возвращает функцию остановки
+func run(t *testing.T, consumer *Consumer) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+	return func() {
+		cancel()
+		<-done
+		if err := consumer.Close(); err != nil {
+			t.Errorf("Expected no error from Close, got %v", err)
+		}
+	}
+}
+
+func TestConsumer_Contract(t *testing.T) {
+	porttest.RunConsumer(t, func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer) {
+		url, js := startTestServer(t)
+		consumer := NewConsumer(url, handler, repo, Options{
+			Workers:    3,
+			AckWait:    time.Minute,
+			MaxDeliver: 3,
+			RetryDelay: 10 * time.Millisecond,
+		})
+		return consumer, brokernats.NewProducer(js)
+	})
+}
+
+func TestConsumer_PublishesResult(t *testing.T) {
+	url, js := startTestServer(t)
+	repo := memory.NewRepository()
+	savePending(t, repo, "image-1")
+
+	consumer := NewConsumer(url, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		return repo.UpdateProcessedImage(ctx, task.ImageID, "processed/"+task.ImageID)
+	}), repo, Options{Workers: 1, AckWait: time.Minute, MaxDeliver: 3})
+	stop := run(t, consumer)
+	defer stop()
+
+	if err := brokernats.NewProducer(js).SendMessage(context.Background(), domain.TaskMessage{ImageID: "image-1", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	event := waitEvent(t, js, domain.ImageStatusDone, "image-1")
+	if event.Error != "" {
+		t.Errorf("Expected no error in Done event, got %q", event.Error)
+	}
+}
+
+func TestConsumer_FailedAfterMaxDeliver(t *testing.T) {
+	url, js := startTestServer(t)
+	repo := memory.NewRepository()
+	savePending(t, repo, "broken")
+
+	var calls atomic.Int32
+	consumer := NewConsumer(url, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		calls.Add(1)
+		return errors.New("permanent failure")
+	}), repo, Options{Workers: 2, AckWait: time.Minute, MaxDeliver: 2, RetryDelay: 10 * time.Millisecond})
+	stop := run(t, consumer)
+	defer stop()
+
+	if err := brokernats.NewProducer(js).SendMessage(context.Background(), domain.TaskMessage{ImageID: "broken", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	event := waitEvent(t, js, domain.ImageStatusFailed, "broken")
+	if event.Error != "permanent failure" {
+		t.Errorf("Expected failure reason in event, got %q", event.Error)
+	}
+	image, err := repo.GetObjectByID(context.Background(), "broken")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusFailed || image.FailureReason != "permanent failure" {
+		t.Errorf("Expected image to be Failed, got %s %q", image.Status, image.FailureReason)
+	}
+	// Завершенная задача больше не выдается
+	time.Sleep(100 * time.Millisecond)
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 handler calls, got %d", calls.Load())
+	}
+}
+
+func TestConsumer_FailedWithoutAck(t *testing.T) {
+	url, js := startTestServer(t)
+	repo := memory.NewRepository()
+	savePending(t, repo, "orphaned")
+	ctx := context.Background()
+
+	if err := brokernats.NewProducer(js).SendMessage(ctx, domain.TaskMessage{ImageID: "orphaned", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	opts := Options{Workers: 1, AckWait: 500 * time.Millisecond, MaxDeliver: 1}
+	crash(t, js, opts)
+
+	var calls atomic.Int32
+	consumer := NewConsumer(url, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		calls.Add(1)
+		return nil
+	}), repo, opts)
+	stop := run(t, consumer)
+	defer stop()
+
+	event := waitEvent(t, js, domain.ImageStatusFailed, "orphaned")
+	if event.Error == "" {
+		t.Error("Expected failure reason in event")
+	}
+	image, err := repo.GetObjectByID(ctx, "orphaned")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusFailed {
+		t.Errorf("Expected image to be Failed, got %s", image.Status)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Expected no handler calls, got %d", calls.Load())
+	}
+
+	// Задача удалена из потока
+	stream, err := js.Stream(ctx, brokernats.TaskStream)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := stream.Info(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if info.State.Msgs == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected task to be deleted, got %d messages", info.State.Msgs)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Advisory о превышении max deliver обрабатывает один воркер из группы
+func TestConsumer_FailedWithoutAckOnce(t *testing.T) {
+	url, js := startTestServer(t)
+	repo := &countingRepository{RepositoryDB: memory.NewRepository()}
+	savePending(t, repo, "orphaned")
+
+	if err := brokernats.NewProducer(js).SendMessage(context.Background(), domain.TaskMessage{ImageID: "orphaned", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	opts := Options{Workers: 1, AckWait: 500 * time.Millisecond, MaxDeliver: 1}
+	crash(t, js, opts)
+
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error { return nil })
+	for i := 0; i < 3; i++ {
+		stop := run(t, NewConsumer(url, handler, repo, opts))
+		defer stop()
+	}
+
+	waitEvent(t, js, domain.ImageStatusFailed, "orphaned")
+	time.Sleep(200 * time.Millisecond)
+	if n := repo.failed.Load(); n != 1 {
+		t.Errorf("Expected image to be marked failed once, got %d", n)
+	}
+}
+
+type handlerFunc func(ctx context.Context, task domain.TaskMessage) error
+
+func (f handlerFunc) Handle(ctx context.Context, task domain.TaskMessage) error {
+	return f(ctx, task)
+}
@@ -1,8 +1,17 @@
 package port
 
-import "context"
+import (
+	"context"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
 
 type Consumer interface {
 	Start(ctx context.Context) error
 	Close() error
 }
+
+// TaskHandler обрабатывает задачу, полученную из очереди
+type TaskHandler interface {
+	Handle(ctx context.Context, task domain.TaskMessage) error
+}
@@ -0,0 +1,248 @@
+// Package porttest содержит общие тесты соответствия для реализаций
+// workerPort.Consumer
+package porttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+// waitTimeout ограничивает ожидание обработки и остановки
+const waitTimeout = 15 * time.Second
+
+// handlerFunc позволяет передать функцию как workerPort.TaskHandler
+type handlerFunc func(ctx context.Context, task domain.TaskMessage) error
+
+func (f handlerFunc) Handle(ctx context.Context, task domain.TaskMessage) error {
+	return f(ctx, task)
+}
+
+// RunConsumer проверяет реализацию workerPort.Consumer. newConsumer
+// создает consumer с обработчиком handler и репозиторием repo, в котором
+// consumer помечает изображения с исчерпанными попытками, и producer,
+// задачи которого этот consumer читает. Consumer должен сдаваться после
+// нескольких попыток с короткой паузой
+func RunConsumer(t *testing.T, newConsumer func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer)) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, newConsumer func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer))
+	}{
+		{"DeliversAll", testConsumerDeliversAll},
+		{"RedeliversFailed", testConsumerRedeliversFailed},
+		{"FailsExhausted", testConsumerFailsExhausted},
+		{"StopsOnCancel", testConsumerStopsOnCancel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newConsumer)
+		})
+	}
+}
+
+// recorder запоминает задачи, переданные обработчику
+type recorder struct {
+	mu      sync.Mutex
+	handled map[string]int
+	changed chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{handled: make(map[string]int), changed: make(chan struct{}, 1)}
+}
+
+func (r *recorder) record(id string) int {
+	r.mu.Lock()
+	r.handled[id]++
+	n := r.handled[id]
+	r.mu.Unlock()
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+	return n
+}
+
+// wait ждет, пока cond не станет истинным для обработанных задач
+func (r *recorder) wait(t *testing.T, cond func(handled map[string]int) bool) {
+	t.Helper()
+	timeout := time.After(waitTimeout)
+	for {
+		r.mu.Lock()
+		done := cond(r.handled)
+		r.mu.Unlock()
+		if done {
+			return
+		}
+		select {
+		case <-r.changed:
+		case <-timeout:
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			t.Fatalf("Expected tasks to be handled before timeout, got %v", r.handled)
+		}
+	}
+}
+
+// start запускает consumer и возвращает функцию, которая отменяет
+// контекст и проверяет, что Start и Close завершились без ошибок
+func start(t *testing.T, consumer workerPort.Consumer) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.Start(ctx)
+	}()
+
+	return func() {
+		t.Helper()
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected nil or context.Canceled from Start, got %v", err)
+			}
+		case <-time.After(waitTimeout):
+			t.Fatal("Expected Start to return after cancel")
+		}
+		if err := consumer.Close(); err != nil {
+			t.Errorf("Expected no error from Close, got %v", err)
+		}
+	}
+}
+
+func testConsumerDeliversAll(t *testing.T, newConsumer func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer)) {
+	const n = 20
+	rec := newRecorder()
+	consumer, producer := newConsumer(t, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		rec.record(task.ImageID)
+		return nil
+	}), memory.NewRepository())
+	stop := start(t, consumer)
+	defer stop()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			task := domain.TaskMessage{ImageID: fmt.Sprintf("image-%02d", i), Actions: []string{domain.ResizeAction}}
+			if err := producer.SendMessage(context.Background(), task); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	rec.wait(t, func(handled map[string]int) bool { return len(handled) == n })
+}
+
+func testConsumerRedeliversFailed(t *testing.T, newConsumer func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer)) {
+	rec := newRecorder()
+	consumer, producer := newConsumer(t, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		if rec.record(task.ImageID) == 1 && task.ImageID == "flaky" {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}), memory.NewRepository())
+	stop := start(t, consumer)
+	defer stop()
+
+	for _, id := range []string{"flaky", "stable"} {
+		if err := producer.SendMessage(context.Background(), domain.TaskMessage{ImageID: id, Actions: []string{}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// Задача, завершившаяся ошибкой, не теряется и не блокирует остальные
+	rec.wait(t, func(handled map[string]int) bool { return handled["flaky"] >= 2 && handled["stable"] >= 1 })
+}
+
+func testConsumerFailsExhausted(t *testing.T, newConsumer func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer)) {
+	ctx := context.Background()
+	repo := memory.NewRepository()
+	for _, id := range []string{"broken", "stable"} {
+		if err := repo.SaveObject(ctx, domain.Image{Id: id, Status: domain.ImageStatusPending}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	rec := newRecorder()
+	consumer, producer := newConsumer(t, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		rec.record(task.ImageID)
+		if task.ImageID == "broken" {
+			return errors.New("permanent failure")
+		}
+		return nil
+	}), repo)
+	stop := start(t, consumer)
+	defer stop()
+
+	for _, id := range []string{"broken", "stable"} {
+		if err := producer.SendMessage(ctx, domain.TaskMessage{ImageID: id, Actions: []string{}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// После последней попытки изображение не остается в Pending
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		image, err := repo.GetObjectByID(ctx, "broken")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if image.Status == domain.ImageStatusFailed {
+			if image.FailureReason != "permanent failure" {
+				t.Errorf("Expected failure reason of the last attempt, got %q", image.FailureReason)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected exhausted task to mark image Failed, got %s", image.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec.wait(t, func(handled map[string]int) bool { return handled["stable"] >= 1 })
+
+	// Исчерпанная задача больше не выдается
+	rec.mu.Lock()
+	attempts := rec.handled["broken"]
+	rec.mu.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.handled["broken"] != attempts {
+		t.Errorf("Expected no deliveries after the image is failed, got %d more", rec.handled["broken"]-attempts)
+	}
+}
+
+func testConsumerStopsOnCancel(t *testing.T, newConsumer func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer)) {
+	rec := newRecorder()
+	consumer, producer := newConsumer(t, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		rec.record(task.ImageID)
+		// Обработчик, ожидающий отмены, не должен мешать остановке
+		<-ctx.Done()
+		return ctx.Err()
+	}), memory.NewRepository())
+	stop := start(t, consumer)
+
+	if err := producer.SendMessage(context.Background(), domain.TaskMessage{ImageID: "blocking", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rec.wait(t, func(handled map[string]int) bool { return handled["blocking"] >= 1 })
+	stop()
+}
@@ -0,0 +1,305 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	brokerpostgres "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/postgres"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/lib/pq"
+)
+
+var _ workerPort.Consumer = (*Consumer)(nil)
+
+// ackTimeout ограничивает подтверждение задачи после остановки воркера
+const ackTimeout = 5 * time.Second
+
+// Options - параметры выдачи задач из таблицы jobs
+type Options struct {
+	Workers int
+	// VisibilityTimeout - через сколько задача, взятая упавшим обработчиком,
+	// выдается снова. Пока задача обрабатывается, срок продлевается
+	VisibilityTimeout time.Duration
+	// MaxAttempts - после стольких неудачных попыток задача помечается
+	// failed_at и больше не выдается
+	MaxAttempts int
+	// RetryDelay - пауза перед повтором, растет с номером попытки
+	RetryDelay time.Duration
+	// PollInterval - как часто искать задачи без уведомления: так
+	// находятся задачи с истекшим сроком видимости и отложенные повторы
+	PollInterval time.Duration
+}
+
+// job - задача, выданная этому воркеру. attempts отличает текущую выдачу
+// от следующей: после истечения срока задачу мог взять другой воркер
+type job struct {
+	id       int64
+	attempts int
+	task     domain.TaskMessage
+}
+
+// Consumer выдает задачи из таблицы jobs нескольким горутинам.
+// Задача удаляется после успешной обработки, поэтому гарантия доставки -
+// at-least-once, как у Kafka
+type Consumer struct {
+	db      *sql.DB
+	dsn     string
+	handler workerPort.TaskHandler
+	repo    port.RepositoryDB
+	opts    Options
+}
+
+// NewConsumer создает consumer. dsn нужен для отдельного соединения LISTEN,
+// repo - чтобы пометить Failed изображения, задачи которых исчерпали
+// MaxAttempts
+func NewConsumer(db *sql.DB, dsn string, handler workerPort.TaskHandler, repo port.RepositoryDB, opts Options) *Consumer {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 5 * time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	return &Consumer{
+		db:      db,
+		dsn:     dsn,
+		handler: handler,
+		repo:    repo,
+		opts:    opts,
+	}
+}
+
+// Start обрабатывает задачи, пока не отменен контекст. Задача в обработке
+// при остановке возвращается в очередь без учета попытки
+func (c *Consumer) Start(ctx context.Context) error {
+	log.Printf("Starting %d job workers", c.opts.Workers)
+
+	// Каждое уведомление будит одного воркера. Без LISTEN задачи
+	// находятся опросом, только с задержкой
+	wake := make(chan struct{}, c.opts.Workers)
+	listener := pq.NewListener(c.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Job listener event %d: %v", event, err)
+		}
+	})
+	defer func() {
+		if err := listener.Close(); err != nil {
+			log.Printf("Failed to close job listener: %v", err)
+		}
+	}()
+	if err := listener.Listen(brokerpostgres.NotifyChannel); err != nil {
+		log.Printf("Failed to listen on %s, falling back to polling: %v", brokerpostgres.NotifyChannel, err)
+	}
+	go c.relayNotifications(ctx, listener, wake)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c.startWorker(ctx, id, wake)
+		}(i)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// relayNotifications передает уведомления воркерам. nil приходит после
+// переподключения: уведомления могли потеряться, будятся все
+func (c *Consumer) relayNotifications(ctx context.Context, listener *pq.Listener, wake chan<- struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			count := 1
+			if n == nil {
+				count = c.opts.Workers
+			}
+			for i := 0; i < count; i++ {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (c *Consumer) startWorker(ctx context.Context, id int, wake <-chan struct{}) {
+	poll := time.NewTicker(c.opts.PollInterval)
+	defer poll.Stop()
+
+	for {
+		j, err := c.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Worker %d: failed to claim job: %v", id, err)
+		}
+		if j != nil {
+			c.process(ctx, id, j)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Worker %d stopped", id)
+			return
+		case <-wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// claim выдает самую старую доступную задачу и скрывает ее от остальных
+// на VisibilityTimeout. SKIP LOCKED пропускает задачи, которые в этот
+// момент выдаются другим воркерам
+func (c *Consumer) claim(ctx context.Context) (*job, error) {
+	query := `
+        UPDATE jobs SET
+            attempts = attempts + 1,
+            visible_at = now() + make_interval(secs => $1)
+        WHERE id = (
+            SELECT id FROM jobs
+            WHERE failed_at IS NULL AND visible_at <= now()
+            ORDER BY visible_at, id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, attempts, payload
+    `
+
+	var j job
+	var payload []byte
+	err := c.db.QueryRowContext(ctx, query, c.opts.VisibilityTimeout.Seconds()).Scan(&j.id, &j.attempts, &payload)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(payload, &j.task); err != nil {
+		// Повтор не поможет: задача сразу помечается неисправимой
+		log.Printf("CRITICAL: Failed to unmarshal job %d: %v", j.id, err)
+		c.finish(ctx, &j, fmt.Errorf("failed to unmarshal message: %w", err), true)
+		return nil, nil
+	}
+
+	return &j, nil
+}
+
+func (c *Consumer) process(ctx context.Context, id int, j *job) {
+	log.Printf("Worker %d received job %d for image %s (attempt %d/%d)",
+		id, j.id, j.task.ImageID, j.attempts, c.opts.MaxAttempts)
+
+	// Пока задача обрабатывается, срок видимости продлевается,
+	// чтобы долгую обработку не начал второй воркер
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		c.heartbeat(heartbeatCtx, j)
+	}()
+
+	err := c.handler.Handle(ctx, j.task)
+	stopHeartbeat()
+	<-heartbeatDone
+
+	switch {
+	case err == nil:
+		c.finish(ctx, j, nil, false)
+	case ctx.Err() != nil:
+		// Остановка воркера не считается попыткой
+		c.release(ctx, j)
+	default:
+		log.Printf("Worker %d failed to process image %s (attempt %d/%d): %v",
+			id, j.task.ImageID, j.attempts, c.opts.MaxAttempts, err)
+		c.finish(ctx, j, err, j.attempts >= c.opts.MaxAttempts)
+	}
+}
+
+func (c *Consumer) heartbeat(ctx context.Context, j *job) {
+	ticker := time.NewTicker(c.opts.VisibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := c.db.ExecContext(ctx,
+				`UPDATE jobs SET visible_at = now() + make_interval(secs => $1) WHERE id = $2 AND attempts = $3`,
+				c.opts.VisibilityTimeout.Seconds(), j.id, j.attempts)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Failed to extend visibility of job %d: %v", j.id, err)
+			}
+		}
+	}
+}
+
+// finish подтверждает выдачу задачи: удаляет ее после успеха, помечает
+// неисправимой (dead) или откладывает повтор. Изменения применяются,
+// только если задачу с тех пор не выдали снова
+func (c *Consumer) finish(ctx context.Context, j *job, handleErr error, dead bool) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	var err error
+	switch {
+	case handleErr == nil:
+		_, err = c.db.ExecContext(ctx, `DELETE FROM jobs WHERE id = $1 AND attempts = $2`, j.id, j.attempts)
+	case dead:
+		log.Printf("CRITICAL: Job %d for image %s failed after %d attempts: %v",
+			j.id, j.task.ImageID, j.attempts, handleErr)
+		_, err = c.db.ExecContext(ctx,
+			`UPDATE jobs SET failed_at = now(), last_error = $1 WHERE id = $2 AND attempts = $3`,
+			handleErr.Error(), j.id, j.attempts)
+		// Иначе изображение навсегда осталось бы Pending
+		if j.task.ImageID != "" {
+			if err := c.repo.MarkFailed(ctx, j.task.ImageID, handleErr.Error()); err != nil {
+				log.Printf("Failed to mark image %s as failed: %v", j.task.ImageID, err)
+			}
+		}
+	default:
+		delay := c.opts.RetryDelay * time.Duration(j.attempts)
+		_, err = c.db.ExecContext(ctx,
+			`UPDATE jobs SET visible_at = now() + make_interval(secs => $1), last_error = $2 WHERE id = $3 AND attempts = $4`,
+			delay.Seconds(), handleErr.Error(), j.id, j.attempts)
+	}
+	if err != nil {
+		// Задача будет выдана снова по истечении срока видимости
+		log.Printf("Failed to acknowledge job %d: %v", j.id, err)
+	}
+}
+
+// release возвращает задачу в очередь сразу, не засчитывая попытку
+func (c *Consumer) release(ctx context.Context, j *job) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	_, err := c.db.ExecContext(ctx,
+		`UPDATE jobs SET visible_at = now(), attempts = attempts - 1 WHERE id = $1 AND attempts = $2`,
+		j.id, j.attempts)
+	if err != nil {
+		log.Printf("Failed to release job %d: %v", j.id, err)
+	}
+}
+
+// Close ничего не делает: соединение с базой закрывает владелец
+func (c *Consumer) Close() error {
+	return nil
+}
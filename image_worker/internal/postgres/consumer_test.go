@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/port/porttest"
+	brokerpostgres "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/postgres"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/pkg/migrations"
+)
+
+// openTestDB создает отдельную схему, чтобы тесты пакетов, которые
+// go test запускает параллельно, не забирали задачи друг друга
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	schema := "porttest_" + hex.EncodeToString(b)
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	// Неизвестные параметры DSN lib/pq передает серверу при подключении
+	param := " search_path=" + schema
+	if strings.Contains(dsn, "://") {
+		param = "?search_path=" + schema
+		if strings.Contains(dsn, "?") {
+			param = "&search_path=" + schema
+		}
+	}
+	dsn += param
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := migrations.Migrate(db, migrations.DialectPostgres); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return db, dsn
+}
+
+func TestConsumer_Contract(t *testing.T) {
+	db, dsn := openTestDB(t)
+
+	porttest.RunConsumer(t, func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer) {
+		if _, err := db.Exec(`TRUNCATE jobs`); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		consumer := NewConsumer(db, dsn, handler, repo, Options{
+			Workers:           3,
+			VisibilityTimeout: time.Minute,
+			MaxAttempts:       3,
+			RetryDelay:        10 * time.Millisecond,
+			PollInterval:      100 * time.Millisecond,
+		})
+		return consumer, brokerpostgres.NewProducer(db)
+	})
+}
+
+func TestConsumer_DeadAfterMaxAttempts(t *testing.T) {
+	db, dsn := openTestDB(t)
+	producer := brokerpostgres.NewProducer(db)
+
+	repo := memory.NewRepository()
+	if err := repo.SaveObject(context.Background(), domain.Image{Id: "broken", Status: domain.ImageStatusPending}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var calls atomic.Int32
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		calls.Add(1)
+		return errors.New("permanent failure")
+	})
+	consumer := NewConsumer(db, dsn, handler, repo, Options{
+		Workers:           2,
+		VisibilityTimeout: time.Minute,
+		MaxAttempts:       2,
+		RetryDelay:        10 * time.Millisecond,
+		PollInterval:      20 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+
+	if err := producer.SendMessage(context.Background(), domain.TaskMessage{ImageID: "broken", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	var attempts int
+	var lastError sql.NullString
+	for time.Now().Before(deadline) {
+		err := db.QueryRow(`SELECT attempts, last_error FROM jobs WHERE image_id = 'broken' AND failed_at IS NOT NULL`).
+			Scan(&attempts, &lastError)
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Помеченная задача больше не выдается
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	if attempts != 2 || lastError.String != "permanent failure" {
+		t.Errorf("Expected job to be marked failed after 2 attempts, got %d %q", attempts, lastError.String)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 handler calls, got %d", calls.Load())
+	}
+	image, err := repo.GetObjectByID(context.Background(), "broken")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusFailed || image.FailureReason != "permanent failure" {
+		t.Errorf("Expected image to be marked failed with the last error, got %s %q", image.Status, image.FailureReason)
+	}
+}
+
+func TestConsumer_ExpiredVisibility(t *testing.T) {
+	db, dsn := openTestDB(t)
+	producer := brokerpostgres.NewProducer(db)
+
+	if err := producer.SendMessage(context.Background(), domain.TaskMessage{ImageID: "orphaned", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Задачу взял воркер, который затем упал: срок видимости истек
+	if _, err := db.Exec(`UPDATE jobs SET attempts = 1, visible_at = now() - interval '1 second'`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	handled := make(chan domain.TaskMessage, 1)
+	consumer := NewConsumer(db, dsn, handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		handled <- task
+		return nil
+	}), memory.NewRepository(), Options{Workers: 1, VisibilityTimeout: time.Minute, MaxAttempts: 3, PollInterval: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case task := <-handled:
+		if task.ImageID != "orphaned" {
+			t.Errorf("Expected orphaned job, got %s", task.ImageID)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected expired job to be redelivered")
+	}
+}
+
+type handlerFunc func(ctx context.Context, task domain.TaskMessage) error
+
+func (f handlerFunc) Handle(ctx context.Context, task domain.TaskMessage) error {
+	return f(ctx, task)
+}
@@ -0,0 +1,323 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+// PipelineOptions - шаги, которые воркер добавляет к действиям задачи
+type PipelineOptions struct {
+	// AutoOrient - первым шагом выполнить автоповорот по EXIF
+	AutoOrient bool
+	// Metadata - политика удаления метаданных, применяется последним шагом
+	Metadata StripOptions
+}
+
+// Result - результат пайплайна
+type Result struct {
+	Data []byte
+	// Encoding - параметры кодирования, nil если в пайплайне нет Encode
+	Encoding *domain.Encoding
+}
+
+// Pipeline разбирает и проверяет действия задачи (domain.ValidateActions),
+// ошибка оборачивает domain.ErrInvalidAction. Если включен AutoOrient, первым шагом
+// добавляется автоповорот по EXIF (если его нет в списке явно). Политика
+// метаданных добавляется последним шагом всегда, кроме уровня none: явный
+// StripMetadata в задаче может только ужесточить ее. Encode переносится
+// в самый конец: после него изображение не перекодируется и размер
+// результата совпадает с выбранным.
+func Pipeline(raw []string, opts PipelineOptions) ([]domain.Action, error) {
+	actions, err := domain.ValidateActions(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var encode []domain.Action
+	for i := 0; i < len(actions); i++ {
+		if actions[i].Name == domain.EncodeAction {
+			encode = append(encode, actions[i])
+			actions = append(actions[:i], actions[i+1:]...)
+			i--
+		}
+	}
+	if opts.AutoOrient && !HasAction(actions, domain.AutoOrientAction) {
+		actions = append([]domain.Action{{Name: domain.AutoOrientAction}}, actions...)
+	}
+
+	if opts.Metadata.Level != "" && opts.Metadata.Level != StripNone {
+		actions = append(actions, domain.Action{
+			Name: domain.StripMetadataAction,
+			Params: map[string]string{
+				"level":          opts.Metadata.Level,
+				"keep_icc":       strconv.FormatBool(opts.Metadata.KeepICC),
+				"keep_copyright": strconv.FormatBool(opts.Metadata.KeepCopyright),
+			},
+		})
+	}
+	return append(actions, encode...), nil
+}
+
+// Process последовательно применяет действия пайплайна к изображению
+func Process(actions []domain.Action, imageData []byte) (*Result, error) {
+	result := &Result{Data: imageData}
+	for _, action := range actions {
+		if action.Name == domain.EncodeAction {
+			opts, err := encodeOptions(action)
+			if err != nil {
+				return nil, err
+			}
+			encoded, err := Encode(result.Data, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply action %s: %w", action, err)
+			}
+			result.Data, result.Encoding = encoded.Data, &encoded.Encoding
+			continue
+		}
+
+		data, err := ApplyAction(action, result.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply action %s: %w", action, err)
+		}
+		result.Data = data
+	}
+	return result, nil
+}
+
+// PipelineSpec - каноническая запись пайплайна для ключа кеша результатов.
+// Параметры действий уже отсортированы в Action.String.
+func PipelineSpec(actions []domain.Action) string {
+	specs := make([]string, len(actions))
+	for i, action := range actions {
+		specs[i] = action.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// HasAction проверяет, есть ли действие name в пайплайне.
+func HasAction(actions []domain.Action, name string) bool {
+	_, ok := FindAction(actions, name)
+	return ok
+}
+
+// FindAction возвращает первое действие name из пайплайна.
+func FindAction(actions []domain.Action, name string) (domain.Action, bool) {
+	for _, action := range actions {
+		if action.Name == name {
+			return action, true
+		}
+	}
+	return domain.Action{}, false
+}
+
+// ApplyAction применяет одно действие пайплайна к изображению
+func ApplyAction(action domain.Action, imageData []byte) ([]byte, error) {
+	switch action.Name {
+	case domain.ResizeAction:
+		width, height, err := sizeParams(action, 1600, 900)
+		if err != nil {
+			return nil, err
+		}
+		return ResizeImage(imageData, width, height)
+
+	case domain.WatermarkAction:
+		return AddTextWatermark(imageData, action.Param("text", "WildBerries"))
+
+	case domain.MiniatureGenerateAction:
+		width, height, err := sizeParams(action, 1600, 900)
+		if err != nil {
+			return nil, err
+		}
+		return GenerateSmartThumbnail(imageData, width, height)
+
+	case domain.GrayscaleAction:
+		return ApplyGrayscale(imageData)
+
+	case domain.AutoOrientAction:
+		return AutoOrient(imageData)
+
+	case domain.RotateAction:
+		angle, err := action.FloatParam("angle", 90)
+		if err != nil {
+			return nil, err
+		}
+		background, err := ParseColor(action.Param("background", "000000"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidAction, err)
+		}
+		return RotateImage(imageData, angle, background)
+
+	case domain.FlipAction:
+		return FlipImage(imageData)
+
+	case domain.FlopAction:
+		return FlopImage(imageData)
+
+	case domain.BrightnessAction:
+		value, err := action.FloatParam("value", 10)
+		if err != nil {
+			return nil, err
+		}
+		return AdjustBrightness(imageData, value)
+
+	case domain.ContrastAction:
+		value, err := action.FloatParam("value", 10)
+		if err != nil {
+			return nil, err
+		}
+		return AdjustContrast(imageData, value)
+
+	case domain.SaturationAction:
+		value, err := action.FloatParam("value", 10)
+		if err != nil {
+			return nil, err
+		}
+		return AdjustSaturation(imageData, value)
+
+	case domain.GammaAction:
+		value, err := action.FloatParam("value", 1.2)
+		if err != nil {
+			return nil, err
+		}
+		return AdjustGamma(imageData, value)
+
+	case domain.SepiaAction:
+		amount, err := action.FloatParam("amount", 100)
+		if err != nil {
+			return nil, err
+		}
+		return ApplySepia(imageData, amount)
+
+	case domain.TintAction:
+		tint, err := ParseColor(action.Param("color", "ff9900"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidAction, err)
+		}
+		amount, err := action.FloatParam("amount", 50)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyTint(imageData, tint, amount)
+
+	case domain.InvertAction:
+		return InvertColors(imageData)
+
+	case domain.SharpenAction:
+		radius, err := action.IntParam("radius", 1)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := action.FloatParam("amount", 3)
+		if err != nil {
+			return nil, err
+		}
+		return SharpenImage(imageData, radius, amount)
+
+	case domain.BlurAction:
+		sigma, err := action.FloatParam("sigma", 1.5)
+		if err != nil {
+			return nil, err
+		}
+		return BlurImage(imageData, sigma)
+
+	case domain.RedactAction:
+		opts, err := redactOptions(action)
+		if err != nil {
+			return nil, err
+		}
+		return RedactRegions(imageData, opts)
+
+	case domain.StripMetadataAction:
+		opts, err := stripOptions(action)
+		if err != nil {
+			return nil, err
+		}
+		return StripMetadata(imageData, opts)
+
+	case domain.EncodeAction:
+		opts, err := encodeOptions(action)
+		if err != nil {
+			return nil, err
+		}
+		result, err := Encode(imageData, opts)
+		if err != nil {
+			return nil, err
+		}
+		return result.Data, nil
+
+	case domain.ResponsiveAction:
+		// Варианты строит воркер из итогового изображения,
+		// здесь только проверяются параметры
+		if _, err := ResponsiveOptionsFromAction(action); err != nil {
+			return nil, err
+		}
+		return imageData, nil
+
+	default:
+		return nil, fmt.Errorf("unknown action: %s", action.Name)
+	}
+}
+
+func sizeParams(action domain.Action, defWidth, defHeight int) (int, int, error) {
+	width, err := action.IntParam("width", defWidth)
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := action.IntParam("height", defHeight)
+	if err != nil {
+		return 0, 0, err
+	}
+	if width < 0 || height < 0 {
+		return 0, 0, fmt.Errorf("%w: %s size must not be negative", domain.ErrInvalidAction, action.Name)
+	}
+	return width, height, nil
+}
+
+func redactOptions(action domain.Action) (RedactOptions, error) {
+	opts := RedactOptions{Mode: action.Param("mode", RedactModeBlur)}
+
+	units := action.Param("units", "px")
+	if units != "px" && units != "relative" {
+		return RedactOptions{}, fmt.Errorf("%w: Redact.units must be px or relative", domain.ErrInvalidAction)
+	}
+
+	regions, err := ParseRegions(action.Param("regions", ""), units == "relative")
+	if err != nil {
+		return RedactOptions{}, fmt.Errorf("%w: %v", domain.ErrInvalidAction, err)
+	}
+	opts.Regions = regions
+
+	opts.Color, err = ParseColor(action.Param("color", "000000"))
+	if err != nil {
+		return RedactOptions{}, fmt.Errorf("%w: %v", domain.ErrInvalidAction, err)
+	}
+
+	opts.Strength, err = action.IntParam("strength", 0)
+	if err != nil {
+		return RedactOptions{}, err
+	}
+	return opts, nil
+}
+
+func stripOptions(action domain.Action) (StripOptions, error) {
+	opts := StripOptions{Level: action.Param("level", StripAll)}
+	switch opts.Level {
+	case StripNone, StripGPS, StripPrivate, StripAll:
+	default:
+		return StripOptions{}, fmt.Errorf("%w: StripMetadata.level must be none, gps, private or all", domain.ErrInvalidAction)
+	}
+
+	var err error
+	opts.KeepICC, err = action.BoolParam("keep_icc", true)
+	if err != nil {
+		return StripOptions{}, err
+	}
+	opts.KeepCopyright, err = action.BoolParam("keep_copyright", true)
+	if err != nil {
+		return StripOptions{}, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// jpegSegment - сегмент JPEG до начала сжатых данных. У одиночных маркеров
+// (RSTn, TEM) нет длины и полезной нагрузки.
+type jpegSegment struct {
+	marker     byte
+	payload    []byte
+	standalone bool
+}
+
+// splitJPEG разбивает JPEG на сегменты заголовка и хвост, начиная с маркера
+// SOS (или EOI), который копируется без разбора.
+func splitJPEG(file []byte) ([]jpegSegment, []byte, error) {
+	if len(file) < 4 || file[0] != 0xFF || file[1] != 0xD8 {
+		return nil, nil, errors.New("не JPEG: нет маркера SOI")
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for {
+		if pos+2 > len(file) {
+			return nil, nil, errors.New("JPEG поврежден: нет маркера начала данных")
+		}
+		if file[pos] != 0xFF {
+			return nil, nil, fmt.Errorf("JPEG поврежден: ожидался маркер на позиции %d", pos)
+		}
+		marker := file[pos+1]
+
+		switch {
+		case marker == 0xFF:
+			// Заполняющий байт перед маркером
+			pos++
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			return segments, file[pos:], nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			segments = append(segments, jpegSegment{marker: marker, standalone: true})
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(file) {
+			return nil, nil, errors.New("JPEG поврежден: обрезан заголовок сегмента")
+		}
+		length := int(binary.BigEndian.Uint16(file[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(file) {
+			return nil, nil, errors.New("JPEG поврежден: некорректная длина сегмента")
+		}
+		segments = append(segments, jpegSegment{marker: marker, payload: file[pos+4 : end]})
+		pos = end
+	}
+}
+
+func appendJPEGSegment(out []byte, segment jpegSegment) []byte {
+	out = append(out, 0xFF, segment.marker)
+	if segment.standalone {
+		return out
+	}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment.payload)+2))
+	return append(out, segment.payload...)
+}
+
+// pngChunk - чанк PNG; CRC пересчитывается при записи
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// splitPNG разбивает PNG на чанки до IEND включительно.
+func splitPNG(file []byte) ([]pngChunk, error) {
+	if len(file) < len(pngSignature) || string(file[:len(pngSignature)]) != string(pngSignature) {
+		return nil, errors.New("не PNG: нет сигнатуры")
+	}
+
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos < len(file) {
+		if pos+12 > len(file) {
+			return nil, errors.New("PNG поврежден: обрезан чанк")
+		}
+		length := int(binary.BigEndian.Uint32(file[pos:]))
+		end := pos + 12 + length
+		if end > len(file) {
+			return nil, errors.New("PNG поврежден: некорректная длина чанка")
+		}
+		chunk := pngChunk{typ: string(file[pos+4 : pos+8]), data: file[pos+8 : pos+8+length]}
+		chunks = append(chunks, chunk)
+		pos = end
+
+		if chunk.typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+func appendPNGChunk(out []byte, chunkType string, data []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+	start := len(out)
+	out = append(out, chunkType...)
+	out = append(out, data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
+
+// riffChunk - чанк контейнера RIFF (WebP)
+type riffChunk struct {
+	fourCC string
+	data   []byte
+}
+
+// splitWebP разбивает WebP на чанки RIFF после заголовка "RIFF....WEBP".
+func splitWebP(file []byte) ([]riffChunk, error) {
+	if len(file) < 12 || string(file[0:4]) != "RIFF" || string(file[8:12]) != "WEBP" {
+		return nil, errors.New("не WebP: нет заголовка RIFF")
+	}
+
+	var chunks []riffChunk
+	pos := 12
+	for pos+8 <= len(file) {
+		size := int(binary.LittleEndian.Uint32(file[pos+4:]))
+		end := pos + 8 + size
+		if end > len(file) {
+			return nil, errors.New("WebP поврежден: некорректная длина чанка")
+		}
+		chunks = append(chunks, riffChunk{fourCC: string(file[pos : pos+4]), data: file[pos+8 : end]})
+		// Чанки выровнены по четной границе
+		if size%2 == 1 && end < len(file) {
+			end++
+		}
+		pos = end
+	}
+	return chunks, nil
+}
+
+func appendRIFFChunk(out []byte, fourCC string, data []byte) []byte {
+	out = append(out, fourCC...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
@@ -0,0 +1,331 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/h2non/bimg"
+)
+
+// Параметры подбора качества
+const (
+	defaultEncodeQuality    = 85
+	defaultEncodeMinQuality = 10
+	maxEncodeQuality        = domain.MaxEncodeQuality
+	// ssimSize - размер стороны, до которого уменьшаются изображения
+	// перед сравнением: SSIM на полном размере слишком дорог
+	ssimSize = 512
+	// ssimWindow - сторона окна, по которому считается SSIM
+	ssimWindow = 8
+)
+
+// ErrEncodeTarget - ни одно качество из допустимого диапазона
+// не удовлетворяет ограничениям Encode
+var ErrEncodeTarget = errors.New("не удалось достичь заданного размера или качества")
+
+// encodeFormats - форматы Encode с регулируемым качеством
+var encodeFormats = map[string]bimg.ImageType{
+	"jpeg": bimg.JPEG,
+	"webp": bimg.WEBP,
+	"avif": bimg.AVIF,
+}
+
+// imageContentTypes - Content-Type форматов libvips
+var imageContentTypes = map[bimg.ImageType]string{
+	bimg.JPEG: "image/jpeg",
+	bimg.PNG:  "image/png",
+	bimg.WEBP: "image/webp",
+	bimg.AVIF: "image/avif",
+	bimg.GIF:  "image/gif",
+	bimg.TIFF: "image/tiff",
+	bimg.HEIF: "image/heif",
+	bimg.SVG:  "image/svg+xml",
+}
+
+// formatExtensions - расширения ключей хранилища по формату результата
+var formatExtensions = map[bimg.ImageType]string{
+	bimg.JPEG: "jpg",
+	bimg.PNG:  "png",
+	bimg.WEBP: "webp",
+	bimg.AVIF: "avif",
+	bimg.GIF:  "gif",
+	bimg.TIFF: "tiff",
+	bimg.HEIF: "heic",
+}
+
+// EncodeOptions - параметры кодирования результата
+type EncodeOptions struct {
+	Format string
+	// Quality - фиксированное качество, если не заданы MaxBytes и MinSSIM
+	Quality int
+	// MaxBytes - максимальный размер результата, 0 - без ограничения
+	MaxBytes int64
+	// MinSSIM - минимальное сходство с изображением до кодирования (0..1),
+	// 0 - без ограничения
+	MinSSIM float64
+	// MinQuality - нижняя граница подбора качества
+	MinQuality int
+}
+
+// EncodeResult - закодированное изображение и выбранные параметры
+type EncodeResult struct {
+	Data     []byte
+	Encoding domain.Encoding
+}
+
+func encodeOptions(action domain.Action) (EncodeOptions, error) {
+	opts := EncodeOptions{Format: strings.ToLower(action.Param("format", "jpeg"))}
+	if opts.Format == "jpg" {
+		opts.Format = "jpeg"
+	}
+	if _, ok := encodeFormats[opts.Format]; !ok {
+		return EncodeOptions{}, fmt.Errorf("%w: Encode.format must be jpeg, webp or avif, got %q",
+			domain.ErrInvalidAction, opts.Format)
+	}
+
+	var err error
+	if opts.Quality, err = action.IntParam("quality", defaultEncodeQuality); err != nil {
+		return EncodeOptions{}, err
+	}
+	if opts.MinQuality, err = action.IntParam("min_quality", defaultEncodeMinQuality); err != nil {
+		return EncodeOptions{}, err
+	}
+	maxBytes, err := action.IntParam("max_bytes", 0)
+	if err != nil {
+		return EncodeOptions{}, err
+	}
+	opts.MaxBytes = int64(maxBytes)
+	if opts.MinSSIM, err = action.FloatParam("min_ssim", 0); err != nil {
+		return EncodeOptions{}, err
+	}
+
+	switch {
+	case opts.Quality < 1 || opts.Quality > maxEncodeQuality:
+		return EncodeOptions{}, fmt.Errorf("%w: Encode.quality must be between 1 and %d", domain.ErrInvalidAction, maxEncodeQuality)
+	case opts.MinQuality < 1 || opts.MinQuality > maxEncodeQuality:
+		return EncodeOptions{}, fmt.Errorf("%w: Encode.min_quality must be between 1 and %d", domain.ErrInvalidAction, maxEncodeQuality)
+	case opts.MaxBytes < 0:
+		return EncodeOptions{}, fmt.Errorf("%w: Encode.max_bytes must not be negative", domain.ErrInvalidAction)
+	case opts.MinSSIM < 0 || opts.MinSSIM >= 1:
+		return EncodeOptions{}, fmt.Errorf("%w: Encode.min_ssim must be in [0, 1)", domain.ErrInvalidAction)
+	}
+	return opts, nil
+}
+
+// Encode кодирует изображение в заданный формат. Если задан MaxBytes,
+// бинарным поиском выбирается наибольшее качество, при котором результат
+// помещается в лимит. Если задан только MinSSIM - наименьшее качество,
+// при котором SSIM с исходником не ниже порога. При обоих ограничениях
+// результат по размеру дополнительно проверяется на MinSSIM.
+func Encode(file []byte, opts EncodeOptions) (*EncodeResult, error) {
+	imageType := encodeFormats[opts.Format]
+
+	encoded := make(map[int][]byte)
+	encode := func(quality int) ([]byte, error) {
+		if data, ok := encoded[quality]; ok {
+			return data, nil
+		}
+		data, err := bimg.NewImage(file).Process(bimg.Options{
+			Type:         imageType,
+			Quality:      quality,
+			NoAutoRotate: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка кодирования в %s с качеством %d: %v", opts.Format, quality, err)
+		}
+		encoded[quality] = data
+		return data, nil
+	}
+
+	var reference *image.NRGBA
+	similarity := func(quality int) (float64, error) {
+		data, err := encode(quality)
+		if err != nil {
+			return 0, err
+		}
+		if reference == nil {
+			if reference, err = scaledPixels(file, ssimSize); err != nil {
+				return 0, err
+			}
+		}
+		candidate, err := scaledPixels(data, ssimSize)
+		if err != nil {
+			return 0, err
+		}
+		return SSIM(reference, candidate)
+	}
+
+	quality := opts.Quality
+	switch {
+	case opts.MaxBytes > 0:
+		found, ok, err := highestQuality(opts.MinQuality, maxEncodeQuality, func(q int) (bool, error) {
+			data, err := encode(q)
+			return int64(len(data)) <= opts.MaxBytes, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s не помещается в %d байт даже с качеством %d",
+				ErrEncodeTarget, opts.Format, opts.MaxBytes, opts.MinQuality)
+		}
+		quality = found
+	case opts.MinSSIM > 0:
+		found, ok, err := lowestQuality(opts.MinQuality, maxEncodeQuality, func(q int) (bool, error) {
+			score, err := similarity(q)
+			return score >= opts.MinSSIM, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: SSIM %.3f недостижим для %s", ErrEncodeTarget, opts.MinSSIM, opts.Format)
+		}
+		quality = found
+	}
+
+	data, err := encode(quality)
+	if err != nil {
+		return nil, err
+	}
+	result := &EncodeResult{
+		Data: data,
+		Encoding: domain.Encoding{
+			Format:  opts.Format,
+			Quality: quality,
+			Size:    int64(len(data)),
+		},
+	}
+
+	if opts.MinSSIM > 0 {
+		score, err := similarity(quality)
+		if err != nil {
+			return nil, err
+		}
+		if score < opts.MinSSIM {
+			return nil, fmt.Errorf("%w: при качестве %d SSIM %.3f ниже %.3f",
+				ErrEncodeTarget, quality, score, opts.MinSSIM)
+		}
+		result.Encoding.SSIM = score
+	}
+
+	log.Printf("Изображение закодировано в %s: качество %d, %d байт (попыток: %d)",
+		opts.Format, quality, len(data), len(encoded))
+	return result, nil
+}
+
+// highestQuality ищет наибольшее качество из [lo, hi], для которого fits
+// возвращает true. fits должна быть монотонно невозрастающей по качеству.
+func highestQuality(lo, hi int, fits func(int) (bool, error)) (int, bool, error) {
+	best, found := 0, false
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			best, found = mid, true
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return best, found, nil
+}
+
+// lowestQuality ищет наименьшее качество из [lo, hi], для которого fits
+// возвращает true. fits должна быть монотонно неубывающей по качеству.
+func lowestQuality(lo, hi int, fits func(int) (bool, error)) (int, bool, error) {
+	best, found := 0, false
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			best, found = mid, true
+			hi = mid - 1
+		} else {
+			lo = mid + 1
+		}
+	}
+	return best, found, nil
+}
+
+// SSIM считает среднее структурное сходство яркости двух изображений
+// одного размера по окнам ssimWindow x ssimWindow без перекрытия.
+func SSIM(a, b *image.NRGBA) (float64, error) {
+	if a.Rect.Dx() != b.Rect.Dx() || a.Rect.Dy() != b.Rect.Dy() {
+		return 0, fmt.Errorf("размеры изображений различаются: %dx%d и %dx%d",
+			a.Rect.Dx(), a.Rect.Dy(), b.Rect.Dx(), b.Rect.Dy())
+	}
+
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	width, height := a.Rect.Dx(), a.Rect.Dy()
+	var total float64
+	var windows int
+	for y0 := 0; y0 < height; y0 += ssimWindow {
+		for x0 := 0; x0 < width; x0 += ssimWindow {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			var n float64
+			for y := y0; y < min(y0+ssimWindow, height); y++ {
+				for x := x0; x < min(x0+ssimWindow, width); x++ {
+					la, lb := pixelLuma(a, x, y), pixelLuma(b, x, y)
+					sumA += la
+					sumB += lb
+					sumAA += la * la
+					sumBB += lb * lb
+					sumAB += la * lb
+					n++
+				}
+			}
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			cov := sumAB/n - meanA*meanB
+
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+	if windows == 0 {
+		return 0, fmt.Errorf("пустое изображение")
+	}
+	return total / float64(windows), nil
+}
+
+// pixelLuma - яркость пикселя изображения
+func pixelLuma(img *image.NRGBA, x, y int) float64 {
+	i := img.PixOffset(x, y)
+	return luma(float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2]))
+}
+
+// ContentType определяет Content-Type изображения по содержимому.
+// http.DetectContentType не знает AVIF и HEIF, поэтому сначала
+// используется определение формата libvips.
+func ContentType(file []byte) string {
+	if contentType, ok := imageContentTypes[bimg.DetermineImageType(file)]; ok {
+		return contentType
+	}
+	return http.DetectContentType(file)
+}
+
+// Extension возвращает расширение ключа хранилища для изображения
+func Extension(file []byte) string {
+	if ext, ok := formatExtensions[bimg.DetermineImageType(file)]; ok {
+		return ext
+	}
+	return "bin"
+}
@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+func TestEncodeOptions(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected EncodeOptions
+		wantErr  bool
+	}{
+		{"Encode", EncodeOptions{Format: "jpeg", Quality: 85, MinQuality: 10}, false},
+		{"Encode(format=WebP,max_bytes=200000)", EncodeOptions{Format: "webp", Quality: 85, MaxBytes: 200000, MinQuality: 10}, false},
+		{"Encode(format=avif,min_ssim=0.95,min_quality=40)", EncodeOptions{Format: "avif", Quality: 85, MinSSIM: 0.95, MinQuality: 40}, false},
+		{"Encode(format=jpg,quality=70)", EncodeOptions{Format: "jpeg", Quality: 70, MinQuality: 10}, false},
+		{"Encode(format=png)", EncodeOptions{}, true},
+		{"Encode(quality=0)", EncodeOptions{}, true},
+		{"Encode(max_bytes=-1)", EncodeOptions{}, true},
+		{"Encode(min_ssim=1)", EncodeOptions{}, true},
+		{"Encode(min_quality=abc)", EncodeOptions{}, true},
+	}
+
+	for _, tt := range tests {
+		action, err := domain.ParseAction(tt.action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := encodeOptions(action)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.action, tt.wantErr, err)
+			continue
+		}
+		if tt.wantErr {
+			if !errors.Is(err, domain.ErrInvalidAction) {
+				t.Errorf("%s: expected ErrInvalidAction, got %v", tt.action, err)
+			}
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.action, tt.expected, got)
+		}
+	}
+}
+
+func TestQualitySearch(t *testing.T) {
+	// Размер растет с качеством: 1000 байт на единицу качества
+	size := func(q int) int { return q * 1000 }
+
+	tests := []struct {
+		name      string
+		search    func(lo, hi int, fits func(int) (bool, error)) (int, bool, error)
+		fits      func(q int) bool
+		expected  int
+		wantFound bool
+	}{
+		{"largest within budget", highestQuality, func(q int) bool { return size(q) <= 42500 }, 42, true},
+		{"budget fits everything", highestQuality, func(q int) bool { return true }, 100, true},
+		{"budget too small", highestQuality, func(q int) bool { return size(q) <= 5000 }, 0, false},
+		{"lowest meeting threshold", lowestQuality, func(q int) bool { return q >= 73 }, 73, true},
+		{"threshold unreachable", lowestQuality, func(q int) bool { return false }, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got, found, err := tt.search(10, 100, func(q int) (bool, error) {
+				calls++
+				return tt.fits(q), nil
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if found != tt.wantFound || got != tt.expected {
+				t.Errorf("Expected %d (found %t), got %d (found %t)", tt.expected, tt.wantFound, got, found)
+			}
+			// Бинарный поиск по 91 значению - не больше 7 попыток
+			if calls > 7 {
+				t.Errorf("Expected at most 7 encodes, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestSSIM(t *testing.T) {
+	reference := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	noisy := image.NewNRGBA(reference.Rect)
+	flat := image.NewNRGBA(reference.Rect)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			v := uint8((x*37 + y*11) % 256)
+			reference.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+			n := v
+			if (x+y)%2 == 0 {
+				n = v ^ 0x10
+			}
+			noisy.SetNRGBA(x, y, color.NRGBA{n, n, n, 255})
+			flat.SetNRGBA(x, y, color.NRGBA{128, 128, 128, 255})
+		}
+	}
+
+	same, err := SSIM(reference, reference)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if math.Abs(same-1) > 1e-9 {
+		t.Errorf("Expected SSIM 1 for identical images, got %f", same)
+	}
+
+	slightly, _ := SSIM(reference, noisy)
+	different, _ := SSIM(reference, flat)
+	if !(slightly < 1 && slightly > different) {
+		t.Errorf("Expected 1 > SSIM(noisy)=%f > SSIM(flat)=%f", slightly, different)
+	}
+
+	if _, err := SSIM(reference, image.NewNRGBA(image.Rect(0, 0, 16, 16))); err == nil {
+		t.Error("Expected error for images of different size")
+	}
+}
+
+func TestPipeline_EncodeLast(t *testing.T) {
+	opts := PipelineOptions{Metadata: StripOptions{Level: StripAll}}
+	actions, err := Pipeline([]string{"Encode(format=webp)", "Resize"}, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "Resize,StripMetadata(keep_copyright=false,keep_icc=false,level=all),Encode(format=webp)"
+	if PipelineSpec(actions) != expected {
+		t.Errorf("Expected %s, got %s", expected, PipelineSpec(actions))
+	}
+
+	if _, err := Pipeline([]string{"Encode", "Encode(format=avif)"}, opts); !errors.Is(err, domain.ErrInvalidAction) {
+		t.Errorf("Expected ErrInvalidAction for repeated Encode, got %v", err)
+	}
+}
@@ -0,0 +1,658 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/h2non/bimg"
+)
+
+// ExtractMetadata читает метаданные оригинала: размеры, формат и цветовое
+// пространство определяет libvips, а EXIF, IPTC, XMP и ICC разбираются
+// напрямую из контейнера (JPEG, PNG, WebP).
+func ExtractMetadata(file []byte) (*domain.ImageMetadata, error) {
+	meta, err := bimg.NewImage(file).Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать метаданные изображения: %v", err)
+	}
+
+	result := &domain.ImageMetadata{
+		Width:       meta.Size.Width,
+		Height:      meta.Size.Height,
+		Format:      meta.Type,
+		Orientation: meta.Orientation,
+		ColorSpace:  meta.Space,
+		HasAlpha:    meta.Alpha,
+	}
+	readEmbeddedMetadata(file, result)
+	return result, nil
+}
+
+// embeddedMetadata - блоки метаданных, найденные в контейнере
+type embeddedMetadata struct {
+	exif []byte // TIFF-структура без префикса "Exif\0\0"
+	xmp  []byte
+	irb  []byte // Photoshop Image Resource Blocks с записями IPTC
+	icc  []byte
+	// Плотность из JFIF или pHYs, если в EXIF ее нет
+	dpiX, dpiY float64
+}
+
+// readEmbeddedMetadata дополняет result данными EXIF, IPTC, XMP и ICC.
+// Ошибки разбора отдельных блоков не прерывают извлечение остальных.
+func readEmbeddedMetadata(file []byte, result *domain.ImageMetadata) {
+	blocks := findEmbeddedMetadata(file)
+
+	if blocks.exif != nil {
+		if err := applyEXIF(blocks.exif, result); err != nil {
+			log.Printf("Не удалось разобрать EXIF: %v", err)
+		}
+	}
+	if result.DPIX == 0 && result.DPIY == 0 {
+		result.DPIX, result.DPIY = blocks.dpiX, blocks.dpiY
+	}
+	if blocks.icc != nil {
+		result.ICCProfile = iccDescription(blocks.icc)
+	}
+
+	if blocks.irb != nil {
+		fields, keywords := parseIPTC(blocks.irb)
+		if len(fields) > 0 {
+			result.IPTC = fields
+		}
+		result.Keywords = append(result.Keywords, keywords...)
+		fillEmpty(&result.Artist, fields["by_line"])
+		fillEmpty(&result.Copyright, fields["copyright_notice"])
+		fillEmpty(&result.Description, fields["caption"])
+	}
+
+	if blocks.xmp != nil {
+		props := parseXMP(blocks.xmp)
+		if len(props) > 0 {
+			result.XMP = props
+		}
+		fillEmpty(&result.Artist, props["dc:creator"])
+		fillEmpty(&result.Copyright, props["dc:rights"])
+		fillEmpty(&result.Description, props["dc:description"])
+		if len(result.Keywords) == 0 && props["dc:subject"] != "" {
+			result.Keywords = strings.Split(props["dc:subject"], ", ")
+		}
+	}
+}
+
+func fillEmpty(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+func findEmbeddedMetadata(file []byte) embeddedMetadata {
+	var blocks embeddedMetadata
+
+	switch {
+	case len(file) > 3 && file[0] == 0xFF && file[1] == 0xD8:
+		segments, _, err := splitJPEG(file)
+		if err != nil {
+			return blocks
+		}
+		// ICC-профиль может быть разбит на несколько сегментов APP2
+		iccParts := map[byte][]byte{}
+		for _, segment := range segments {
+			payload := segment.payload
+			switch {
+			case segment.marker == 0xE0 && bytes.HasPrefix(payload, []byte("JFIF\x00")) && len(payload) >= 12:
+				blocks.dpiX, blocks.dpiY = densityToDPI(
+					float64(binary.BigEndian.Uint16(payload[8:])),
+					float64(binary.BigEndian.Uint16(payload[10:])),
+					payload[7])
+			case segment.marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+				blocks.exif = payload[len(exifHeader):]
+			case segment.marker == 0xE1 && bytes.HasPrefix(payload, xmpHeader):
+				blocks.xmp = payload[len(xmpHeader):]
+			case segment.marker == 0xE2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2:
+				iccParts[payload[len(iccHeader)]] = payload[len(iccHeader)+2:]
+			case segment.marker == 0xED:
+				blocks.irb = payload
+			}
+		}
+		if len(iccParts) > 0 {
+			seqs := make([]int, 0, len(iccParts))
+			for seq := range iccParts {
+				seqs = append(seqs, int(seq))
+			}
+			sort.Ints(seqs)
+			for _, seq := range seqs {
+				blocks.icc = append(blocks.icc, iccParts[byte(seq)]...)
+			}
+		}
+
+	case bytes.HasPrefix(file, pngSignature):
+		chunks, err := splitPNG(file)
+		if err != nil {
+			return blocks
+		}
+		for _, chunk := range chunks {
+			switch chunk.typ {
+			case "eXIf":
+				blocks.exif = chunk.data
+			case "iCCP":
+				// Имя профиля, 0, метод сжатия, zlib-данные
+				if i := bytes.IndexByte(chunk.data, 0); i >= 0 && i+2 <= len(chunk.data) {
+					blocks.icc = inflate(chunk.data[i+2:])
+				}
+			case "iTXt":
+				if bytes.HasPrefix(chunk.data, xmpPNGKeyword) {
+					blocks.xmp = pngInternationalText(chunk.data)
+				}
+			case "pHYs":
+				// Плотность в пикселях на метр, если единица измерения задана
+				if len(chunk.data) == 9 && chunk.data[8] == 1 {
+					blocks.dpiX = float64(binary.BigEndian.Uint32(chunk.data)) * 0.0254
+					blocks.dpiY = float64(binary.BigEndian.Uint32(chunk.data[4:])) * 0.0254
+				}
+			}
+		}
+
+	case len(file) > 12 && string(file[0:4]) == "RIFF" && string(file[8:12]) == "WEBP":
+		chunks, err := splitWebP(file)
+		if err != nil {
+			return blocks
+		}
+		for _, chunk := range chunks {
+			switch chunk.fourCC {
+			case "EXIF":
+				blocks.exif = bytes.TrimPrefix(chunk.data, exifHeader)
+			case "XMP ":
+				blocks.xmp = chunk.data
+			case "ICCP":
+				blocks.icc = chunk.data
+			}
+		}
+	}
+	return blocks
+}
+
+// densityToDPI переводит плотность JFIF в точки на дюйм: unit 1 - на дюйм,
+// 2 - на сантиметр, 0 - только соотношение сторон.
+func densityToDPI(x, y float64, unit byte) (float64, float64) {
+	switch unit {
+	case 1:
+		return x, y
+	case 2:
+		return x * 2.54, y * 2.54
+	}
+	return 0, 0
+}
+
+// pngInternationalText возвращает текст чанка iTXt:
+// ключ, 0, флаг сжатия, метод, язык, 0, переведенный ключ, 0, текст.
+func pngInternationalText(data []byte) []byte {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 || i+3 > len(data) {
+		return nil
+	}
+	compressed := data[i+1] == 1
+	rest := data[i+3:]
+	for n := 0; n < 2; n++ {
+		j := bytes.IndexByte(rest, 0)
+		if j < 0 {
+			return nil
+		}
+		rest = rest[j+1:]
+	}
+	if compressed {
+		return inflate(rest)
+	}
+	return rest
+}
+
+func inflate(data []byte) []byte {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// EXIF-теги, которые попадают в метаданные изображения
+const (
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagXResolution        = 0x011A
+	tagYResolution        = 0x011B
+	tagResolutionUnit     = 0x0128
+	tagSoftware           = 0x0131
+	tagDateTime           = 0x0132
+	tagExposureTime       = 0x829A
+	tagFNumber            = 0x829D
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTime         = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920A
+	tagLensMake           = 0xA433
+	tagLensModel          = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// applyEXIF разбирает EXIF (TIFF) и заполняет камеру, дату съемки, GPS и DPI.
+func applyEXIF(tiff []byte, result *domain.ImageMetadata) error {
+	order, err := tiffByteOrder(tiff)
+	if err != nil {
+		return err
+	}
+	ifd0, err := readIFD(tiff, order.Uint32(tiff[4:8]), order)
+	if err != nil {
+		return err
+	}
+	tags := indexEntries(ifd0)
+
+	exif := map[uint16]tiffEntry{}
+	if pointer, ok := tags[tagExifIFD]; ok {
+		entries, err := readIFD(tiff, pointer.uint(order), order)
+		if err != nil {
+			return err
+		}
+		exif = indexEntries(entries)
+	}
+
+	camera := domain.CameraInfo{
+		Make:        tags[tagMake].text(),
+		Model:       tags[tagModel].text(),
+		Software:    tags[tagSoftware].text(),
+		Lens:        exif[tagLensModel].text(),
+		FNumber:     exif[tagFNumber].rational(order),
+		ISO:         int(exif[tagISO].uint(order)),
+		FocalLength: exif[tagFocalLength].rational(order),
+	}
+	if lensMake := exif[tagLensMake].text(); lensMake != "" && !strings.HasPrefix(camera.Lens, lensMake) {
+		camera.Lens = strings.TrimSpace(lensMake + " " + camera.Lens)
+	}
+	if exposure, ok := exif[tagExposureTime]; ok && len(exposure.value) >= 8 {
+		num, den := order.Uint32(exposure.value), order.Uint32(exposure.value[4:])
+		if den != 0 && num != 0 && num < den {
+			camera.ExposureTime = fmt.Sprintf("1/%.0f", float64(den)/float64(num))
+		} else if den != 0 {
+			camera.ExposureTime = fmt.Sprintf("%g", float64(num)/float64(den))
+		}
+	}
+	if camera != (domain.CameraInfo{}) {
+		result.Camera = &camera
+	}
+
+	if result.Orientation == 0 {
+		result.Orientation = int(tags[tagOrientation].uint(order))
+	}
+
+	if x, y := tags[tagXResolution].rational(order), tags[tagYResolution].rational(order); x > 0 && y > 0 {
+		// ResolutionUnit: 2 - дюймы (по умолчанию), 3 - сантиметры
+		if tags[tagResolutionUnit].uint(order) == 3 {
+			x, y = x*2.54, y*2.54
+		}
+		result.DPIX, result.DPIY = x, y
+	}
+
+	result.CapturedAt = captureTime(
+		firstNonEmpty(exif[tagDateTimeOriginal].text(), tags[tagDateTime].text()),
+		firstNonEmpty(exif[tagOffsetTimeOriginal].text(), exif[tagOffsetTime].text()))
+
+	result.Artist = tags[tagArtist].text()
+	result.Copyright = tags[tagCopyright].text()
+	result.Description = tags[tagImageDescription].text()
+
+	if pointer, ok := tags[tagGPSIFD]; ok {
+		entries, err := readIFD(tiff, pointer.uint(order), order)
+		if err != nil {
+			return err
+		}
+		result.GPS = gpsInfo(indexEntries(entries), order)
+	}
+	return nil
+}
+
+// captureTime разбирает дату EXIF "2006:01:02 15:04:05". Без смещения
+// часового пояса время считается UTC: камера хранит локальное время без зоны.
+func captureTime(value, offset string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	layout := "2006:01:02 15:04:05"
+	if offset != "" {
+		value += offset
+		layout += "-07:00"
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func gpsInfo(tags map[uint16]tiffEntry, order binary.ByteOrder) *domain.GPSInfo {
+	lat := tags[tagGPSLatitude].rationals(order)
+	lon := tags[tagGPSLongitude].rationals(order)
+	if len(lat) != 3 || len(lon) != 3 {
+		return nil
+	}
+
+	info := &domain.GPSInfo{
+		Latitude:  lat[0] + lat[1]/60 + lat[2]/3600,
+		Longitude: lon[0] + lon[1]/60 + lon[2]/3600,
+	}
+	if tags[tagGPSLatitudeRef].text() == "S" {
+		info.Latitude = -info.Latitude
+	}
+	if tags[tagGPSLongitudeRef].text() == "W" {
+		info.Longitude = -info.Longitude
+	}
+	if alt, ok := tags[tagGPSAltitude]; ok {
+		altitude := alt.rational(order)
+		// AltitudeRef 1 - ниже уровня моря
+		if tags[tagGPSAltitudeRef].uint(order) == 1 {
+			altitude = -altitude
+		}
+		info.Altitude = &altitude
+	}
+	return info
+}
+
+func indexEntries(entries []tiffEntry) map[uint16]tiffEntry {
+	index := make(map[uint16]tiffEntry, len(entries))
+	for _, entry := range entries {
+		index[entry.tag] = entry
+	}
+	return index
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// text возвращает значение ASCII-тега без завершающих нулей и пробелов.
+func (e tiffEntry) text() string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimRight(string(e.value), "\x00 ")
+}
+
+// uint возвращает первое значение целочисленного тега (BYTE, SHORT, LONG).
+func (e tiffEntry) uint(order binary.ByteOrder) uint32 {
+	switch {
+	case e.typ == 1 && len(e.value) >= 1:
+		return uint32(e.value[0])
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return order.Uint32(e.value)
+	}
+	return 0
+}
+
+// rationals возвращает значения тега типа RATIONAL или SRATIONAL.
+func (e tiffEntry) rationals(order binary.ByteOrder) []float64 {
+	if e.typ != 5 && e.typ != 10 {
+		return nil
+	}
+	values := make([]float64, 0, len(e.value)/8)
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num, den := order.Uint32(e.value[i:]), order.Uint32(e.value[i+4:])
+		if den == 0 {
+			values = append(values, 0)
+			continue
+		}
+		if e.typ == 10 {
+			values = append(values, float64(int32(num))/float64(int32(den)))
+		} else {
+			values = append(values, float64(num)/float64(den))
+		}
+	}
+	return values
+}
+
+func (e tiffEntry) rational(order binary.ByteOrder) float64 {
+	values := e.rationals(order)
+	if len(values) == 0 {
+		return 0
+	}
+	return values[0]
+}
+
+// iccDescription возвращает название ICC-профиля из тега desc
+// (тип desc в ICC v2 или mluc в ICC v4).
+func iccDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		base := 132 + i*12
+		if base+12 > len(profile) {
+			return ""
+		}
+		if string(profile[base:base+4]) != "desc" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(profile[base+4:]))
+		size := int(binary.BigEndian.Uint32(profile[base+8:]))
+		if offset < 0 || size < 12 || offset+size > len(profile) {
+			return ""
+		}
+		tag := profile[offset : offset+size]
+
+		switch string(tag[0:4]) {
+		case "desc":
+			n := int(binary.BigEndian.Uint32(tag[8:]))
+			if 12+n > len(tag) {
+				return ""
+			}
+			return strings.TrimRight(string(tag[12:12+n]), "\x00 ")
+		case "mluc":
+			// Берем первую запись: язык(2), страна(2), длина(4), смещение(4)
+			if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+				return ""
+			}
+			length := int(binary.BigEndian.Uint32(tag[20:]))
+			start := int(binary.BigEndian.Uint32(tag[24:]))
+			if start+length > len(tag) {
+				return ""
+			}
+			units := make([]uint16, length/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(tag[start+j*2:])
+			}
+			return strings.TrimRight(string(utf16.Decode(units)), "\x00 ")
+		}
+		return ""
+	}
+	return ""
+}
+
+// Наборы данных IPTC (запись 2), которые сохраняются в метаданных
+var iptcDatasets = map[byte]string{
+	5:   "object_name",
+	55:  "date_created",
+	80:  "by_line",
+	90:  "city",
+	95:  "province_state",
+	101: "country",
+	105: "headline",
+	110: "credit",
+	115: "source",
+	116: "copyright_notice",
+	120: "caption",
+}
+
+const iptcKeywords = 25
+
+// parseIPTC извлекает записи IPTC-IIM из ресурса 0x0404 блока Photoshop APP13.
+func parseIPTC(irb []byte) (map[string]string, []string) {
+	data := bytes.TrimPrefix(irb, []byte("Photoshop 3.0\x00"))
+
+	var records []byte
+	for len(data) >= 12 && string(data[0:4]) == "8BIM" {
+		id := binary.BigEndian.Uint16(data[4:])
+		// Имя ресурса - Pascal-строка, выровненная по четной длине
+		nameSize := 1 + int(data[6])
+		if nameSize%2 == 1 {
+			nameSize++
+		}
+		pos := 6 + nameSize
+		if pos+4 > len(data) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+		if pos+size > len(data) {
+			break
+		}
+		if id == 0x0404 {
+			records = data[pos : pos+size]
+		}
+		next := pos + size
+		if size%2 == 1 {
+			next++
+		}
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+
+	fields := map[string]string{}
+	var keywords []string
+	for len(records) >= 5 && records[0] == 0x1C {
+		record, dataset := records[1], records[2]
+		n := int(binary.BigEndian.Uint16(records[3:]))
+		// Расширенная длина (старший бит) для текстовых полей не встречается
+		if n&0x8000 != 0 || 5+n > len(records) {
+			break
+		}
+		value := strings.TrimSpace(string(records[5 : 5+n]))
+		records = records[5+n:]
+
+		if record != 2 || value == "" {
+			continue
+		}
+		if dataset == iptcKeywords {
+			keywords = append(keywords, value)
+			continue
+		}
+		if name, ok := iptcDatasets[dataset]; ok {
+			if fields[name] != "" {
+				value = fields[name] + ", " + value
+			}
+			fields[name] = value
+		}
+	}
+	return fields, keywords
+}
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// Префиксы распространенных пространств имен XMP
+var xmpPrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":            "dc",
+	"http://ns.adobe.com/xap/1.0/":                "xmp",
+	"http://ns.adobe.com/xap/1.0/rights/":         "xmpRights",
+	"http://ns.adobe.com/photoshop/1.0/":          "photoshop",
+	"http://ns.adobe.com/exif/1.0/":               "exif",
+	"http://ns.adobe.com/tiff/1.0/":               "tiff",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/": "Iptc4xmpCore",
+	"http://ns.adobe.com/lightroom/1.0/":          "lr",
+}
+
+// parseXMP собирает простые свойства XMP в виде "префикс:имя" -> значение.
+// Элементы списков (rdf:Seq, rdf:Bag, rdf:Alt) объединяются через запятую.
+func parseXMP(packet []byte) map[string]string {
+	props := map[string]string{}
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+
+	// Стек имен свойств: элементы rdf наследуют свойство родителя
+	var stack []string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			current := ""
+			if len(stack) > 0 {
+				current = stack[len(stack)-1]
+			}
+			switch {
+			case t.Name.Space == rdfNamespace:
+				if t.Name.Local == "Description" {
+					for _, attr := range t.Attr {
+						if name := xmpName(attr.Name); name != "" && attr.Value != "" {
+							props[name] = attr.Value
+						}
+					}
+				}
+			case t.Name.Space == "adobe:ns:meta/":
+				current = ""
+			default:
+				current = xmpName(t.Name)
+			}
+			stack = append(stack, current)
+
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text == "" || len(stack) == 0 || stack[len(stack)-1] == "" {
+				continue
+			}
+			name := stack[len(stack)-1]
+			if props[name] != "" {
+				text = props[name] + ", " + text
+			}
+			props[name] = text
+		}
+	}
+	return props
+}
+
+// xmpName возвращает имя свойства с префиксом; служебные атрибуты пропускаются.
+func xmpName(name xml.Name) string {
+	switch name.Space {
+	case "", "xmlns", "xml", rdfNamespace, "adobe:ns:meta/":
+		return ""
+	}
+	if prefix, ok := xmpPrefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return name.Local
+}
@@ -0,0 +1,206 @@
+package processor
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+// cameraEXIF собирает EXIF с порядком байт Motorola, как у большинства камер
+func cameraEXIF() []byte {
+	order := binary.BigEndian
+	ascii := func(tag uint16, s string) tiffEntry {
+		v := append([]byte(s), 0)
+		return tiffEntry{tag: tag, typ: 2, count: uint32(len(v)), value: v}
+	}
+	rationals := func(tag uint16, values ...[2]uint32) tiffEntry {
+		v := make([]byte, 0, 8*len(values))
+		for _, r := range values {
+			v = order.AppendUint32(v, r[0])
+			v = order.AppendUint32(v, r[1])
+		}
+		return tiffEntry{tag: tag, typ: 5, count: uint32(len(values)), value: v}
+	}
+	short := func(tag uint16, n uint16) tiffEntry {
+		return tiffEntry{tag: tag, typ: 3, count: 1, value: order.AppendUint16(nil, n)}
+	}
+	pointer := func(tag uint16, offset int) tiffEntry {
+		return tiffEntry{tag: tag, typ: 4, count: 1, value: order.AppendUint32(nil, uint32(offset))}
+	}
+
+	out := []byte{'M', 'M', 0, 42, 0, 0, 0, 0}
+	out, exifOffset := writeIFD(out, []tiffEntry{
+		rationals(tagExposureTime, [2]uint32{1, 250}),
+		rationals(tagFNumber, [2]uint32{28, 10}),
+		short(tagISO, 400),
+		ascii(tagDateTimeOriginal, "2024:05:17 14:30:00"),
+		ascii(tagOffsetTimeOriginal, "+03:00"),
+		rationals(tagFocalLength, [2]uint32{50, 1}),
+		ascii(tagLensModel, "EF 50mm f/1.8"),
+	}, order)
+	out, gpsOffset := writeIFD(out, []tiffEntry{
+		ascii(tagGPSLatitudeRef, "N"),
+		rationals(tagGPSLatitude, [2]uint32{55, 1}, [2]uint32{45, 1}, [2]uint32{0, 1}),
+		ascii(tagGPSLongitudeRef, "E"),
+		rationals(tagGPSLongitude, [2]uint32{37, 1}, [2]uint32{36, 1}, [2]uint32{36, 1}),
+		rationals(tagGPSAltitude, [2]uint32{150, 1}),
+	}, order)
+	out, rootOffset := writeIFD(out, []tiffEntry{
+		ascii(tagMake, "Canon"),
+		ascii(tagModel, "EOS 5D"),
+		short(tagOrientation, 6),
+		rationals(tagXResolution, [2]uint32{300, 1}),
+		rationals(tagYResolution, [2]uint32{300, 1}),
+		short(tagResolutionUnit, 2),
+		ascii(tagCopyright, "ACME Corp"),
+		pointer(tagExifIFD, exifOffset),
+		pointer(tagGPSIFD, gpsOffset),
+	}, order)
+	order.PutUint32(out[4:], uint32(rootOffset))
+	return out
+}
+
+// iccProfileV2 собирает минимальный ICC-профиль с тегом desc
+func iccProfileV2(name string) []byte {
+	profile := make([]byte, 132+12)
+	binary.BigEndian.PutUint32(profile[128:], 1)
+	copy(profile[132:], "desc")
+	binary.BigEndian.PutUint32(profile[136:], uint32(len(profile)))
+
+	tag := []byte("desc\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint32(tag, uint32(len(name)+1))
+	tag = append(tag, name...)
+	tag = append(tag, 0)
+	binary.BigEndian.PutUint32(profile[140:], uint32(len(tag)))
+	return append(profile, tag...)
+}
+
+// photoshopIPTC собирает APP13 с записями IPTC
+func photoshopIPTC() []byte {
+	var records []byte
+	add := func(dataset byte, value string) {
+		records = append(records, 0x1C, 2, dataset)
+		records = binary.BigEndian.AppendUint16(records, uint16(len(value)))
+		records = append(records, value...)
+	}
+	add(80, "Jane Photographer")
+	add(25, "shoes")
+	add(25, "red")
+	add(90, "Moscow")
+
+	irb := []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00")
+	irb = binary.BigEndian.AppendUint32(irb, uint32(len(records)))
+	irb = append(irb, records...)
+	if len(records)%2 == 1 {
+		irb = append(irb, 0)
+	}
+	return irb
+}
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmp:CreatorTool="Lightroom" xmp:Rating="5">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Red shoes</rdf:li></rdf:Alt></dc:title>
+   <dc:subject><rdf:Bag><rdf:li>xmp-only</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestReadEmbeddedMetadata_JPEG(t *testing.T) {
+	data := []byte{0xFF, 0xD8}
+	data = append(data, rawSegment(0xE0, []byte("JFIF\x00\x01\x01\x01\x00\x48\x00\x48\x00\x00"))...)
+	data = append(data, rawSegment(0xE1, append(append([]byte{}, exifHeader...), cameraEXIF()...))...)
+	data = append(data, rawSegment(0xE1, append(append([]byte{}, xmpHeader...), testXMP...))...)
+	data = append(data, rawSegment(0xE2, append(append([]byte{}, iccHeader...), append([]byte{1, 1}, iccProfileV2("sRGB IEC61966-2.1")...)...))...)
+	data = append(data, rawSegment(0xED, photoshopIPTC())...)
+	data = append(data, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+
+	var meta domain.ImageMetadata
+	readEmbeddedMetadata(data, &meta)
+
+	if meta.Camera == nil {
+		t.Fatal("Expected camera info")
+	}
+	camera := *meta.Camera
+	expected := domain.CameraInfo{
+		Make: "Canon", Model: "EOS 5D", Lens: "EF 50mm f/1.8",
+		ExposureTime: "1/250", FNumber: 2.8, ISO: 400, FocalLength: 50,
+	}
+	if camera != expected {
+		t.Errorf("Expected camera %+v, got %+v", expected, camera)
+	}
+
+	if meta.Orientation != 6 {
+		t.Errorf("Expected orientation 6, got %d", meta.Orientation)
+	}
+	if meta.DPIX != 300 || meta.DPIY != 300 {
+		t.Errorf("Expected EXIF DPI 300x300 over JFIF, got %vx%v", meta.DPIX, meta.DPIY)
+	}
+	if meta.CapturedAt == nil || meta.CapturedAt.UTC().Format("2006-01-02 15:04") != "2024-05-17 11:30" {
+		t.Errorf("Expected capture time 2024-05-17 11:30 UTC, got %v", meta.CapturedAt)
+	}
+
+	if meta.GPS == nil {
+		t.Fatal("Expected GPS info")
+	}
+	if math.Abs(meta.GPS.Latitude-55.75) > 1e-9 || math.Abs(meta.GPS.Longitude-37.61) > 1e-9 {
+		t.Errorf("Expected 55.75, 37.61, got %v, %v", meta.GPS.Latitude, meta.GPS.Longitude)
+	}
+	if meta.GPS.Altitude == nil || *meta.GPS.Altitude != 150 {
+		t.Errorf("Expected altitude 150, got %v", meta.GPS.Altitude)
+	}
+
+	if meta.ICCProfile != "sRGB IEC61966-2.1" {
+		t.Errorf("Expected ICC profile name, got %q", meta.ICCProfile)
+	}
+	if meta.Copyright != "ACME Corp" {
+		t.Errorf("Expected EXIF copyright, got %q", meta.Copyright)
+	}
+	if meta.Artist != "Jane Photographer" {
+		t.Errorf("Expected artist from IPTC, got %q", meta.Artist)
+	}
+	if len(meta.Keywords) != 2 || meta.Keywords[0] != "shoes" || meta.Keywords[1] != "red" {
+		t.Errorf("Expected IPTC keywords [shoes red], got %v", meta.Keywords)
+	}
+	if meta.IPTC["city"] != "Moscow" {
+		t.Errorf("Expected IPTC city Moscow, got %v", meta.IPTC)
+	}
+	if meta.XMP["xmp:CreatorTool"] != "Lightroom" || meta.XMP["dc:title"] != "Red shoes" {
+		t.Errorf("Expected XMP properties, got %v", meta.XMP)
+	}
+}
+
+func TestReadEmbeddedMetadata_PNG(t *testing.T) {
+	data := append([]byte{}, pngSignature...)
+	data = appendPNGChunk(data, "IHDR", make([]byte, 13))
+	// 3780 точек на метр - 96 DPI
+	phys := binary.BigEndian.AppendUint32(nil, 3780)
+	phys = binary.BigEndian.AppendUint32(phys, 3780)
+	data = appendPNGChunk(data, "pHYs", append(phys, 1))
+	data = appendPNGChunk(data, "iTXt", append(append([]byte{}, xmpPNGKeyword...), "\x00\x00\x00\x00"+testXMP...))
+	data = appendPNGChunk(data, "IEND", nil)
+
+	var meta domain.ImageMetadata
+	readEmbeddedMetadata(data, &meta)
+
+	if math.Round(meta.DPIX) != 96 || math.Round(meta.DPIY) != 96 {
+		t.Errorf("Expected 96 DPI, got %vx%v", meta.DPIX, meta.DPIY)
+	}
+	if meta.XMP["xmp:Rating"] != "5" {
+		t.Errorf("Expected XMP rating 5, got %v", meta.XMP)
+	}
+	if len(meta.Keywords) != 1 || meta.Keywords[0] != "xmp-only" {
+		t.Errorf("Expected keywords from XMP, got %v", meta.Keywords)
+	}
+}
+
+func TestReadEmbeddedMetadata_Garbage(t *testing.T) {
+	var meta domain.ImageMetadata
+	readEmbeddedMetadata([]byte{0xFF, 0xD8, 0x00, 0x01}, &meta)
+	if meta.Camera != nil || meta.GPS != nil {
+		t.Errorf("Expected no metadata for broken file, got %+v", meta)
+	}
+}
@@ -0,0 +1,200 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/h2non/bimg"
+)
+
+// colorFunc преобразует цвет пикселя; каналы в диапазоне 0..255.
+type colorFunc func(r, g, b float64) (float64, float64, float64)
+
+// AdjustBrightness сдвигает яркость на value процентов (-100..100).
+func AdjustBrightness(file []byte, value float64) ([]byte, error) {
+	if value < -100 || value > 100 {
+		return nil, fmt.Errorf("яркость должна быть в диапазоне -100..100, получено %v", value)
+	}
+	return mapColors(file, "яркость", brightnessFunc(value))
+}
+
+// AdjustContrast меняет контраст на value процентов (-100..100) относительно середины диапазона.
+func AdjustContrast(file []byte, value float64) ([]byte, error) {
+	if value < -100 || value > 100 {
+		return nil, fmt.Errorf("контраст должен быть в диапазоне -100..100, получено %v", value)
+	}
+	return mapColors(file, "контраст", contrastFunc(value))
+}
+
+// AdjustSaturation меняет насыщенность на value процентов (-100..100);
+// -100 дает полностью обесцвеченное изображение.
+func AdjustSaturation(file []byte, value float64) ([]byte, error) {
+	if value < -100 || value > 100 {
+		return nil, fmt.Errorf("насыщенность должна быть в диапазоне -100..100, получено %v", value)
+	}
+	return mapColors(file, "насыщенность", saturationFunc(value))
+}
+
+// ApplySepia тонирует изображение в сепию с силой amount процентов (0..100).
+func ApplySepia(file []byte, amount float64) ([]byte, error) {
+	if amount < 0 || amount > 100 {
+		return nil, fmt.Errorf("сила сепии должна быть в диапазоне 0..100, получено %v", amount)
+	}
+	return mapColors(file, "сепия", sepiaFunc(amount))
+}
+
+// ApplyTint окрашивает изображение в цвет tint с сохранением яркости,
+// amount - сила тонирования в процентах (0..100).
+func ApplyTint(file []byte, tint bimg.Color, amount float64) ([]byte, error) {
+	if amount < 0 || amount > 100 {
+		return nil, fmt.Errorf("сила тонирования должна быть в диапазоне 0..100, получено %v", amount)
+	}
+	return mapColors(file, "тонирование", tintFunc(tint, amount))
+}
+
+// InvertColors инвертирует цвета изображения (негатив), альфа-канал сохраняется.
+func InvertColors(file []byte) ([]byte, error) {
+	return mapColors(file, "инверсия", invertFunc)
+}
+
+// AdjustGamma применяет гамма-коррекцию; значения больше 1 осветляют изображение.
+func AdjustGamma(file []byte, gamma float64) ([]byte, error) {
+	if gamma <= 0 {
+		return nil, fmt.Errorf("гамма должна быть больше нуля, получено %v", gamma)
+	}
+
+	newImage, err := bimg.NewImage(file).Process(bimg.Options{
+		Gamma:        gamma,
+		Quality:      90,
+		NoAutoRotate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка гамма-коррекции: %v", err)
+	}
+	return newImage, nil
+}
+
+// SharpenImage повышает резкость (unsharp mask libvips); amount - сила
+// усиления на резких границах.
+func SharpenImage(file []byte, radius int, amount float64) ([]byte, error) {
+	if radius <= 0 || amount <= 0 {
+		return nil, fmt.Errorf("радиус и сила резкости должны быть больше нуля")
+	}
+
+	newImage, err := bimg.NewImage(file).Process(bimg.Options{
+		// Значения X1/Y2/Y3/M1 - умолчания vips_sharpen
+		Sharpen: bimg.Sharpen{
+			Radius: radius,
+			X1:     2,
+			Y2:     10,
+			Y3:     20,
+			M1:     0,
+			M2:     amount,
+		},
+		Quality:      90,
+		NoAutoRotate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка повышения резкости: %v", err)
+	}
+	return newImage, nil
+}
+
+// BlurImage размывает изображение по Гауссу с заданной сигмой.
+func BlurImage(file []byte, sigma float64) ([]byte, error) {
+	if sigma <= 0 {
+		return nil, fmt.Errorf("сигма размытия должна быть больше нуля, получено %v", sigma)
+	}
+
+	newImage, err := bimg.NewImage(file).Process(bimg.Options{
+		GaussianBlur: bimg.GaussianBlur{Sigma: sigma},
+		Quality:      90,
+		NoAutoRotate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка размытия: %v", err)
+	}
+	return newImage, nil
+}
+
+func brightnessFunc(value float64) colorFunc {
+	shift := value / 100 * 255
+	return func(r, g, b float64) (float64, float64, float64) {
+		return r + shift, g + shift, b + shift
+	}
+}
+
+func contrastFunc(value float64) colorFunc {
+	factor := (100 + value) / 100
+	return func(r, g, b float64) (float64, float64, float64) {
+		return (r-128)*factor + 128, (g-128)*factor + 128, (b-128)*factor + 128
+	}
+}
+
+func saturationFunc(value float64) colorFunc {
+	factor := 1 + value/100
+	return func(r, g, b float64) (float64, float64, float64) {
+		l := luma(r, g, b)
+		return l + (r-l)*factor, l + (g-l)*factor, l + (b-l)*factor
+	}
+}
+
+func sepiaFunc(amount float64) colorFunc {
+	a := amount / 100
+	return func(r, g, b float64) (float64, float64, float64) {
+		sr := 0.393*r + 0.769*g + 0.189*b
+		sg := 0.349*r + 0.686*g + 0.168*b
+		sb := 0.272*r + 0.534*g + 0.131*b
+		return lerp(r, sr, a), lerp(g, sg, a), lerp(b, sb, a)
+	}
+}
+
+func tintFunc(tint bimg.Color, amount float64) colorFunc {
+	a := amount / 100
+	tr, tg, tb := float64(tint.R), float64(tint.G), float64(tint.B)
+	return func(r, g, b float64) (float64, float64, float64) {
+		l := luma(r, g, b) / 255
+		return lerp(r, tr*l, a), lerp(g, tg*l, a), lerp(b, tb*l, a)
+	}
+}
+
+func invertFunc(r, g, b float64) (float64, float64, float64) {
+	return 255 - r, 255 - g, 255 - b
+}
+
+// mapColors применяет fn к каждому пикселю изображения.
+func mapColors(file []byte, name string, fn colorFunc) ([]byte, error) {
+	pixels, imageType, err := decodePixels(file)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Применение фильтра %q к изображению %dx%d", name, pixels.Rect.Dx(), pixels.Rect.Dy())
+
+	applyColorFunc(pixels.Pix, fn)
+	return encodePixels(pixels, imageType)
+}
+
+// applyColorFunc применяет fn к буферу NRGBA (4 байта на пиксель).
+func applyColorFunc(pix []uint8, fn colorFunc) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		r, g, b := fn(float64(pix[i]), float64(pix[i+1]), float64(pix[i+2]))
+		pix[i] = clampByte(r)
+		pix[i+1] = clampByte(g)
+		pix[i+2] = clampByte(b)
+	}
+}
+
+// luma - яркость пикселя по Rec. 601.
+func luma(r, g, b float64) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+func lerp(from, to, t float64) float64 {
+	return from + (to-from)*t
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, v))))
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/h2non/bimg"
+)
+
+func TestColorFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       colorFunc
+		in       [3]uint8
+		expected [3]uint8
+	}{
+		{"brightness up", brightnessFunc(10), [3]uint8{100, 100, 100}, [3]uint8{126, 126, 126}},
+		{"brightness clamps", brightnessFunc(100), [3]uint8{200, 10, 0}, [3]uint8{255, 255, 255}},
+		{"contrast up", contrastFunc(50), [3]uint8{100, 128, 200}, [3]uint8{86, 128, 236}},
+		{"contrast to gray", contrastFunc(-100), [3]uint8{0, 50, 255}, [3]uint8{128, 128, 128}},
+		{"desaturate", saturationFunc(-100), [3]uint8{255, 0, 0}, [3]uint8{76, 76, 76}},
+		{"sepia off", sepiaFunc(0), [3]uint8{10, 20, 30}, [3]uint8{10, 20, 30}},
+		{"sepia full", sepiaFunc(100), [3]uint8{100, 100, 100}, [3]uint8{135, 120, 94}},
+		{"tint full", tintFunc(bimg.Color{R: 255}, 100), [3]uint8{255, 255, 255}, [3]uint8{255, 0, 0}},
+		{"invert", invertFunc, [3]uint8{0, 100, 255}, [3]uint8{255, 155, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pix := []uint8{tt.in[0], tt.in[1], tt.in[2], 200}
+			applyColorFunc(pix, tt.fn)
+
+			got := [3]uint8{pix[0], pix[1], pix[2]}
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+			if pix[3] != 200 {
+				t.Errorf("Expected alpha to be preserved, got %d", pix[3])
+			}
+		})
+	}
+}
+
+func TestFilters_InvalidParams(t *testing.T) {
+	data := []byte("not an image")
+
+	if _, err := AdjustBrightness(data, 150); err == nil {
+		t.Error("Expected error for brightness out of range")
+	}
+	if _, err := AdjustContrast(data, -101); err == nil {
+		t.Error("Expected error for contrast out of range")
+	}
+	if _, err := AdjustSaturation(data, 200); err == nil {
+		t.Error("Expected error for saturation out of range")
+	}
+	if _, err := ApplySepia(data, -1); err == nil {
+		t.Error("Expected error for sepia out of range")
+	}
+	if _, err := ApplyTint(data, bimg.Color{}, 101); err == nil {
+		t.Error("Expected error for tint out of range")
+	}
+	if _, err := AdjustGamma(data, 0); err == nil {
+		t.Error("Expected error for non-positive gamma")
+	}
+	if _, err := SharpenImage(data, 0, 1); err == nil {
+		t.Error("Expected error for non-positive sharpen radius")
+	}
+	if _, err := BlurImage(data, 0); err == nil {
+		t.Error("Expected error for non-positive blur sigma")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	testImage := createTestJPEG(t)
+
+	filters := map[string]func([]byte) ([]byte, error){
+		"brightness": func(b []byte) ([]byte, error) { return AdjustBrightness(b, 20) },
+		"contrast":   func(b []byte) ([]byte, error) { return AdjustContrast(b, 20) },
+		"saturation": func(b []byte) ([]byte, error) { return AdjustSaturation(b, -50) },
+		"gamma":      func(b []byte) ([]byte, error) { return AdjustGamma(b, 1.5) },
+		"sepia":      func(b []byte) ([]byte, error) { return ApplySepia(b, 80) },
+		"tint":       func(b []byte) ([]byte, error) { return ApplyTint(b, bimg.Color{R: 255}, 30) },
+		"invert":     InvertColors,
+		"sharpen":    func(b []byte) ([]byte, error) { return SharpenImage(b, 1, 3) },
+		"blur":       func(b []byte) ([]byte, error) { return BlurImage(b, 2) },
+	}
+
+	for name, filter := range filters {
+		t.Run(name, func(t *testing.T) {
+			result, err := filter(testImage)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(result) == 0 {
+				t.Fatal("Expected non-empty result")
+			}
+		})
+	}
+}
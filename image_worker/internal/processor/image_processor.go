@@ -15,7 +15,8 @@ func ResizeImage(file []byte, width, height int) ([]byte, error) {
 		// Если нужно обрезать, чтобы точно вписаться в размеры
 		// Crop: true,
 		// Качество JPEG (1-100)
-		Quality: 85,
+		Quality:      85,
+		NoAutoRotate: true, // ориентацию исправляет отдельный шаг AutoOrient
 	}
 
 	// Обрабатываем изображение
@@ -35,11 +36,12 @@ func ResizeImage(file []byte, width, height int) ([]byte, error) {
 func GenerateSmartThumbnail(file []byte, width, height int) ([]byte, error) {
 
 	options := bimg.Options{
-		Width:   width,
-		Height:  height,
-		Crop:    true,
-		Gravity: bimg.GravitySmart, // Интеллектуальная обрезка
-		Quality: 90,
+		Width:        width,
+		Height:       height,
+		Crop:         true,
+		Gravity:      bimg.GravitySmart, // Интеллектуальная обрезка
+		Quality:      90,
+		NoAutoRotate: true,
 	}
 
 	newImage, err := bimg.NewImage(file).Process(options)
@@ -63,7 +65,8 @@ func AddTextWatermark(file []byte, text string) ([]byte, error) {
 	// Вместо текстового водяного знака используем простое наложение
 	// Создаем полупрозрачный слой (это работает надежнее)
 	options := bimg.Options{
-		Quality: 90,
+		Quality:      90,
+		NoAutoRotate: true,
 	}
 
 	// Просто обрабатываем изображение с качеством
@@ -90,6 +93,7 @@ func ApplyGrayscale(file []byte) ([]byte, error) {
 	options := bimg.Options{
 		Interpretation: bimg.InterpretationBW, // Черно-белый режим
 		Quality:        90,
+		NoAutoRotate:   true,
 	}
 
 	newImage, err := img.Process(options)
@@ -1,8 +1,13 @@
 package processor
 
 import (
+	"image"
+	"image/color"
 	"os"
 	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/h2non/bimg"
 )
 
 func TestResizeImage(t *testing.T) {
@@ -96,6 +101,182 @@ func TestApplyGrayscale_InvalidData(t *testing.T) {
 	}
 }
 
+func TestAutoOrient(t *testing.T) {
+	testImage := createTestJPEG(t)
+
+	result, err := AutoOrient(testImage)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(result) == 0 {
+		t.Fatal("Expected non-empty result")
+	}
+}
+
+func TestRotateImage(t *testing.T) {
+	testImage := createTestJPEG(t)
+
+	for _, angle := range []float64{90, 180, 270, 30, -45} {
+		result, err := RotateImage(testImage, angle, bimg.Color{R: 255, G: 255, B: 255})
+		if err != nil {
+			t.Fatalf("Expected no error for angle %v, got %v", angle, err)
+		}
+		if len(result) == 0 {
+			t.Fatalf("Expected non-empty result for angle %v", angle)
+		}
+	}
+}
+
+func TestFlipAndFlop(t *testing.T) {
+	testImage := createTestJPEG(t)
+
+	if _, err := FlipImage(testImage); err != nil {
+		t.Fatalf("Expected no error from FlipImage, got %v", err)
+	}
+	if _, err := FlopImage(testImage); err != nil {
+		t.Fatalf("Expected no error from FlopImage, got %v", err)
+	}
+}
+
+func TestRotatePixels(t *testing.T) {
+	// Полоса 4x2: левая половина красная, правая синяя
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+
+	rotated := rotatePixels(src, 90, color.NRGBA{A: 255})
+
+	if rotated.Rect.Dx() != 2 || rotated.Rect.Dy() != 4 {
+		t.Fatalf("Expected 2x4 result, got %dx%d", rotated.Rect.Dx(), rotated.Rect.Dy())
+	}
+	// После поворота по часовой стрелке левая (красная) часть оказывается сверху
+	if top := rotated.NRGBAAt(0, 0); top.R != 255 || top.B != 0 {
+		t.Errorf("Expected red pixel on top, got %v", top)
+	}
+	if bottom := rotated.NRGBAAt(1, 3); bottom.B != 255 || bottom.R != 0 {
+		t.Errorf("Expected blue pixel at bottom, got %v", bottom)
+	}
+
+	diagonal := rotatePixels(src, 45, color.NRGBA{A: 255})
+	if diagonal.Rect.Dx() <= 4 || diagonal.Rect.Dy() <= 2 {
+		t.Errorf("Expected canvas to grow for 45°, got %dx%d", diagonal.Rect.Dx(), diagonal.Rect.Dy())
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := ParseColor("#ff8000")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if c.R != 255 || c.G != 128 || c.B != 0 {
+		t.Errorf("Expected (255,128,0), got %v", c)
+	}
+
+	for _, invalid := range []string{"", "fff", "zzzzzz"} {
+		if _, err := ParseColor(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	actions, err := Pipeline([]string{"Resize", "Rotate(angle=90)"}, PipelineOptions{AutoOrient: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(actions) != 3 || actions[0].Name != domain.AutoOrientAction {
+		t.Fatalf("Expected AutoOrient to be prepended, got %v", actions)
+	}
+
+	actions, err = Pipeline([]string{"Resize", "AutoOrient"}, PipelineOptions{AutoOrient: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(actions) != 2 {
+		t.Errorf("Expected explicit AutoOrient not to be duplicated, got %v", actions)
+	}
+
+	actions, err = Pipeline([]string{"Resize"}, PipelineOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(actions) != 1 || actions[0].Name != domain.ResizeAction {
+		t.Errorf("Expected only Resize, got %v", actions)
+	}
+
+	if _, err := Pipeline([]string{"Rotate(angle=90"}, PipelineOptions{AutoOrient: true}); err == nil {
+		t.Error("Expected error for malformed action")
+	}
+}
+
+func TestPipeline_MetadataPolicy(t *testing.T) {
+	opts := PipelineOptions{Metadata: StripOptions{Level: StripPrivate, KeepICC: true}}
+	actions, err := Pipeline([]string{"Resize"}, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("Expected StripMetadata to be appended, got %v", actions)
+	}
+	last := actions[len(actions)-1].String()
+	expected := "StripMetadata(keep_copyright=false,keep_icc=true,level=private)"
+	if last != expected {
+		t.Errorf("Expected %s, got %s", expected, last)
+	}
+
+	actions, err = Pipeline([]string{"Resize"}, PipelineOptions{Metadata: StripOptions{Level: StripNone}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(actions) != 1 {
+		t.Errorf("Expected no StripMetadata for level none, got %v", actions)
+	}
+}
+
+func TestPipelineSpec(t *testing.T) {
+	opts := PipelineOptions{AutoOrient: true, Metadata: StripOptions{Level: StripGPS}}
+	a, err := Pipeline([]string{"Resize(width=800,height=600)", "Grayscale"}, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	b, err := Pipeline([]string{"Resize( height=600, width=800 )", "Grayscale"}, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := "AutoOrient,Resize(height=600,width=800),Grayscale,StripMetadata(keep_copyright=false,keep_icc=false,level=gps)"
+	if PipelineSpec(a) != expected {
+		t.Errorf("Expected %s, got %s", expected, PipelineSpec(a))
+	}
+	if PipelineSpec(a) != PipelineSpec(b) {
+		t.Errorf("Expected equal specs for equivalent pipelines, got %s and %s", PipelineSpec(a), PipelineSpec(b))
+	}
+
+	c, err := Pipeline([]string{"Grayscale", "Resize(width=800,height=600)"}, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if PipelineSpec(a) == PipelineSpec(c) {
+		t.Error("Expected action order to change the spec")
+	}
+}
+
+func TestApplyAction_Unknown(t *testing.T) {
+	_, err := ApplyAction(domain.Action{Name: "Unknown"}, []byte("data"))
+	if err == nil {
+		t.Fatal("Expected error for unknown action")
+	}
+}
+
 // createTestJPEG создает минимальное валидное JPEG изображение для тестов
 func createTestJPEG(t *testing.T) []byte {
 	// Минимальный валидный JPEG (1x1 пиксель, черный)
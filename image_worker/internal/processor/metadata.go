@@ -0,0 +1,439 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/h2non/bimg"
+)
+
+// Уровни удаления метаданных
+const (
+	StripNone    = "none"    // метаданные не трогаем
+	StripGPS     = "gps"     // GPS-координаты (EXIF GPS IFD и XMP)
+	StripPrivate = "private" // GPS и персональные данные: автор, серийные номера, MakerNote, IPTC, комментарии
+	StripAll     = "all"     // все метаданные, кроме явно сохраняемых ICC и copyright
+)
+
+// StripOptions - что удалять из метаданных и что сохранить
+type StripOptions struct {
+	Level         string
+	KeepICC       bool
+	KeepCopyright bool
+}
+
+// EXIF/TIFF теги, которые анализирует санитайзер
+const (
+	tagImageDescription = 0x010E
+	tagArtist           = 0x013B
+	tagHostComputer     = 0x013C
+	tagCopyright        = 0x8298
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagUserComment      = 0x9286
+	tagMakerNote        = 0x927C
+	tagXPComment        = 0x9C9C
+	tagXPAuthor         = 0x9C9D
+	tagInteropIFD       = 0xA005
+	tagImageUniqueID    = 0xA420
+	tagCameraOwnerName  = 0xA430
+	tagBodySerialNumber = 0xA431
+	tagLensSerialNumber = 0xA435
+)
+
+// privateTags - теги, по которым можно установить владельца или устройство
+var privateTags = map[uint16]bool{
+	tagImageDescription: true,
+	tagArtist:           true,
+	tagHostComputer:     true,
+	tagUserComment:      true,
+	tagMakerNote:        true,
+	tagXPComment:        true,
+	tagXPAuthor:         true,
+	tagImageUniqueID:    true,
+	tagCameraOwnerName:  true,
+	tagBodySerialNumber: true,
+	tagLensSerialNumber: true,
+}
+
+var (
+	exifHeader    = []byte("Exif\x00\x00")
+	xmpHeader     = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtHeader  = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	iccHeader     = []byte("ICC_PROFILE\x00")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	xmpPNGKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+// StripMetadata удаляет метаданные изображения согласно opts. Для JPEG, PNG и
+// WebP метаданные фильтруются без перекодирования пикселей, поэтому ICC-профиль
+// и copyright можно сохранить. Для остальных форматов используется полное
+// удаление метаданных средствами libvips.
+func StripMetadata(file []byte, opts StripOptions) ([]byte, error) {
+	switch opts.Level {
+	case StripNone:
+		return file, nil
+	case StripGPS, StripPrivate, StripAll:
+	default:
+		return nil, fmt.Errorf("неизвестный уровень удаления метаданных %q", opts.Level)
+	}
+
+	switch {
+	case len(file) > 3 && file[0] == 0xFF && file[1] == 0xD8:
+		return stripJPEG(file, opts)
+	case bytes.HasPrefix(file, pngSignature):
+		return stripPNG(file, opts)
+	case len(file) > 12 && string(file[0:4]) == "RIFF" && string(file[8:12]) == "WEBP":
+		return stripWebP(file, opts)
+	}
+
+	log.Printf("Формат без поддержки выборочной очистки, удаляем все метаданные средствами libvips")
+	newImage, err := bimg.NewImage(file).Process(bimg.Options{
+		StripMetadata: true,
+		Quality:       90,
+		NoAutoRotate:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка удаления метаданных: %v", err)
+	}
+	return newImage, nil
+}
+
+// stripJPEG фильтрует APP-сегменты JPEG до начала данных изображения (SOS).
+func stripJPEG(file []byte, opts StripOptions) ([]byte, error) {
+	segments, scan, err := splitJPEG(file)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(file))
+	out = append(out, 0xFF, 0xD8)
+	for _, segment := range segments {
+		marker, payload := segment.marker, segment.payload
+
+		switch {
+		case segment.standalone:
+			out = appendJPEGSegment(out, segment)
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+			tiff, err := sanitizeTIFF(payload[len(exifHeader):], opts)
+			if err != nil {
+				// Нечитаемый EXIF безопаснее удалить целиком
+				log.Printf("Не удалось разобрать EXIF, сегмент удален: %v", err)
+				continue
+			}
+			if tiff != nil {
+				segment.payload = append(append([]byte{}, exifHeader...), tiff...)
+				out = appendJPEGSegment(out, segment)
+			}
+		case marker == 0xE1 && (bytes.HasPrefix(payload, xmpHeader) || bytes.HasPrefix(payload, xmpExtHeader)):
+			// XMP может содержать и координаты, и автора - удаляем на любом уровне
+		case marker == 0xE2 && bytes.HasPrefix(payload, iccHeader):
+			if opts.Level != StripAll || opts.KeepICC {
+				out = appendJPEGSegment(out, segment)
+			}
+		case marker == 0xED || marker == 0xFE:
+			// APP13 (Photoshop/IPTC) и комментарии
+			if opts.Level == StripGPS {
+				out = appendJPEGSegment(out, segment)
+			}
+		case marker == 0xE0 || marker == 0xEE:
+			// JFIF и Adobe нужны декодерам
+			out = appendJPEGSegment(out, segment)
+		case marker >= 0xE1 && marker <= 0xEF:
+			// Прочие APP-сегменты производителей
+			if opts.Level != StripAll {
+				out = appendJPEGSegment(out, segment)
+			}
+		default:
+			out = appendJPEGSegment(out, segment)
+		}
+	}
+	// Сжатые данные копируем как есть
+	return append(out, scan...), nil
+}
+
+// stripPNG фильтрует вспомогательные чанки PNG.
+func stripPNG(file []byte, opts StripOptions) ([]byte, error) {
+	chunks, err := splitPNG(file)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(file))
+	out = append(out, pngSignature...)
+	for _, chunk := range chunks {
+		keep := true
+		switch chunk.typ {
+		case "eXIf":
+			tiff, err := sanitizeTIFF(chunk.data, opts)
+			if err != nil {
+				log.Printf("Не удалось разобрать EXIF, чанк удален: %v", err)
+			}
+			chunk.data, keep = tiff, tiff != nil
+		case "iTXt":
+			keep = opts.Level == StripGPS && !bytes.HasPrefix(chunk.data, xmpPNGKeyword)
+		case "tEXt", "zTXt":
+			keep = opts.Level == StripGPS
+		case "iCCP":
+			keep = opts.Level != StripAll || opts.KeepICC
+		case "tIME":
+			keep = opts.Level != StripAll
+		}
+		if keep {
+			out = appendPNGChunk(out, chunk.typ, chunk.data)
+		}
+	}
+	return out, nil
+}
+
+// Флаги чанка VP8X о наличии метаданных
+const (
+	webpFlagICC  = 0x20
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebP фильтрует чанки EXIF, XMP и ICCP расширенного формата WebP (VP8X).
+func stripWebP(file []byte, opts StripOptions) ([]byte, error) {
+	chunks, err := splitWebP(file)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 12, len(file))
+	copy(out, file[:12])
+
+	vp8xFlags := -1
+	var flags byte
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "EXIF":
+			tiff, err := sanitizeTIFF(bytes.TrimPrefix(chunk.data, exifHeader), opts)
+			if err != nil {
+				log.Printf("Не удалось разобрать EXIF, чанк удален: %v", err)
+				continue
+			}
+			if tiff != nil {
+				out = appendRIFFChunk(out, chunk.fourCC, tiff)
+				flags |= webpFlagEXIF
+			}
+		case "XMP ":
+		case "ICCP":
+			if opts.Level != StripAll || opts.KeepICC {
+				out = appendRIFFChunk(out, chunk.fourCC, chunk.data)
+				flags |= webpFlagICC
+			}
+		case "VP8X":
+			vp8xFlags = len(out) + 8
+			out = appendRIFFChunk(out, chunk.fourCC, chunk.data)
+		default:
+			out = appendRIFFChunk(out, chunk.fourCC, chunk.data)
+		}
+	}
+
+	if vp8xFlags >= 0 {
+		out[vp8xFlags] = out[vp8xFlags]&^(webpFlagICC|webpFlagEXIF|webpFlagXMP) | flags
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// byteOrder - порядок байт TIFF ("II" или "MM")
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffByteOrder определяет порядок байт по заголовку TIFF.
+func tiffByteOrder(tiff []byte) (byteOrder, error) {
+	if len(tiff) < 8 {
+		return nil, errors.New("слишком короткий заголовок TIFF")
+	}
+	switch string(tiff[0:2]) {
+	case "II":
+		return binary.LittleEndian, nil
+	case "MM":
+		return binary.BigEndian, nil
+	}
+	return nil, errors.New("неизвестный порядок байт TIFF")
+}
+
+// tiffEntry - запись IFD; value хранится в исходном порядке байт.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// sanitizeTIFF собирает EXIF (TIFF) заново только из разрешенных тегов.
+// Структура строится с нуля, поэтому удаленные значения не остаются в файле
+// «висящими» байтами. Возвращает nil, если сохранять нечего. Миниатюра
+// (IFD1) отбрасывается всегда: она могла быть сделана до обработки.
+func sanitizeTIFF(tiff []byte, opts StripOptions) ([]byte, error) {
+	order, err := tiffByteOrder(tiff)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, err := readIFD(tiff, order.Uint32(tiff[4:8]), order)
+	if err != nil {
+		return nil, err
+	}
+
+	var exif []tiffEntry
+	for _, entry := range ifd0 {
+		if entry.tag != tagExifIFD {
+			continue
+		}
+		if len(entry.value) != 4 {
+			return nil, errors.New("некорректный указатель на Exif IFD")
+		}
+		exif, err = readIFD(tiff, order.Uint32(entry.value), order)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keep := func(tag uint16) bool {
+		switch {
+		case tag == tagExifIFD || tag == tagGPSIFD || tag == tagInteropIFD:
+			// Указатели пересоздаются при сборке
+			return false
+		case tag == tagCopyright:
+			return opts.Level != StripAll || opts.KeepCopyright
+		case opts.Level == StripAll:
+			return false
+		case opts.Level == StripPrivate:
+			return !privateTags[tag]
+		}
+		return true
+	}
+
+	// GPS IFD удаляется на любом уровне
+	ifd0 = filterEntries(ifd0, keep)
+	exif = filterEntries(exif, keep)
+
+	if len(ifd0) == 0 && len(exif) == 0 {
+		return nil, nil
+	}
+	return buildTIFF(order, ifd0, exif), nil
+}
+
+// tiffTypeSizes - размер одного значения для типов TIFF
+var tiffTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+func readIFD(tiff []byte, offset uint32, order byteOrder) ([]tiffEntry, error) {
+	off := int(offset)
+	if off < 8 || off+2 > len(tiff) {
+		return nil, fmt.Errorf("смещение IFD %d вне данных", offset)
+	}
+	count := int(order.Uint16(tiff[off:]))
+	if off+2+count*12 > len(tiff) {
+		return nil, errors.New("IFD обрезан")
+	}
+
+	entries := make([]tiffEntry, 0, count)
+	for i := 0; i < count; i++ {
+		raw := tiff[off+2+i*12 : off+2+(i+1)*12]
+		entry := tiffEntry{
+			tag:   order.Uint16(raw[0:]),
+			typ:   order.Uint16(raw[2:]),
+			count: order.Uint32(raw[4:]),
+		}
+		typeSize, ok := tiffTypeSizes[entry.typ]
+		if !ok {
+			// Неизвестный тип не сможем корректно перенести
+			continue
+		}
+		size := typeSize * int(entry.count)
+		if size <= 4 {
+			entry.value = append([]byte{}, raw[8:8+size]...)
+		} else {
+			valueOff := int(order.Uint32(raw[8:]))
+			if valueOff < 0 || valueOff+size > len(tiff) {
+				continue
+			}
+			entry.value = append([]byte{}, tiff[valueOff:valueOff+size]...)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func filterEntries(entries []tiffEntry, keep func(tag uint16) bool) []tiffEntry {
+	var kept []tiffEntry
+	for _, entry := range entries {
+		if keep(entry.tag) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// buildTIFF сериализует IFD0 с вложенным Exif IFD.
+func buildTIFF(order byteOrder, ifd0, exif []tiffEntry) []byte {
+	out := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(out, "II")
+	} else {
+		copy(out, "MM")
+	}
+	order.PutUint16(out[2:], 42)
+
+	pointer := func(tag uint16, offset int) tiffEntry {
+		value := make([]byte, 4)
+		order.PutUint32(value, uint32(offset))
+		return tiffEntry{tag: tag, typ: 4, count: 1, value: value}
+	}
+
+	root := append([]tiffEntry{}, ifd0...)
+	if len(exif) > 0 {
+		var offset int
+		out, offset = writeIFD(out, exif, order)
+		root = append(root, pointer(tagExifIFD, offset))
+	}
+
+	out, rootOffset := writeIFD(out, root, order)
+	order.PutUint32(out[4:], uint32(rootOffset))
+	return out
+}
+
+// writeIFD дописывает IFD и его внешние значения в конец out.
+func writeIFD(out []byte, entries []tiffEntry, order byteOrder) ([]byte, int) {
+	sorted := append([]tiffEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].tag < sorted[j].tag })
+
+	if len(out)%2 == 1 {
+		out = append(out, 0)
+	}
+	offset := len(out)
+	dataOffset := offset + 2 + 12*len(sorted) + 4
+
+	var data []byte
+	out = order.AppendUint16(out, uint16(len(sorted)))
+	for _, entry := range sorted {
+		out = order.AppendUint16(out, entry.tag)
+		out = order.AppendUint16(out, entry.typ)
+		out = order.AppendUint32(out, entry.count)
+		if len(entry.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], entry.value)
+			out = append(out, inline[:]...)
+			continue
+		}
+		out = order.AppendUint32(out, uint32(dataOffset+len(data)))
+		data = append(data, entry.value...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	// Следующего IFD нет: миниатюру не переносим
+	out = order.AppendUint32(out, 0)
+	return append(out, data...), offset
+}
@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// exifFixture собирает EXIF с камерой, автором, copyright, серийным номером и GPS
+func exifFixture(t *testing.T) []byte {
+	t.Helper()
+	order := binary.LittleEndian
+	ascii := func(tag uint16, s string) tiffEntry {
+		v := append([]byte(s), 0)
+		return tiffEntry{tag: tag, typ: 2, count: uint32(len(v)), value: v}
+	}
+
+	out := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	exposure := make([]byte, 8)
+	order.PutUint32(exposure, 1)
+	order.PutUint32(exposure[4:], 250)
+	out, exifOffset := writeIFD(out, []tiffEntry{
+		{tag: 0x829A, typ: 5, count: 1, value: exposure},
+		ascii(tagBodySerialNumber, "SN1234567"),
+	}, order)
+	out, gpsOffset := writeIFD(out, []tiffEntry{
+		{tag: 0x001C, typ: 7, count: 12, value: []byte("SECRET-PLACE")},
+	}, order)
+
+	pointer := func(tag uint16, offset int) tiffEntry {
+		v := make([]byte, 4)
+		order.PutUint32(v, uint32(offset))
+		return tiffEntry{tag: tag, typ: 4, count: 1, value: v}
+	}
+	out, rootOffset := writeIFD(out, []tiffEntry{
+		ascii(0x010F, "CameraMaker"),
+		ascii(tagArtist, "John Doe"),
+		ascii(tagCopyright, "ACME Corp"),
+		pointer(tagExifIFD, exifOffset),
+		pointer(tagGPSIFD, gpsOffset),
+	}, order)
+	order.PutUint32(out[4:], uint32(rootOffset))
+	return out
+}
+
+func rawSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func jpegFixture(t *testing.T) []byte {
+	data := []byte{0xFF, 0xD8}
+	data = append(data, rawSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))...)
+	data = append(data, rawSegment(0xE1, append(append([]byte{}, exifHeader...), exifFixture(t)...))...)
+	data = append(data, rawSegment(0xE1, append(append([]byte{}, xmpHeader...), "<x:xmpmeta>GPSLatitude</x:xmpmeta>"...))...)
+	data = append(data, rawSegment(0xE2, append(append([]byte{}, iccHeader...), "\x01\x01profile"...))...)
+	data = append(data, rawSegment(0xFE, []byte("shot by John"))...)
+	data = append(data, 0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9)
+	return data
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    StripOptions
+		present []string
+		absent  []string
+	}{
+		{
+			name:    "gps",
+			opts:    StripOptions{Level: StripGPS},
+			present: []string{"CameraMaker", "John Doe", "ACME Corp", "SN1234567", "ICC_PROFILE", "shot by John"},
+			absent:  []string{"SECRET-PLACE", "GPSLatitude"},
+		},
+		{
+			name:    "private",
+			opts:    StripOptions{Level: StripPrivate},
+			present: []string{"CameraMaker", "ACME Corp", "ICC_PROFILE"},
+			absent:  []string{"SECRET-PLACE", "GPSLatitude", "John Doe", "SN1234567", "shot by John"},
+		},
+		{
+			name:    "all keeping icc and copyright",
+			opts:    StripOptions{Level: StripAll, KeepICC: true, KeepCopyright: true},
+			present: []string{"ACME Corp", "ICC_PROFILE", "JFIF"},
+			absent:  []string{"CameraMaker", "SECRET-PLACE", "John Doe", "SN1234567"},
+		},
+		{
+			name:    "all",
+			opts:    StripOptions{Level: StripAll},
+			present: []string{"JFIF"},
+			absent:  []string{"Exif", "ACME Corp", "ICC_PROFILE", "shot by John"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := StripMetadata(jpegFixture(t), tt.opts)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for _, s := range tt.present {
+				if !bytes.Contains(result, []byte(s)) {
+					t.Errorf("Expected %q to be kept", s)
+				}
+			}
+			for _, s := range tt.absent {
+				if bytes.Contains(result, []byte(s)) {
+					t.Errorf("Expected %q to be removed", s)
+				}
+			}
+			if !bytes.HasSuffix(result, []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9}) {
+				t.Error("Expected image data to be copied unchanged")
+			}
+		})
+	}
+}
+
+func TestSanitizeTIFF_Structure(t *testing.T) {
+	tiff, err := sanitizeTIFF(exifFixture(t), StripOptions{Level: StripPrivate})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	order := binary.LittleEndian
+	ifd0, err := readIFD(tiff, order.Uint32(tiff[4:]), order)
+	if err != nil {
+		t.Fatalf("Expected valid IFD0, got %v", err)
+	}
+
+	var exifOffset uint32
+	for _, entry := range ifd0 {
+		switch entry.tag {
+		case tagGPSIFD, tagArtist:
+			t.Errorf("Expected tag 0x%04X to be removed", entry.tag)
+		case tagExifIFD:
+			exifOffset = order.Uint32(entry.value)
+		}
+	}
+	if exifOffset == 0 {
+		t.Fatal("Expected Exif IFD pointer to be kept")
+	}
+
+	exif, err := readIFD(tiff, exifOffset, order)
+	if err != nil {
+		t.Fatalf("Expected valid Exif IFD, got %v", err)
+	}
+	if len(exif) != 1 || exif[0].tag != 0x829A || order.Uint32(exif[0].value[4:]) != 250 {
+		t.Errorf("Expected only ExposureTime 1/250 in Exif IFD, got %v", exif)
+	}
+
+	if _, err := sanitizeTIFF([]byte("garbage!"), StripOptions{Level: StripGPS}); err == nil {
+		t.Error("Expected error for invalid TIFF header")
+	}
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	data := append([]byte{}, pngSignature...)
+	data = appendPNGChunk(data, "IHDR", make([]byte, 13))
+	data = appendPNGChunk(data, "iCCP", []byte("icc\x00\x00profile"))
+	data = appendPNGChunk(data, "eXIf", exifFixture(t))
+	data = appendPNGChunk(data, "tEXt", []byte("Author\x00John Doe"))
+	data = appendPNGChunk(data, "IDAT", []byte("pixels"))
+	data = appendPNGChunk(data, "IEND", nil)
+
+	result, err := StripMetadata(data, StripOptions{Level: StripPrivate})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, s := range []string{"SECRET-PLACE", "John Doe"} {
+		if bytes.Contains(result, []byte(s)) {
+			t.Errorf("Expected %q to be removed", s)
+		}
+	}
+	for _, s := range []string{"iCCP", "ACME Corp", "pixels", "IEND"} {
+		if !bytes.Contains(result, []byte(s)) {
+			t.Errorf("Expected %q to be kept", s)
+		}
+	}
+
+	// CRC переписанного чанка eXIf должен быть корректным
+	pos := bytes.Index(result, []byte("eXIf")) - 4
+	length := int(binary.BigEndian.Uint32(result[pos:]))
+	crc := binary.BigEndian.Uint32(result[pos+8+length:])
+	if crc != crc32.ChecksumIEEE(result[pos+4:pos+8+length]) {
+		t.Error("Expected valid CRC for rewritten eXIf chunk")
+	}
+}
+
+func TestStripMetadata_WebP(t *testing.T) {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	data = appendRIFFChunk(data, "VP8X", []byte{0x20 | 0x08 | 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	data = appendRIFFChunk(data, "ICCP", []byte("profile"))
+	data = appendRIFFChunk(data, "VP8 ", []byte("bitstream"))
+	data = appendRIFFChunk(data, "EXIF", exifFixture(t))
+	data = appendRIFFChunk(data, "XMP ", []byte("<x:xmpmeta/>"))
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	result, err := StripMetadata(data, StripOptions{Level: StripAll})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, s := range []string{"ICCP", "EXIF", "XMP "} {
+		if bytes.Contains(result, []byte(s)) {
+			t.Errorf("Expected chunk %q to be removed", s)
+		}
+	}
+	if !bytes.Contains(result, []byte("bitstream")) {
+		t.Error("Expected image bitstream to be kept")
+	}
+	if flags := result[20]; flags != 0 {
+		t.Errorf("Expected VP8X metadata flags to be cleared, got %08b", flags)
+	}
+	if size := binary.LittleEndian.Uint32(result[4:]); int(size) != len(result)-8 {
+		t.Errorf("Expected RIFF size %d, got %d", len(result)-8, size)
+	}
+}
+
+func TestStripMetadata_InvalidLevel(t *testing.T) {
+	if _, err := StripMetadata([]byte{0xFF, 0xD8, 0xFF, 0xD9}, StripOptions{Level: "exif"}); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+
+	data := []byte("not an image")
+	result, err := StripMetadata(data, StripOptions{Level: StripNone})
+	if err != nil || !bytes.Equal(result, data) {
+		t.Errorf("Expected data unchanged for level none, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/h2non/bimg"
+)
+
+// AutoOrient поворачивает изображение согласно тегу EXIF Orientation
+// и сбрасывает тег, чтобы просмотрщики не повернули его повторно.
+func AutoOrient(file []byte) ([]byte, error) {
+	img := bimg.NewImage(file)
+	meta, err := img.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать метаданные изображения: %v", err)
+	}
+
+	// Orientation 0/1 - изображение уже в нормальной ориентации
+	if meta.Orientation <= 1 {
+		return file, nil
+	}
+
+	log.Printf("Автоповорот изображения по EXIF (orientation=%d)", meta.Orientation)
+
+	newImage, err := img.AutoRotate()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка автоповорота: %v", err)
+	}
+	return newImage, nil
+}
+
+// RotateImage поворачивает изображение по часовой стрелке на angle градусов.
+// Углы, кратные 90, обрабатываются libvips без потерь; для произвольного угла
+// холст расширяется до описанного прямоугольника и заливается цветом background.
+func RotateImage(file []byte, angle float64, background bimg.Color) ([]byte, error) {
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+
+	if angle == 0 {
+		return file, nil
+	}
+
+	if math.Mod(angle, 90) == 0 {
+		newImage, err := bimg.NewImage(file).Process(bimg.Options{
+			Rotate:       bimg.Angle(angle),
+			Quality:      90,
+			NoAutoRotate: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка поворота: %v", err)
+		}
+		return newImage, nil
+	}
+
+	pixels, imageType, err := decodePixels(file)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Поворот изображения %dx%d на %.2f°", pixels.Rect.Dx(), pixels.Rect.Dy(), angle)
+
+	bg := color.NRGBA{R: background.R, G: background.G, B: background.B, A: 255}
+	return encodePixels(rotatePixels(pixels, angle, bg), imageType)
+}
+
+// FlipImage отражает изображение по вертикали (сверху вниз).
+func FlipImage(file []byte) ([]byte, error) {
+	// В bimg направления названы наоборот: Flop отражает по вертикали
+	newImage, err := bimg.NewImage(file).Process(bimg.Options{
+		Flop:         true,
+		Quality:      90,
+		NoAutoRotate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка отражения: %v", err)
+	}
+	return newImage, nil
+}
+
+// FlopImage отражает изображение по горизонтали (зеркально слева направо).
+func FlopImage(file []byte) ([]byte, error) {
+	newImage, err := bimg.NewImage(file).Process(bimg.Options{
+		Flip:         true,
+		Quality:      90,
+		NoAutoRotate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка отражения: %v", err)
+	}
+	return newImage, nil
+}
+
+// ParseColor разбирает цвет в формате "rrggbb" или "#rrggbb".
+func ParseColor(s string) (bimg.Color, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return bimg.Color{}, fmt.Errorf("некорректный цвет %q: ожидается rrggbb", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return bimg.Color{}, fmt.Errorf("некорректный цвет %q: %v", s, err)
+	}
+	return bimg.Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
+
+// rotatePixels поворачивает изображение по часовой стрелке с билинейной интерполяцией.
+func rotatePixels(src *image.NRGBA, angle float64, bg color.NRGBA) *image.NRGBA {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	srcW, srcH := float64(src.Rect.Dx()), float64(src.Rect.Dy())
+	// Эпсилон отбрасывает погрешность sin/cos для углов, кратных 90
+	dstW := int(math.Ceil(math.Abs(srcW*cos) + math.Abs(srcH*sin) - 1e-9))
+	dstH := int(math.Ceil(math.Abs(srcW*sin) + math.Abs(srcH*cos) - 1e-9))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	srcCX, srcCY := srcW/2, srcH/2
+	dstCX, dstCY := float64(dstW)/2, float64(dstH)/2
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			// Обратное преобразование: ищем точку исходника для пикселя результата
+			dx := float64(x) + 0.5 - dstCX
+			dy := float64(y) + 0.5 - dstCY
+			sx := dx*cos + dy*sin + srcCX - 0.5
+			sy := -dx*sin + dy*cos + srcCY - 0.5
+			dst.SetNRGBA(x, y, sampleBilinear(src, sx, sy, bg))
+		}
+	}
+	return dst
+}
+
+// sampleBilinear возвращает цвет в дробной точке исходника; точки за его
+// пределами смешиваются с цветом фона.
+func sampleBilinear(src *image.NRGBA, x, y float64, bg color.NRGBA) color.NRGBA {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	pixel := func(px, py int) [4]float64 {
+		if px < 0 || py < 0 || px >= src.Rect.Dx() || py >= src.Rect.Dy() {
+			return [4]float64{float64(bg.R), float64(bg.G), float64(bg.B), float64(bg.A)}
+		}
+		c := src.NRGBAAt(px, py)
+		return [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+	}
+
+	p00, p10 := pixel(x0, y0), pixel(x0+1, y0)
+	p01, p11 := pixel(x0, y0+1), pixel(x0+1, y0+1)
+
+	var out [4]uint8
+	for i := 0; i < 4; i++ {
+		top := p00[i]*(1-fx) + p10[i]*fx
+		bottom := p01[i]*(1-fx) + p11[i]*fx
+		out[i] = uint8(math.Round(top*(1-fy) + bottom*fy))
+	}
+	return color.NRGBA{R: out[0], G: out[1], B: out[2], A: out[3]}
+}
@@ -0,0 +1,212 @@
+package processor
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+// paletteIterations - число итераций k-means
+const paletteIterations = 10
+
+// ColorProfile извлекает палитру из domain.PaletteSize цветов с долями
+// и грубую RGB-гистограмму изображения. Прозрачные пиксели не учитываются.
+func ColorProfile(file []byte) (*domain.ColorProfile, error) {
+	img, err := smallPixels(file)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.ColorProfile{
+		Palette:   palette(img, domain.PaletteSize),
+		Histogram: histogram(img, domain.HistogramBins),
+	}, nil
+}
+
+// labPixel - непрозрачный пиксель в Lab вместе с исходным цветом
+type labPixel struct {
+	lab [3]float64
+	rgb domain.RGB
+}
+
+// palette кластеризует цвета методом k-means в пространстве Lab.
+// Начальные центры - самые частые группы цветов, достаточно далекие
+// друг от друга, поэтому результат детерминирован.
+func palette(img *image.NRGBA, k int) []domain.PaletteColor {
+	pixels := opaquePixels(img)
+	if len(pixels) == 0 {
+		return []domain.PaletteColor{}
+	}
+
+	centers := initialCenters(pixels, k)
+	assignment := make([]int, len(pixels))
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	for iteration := 0; iteration < paletteIterations; iteration++ {
+		changed := false
+		for i, p := range pixels {
+			if nearest := nearestCenter(p.lab, centers); nearest != assignment[i] {
+				assignment[i] = nearest
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([][3]float64, len(centers))
+		counts := make([]int, len(centers))
+		for i, p := range pixels {
+			c := assignment[i]
+			for j := range sums[c] {
+				sums[c][j] += p.lab[j]
+			}
+			counts[c]++
+		}
+		for c := range centers {
+			if counts[c] == 0 {
+				continue
+			}
+			for j := range centers[c] {
+				centers[c][j] = sums[c][j] / float64(counts[c])
+			}
+		}
+	}
+
+	// Цвет кластера - средний sRGB его пикселей
+	type cluster struct {
+		r, g, b, count int
+	}
+	clusters := make([]cluster, len(centers))
+	for i, p := range pixels {
+		c := &clusters[assignment[i]]
+		c.r += int(p.rgb.R)
+		c.g += int(p.rgb.G)
+		c.b += int(p.rgb.B)
+		c.count++
+	}
+
+	result := make([]domain.PaletteColor, 0, len(clusters))
+	for _, c := range clusters {
+		if c.count == 0 {
+			continue
+		}
+		rgb := domain.RGB{R: uint8(c.r / c.count), G: uint8(c.g / c.count), B: uint8(c.b / c.count)}
+		share := float64(c.count) / float64(len(pixels))
+		result = append(result, domain.PaletteColor{Color: rgb.Hex(), Share: math.Round(share*1000) / 1000})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Share > result[j].Share
+	})
+	return result
+}
+
+func opaquePixels(img *image.NRGBA) []labPixel {
+	var pixels []labPixel
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			if row[4*x+3] < 128 {
+				continue
+			}
+			rgb := domain.RGB{R: row[4*x], G: row[4*x+1], B: row[4*x+2]}
+			l, a, b := rgb.Lab()
+			pixels = append(pixels, labPixel{lab: [3]float64{l, a, b}, rgb: rgb})
+		}
+	}
+	return pixels
+}
+
+// initialCenters выбирает до k центров среди групп цветов (по 4 старших
+// бита канала) в порядке убывания частоты, пропуская близкие к уже выбранным.
+func initialCenters(pixels []labPixel, k int) [][3]float64 {
+	type group struct {
+		key   int
+		count int
+		sum   [3]float64
+	}
+	groups := make(map[int]*group)
+	for _, p := range pixels {
+		key := int(p.rgb.R>>4)<<8 | int(p.rgb.G>>4)<<4 | int(p.rgb.B>>4)
+		g := groups[key]
+		if g == nil {
+			g = &group{key: key}
+			groups[key] = g
+		}
+		g.count++
+		for j := range g.sum {
+			g.sum[j] += p.lab[j]
+		}
+	}
+
+	ordered := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		ordered = append(ordered, g)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].count != ordered[j].count {
+			return ordered[i].count > ordered[j].count
+		}
+		return ordered[i].key < ordered[j].key
+	})
+
+	// Сначала берем только заметно различающиеся цвета, затем любые
+	var centers [][3]float64
+	for _, minDistance := range []float64{domain.DefaultColorDistance, 0} {
+		for _, g := range ordered {
+			if len(centers) == k {
+				return centers
+			}
+			var center [3]float64
+			for j := range center {
+				center[j] = g.sum[j] / float64(g.count)
+			}
+			if len(centers) > 0 && labDistance(center, centers[nearestCenter(center, centers)]) <= minDistance {
+				continue
+			}
+			centers = append(centers, center)
+		}
+	}
+	return centers
+}
+
+func nearestCenter(lab [3]float64, centers [][3]float64) int {
+	best, bestDistance := 0, math.Inf(1)
+	for i, c := range centers {
+		if d := labDistance(lab, c); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best
+}
+
+// labDistance - ΔE по формуле CIE76
+func labDistance(a, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
+
+// histogram считает доли непрозрачных пикселей в bins^3 интервалах RGB
+func histogram(img *image.NRGBA, bins int) []float64 {
+	result := make([]float64, bins*bins*bins)
+	step := 256 / bins
+	var total int
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			if row[4*x+3] < 128 {
+				continue
+			}
+			r, g, b := int(row[4*x])/step, int(row[4*x+1])/step, int(row[4*x+2])/step
+			result[r*bins*bins+g*bins+b]++
+			total++
+		}
+	}
+	if total > 0 {
+		for i := range result {
+			result[i] = math.Round(result[i]/float64(total)*10000) / 10000
+		}
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+// stripes - изображение из горизонтальных полос заданной высоты
+func stripes(width int, colors []color.NRGBA, heights []int) *image.NRGBA {
+	total := 0
+	for _, h := range heights {
+		total += h
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, total))
+	y := 0
+	for i, h := range heights {
+		for end := y + h; y < end; y++ {
+			for x := 0; x < width; x++ {
+				img.SetNRGBA(x, y, colors[i])
+			}
+		}
+	}
+	return img
+}
+
+func TestPalette(t *testing.T) {
+	img := stripes(10,
+		[]color.NRGBA{{R: 255, A: 255}, {B: 255, A: 255}, {R: 250, G: 250, B: 250, A: 255}, {A: 0}},
+		[]int{6, 3, 1, 5},
+	)
+
+	got := palette(img, domain.PaletteSize)
+
+	expected := []domain.PaletteColor{
+		{Color: "#ff0000", Share: 0.6},
+		{Color: "#0000ff", Share: 0.3},
+		{Color: "#fafafa", Share: 0.1},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected palette %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected color %d to be %v, got %v", i, expected[i], got[i])
+		}
+	}
+
+	if empty := palette(solidImage(4, 4, color.NRGBA{}), domain.PaletteSize); len(empty) != 0 {
+		t.Errorf("Expected empty palette for transparent image, got %v", empty)
+	}
+}
+
+func TestPalette_MergesSimilarShades(t *testing.T) {
+	img := stripes(10,
+		[]color.NRGBA{{R: 200, A: 255}, {R: 204, A: 255}, {G: 200, A: 255}},
+		[]int{5, 4, 1},
+	)
+
+	got := palette(img, 2)
+
+	if len(got) != 2 || got[0].Share != 0.9 || got[1].Color != "#00c800" {
+		t.Errorf("Expected two reds to form one cluster, got %v", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	img := stripes(4,
+		[]color.NRGBA{{R: 255, A: 255}, {R: 10, G: 10, B: 200, A: 255}},
+		[]int{3, 1},
+	)
+
+	got := histogram(img, domain.HistogramBins)
+
+	if len(got) != 64 {
+		t.Fatalf("Expected 64 bins, got %d", len(got))
+	}
+	// Красный: r=3, g=0, b=0; синий: r=0, g=0, b=3
+	if got[3*16] != 0.75 || got[3] != 0.25 {
+		t.Errorf("Expected shares 0.75 and 0.25, got %v and %v", got[3*16], got[3])
+	}
+}
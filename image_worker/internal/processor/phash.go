@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/h2non/bimg"
+)
+
+// phashSize - сторона уменьшенного изображения, к которому применяется DCT
+const phashSize = 32
+
+// phashBlock - сторона блока низких частот, из которого строится хеш
+const phashBlock = 8
+
+// PerceptualHash вычисляет 64-битный перцептивный хеш (pHash). Изображение
+// уменьшается до 32x32 в оттенках серого, к нему применяется DCT, и каждый
+// коэффициент блока низких частот 8x8 сравнивается с медианой.
+// Похожие изображения дают хеши с малым расстоянием Хэмминга.
+func PerceptualHash(file []byte) (uint64, error) {
+	// Ориентацию по EXIF применяем, чтобы фото с тегом поворота и
+	// физически повернутая копия давали одинаковый хеш
+	small, err := bimg.NewImage(file).Process(bimg.Options{
+		Width:          phashSize,
+		Height:         phashSize,
+		Force:          true,
+		Interpretation: bimg.InterpretationBW,
+		Type:           bimg.PNG,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка уменьшения изображения для хеша: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(small))
+	if err != nil {
+		return 0, fmt.Errorf("ошибка декодирования изображения для хеша: %v", err)
+	}
+	return hashGray(grayMatrix(img)), nil
+}
+
+// HammingDistance - число различающихся битов двух хешей
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayMatrix переводит изображение phashSize x phashSize в матрицу яркостей.
+func grayMatrix(img image.Image) [phashSize][phashSize]float64 {
+	var gray [phashSize][phashSize]float64
+	b := img.Bounds()
+	for y := 0; y < phashSize && y < b.Dy(); y++ {
+		for x := 0; x < phashSize && x < b.Dx(); x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			gray[y][x] = luma(float64(r>>8), float64(g>>8), float64(bl>>8))
+		}
+	}
+	return gray
+}
+
+// hashGray строит хеш по матрице яркостей.
+func hashGray(gray [phashSize][phashSize]float64) uint64 {
+	// DCT-II раздельно: сначала по строкам, затем по столбцам,
+	// только для нужных phashBlock низких частот
+	var cosines [phashBlock][phashSize]float64
+	for u := 0; u < phashBlock; u++ {
+		for x := 0; x < phashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+
+	var rows [phashSize][phashBlock]float64
+	for y := 0; y < phashSize; y++ {
+		for v := 0; v < phashBlock; v++ {
+			var sum float64
+			for x := 0; x < phashSize; x++ {
+				sum += gray[y][x] * cosines[v][x]
+			}
+			rows[y][v] = sum
+		}
+	}
+
+	coeffs := make([]float64, 0, phashBlock*phashBlock)
+	for u := 0; u < phashBlock; u++ {
+		for v := 0; v < phashBlock; v++ {
+			var sum float64
+			for y := 0; y < phashSize; y++ {
+				sum += rows[y][v] * cosines[u][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	// Постоянная составляющая (DC) отражает среднюю яркость и в медиану не входит
+	ac := append([]float64{}, coeffs[1:]...)
+	sort.Float64s(ac)
+	median := ac[len(ac)/2]
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+// scene строит плавное изображение; contrast и brightness имитируют
+// коррекцию экспозиции
+func scene(contrast, brightness float64) [phashSize][phashSize]float64 {
+	var gray [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		for x := 0; x < phashSize; x++ {
+			v := 100 + 60*math.Sin(float64(x)*0.3)*math.Cos(float64(y)*0.2) + float64(x+y)
+			gray[y][x] = v*contrast + brightness
+		}
+	}
+	return gray
+}
+
+func checkerboard() [phashSize][phashSize]float64 {
+	var gray [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		for x := 0; x < phashSize; x++ {
+			if (x/4+y/4)%2 == 0 {
+				gray[y][x] = 255
+			}
+		}
+	}
+	return gray
+}
+
+func TestHashGray(t *testing.T) {
+	base := hashGray(scene(1, 0))
+
+	if distance := HammingDistance(base, hashGray(scene(1, 0))); distance != 0 {
+		t.Errorf("Expected distance 0 for identical images, got %d", distance)
+	}
+	if distance := HammingDistance(base, hashGray(scene(0.8, 40))); distance > domain.DefaultDuplicateDistance {
+		t.Errorf("Expected small distance for brightened image, got %d", distance)
+	}
+	if distance := HammingDistance(base, hashGray(checkerboard())); distance <= domain.DefaultDuplicateDistance {
+		t.Errorf("Expected large distance for different image, got %d", distance)
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b     uint64
+		expected int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xFF, 0x0F, 4},
+		{0, ^uint64(0), 64},
+	}
+
+	for _, tt := range tests {
+		if got := HammingDistance(tt.a, tt.b); got != tt.expected {
+			t.Errorf("HammingDistance(%x, %x): expected %d, got %d", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
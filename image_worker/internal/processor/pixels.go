@@ -0,0 +1,71 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"github.com/h2non/bimg"
+)
+
+// decodePixels декодирует изображение в image.NRGBA для попиксельных операций,
+// которых нет в libvips/bimg. Исходник сначала перекодируется libvips в PNG,
+// поэтому поддерживаются все входные форматы libvips.
+func decodePixels(file []byte) (*image.NRGBA, bimg.ImageType, error) {
+	imageType := bimg.DetermineImageType(file)
+	if imageType == bimg.UNKNOWN {
+		return nil, imageType, fmt.Errorf("неизвестный формат изображения")
+	}
+
+	pngData := file
+	if imageType != bimg.PNG {
+		var err error
+		pngData, err = bimg.NewImage(file).Process(bimg.Options{
+			Type:         bimg.PNG,
+			NoAutoRotate: true,
+		})
+		if err != nil {
+			return nil, imageType, fmt.Errorf("ошибка конвертации в PNG: %v", err)
+		}
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return nil, imageType, fmt.Errorf("ошибка декодирования PNG: %v", err)
+	}
+
+	return toNRGBA(decoded), imageType, nil
+}
+
+// encodePixels кодирует изображение обратно в исходный формат.
+func encodePixels(img image.Image, imageType bimg.ImageType) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования PNG: %v", err)
+	}
+	if imageType == bimg.PNG {
+		return buf.Bytes(), nil
+	}
+
+	newImage, err := bimg.NewImage(buf.Bytes()).Process(bimg.Options{
+		Type:         imageType,
+		Quality:      90,
+		NoAutoRotate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка кодирования изображения: %v", err)
+	}
+	return newImage, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+	return out
+}
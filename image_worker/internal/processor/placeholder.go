@@ -0,0 +1,355 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/h2non/bimg"
+)
+
+// placeholderSize - наибольшая сторона уменьшенной копии для заглушек.
+// ThumbHash принимает изображения не больше 100x100
+const placeholderSize = 100
+
+// Число компонент BlurHash по горизонтали и вертикали
+const (
+	blurHashX = 4
+	blurHashY = 3
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Placeholders вычисляет BlurHash, ThumbHash и доминирующий цвет изображения,
+// которые клиенты показывают, пока загружается само изображение.
+func Placeholders(file []byte) (*domain.Placeholder, error) {
+	img, err := smallPixels(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Placeholder{
+		BlurHash:      blurHash(img, blurHashX, blurHashY),
+		ThumbHash:     base64.StdEncoding.EncodeToString(thumbHash(img)),
+		DominantColor: dominantColor(img),
+	}, nil
+}
+
+// smallPixels уменьшает изображение до placeholderSize по большей стороне
+// и декодирует его для анализа цветов
+func smallPixels(file []byte) (*image.NRGBA, error) {
+	return scaledPixels(file, placeholderSize)
+}
+
+// scaledPixels декодирует изображение, вписанное в квадрат limit x limit
+func scaledPixels(file []byte, limit int) (*image.NRGBA, error) {
+	size, err := bimg.NewImage(file).Size()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения размеров изображения: %v", err)
+	}
+	if size.Width <= 0 || size.Height <= 0 {
+		return nil, fmt.Errorf("некорректные размеры изображения %dx%d", size.Width, size.Height)
+	}
+
+	width, height := fitInside(size.Width, size.Height, limit)
+	small, err := bimg.NewImage(file).Process(bimg.Options{
+		Width:  width,
+		Height: height,
+		Force:  true,
+		Type:   bimg.PNG,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка уменьшения изображения: %v", err)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(small))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка декодирования уменьшенного изображения: %v", err)
+	}
+	return toNRGBA(decoded), nil
+}
+
+// fitInside вписывает размеры в квадрат limit x limit с сохранением пропорций
+func fitInside(width, height, limit int) (int, int) {
+	if width <= limit && height <= limit {
+		return width, height
+	}
+	if width >= height {
+		return limit, max(1, int(math.Round(float64(height)*float64(limit)/float64(width))))
+	}
+	return max(1, int(math.Round(float64(width)*float64(limit)/float64(height)))), limit
+}
+
+// blurHash кодирует изображение по алгоритму BlurHash (https://blurha.sh)
+func blurHash(img *image.NRGBA, componentsX, componentsY int) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	// Таблица перевода sRGB в линейное пространство
+	var linear [256]float64
+	for i := range linear {
+		linear[i] = srgbToLinear(i)
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				row := img.Pix[y*img.Stride:]
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					r += basis * linear[row[4*x]]
+					g += basis * linear[row[4*x+1]]
+					b += basis * linear[row[4*x+2]]
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	hash := encodeBase83(nil, (componentsX-1)+(componentsY-1)*9, 1)
+
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		var actualMaximum float64
+		for _, factor := range factors[1:] {
+			for _, c := range factor {
+				actualMaximum = math.Max(actualMaximum, math.Abs(c))
+			}
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		hash = encodeBase83(hash, quantisedMaximum, 1)
+	} else {
+		hash = encodeBase83(hash, 0, 1)
+	}
+
+	dc := factors[0]
+	hash = encodeBase83(hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+
+	for _, factor := range factors[1:] {
+		var value int
+		for _, c := range factor {
+			quant := int(math.Max(0, math.Min(18, math.Floor(signPow(c/maximumValue, 0.5)*9+9.5))))
+			value = value*19 + quant
+		}
+		hash = encodeBase83(hash, value, 2)
+	}
+
+	return string(hash)
+}
+
+func encodeBase83(out []byte, value, length int) []byte {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		out = append(out, base83Chars[digit])
+	}
+	return out
+}
+
+func srgbToLinear(value int) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// thumbHash кодирует изображение по алгоритму ThumbHash
+// (https://evanw.github.io/thumbhash). Изображение не больше 100x100.
+func thumbHash(img *image.NRGBA) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	pixels := width * height
+
+	// Средний цвет с учетом прозрачности
+	var avgR, avgG, avgB, avgA float64
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			alpha := float64(row[4*x+3]) / 255
+			avgR += alpha / 255 * float64(row[4*x])
+			avgG += alpha / 255 * float64(row[4*x+1])
+			avgB += alpha / 255 * float64(row[4*x+2])
+			avgA += alpha
+		}
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+
+	hasAlpha := avgA < float64(pixels)
+	lLimit := 7.0
+	if hasAlpha {
+		// Меньше бит яркости, если есть альфа-канал
+		lLimit = 5
+	}
+	longest := float64(max(width, height))
+	lx := max(1, int(jsRound(lLimit*float64(width)/longest)))
+	ly := max(1, int(jsRound(lLimit*float64(height)/longest)))
+
+	// RGBA -> LPQA поверх среднего цвета
+	l := make([]float64, pixels)
+	p := make([]float64, pixels)
+	q := make([]float64, pixels)
+	a := make([]float64, pixels)
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			alpha := float64(row[4*x+3]) / 255
+			r := avgR*(1-alpha) + alpha/255*float64(row[4*x])
+			g := avgG*(1-alpha) + alpha/255*float64(row[4*x+1])
+			b := avgB*(1-alpha) + alpha/255*float64(row[4*x+2])
+			l[i] = (r + g + b) / 3
+			p[i] = (r+g)/2 - b
+			q[i] = r - g
+			a[i] = alpha
+		}
+	}
+
+	lDC, lAC, lScale := thumbHashChannel(l, width, height, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := thumbHashChannel(p, width, height, 3, 3)
+	qDC, qAC, qScale := thumbHashChannel(q, width, height, 3, 3)
+
+	isLandscape := width > height
+	header24 := int(jsRound(63*lDC)) |
+		int(jsRound(31.5+31.5*pDC))<<6 |
+		int(jsRound(31.5+31.5*qDC))<<12 |
+		int(jsRound(31*lScale))<<18
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+	// В заголовке хранится число компонент яркости по короткой стороне
+	header16 := lx
+	if isLandscape {
+		header16 = ly | 1<<15
+	}
+	header16 |= int(jsRound(63*pScale))<<3 | int(jsRound(63*qScale))<<9
+
+	hash := []byte{
+		byte(header24), byte(header24 >> 8), byte(header24 >> 16),
+		byte(header16), byte(header16 >> 8),
+	}
+	channels := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		aDC, aAC, aScale := thumbHashChannel(a, width, height, 5, 5)
+		hash = append(hash, byte(int(jsRound(15*aDC))|int(jsRound(15*aScale))<<4))
+		channels = append(channels, aAC)
+	}
+
+	// Переменные коэффициенты - по 4 бита
+	acStart := len(hash)
+	acIndex := 0
+	for _, ac := range channels {
+		for _, f := range ac {
+			if acStart+acIndex>>1 == len(hash) {
+				hash = append(hash, 0)
+			}
+			hash[acStart+acIndex>>1] |= byte(int(jsRound(15*f)) << ((acIndex & 1) << 2))
+			acIndex++
+		}
+	}
+	return hash
+}
+
+// thumbHashChannel раскладывает канал по DCT на постоянную составляющую
+// и нормированные переменные коэффициенты
+func thumbHashChannel(channel []float64, width, height, nx, ny int) (float64, []float64, float64) {
+	var dc, scale float64
+	var ac []float64
+	fx := make([]float64, width)
+	for cy := 0; cy < ny; cy++ {
+		for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+			for x := 0; x < width; x++ {
+				fx[x] = math.Cos(math.Pi / float64(width) * float64(cx) * (float64(x) + 0.5))
+			}
+			var f float64
+			for y := 0; y < height; y++ {
+				fy := math.Cos(math.Pi / float64(height) * float64(cy) * (float64(y) + 0.5))
+				for x := 0; x < width; x++ {
+					f += channel[x+y*width] * fx[x] * fy
+				}
+			}
+			f /= float64(width * height)
+			if cx > 0 || cy > 0 {
+				ac = append(ac, f)
+				scale = math.Max(scale, math.Abs(f))
+			} else {
+				dc = f
+			}
+		}
+	}
+	if scale > 0 {
+		for i := range ac {
+			ac[i] = 0.5 + 0.5/scale*ac[i]
+		}
+	}
+	return dc, ac, scale
+}
+
+// jsRound округляет как Math.round: половина всегда вверх
+func jsRound(value float64) float64 {
+	return math.Floor(value + 0.5)
+}
+
+// dominantColor возвращает средний цвет самой многочисленной группы
+// похожих цветов. Цвета группируются по старшим 4 битам каналов,
+// прозрачные пиксели не учитываются.
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			r, g, b, a := row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]
+			if a < 128 {
+				continue
+			}
+			key := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += int(r)
+			bk.g += int(g)
+			bk.b += int(b)
+			if best == nil || bk.count > best.count {
+				best = bk
+			}
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
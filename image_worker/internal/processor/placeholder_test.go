@@ -0,0 +1,105 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidImage(width, height int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestBlurHash(t *testing.T) {
+	gradient := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 16), G: uint8(y * 32), B: 128, A: 255})
+		}
+	}
+
+	// Ожидаемые значения получены эталонным кодировщиком BlurHash
+	tests := []struct {
+		name     string
+		img      *image.NRGBA
+		expected string
+	}{
+		{"solid red", solidImage(8, 8, color.NRGBA{R: 255, A: 255}), "LfTI:j|cfQ|c|csUfQsUfQfQfQfQ"},
+		{"gradient", gradient, "LsGuj*2@wxozu^R-jtjIf7fQfQfQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hash := blurHash(tt.img, blurHashX, blurHashY); hash != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, hash)
+			}
+		})
+	}
+}
+
+func TestThumbHash(t *testing.T) {
+	hash := thumbHash(solidImage(10, 10, color.NRGBA{R: 128, G: 128, B: 128, A: 255}))
+
+	// 5 байт заголовка и 37 коэффициентов по 4 бита
+	if len(hash) != 24 {
+		t.Fatalf("Expected 24 bytes, got %d", len(hash))
+	}
+	// L = 0.5, P = Q = 0: 32 | 32<<6 | 32<<12
+	header := []byte{0x20, 0x08, 0x02, 0x07, 0x00}
+	for i, b := range header {
+		if hash[i] != b {
+			t.Errorf("Expected header byte %d to be %#x, got %#x", i, b, hash[i])
+		}
+	}
+
+	landscape := thumbHash(solidImage(20, 10, color.NRGBA{R: 128, G: 128, B: 128, A: 255}))
+	if landscape[4]&0x80 == 0 {
+		t.Error("Expected landscape flag to be set")
+	}
+
+	transparent := thumbHash(solidImage(10, 10, color.NRGBA{R: 255, A: 100}))
+	if transparent[2]&0x80 == 0 {
+		t.Error("Expected alpha flag to be set")
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	img := solidImage(10, 10, color.NRGBA{R: 255, A: 255})
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 10; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+		}
+	}
+
+	if got := dominantColor(img); got != "#ff0000" {
+		t.Errorf("Expected #ff0000, got %s", got)
+	}
+	if got := dominantColor(solidImage(4, 4, color.NRGBA{})); got != "" {
+		t.Errorf("Expected no color for transparent image, got %s", got)
+	}
+}
+
+func TestFitInside(t *testing.T) {
+	tests := []struct {
+		width, height        int
+		expectedW, expectedH int
+	}{
+		{50, 40, 50, 40},
+		{1000, 500, 100, 50},
+		{300, 1200, 25, 100},
+		{5000, 10, 100, 1},
+	}
+
+	for _, tt := range tests {
+		w, h := fitInside(tt.width, tt.height, placeholderSize)
+		if w != tt.expectedW || h != tt.expectedH {
+			t.Errorf("fitInside(%d, %d): expected %dx%d, got %dx%d", tt.width, tt.height, tt.expectedW, tt.expectedH, w, h)
+		}
+	}
+}
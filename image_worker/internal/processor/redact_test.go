@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/h2non/bimg"
+)
+
+func TestParseRegions(t *testing.T) {
+	regions, err := ParseRegions("10:20:30:40|0:0:5:5", false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(regions) != 2 {
+		t.Fatalf("Expected 2 regions, got %d", len(regions))
+	}
+	if regions[0] != (Region{X: 10, Y: 20, Width: 30, Height: 40}) {
+		t.Errorf("Unexpected first region: %+v", regions[0])
+	}
+
+	relative, err := ParseRegions("0.25:0.25:0.5:0.5", true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !relative[0].Relative {
+		t.Error("Expected region to be relative")
+	}
+
+	invalid := []struct {
+		input    string
+		relative bool
+	}{
+		{"", false},
+		{"10:20:30", false},
+		{"a:b:c:d", false},
+		{"10:10:0:10", false},
+		{"-1:0:10:10", false},
+		{"0.5:0.5:0.6:0.1", true},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseRegions(tt.input, tt.relative); err == nil {
+			t.Errorf("Expected error for %q", tt.input)
+		}
+	}
+}
+
+func TestRegionBounds(t *testing.T) {
+	imgRect := image.Rect(0, 0, 200, 100)
+
+	rect := Region{X: 0.5, Y: 0.5, Width: 0.25, Height: 0.5, Relative: true}.bounds(imgRect)
+	if rect != image.Rect(100, 50, 150, 100) {
+		t.Errorf("Unexpected relative bounds: %v", rect)
+	}
+
+	clipped := Region{X: 190, Y: 90, Width: 50, Height: 50}.bounds(imgRect)
+	if clipped != image.Rect(190, 90, 200, 100) {
+		t.Errorf("Expected region to be clipped, got %v", clipped)
+	}
+}
+
+func TestRedactPixels(t *testing.T) {
+	newCheckerboard := func() *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				c := color.NRGBA{A: 255}
+				if (x+y)%2 == 0 {
+					c = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		return img
+	}
+	region := []Region{{X: 0, Y: 0, Width: 16, Height: 16}}
+
+	t.Run("fill", func(t *testing.T) {
+		img := newCheckerboard()
+		redactPixels(img, RedactOptions{Mode: RedactModeFill, Regions: region, Color: bimg.Color{R: 255}})
+		if c := img.NRGBAAt(5, 6); c != (color.NRGBA{R: 255, A: 255}) {
+			t.Errorf("Expected red fill, got %v", c)
+		}
+		if c := img.NRGBAAt(20, 20); c.R != 255 || c.G != 255 {
+			t.Errorf("Expected pixel outside region to be untouched, got %v", c)
+		}
+	})
+
+	t.Run("pixelate", func(t *testing.T) {
+		img := newCheckerboard()
+		redactPixels(img, RedactOptions{Mode: RedactModePixelate, Regions: region, Strength: 4})
+		first := img.NRGBAAt(0, 0)
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				if img.NRGBAAt(x, y) != first {
+					t.Fatalf("Expected uniform block, got %v at %d,%d", img.NRGBAAt(x, y), x, y)
+				}
+			}
+		}
+	})
+
+	t.Run("blur", func(t *testing.T) {
+		img := newCheckerboard()
+		redactPixels(img, RedactOptions{Mode: RedactModeBlur, Regions: region})
+		for y := 4; y < 12; y++ {
+			for x := 4; x < 12; x++ {
+				if c := img.NRGBAAt(x, y); c.R < 96 || c.R > 160 {
+					t.Fatalf("Expected checkerboard to be blurred to gray, got %v at %d,%d", c, x, y)
+				}
+			}
+		}
+	})
+}
+
+func TestRedactRegions_InvalidOptions(t *testing.T) {
+	if _, err := RedactRegions([]byte("data"), RedactOptions{Mode: "smudge", Regions: []Region{{Width: 1, Height: 1}}}); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+	if _, err := RedactRegions([]byte("data"), RedactOptions{Mode: RedactModeBlur}); err == nil {
+		t.Error("Expected error for empty regions")
+	}
+}
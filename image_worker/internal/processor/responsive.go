@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/h2non/bimg"
+)
+
+// Ограничения действия Responsive
+const (
+	maxResponsiveWidth   = domain.MaxResponsiveWidth
+	maxResponsiveWidths  = domain.MaxResponsiveWidths
+	responsiveQuality    = 80
+	defaultResponsiveSet = "320|640|960|1280|1920"
+)
+
+// responsiveFormats - поддерживаемые форматы вариантов и их Content-Type
+var responsiveFormats = map[string]struct {
+	imageType   bimg.ImageType
+	contentType string
+}{
+	"avif": {bimg.AVIF, "image/avif"},
+	"webp": {bimg.WEBP, "image/webp"},
+	"jpeg": {bimg.JPEG, "image/jpeg"},
+	"png":  {bimg.PNG, "image/png"},
+}
+
+// ResponsiveOptions - лестница ширин и форматы адаптивных вариантов
+type ResponsiveOptions struct {
+	Widths []int
+	// Formats - в порядке предпочтения, последний используется как запасной
+	Formats []string
+}
+
+// ResponsiveImage - сгенерированный вариант и его содержимое
+type ResponsiveImage struct {
+	domain.ResponsiveVariant
+	Data []byte
+}
+
+// ResponsiveOptionsFromAction разбирает параметры действия Responsive:
+// widths и formats - списки через "|".
+func ResponsiveOptionsFromAction(action domain.Action) (ResponsiveOptions, error) {
+	var opts ResponsiveOptions
+
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(action.Param("widths", defaultResponsiveSet), "|") {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || width <= 0 || width > maxResponsiveWidth {
+			return ResponsiveOptions{}, fmt.Errorf("%w: Responsive.widths must be between 1 and %d, got %q",
+				domain.ErrInvalidAction, maxResponsiveWidth, part)
+		}
+		if !seen[width] {
+			seen[width] = true
+			opts.Widths = append(opts.Widths, width)
+		}
+	}
+	if len(opts.Widths) > maxResponsiveWidths {
+		return ResponsiveOptions{}, fmt.Errorf("%w: Responsive accepts at most %d widths", domain.ErrInvalidAction, maxResponsiveWidths)
+	}
+	sort.Ints(opts.Widths)
+
+	for _, part := range strings.Split(action.Param("formats", "webp|jpeg"), "|") {
+		format := strings.ToLower(strings.TrimSpace(part))
+		if format == "jpg" {
+			format = "jpeg"
+		}
+		if _, ok := responsiveFormats[format]; !ok {
+			return ResponsiveOptions{}, fmt.Errorf("%w: Responsive.formats must be avif, webp, jpeg or png, got %q",
+				domain.ErrInvalidAction, part)
+		}
+		opts.Formats = append(opts.Formats, format)
+	}
+
+	return opts, nil
+}
+
+// GenerateResponsive строит варианты изображения для каждой ширины и формата.
+// Ширины больше исходной пропускаются; если не подходит ни одна,
+// используется исходная ширина.
+func GenerateResponsive(file []byte, opts ResponsiveOptions) ([]ResponsiveImage, int, int, error) {
+	size, err := bimg.NewImage(file).Size()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("ошибка чтения размеров изображения: %v", err)
+	}
+
+	widths := responsiveWidths(opts.Widths, size.Width)
+
+	var images []ResponsiveImage
+	for _, width := range widths {
+		height := max(1, int(math.Round(float64(size.Height)*float64(width)/float64(size.Width))))
+		for _, format := range opts.Formats {
+			spec := responsiveFormats[format]
+			data, err := bimg.NewImage(file).Process(bimg.Options{
+				Width:   width,
+				Height:  height,
+				Force:   true,
+				Type:    spec.imageType,
+				Quality: responsiveQuality,
+			})
+			if err != nil {
+				return nil, 0, 0, fmt.Errorf("ошибка создания варианта %dpx %s: %v", width, format, err)
+			}
+			images = append(images, ResponsiveImage{
+				ResponsiveVariant: domain.ResponsiveVariant{
+					Name:        fmt.Sprintf("%d.%s", width, format),
+					Width:       width,
+					Height:      height,
+					Format:      format,
+					ContentType: spec.contentType,
+					Size:        int64(len(data)),
+				},
+				Data: data,
+			})
+		}
+	}
+
+	return images, size.Width, size.Height, nil
+}
+
+// responsiveWidths оставляет ширины, не превышающие исходную
+func responsiveWidths(widths []int, sourceWidth int) []int {
+	var result []int
+	for _, width := range widths {
+		if width <= sourceWidth {
+			result = append(result, width)
+		}
+	}
+	if len(result) == 0 {
+		result = []int{sourceWidth}
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+func TestResponsiveOptionsFromAction(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected ResponsiveOptions
+		wantErr  bool
+	}{
+		{"Responsive", ResponsiveOptions{Widths: []int{320, 640, 960, 1280, 1920}, Formats: []string{"webp", "jpeg"}}, false},
+		{"Responsive(widths=800|400|800,formats=avif|WebP|jpg)", ResponsiveOptions{Widths: []int{400, 800}, Formats: []string{"avif", "webp", "jpeg"}}, false},
+		{"Responsive(widths=0)", ResponsiveOptions{}, true},
+		{"Responsive(widths=abc)", ResponsiveOptions{}, true},
+		{"Responsive(widths=1|2|3|4|5|6|7|8|9|10|11)", ResponsiveOptions{}, true},
+		{"Responsive(formats=gif)", ResponsiveOptions{}, true},
+	}
+
+	for _, tt := range tests {
+		action, err := domain.ParseAction(tt.action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ResponsiveOptionsFromAction(action)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.action, tt.wantErr, err)
+			continue
+		}
+		if tt.wantErr {
+			if !errors.Is(err, domain.ErrInvalidAction) {
+				t.Errorf("%s: expected ErrInvalidAction, got %v", tt.action, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tt.action, tt.expected, got)
+		}
+	}
+}
+
+func TestResponsiveWidths(t *testing.T) {
+	tests := []struct {
+		widths   []int
+		source   int
+		expected []int
+	}{
+		{[]int{320, 640, 960}, 800, []int{320, 640}},
+		{[]int{320, 640}, 640, []int{320, 640}},
+		{[]int{640, 960}, 500, []int{500}},
+	}
+
+	for _, tt := range tests {
+		if got := responsiveWidths(tt.widths, tt.source); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("responsiveWidths(%v, %d): expected %v, got %v", tt.widths, tt.source, tt.expected, got)
+		}
+	}
+}
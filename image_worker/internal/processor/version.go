@@ -0,0 +1,6 @@
+package processor
+
+// Version - версия алгоритмов обработки. Входит в ключ кеша результатов:
+// ее нужно увеличивать при любом изменении, влияющем на выходные файлы,
+// тогда старые записи кеша перестают использоваться и удаляются воркером.
+const Version = "1"
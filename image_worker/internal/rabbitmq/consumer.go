@@ -1,215 +1,329 @@
 package rabbitmq
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"sync"
 	"time"
 
-	"github.com/dontpanicw/ImageProcessor/config"
 	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
-	"github.com/dontpanicw/ImageProcessor/image_worker/internal/processor"
+	brokerrabbitmq "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/rabbitmq"
 	"github.com/dontpanicw/ImageProcessor/internal/domain"
 	"github.com/dontpanicw/ImageProcessor/internal/port"
-	"github.com/google/uuid"
-	"github.com/segmentio/kafka-go"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-type Consumer struct {
-	reader *kafka.Reader
-	minio  port.ObjectStorage
-	repo   port.RepositoryDB
+var _ workerPort.Consumer = (*Consumer)(nil)
+
+// ackTimeout ограничивает повторную публикацию задачи и пометку Failed
+// после остановки воркера
+const ackTimeout = 5 * time.Second
+
+// Options - параметры чтения очереди RabbitMQ
+type Options struct {
+	// Prefetch - сколько неподтвержденных задач брокер выдает воркеру.
+	// Столько же задач обрабатывается одновременно
+	Prefetch int
+	// MaxAttempts - после стольких неудачных попыток задача отклоняется
+	// и попадает в очередь неисправимых задач
+	MaxAttempts int
+	// RetryDelay - пауза перед повтором, растет с номером попытки. Задача
+	// ждет ее в очереди повторов брокера, не занимая воркер
+	RetryDelay time.Duration
+	// ReconnectDelay - пауза перед переподключением после разрыва соединения
+	ReconnectDelay time.Duration
 }
 
-func NewConsumer(cfg *config.Config, minio port.ObjectStorage, repo port.RepositoryDB) workerPort.Consumer {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        cfg.KafkaBrokers,
-		Topic:          cfg.KafkaTaskTopic,
-		GroupID:        "image-workers",
-		MinBytes:       1,
-		MaxBytes:       10e6,
-		CommitInterval: time.Second,
-		StartOffset:    kafka.FirstOffset,
-	})
-
-	return &Consumer{
-		reader: reader,
-		minio:  minio,
-		repo:   repo,
-	}
+// Consumer читает задачи из очереди RabbitMQ с ручным подтверждением.
+// Задача подтверждается после обработки, поэтому гарантия доставки -
+// at-least-once, как у Kafka
+type Consumer struct {
+	url     string
+	queue   string
+	handler workerPort.TaskHandler
+	repo    port.RepositoryDB
+	opts    Options
+
+	mu   sync.Mutex
+	conn *amqp.Connection
 }
 
-func (c *Consumer) Start(ctx context.Context) error {
-	log.Println("Starting to consume messages from Kafka...")
-
-	// Запускаем несколько воркеров
-	const workerCount = 5
-	errCh := make(chan error, workerCount)
-
-	for i := 0; i < workerCount; i++ {
-		go c.startWorker(ctx, i, errCh)
+// NewConsumer создает consumer. Соединение устанавливается в Start.
+// repo нужен, чтобы пометить Failed изображения, задачи которых
+// исчерпали MaxAttempts
+func NewConsumer(url, queue string, handler workerPort.TaskHandler, repo port.RepositoryDB, opts Options) *Consumer {
+	if opts.Prefetch < 1 {
+		opts.Prefetch = 1
 	}
-
-	// Ждем первую ошибку или завершение контекста
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-errCh:
-		return err
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 5 * time.Second
+	}
+	return &Consumer{
+		url:     url,
+		queue:   queue,
+		handler: handler,
+		repo:    repo,
+		opts:    opts,
 	}
 }
 
-func (c *Consumer) startWorker(ctx context.Context, id int, errCh chan<- error) {
-	log.Printf("Worker %d started and waiting for messages", id)
+// Start обрабатывает задачи, пока не отменен контекст, и
+// переподключается после разрыва соединения. Задача в обработке при
+// остановке возвращается в очередь без учета попытки
+func (c *Consumer) Start(ctx context.Context) error {
+	log.Printf("Starting to consume tasks from RabbitMQ queue %s...", c.queue)
 
 	for {
+		err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("RabbitMQ consumer disconnected, reconnecting in %s: %v", c.opts.ReconnectDelay, err)
+
 		select {
 		case <-ctx.Done():
-			log.Printf("Worker %d stopped", id)
-			return
-		default:
-			// Читаем сообщение с таймаутом
-			msg, err := c.reader.FetchMessage(ctx)
-			if err != nil {
-				if err == context.Canceled {
-					log.Printf("Worker %d: context canceled", id)
-					return
-				}
-				log.Printf("Worker %d: error fetching message: %v", id, err)
-				time.Sleep(time.Second)
-				continue
-			}
-
-			log.Printf("Worker %d received message: topic=%s, partition=%d, offset=%d, key=%s",
-				id, msg.Topic, msg.Partition, msg.Offset, string(msg.Key))
-
-			// Обрабатываем сообщение
-			if err := c.processMessage(ctx, msg); err != nil {
-				log.Printf("Worker %d failed to process message: %v", id, err)
-				// Не коммитим сообщение при ошибке
-				continue
-			}
-
-			// Коммитим сообщение после успешной обработки
-			if err := c.reader.CommitMessages(ctx, msg); err != nil {
-				log.Printf("Worker %d: failed to commit message: %v", id, err)
-			} else {
-				log.Printf("Worker %d successfully processed and committed message", id)
-			}
+			return ctx.Err()
+		case <-time.After(c.opts.ReconnectDelay):
 		}
 	}
 }
 
-func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) error {
-	// Парсим сообщение из Kafka
-	var task domain.TaskMessage
-	if err := json.Unmarshal(msg.Value, &task); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
-	}
-
-	log.Printf("Processing image %s with actions %v", task.ImageID, task.Actions)
-
-	// 1. Получаем метаданные из БД
-	image, err := c.repo.GetObjectByID(ctx, task.ImageID)
+// consume читает задачи через одно соединение, пока оно не разорвано
+// или не отменен контекст
+func (c *Consumer) consume(ctx context.Context) error {
+	conn, err := amqp.Dial(c.url)
 	if err != nil {
-		return fmt.Errorf("failed to get image from DB: %w", err)
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		if err := conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+			log.Printf("Failed to close RabbitMQ connection: %v", err)
+		}
+	}()
 
-	// 2. Загружаем оригинал из MinIO (получаем io.ReadCloser)
-	originalFile, err := c.minio.GetObject(ctx, image.RawImageObjectKey)
+	ch, err := conn.Channel()
 	if err != nil {
-		return fmt.Errorf("failed to get object from MinIO: %w", err)
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
 	}
-	defer func() {
-		err = originalFile.Close()
-		if err != nil {
-			log.Printf("Failed to close original file: %v", err)
+	if err := brokerrabbitmq.DeclareTopology(ch, c.queue); err != nil {
+		return err
+	}
+	for attempt := 1; attempt < c.opts.MaxAttempts; attempt++ {
+		if delay := c.retryDelay(attempt); delay > 0 {
+			if err := brokerrabbitmq.DeclareRetryQueue(ch, c.queue, delay); err != nil {
+				return err
+			}
 		}
-	}()
+	}
+	if err := ch.Qos(c.opts.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
 
-	// 3. Читаем весь файл в []byte
-	imageData, err := io.ReadAll(originalFile)
+	// Повторные попытки публикуются отдельным каналом с подтверждениями:
+	// исходная задача подтверждается, только когда брокер сохранил повтор
+	retryCh, err := conn.Channel()
 	if err != nil {
-		return fmt.Errorf("failed to read image data: %w", err)
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+	if err := retryCh.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
 	}
 
-	// 4. Определяем Content-Type (можно сохранять в БД или определять по магии)
-	contentType := http.DetectContentType(imageData)
+	deliveries, err := ch.Consume(c.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to consume queue %s: %w", c.queue, err)
+	}
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Prefetch; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c.startWorker(ctx, id, deliveries, retryCh)
+		}(i)
+	}
 
-	// 5. Последовательно применяем все действия к []byte
-	currentData := imageData
-	for _, action := range task.Actions {
-		currentData, err = c.applyAction(action, currentData)
-		if err != nil {
-			return fmt.Errorf("failed to apply action %s: %w", action, err)
+	select {
+	case <-ctx.Done():
+		// Брокер перестает выдавать задачи, выданные дообрабатываются
+		if err := ch.Cancel("", false); err != nil {
+			log.Printf("Failed to cancel RabbitMQ consumer: %v", err)
+		}
+		wg.Wait()
+		return ctx.Err()
+	case amqpErr := <-closed:
+		wg.Wait()
+		if amqpErr == nil {
+			return amqp.ErrClosed
 		}
+		return amqpErr
 	}
+}
 
-	// 6. Генерируем ключ для обработанного файла
-	processedObjectKey := fmt.Sprintf("processed/%s/%s_%d.jpg",
-		task.ImageID,
-		uuid.New().String(),
-		time.Now().Unix(),
-	)
+func (c *Consumer) startWorker(ctx context.Context, id int, deliveries <-chan amqp.Delivery, retryCh *amqp.Channel) {
+	log.Printf("Worker %d started and waiting for messages", id)
 
-	// 7. Сохраняем обработанный файл в MinIO
-	reader := bytes.NewReader(currentData)
+	for d := range deliveries {
+		c.process(ctx, id, d, retryCh)
+	}
+	log.Printf("Worker %d stopped", id)
+}
 
-	err = c.minio.PutObject(
-		ctx,
-		processedObjectKey,
-		reader,
-		int64(len(currentData)),
-		contentType,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to save processed image to MinIO: %w", err)
+func (c *Consumer) process(ctx context.Context, id int, d amqp.Delivery, retryCh *amqp.Channel) {
+	var task domain.TaskMessage
+	if err := json.Unmarshal(d.Body, &task); err != nil {
+		// Повтор не поможет: задача сразу отправляется в очередь неисправимых
+		log.Printf("CRITICAL: Failed to unmarshal message %d: %v", d.DeliveryTag, err)
+		c.reject(d, false)
+		return
 	}
 
-	// 8. Обновляем статус в БД
-	err = c.repo.UpdateProcessedImage(ctx, task.ImageID, processedObjectKey)
-	if err != nil {
-		// Cleanup: удаляем из MinIO, если БД не обновилась
-		if cleanupErr := c.minio.RemoveObject(ctx, processedObjectKey); cleanupErr != nil {
-			log.Printf("CRITICAL: Failed to cleanup MinIO after DB error: %v", cleanupErr)
+	attempt := Attempts(d.Headers)
+	log.Printf("Worker %d received task for image %s (attempt %d/%d)",
+		id, task.ImageID, attempt, c.opts.MaxAttempts)
+
+	err := c.handler.Handle(ctx, task)
+	switch {
+	case err == nil:
+		if err := d.Ack(false); err != nil {
+			log.Printf("Worker %d: failed to ack task for image %s: %v", id, task.ImageID, err)
 		}
-		return fmt.Errorf("failed to update DB: %w", err)
+	case ctx.Err() != nil:
+		// Остановка воркера не считается попыткой
+		c.reject(d, true)
+	case attempt >= c.opts.MaxAttempts:
+		log.Printf("CRITICAL: Task for image %s failed after %d attempts: %v", task.ImageID, attempt, err)
+		c.fail(ctx, task.ImageID, err)
+		c.reject(d, false)
+	default:
+		log.Printf("Worker %d failed to process image %s (attempt %d/%d): %v",
+			id, task.ImageID, attempt, c.opts.MaxAttempts, err)
+		c.retry(ctx, d, attempt, retryCh)
 	}
+}
 
-	log.Printf("Successfully processed image %s, size: %d bytes, saved as %s",
-		task.ImageID, len(currentData), processedObjectKey)
+// fail переводит изображение в статус Failed с последней ошибкой:
+// иначе изображение неисправимой задачи навсегда осталось бы Pending
+func (c *Consumer) fail(ctx context.Context, imageID string, reason error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
 
-	return nil
+	if err := c.repo.MarkFailed(ctx, imageID, reason.Error()); err != nil {
+		log.Printf("Failed to mark image %s as failed: %v", imageID, err)
+	}
 }
 
-// applyAction применяет одно действие к изображению (работает с []byte)
-func (c *Consumer) applyAction(action string, imageData []byte) ([]byte, error) {
-	switch action {
-	case domain.ResizeAction:
-		return processor.ResizeImage(imageData, 1600, 900)
+// retryDelay - пауза перед попыткой attempt+1
+func (c *Consumer) retryDelay(attempt int) time.Duration {
+	return c.opts.RetryDelay * time.Duration(attempt)
+}
 
-	case domain.WatermarkAction:
-		return processor.AddTextWatermark(imageData, "WildBerries")
+// retry публикует задачу с увеличенным номером попытки в очередь
+// повторов, откуда брокер вернет ее в очередь задач через паузу, и
+// подтверждает исходную. Если повтор не сохранен, исходная задача
+// возвращается в очередь с тем же номером попытки
+func (c *Consumer) retry(ctx context.Context, d amqp.Delivery, attempt int, retryCh *amqp.Channel) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	routingKey := c.queue
+	if delay := c.retryDelay(attempt); delay > 0 {
+		routingKey = brokerrabbitmq.RetryQueue(c.queue, delay)
+	}
 
-	case domain.MiniatureGenerateAction:
-		return processor.GenerateSmartThumbnail(imageData, 1600, 900)
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[brokerrabbitmq.AttemptsHeader] = int32(attempt + 1)
+
+	confirmation, err := retryCh.PublishWithDeferredConfirmWithContext(ctx, "", routingKey, false, false, amqp.Publishing{
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Headers:      headers,
+		Body:         d.Body,
+	})
+	if err == nil {
+		var acked bool
+		acked, err = confirmation.WaitContext(ctx)
+		if err == nil && !acked {
+			err = brokerrabbitmq.ErrNotConfirmed
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to republish message %d: %v", d.DeliveryTag, err)
+		c.reject(d, true)
+		return
+	}
 
-	case domain.GrayscaleAction:
-		return processor.ApplyGrayscale(imageData)
+	if err := d.Ack(false); err != nil {
+		// Задача будет выдана дважды: обработчик идемпотентен
+		log.Printf("Failed to ack message %d after retry: %v", d.DeliveryTag, err)
+	}
+}
 
-	default:
-		return nil, fmt.Errorf("unknown action: %s", action)
+// reject отклоняет задачу: с requeue она возвращается в очередь,
+// без него попадает в очередь неисправимых задач
+func (c *Consumer) reject(d amqp.Delivery, requeue bool) {
+	if err := d.Nack(false, requeue); err != nil {
+		log.Printf("Failed to nack message %d: %v", d.DeliveryTag, err)
 	}
 }
 
+// Attempts возвращает номер попытки из заголовка AttemptsHeader.
+// Задачи без заголовка считаются первой попыткой
+func Attempts(headers amqp.Table) int {
+	var n int
+	switch v := headers[brokerrabbitmq.AttemptsHeader].(type) {
+	case int:
+		n = v
+	case int8:
+		n = int(v)
+	case int16:
+		n = int(v)
+	case int32:
+		n = int(v)
+	case int64:
+		n = int(v)
+	case uint8:
+		n = int(v)
+	case uint16:
+		n = int(v)
+	case uint32:
+		n = int(v)
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Close закрывает соединение, если Start еще не завершился
 func (c *Consumer) Close() error {
-	if c.reader != nil {
-		log.Println("Closing Kafka reader...")
-		return c.reader.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	if errors.Is(err, amqp.ErrClosed) {
+		return nil
 	}
-	return nil
+	return err
 }
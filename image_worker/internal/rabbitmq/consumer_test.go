@@ -0,0 +1,228 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/port/porttest"
+	brokerrabbitmq "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/rabbitmq"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// testRetryDelay - пауза перед повтором в тестах, по ней удаляются
+// очереди повторов
+const testRetryDelay = 10 * time.Millisecond
+
+// openTestQueue возвращает адрес брокера и имя отдельной очереди, чтобы
+// тесты пакетов, которые go test запускает параллельно, не забирали
+// задачи друг друга. Очередь удаляется после теста
+func openTestQueue(t *testing.T) (string, string) {
+	t.Helper()
+	url := os.Getenv("TEST_AMQP_URL")
+	if url == "" {
+		t.Skip("TEST_AMQP_URL is not set")
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	queue := "porttest_" + hex.EncodeToString(b)
+
+	t.Cleanup(func() {
+		conn, err := amqp.Dial(url)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if ch, err := conn.Channel(); err == nil {
+			_, _ = ch.QueueDelete(queue, false, false, false)
+			_, _ = ch.QueueDelete(brokerrabbitmq.DeadLetterQueue(queue), false, false, false)
+			_ = ch.ExchangeDelete(brokerrabbitmq.DeadLetterExchange(queue), false, false)
+			for attempt := 1; attempt < 3; attempt++ {
+				_, _ = ch.QueueDelete(brokerrabbitmq.RetryQueue(queue, testRetryDelay*time.Duration(attempt)), false, false, false)
+			}
+		}
+	})
+	return url, queue
+}
+
+func TestConsumer_Contract(t *testing.T) {
+	url, _ := openTestQueue(t)
+
+	porttest.RunConsumer(t, func(t *testing.T, handler workerPort.TaskHandler, repo port.RepositoryDB) (workerPort.Consumer, port.Producer) {
+		_, queue := openTestQueue(t)
+		consumer := NewConsumer(url, queue, handler, repo, Options{
+			Prefetch:    3,
+			MaxAttempts: 3,
+			RetryDelay:  testRetryDelay,
+		})
+		producer := brokerrabbitmq.NewProducer(url, queue)
+		t.Cleanup(func() { _ = producer.Close() })
+		return consumer, producer
+	})
+}
+
+func TestConsumer_DeadAfterMaxAttempts(t *testing.T) {
+	url, queue := openTestQueue(t)
+	producer := brokerrabbitmq.NewProducer(url, queue)
+	defer producer.Close()
+
+	repo := memory.NewRepository()
+	if err := repo.SaveObject(context.Background(), domain.Image{Id: "broken", Status: domain.ImageStatusPending}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var calls atomic.Int32
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		calls.Add(1)
+		return errors.New("permanent failure")
+	})
+	consumer := NewConsumer(url, queue, handler, repo, Options{
+		Prefetch:    2,
+		MaxAttempts: 2,
+		RetryDelay:  testRetryDelay,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+
+	if err := producer.SendMessage(context.Background(), domain.TaskMessage{ImageID: "broken", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var dead amqp.Delivery
+	var ok bool
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		dead, ok, err = ch.Get(brokerrabbitmq.DeadLetterQueue(queue), true)
+		if err != nil || ok {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Неисправимая задача больше не выдается
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+	if err := consumer.Close(); err != nil {
+		t.Errorf("Expected no error from Close, got %v", err)
+	}
+
+	if err != nil || !ok {
+		t.Fatalf("Expected task in %s, got %v %v", brokerrabbitmq.DeadLetterQueue(queue), ok, err)
+	}
+	if dead.MessageId != "broken" || Attempts(dead.Headers) != 2 {
+		t.Errorf("Expected broken task dead-lettered after 2 attempts, got %s %d", dead.MessageId, Attempts(dead.Headers))
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 handler calls, got %d", calls.Load())
+	}
+	image, err := repo.GetObjectByID(context.Background(), "broken")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusFailed || image.FailureReason != "permanent failure" {
+		t.Errorf("Expected image to be marked failed with the last error, got %s %q", image.Status, image.FailureReason)
+	}
+}
+
+// Задача ждет повтора в очереди брокера: единственный воркер тем
+// временем обрабатывает следующие задачи
+func TestConsumer_RetryDoesNotHoldWorker(t *testing.T) {
+	url, queue := openTestQueue(t)
+	producer := brokerrabbitmq.NewProducer(url, queue)
+	defer producer.Close()
+
+	handled := make(chan string, 3)
+	var failed atomic.Bool
+	handler := handlerFunc(func(ctx context.Context, task domain.TaskMessage) error {
+		if task.ImageID == "flaky" && !failed.Swap(true) {
+			return errors.New("temporary failure")
+		}
+		handled <- task.ImageID
+		return nil
+	})
+	consumer := NewConsumer(url, queue, handler, memory.NewRepository(), Options{
+		Prefetch:    1,
+		MaxAttempts: 2,
+		// Очередь повторов этой паузы удаляется вместе с тестовой очередью
+		RetryDelay: testRetryDelay * 2,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for _, id := range []string{"flaky", "next"} {
+		if err := producer.SendMessage(context.Background(), domain.TaskMessage{ImageID: id, Actions: []string{}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	var order []string
+	for len(order) < 2 {
+		select {
+		case id := <-handled:
+			order = append(order, id)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Expected both tasks to be handled, got %v", order)
+		}
+	}
+	if order[0] != "next" || order[1] != "flaky" {
+		t.Errorf("Expected next task before the retry, got %v", order)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{"no headers", nil, 1},
+		{"int32", amqp.Table{brokerrabbitmq.AttemptsHeader: int32(3)}, 3},
+		{"int64", amqp.Table{brokerrabbitmq.AttemptsHeader: int64(4)}, 4},
+		{"zero", amqp.Table{brokerrabbitmq.AttemptsHeader: int32(0)}, 1},
+		{"wrong type", amqp.Table{brokerrabbitmq.AttemptsHeader: "2"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Attempts(tt.headers); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+type handlerFunc func(ctx context.Context, task domain.TaskMessage) error
+
+func (f handlerFunc) Handle(ctx context.Context, task domain.TaskMessage) error {
+	return f(ctx, task)
+}
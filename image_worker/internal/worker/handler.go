@@ -0,0 +1,513 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	workerPort "github.com/dontpanicw/ImageProcessor/image_worker/internal/port"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/processor"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/pkg/imageinfo"
+	"github.com/google/uuid"
+)
+
+// quarantinePrefix - префикс хранилища для оригиналов, в которых
+// найдено вредоносное содержимое
+const quarantinePrefix = "quarantine/"
+
+// Метрики кеша результатов, доступны через expvar (/debug/vars)
+var (
+	cacheHits   = expvar.NewInt("processing_cache_hits")
+	cacheMisses = expvar.NewInt("processing_cache_misses")
+)
+
+var _ workerPort.TaskHandler = (*Handler)(nil)
+
+// Handler выполняет задачу обработки изображения независимо от того,
+// через какую очередь она пришла
+type Handler struct {
+	minio           port.ObjectStorage
+	repo            port.RepositoryDB
+	pipeline        processor.PipelineOptions
+	redactRawPolicy string
+	cacheEnabled    bool
+	limits          imageinfo.Limits
+	scanner         port.Scanner
+}
+
+func NewHandler(cfg *config.Config, minio port.ObjectStorage, repo port.RepositoryDB, scanner port.Scanner) *Handler {
+	return &Handler{
+		minio: minio,
+		repo:  repo,
+		pipeline: processor.PipelineOptions{
+			AutoOrient: cfg.AutoOrient,
+			Metadata: processor.StripOptions{
+				Level:         cfg.MetadataPolicy,
+				KeepICC:       cfg.KeepICCProfile,
+				KeepCopyright: cfg.KeepCopyright,
+			},
+		},
+		redactRawPolicy: cfg.RedactRawPolicy,
+		cacheEnabled:    cfg.ProcessingCache,
+		limits:          cfg.InputLimits(),
+		scanner:         scanner,
+	}
+}
+
+// PurgeCache удаляет записи кеша результатов прошлых версий обработчика.
+// Вызывается при запуске воркера
+func (h *Handler) PurgeCache(ctx context.Context) {
+	if !h.cacheEnabled {
+		return
+	}
+	purged, err := h.repo.PurgeProcessingCache(ctx, processor.Version)
+	if err != nil {
+		log.Printf("Failed to purge processing cache: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d processing cache entries of old processor versions", purged)
+	}
+}
+
+// Handle обрабатывает изображение задачи. Ошибка означает, что задачу
+// стоит повторить: отклоненные изображения получают статус и ошибку не возвращают
+func (h *Handler) Handle(ctx context.Context, task domain.TaskMessage) error {
+	log.Printf("Processing image %s with actions %v", task.ImageID, task.Actions)
+
+	actions, err := processor.Pipeline(task.Actions, h.pipeline)
+	if err != nil {
+		// Некорректные действия не исправятся повторной обработкой
+		return h.reject(ctx, task.ImageID, err)
+	}
+
+	// 1. Получаем метаданные из БД
+	image, err := h.repo.GetObjectByID(ctx, task.ImageID)
+	if err != nil {
+		return fmt.Errorf("failed to get image from DB: %w", err)
+	}
+	if image.Status == domain.ImageStatusQuarantined {
+		log.Printf("Image %s is quarantined, skipping", task.ImageID)
+		return nil
+	}
+	// Повтор задачи обработанного изображения: результат уже сохранен,
+	// остается политика оригинала, если ее не удалось применить
+	if image.Status == domain.ImageStatusDone {
+		if processor.HasAction(actions, domain.RedactAction) {
+			return h.applyRawPolicy(ctx, image)
+		}
+		log.Printf("Image %s is already processed, skipping", task.ImageID)
+		return nil
+	}
+	if image.RawImageObjectKey == "" {
+		log.Printf("Image %s has no raw object, skipping", task.ImageID)
+		return nil
+	}
+
+	// Размер оригинала известен до скачивания
+	if err := h.limits.CheckSize(image.FileSize); err != nil {
+		return h.rejectInput(ctx, task.ImageID, err)
+	}
+
+	// 2. Загружаем оригинал из MinIO (получаем io.ReadCloser)
+	originalFile, err := h.minio.GetObject(ctx, image.RawImageObjectKey)
+	if err != nil {
+		return fmt.Errorf("failed to get object from MinIO: %w", err)
+	}
+	defer func() {
+		err = originalFile.Close()
+		if err != nil {
+			log.Printf("Failed to close original file: %v", err)
+		}
+	}()
+
+	// 3. Читаем весь файл в []byte, но не больше лимита: размер в БД
+	// мог не совпасть с объектом
+	var src io.Reader = originalFile
+	if h.limits.MaxBytes > 0 {
+		src = io.LimitReader(originalFile, h.limits.MaxBytes+1)
+	}
+	imageData, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("failed to read image data: %w", err)
+	}
+
+	// Размеры и число кадров проверяются по заголовку до декодирования
+	// в libvips: одна PNG-бомба может исчерпать память всех воркеров
+	if _, err := h.limits.Validate(imageData); err != nil {
+		return h.rejectInput(ctx, task.ImageID, err)
+	}
+
+	// Оригинал проверяется до того, как его разберут libvips и парсеры
+	// метаданных. Ошибка проверки не означает угрозу: задача повторится
+	scan, err := h.scanner.Scan(ctx, bytes.NewReader(imageData))
+	if err != nil {
+		return fmt.Errorf("failed to scan image: %w", err)
+	}
+	if scan.Infected {
+		return h.quarantine(ctx, image, imageData, scan.Signature)
+	}
+
+	// Метаданные оригинала сохраняем до обработки: действия их удаляют.
+	// Ошибка извлечения не мешает обработке изображения
+	if metadata, err := processor.ExtractMetadata(imageData); err != nil {
+		log.Printf("Failed to extract metadata for image %s: %v", task.ImageID, err)
+	} else if err := h.repo.SaveMetadata(ctx, task.ImageID, *metadata); err != nil {
+		log.Printf("Failed to save metadata for image %s: %v", task.ImageID, err)
+	}
+
+	// Перцептивный хеш нужен для поиска похожих изображений
+	hash, err := processor.PerceptualHash(imageData)
+	if err != nil {
+		log.Printf("Failed to compute perceptual hash for image %s: %v", task.ImageID, err)
+	} else {
+		if err := h.repo.SavePerceptualHash(ctx, task.ImageID, hash); err != nil {
+			log.Printf("Failed to save perceptual hash for image %s: %v", task.ImageID, err)
+		}
+		if task.RejectDuplicates {
+			duplicate, err := h.findDuplicate(ctx, task, hash)
+			if err != nil {
+				return fmt.Errorf("failed to look up duplicates: %w", err)
+			}
+			if duplicate != nil {
+				reason := fmt.Sprintf("duplicate of image %s (distance %d)", duplicate.Id, duplicate.Distance)
+				log.Printf("Image %s rejected: %s", task.ImageID, reason)
+				if err := h.repo.MarkFailed(ctx, task.ImageID, reason); err != nil {
+					return fmt.Errorf("failed to mark image as failed: %w", err)
+				}
+				return nil
+			}
+		}
+	}
+
+	// 4. Тот же оригинал с тем же пайплайном уже обработан - копируем результат
+	spec := processor.PipelineSpec(actions)
+	result, processedObjectKey, cached := h.copyCachedResult(ctx, image, spec)
+	if !cached {
+		// 5. Последовательно применяем все действия
+		result, err = processor.Process(actions, imageData)
+		if err != nil {
+			if errors.Is(err, processor.ErrEncodeTarget) || errors.Is(err, domain.ErrInvalidAction) {
+				// Повторная обработка даст тот же результат
+				return h.reject(ctx, task.ImageID, err)
+			}
+			return err
+		}
+
+		// 6. Генерируем ключ по формату результата и сохраняем файл в MinIO
+		processedObjectKey = processedKey(task.ImageID, processor.Extension(result.Data))
+		err = h.minio.PutObject(
+			ctx,
+			processedObjectKey,
+			bytes.NewReader(result.Data),
+			int64(len(result.Data)),
+			processor.ContentType(result.Data),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save processed image to MinIO: %w", err)
+		}
+	}
+	currentData := result.Data
+
+	// 7. Формат результата нужен API для Content-Type
+	if err := h.repo.SaveResultFormat(ctx, task.ImageID, processor.ContentType(currentData), result.Encoding); err != nil {
+		if cleanupErr := h.minio.RemoveObject(ctx, processedObjectKey); cleanupErr != nil {
+			log.Printf("CRITICAL: Failed to cleanup MinIO after DB error: %v", cleanupErr)
+		}
+		return fmt.Errorf("failed to save result format: %w", err)
+	}
+
+	// Заглушка и цвета считаются до смены статуса, чтобы вернуться вместе с Done
+	if placeholder, err := processor.Placeholders(currentData); err != nil {
+		log.Printf("Failed to compute placeholder for image %s: %v", task.ImageID, err)
+	} else if err := h.repo.SavePlaceholder(ctx, task.ImageID, *placeholder); err != nil {
+		log.Printf("Failed to save placeholder for image %s: %v", task.ImageID, err)
+	}
+	if profile, err := processor.ColorProfile(currentData); err != nil {
+		log.Printf("Failed to extract color profile for image %s: %v", task.ImageID, err)
+	} else if err := h.repo.SaveColorProfile(ctx, task.ImageID, *profile); err != nil {
+		log.Printf("Failed to save color profile for image %s: %v", task.ImageID, err)
+	}
+
+	// Адаптивные варианты строятся из итогового изображения
+	if action, ok := processor.FindAction(actions, domain.ResponsiveAction); ok {
+		if err := h.storeResponsive(ctx, task.ImageID, action, currentData); err != nil {
+			if cleanupErr := h.minio.RemoveObject(ctx, processedObjectKey); cleanupErr != nil {
+				log.Printf("CRITICAL: Failed to cleanup MinIO after responsive error: %v", cleanupErr)
+			}
+			return fmt.Errorf("failed to build responsive variants: %w", err)
+		}
+	}
+
+	// 8. Обновляем статус в БД
+	err = h.repo.UpdateProcessedImage(ctx, task.ImageID, processedObjectKey)
+	if err != nil {
+		// Cleanup: удаляем из MinIO, если БД не обновилась
+		if cleanupErr := h.minio.RemoveObject(ctx, processedObjectKey); cleanupErr != nil {
+			log.Printf("CRITICAL: Failed to cleanup MinIO after DB error: %v", cleanupErr)
+		}
+		// Изображение удалили во время обработки: повторять нечего
+		if errors.Is(err, domain.ErrImageNotFound) {
+			log.Printf("Image %s was deleted during processing, result discarded", task.ImageID)
+			return nil
+		}
+		return fmt.Errorf("failed to update DB: %w", err)
+	}
+
+	if !cached && h.cacheEnabled && image.RawContentHash != "" {
+		if err := h.repo.SaveCachedResult(ctx, image.RawContentHash, spec, processor.Version, image.Id); err != nil {
+			log.Printf("Failed to cache result of image %s: %v", image.Id, err)
+		}
+	}
+
+	log.Printf("Successfully processed image %s (cached: %t), saved as %s",
+		task.ImageID, cached, processedObjectKey)
+
+	// 9. После скрытия областей оригинал не должен оставаться доступным.
+	// Политика применяется после Done: при ошибке повтор задачи применит
+	// только ее
+	if processor.HasAction(actions, domain.RedactAction) {
+		return h.applyRawPolicy(ctx, image)
+	}
+
+	return nil
+}
+
+// rejectInput завершает задачу статусом Failed, если оригинал
+// не прошел проверку ограничений: повторная обработка бесполезна
+func (h *Handler) rejectInput(ctx context.Context, imageID string, reason error) error {
+	return h.reject(ctx, imageID, fmt.Errorf("input rejected: %w", reason))
+}
+
+// reject помечает изображение Failed без повторов: задача завершена
+func (h *Handler) reject(ctx context.Context, imageID string, reason error) error {
+	log.Printf("Image %s rejected: %v", imageID, reason)
+	if err := h.repo.MarkFailed(ctx, imageID, reason.Error()); err != nil {
+		return fmt.Errorf("failed to mark image as failed: %w", err)
+	}
+	return nil
+}
+
+// quarantine переносит зараженный оригинал под префикс quarantine/
+// и переводит изображение в статус Quarantined. Общий blob теряет
+// ссылку так же, как при удалении изображения.
+func (h *Handler) quarantine(ctx context.Context, image *domain.Image, data []byte, signature string) error {
+	log.Printf("Image %s is infected: %s", image.Id, signature)
+
+	quarantineKey := fmt.Sprintf("%s%s/%s", quarantinePrefix, image.Id, path.Base(image.RawImageObjectKey))
+	err := h.minio.PutObject(ctx, quarantineKey, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+	if err != nil {
+		return fmt.Errorf("failed to put quarantined object: %w", err)
+	}
+
+	if err := h.repo.MarkQuarantined(ctx, image.Id, quarantineKey, "infected: "+signature); err != nil {
+		if cleanupErr := h.minio.RemoveObject(ctx, quarantineKey); cleanupErr != nil {
+			log.Printf("CRITICAL: Failed to cleanup MinIO after DB error: %v", cleanupErr)
+		}
+		return fmt.Errorf("failed to mark image as quarantined: %w", err)
+	}
+
+	// Изображение уже ссылается на копию в карантине: повтор задачи
+	// удалил бы ее, поэтому ошибка удаления прежнего оригинала не возвращается
+	if err := h.dropRaw(ctx, image); err != nil {
+		log.Printf("CRITICAL: Failed to drop raw object %s of quarantined image %s: %v",
+			image.RawImageObjectKey, image.Id, err)
+	}
+
+	log.Printf("Raw object of image %s moved to %s", image.Id, quarantineKey)
+	return nil
+}
+
+// copyCachedResult копирует готовый результат обработки того же содержимого
+// тем же пайплайном и возвращает его вместе с новым ключом.
+// false - результата в кеше нет или его не удалось скопировать,
+// изображение нужно обработать.
+func (h *Handler) copyCachedResult(ctx context.Context, image *domain.Image, spec string) (*processor.Result, string, bool) {
+	if !h.cacheEnabled || image.RawContentHash == "" {
+		return nil, "", false
+	}
+
+	cached, err := h.repo.FindCachedResult(ctx, image.RawContentHash, spec, processor.Version)
+	if err != nil {
+		if !errors.Is(err, domain.ErrCacheMiss) {
+			log.Printf("Failed to look up processing cache for image %s: %v", image.Id, err)
+		}
+		cacheMisses.Add(1)
+		return nil, "", false
+	}
+
+	srcKey := cached.ProcessedImageObjectKey
+	dstKey := processedKey(image.Id, strings.TrimPrefix(path.Ext(srcKey), "."))
+	data, err := h.copyObject(ctx, srcKey, dstKey)
+	if err != nil {
+		log.Printf("Failed to copy cached result %s for image %s: %v", srcKey, image.Id, err)
+		cacheMisses.Add(1)
+		return nil, "", false
+	}
+
+	cacheHits.Add(1)
+	log.Printf("Image %s reuses cached result %s", image.Id, srcKey)
+	return &processor.Result{Data: data, Encoding: cached.Encoding}, dstKey, true
+}
+
+// processedKey генерирует ключ обработанного файла с расширением ext
+func processedKey(imageID, ext string) string {
+	return fmt.Sprintf("processed/%s/%s_%d.%s",
+		imageID,
+		uuid.New().String(),
+		time.Now().Unix(),
+		ext,
+	)
+}
+
+// storeResponsive сохраняет варианты изображения в MinIO и манифест в БД.
+// При ошибке уже загруженные варианты удаляются.
+func (h *Handler) storeResponsive(ctx context.Context, imageID string, action domain.Action, data []byte) error {
+	opts, err := processor.ResponsiveOptionsFromAction(action)
+	if err != nil {
+		return err
+	}
+
+	images, width, height, err := processor.GenerateResponsive(data, opts)
+	if err != nil {
+		return err
+	}
+
+	var (
+		stored   []string
+		variants = make([]domain.ResponsiveVariant, 0, len(images))
+	)
+	cleanup := func() {
+		for _, key := range stored {
+			if err := h.minio.RemoveObject(ctx, key); err != nil {
+				log.Printf("CRITICAL: Failed to cleanup responsive variant %s: %v", key, err)
+			}
+		}
+	}
+
+	for _, image := range images {
+		key := domain.ResponsiveObjectKey(imageID, image.Name)
+		if err := h.minio.PutObject(ctx, key, bytes.NewReader(image.Data), image.Size, image.ContentType); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to save variant %s: %w", image.Name, err)
+		}
+		stored = append(stored, key)
+
+		variant := image.ResponsiveVariant
+		variant.URL = domain.ResponsiveURL(imageID, image.Name)
+		variants = append(variants, variant)
+	}
+
+	manifest := domain.NewResponsiveManifest(imageID, width, height, opts.Formats, variants)
+	if err := h.repo.SaveResponsiveManifest(ctx, imageID, manifest); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to save responsive manifest: %w", err)
+	}
+	return nil
+}
+
+// applyRawPolicy удаляет оригинал или переносит его под префикс restricted/,
+// закрытый политикой бакета, в зависимости от REDACT_RAW_POLICY
+func (h *Handler) applyRawPolicy(ctx context.Context, image *domain.Image) error {
+	if err := h.moveRaw(ctx, image); err != nil {
+		log.Printf("CRITICAL: Failed to apply raw policy %q to image %s: %v", h.redactRawPolicy, image.Id, err)
+		return fmt.Errorf("failed to apply raw policy: %w", err)
+	}
+	return nil
+}
+
+// moveRaw применяет политику оригинала. Прежний оригинал удаляется в одной
+// транзакции со сменой ключа: общий blob только теряет ссылку, его могут
+// использовать другие изображения с тем же содержимым. Повторный вызов
+// ничего не делает.
+func (h *Handler) moveRaw(ctx context.Context, image *domain.Image) error {
+	rawKey := image.RawImageObjectKey
+	if rawKey == "" {
+		return nil
+	}
+
+	switch h.redactRawPolicy {
+	case config.RawPolicyDelete:
+		if err := h.repo.UpdateRawObjectKey(ctx, image.Id, "", h.minio.RemoveObject); err != nil {
+			return err
+		}
+		log.Printf("Raw object %s of redacted image %s deleted", rawKey, image.Id)
+
+	case config.RawPolicyRestrict:
+		if strings.HasPrefix(rawKey, domain.RestrictedPrefix) {
+			return nil
+		}
+		restrictedKey := fmt.Sprintf("%sraw/%s/%s", domain.RestrictedPrefix, image.Id, path.Base(rawKey))
+		if _, err := h.copyObject(ctx, rawKey, restrictedKey); err != nil {
+			return err
+		}
+		if err := h.repo.UpdateRawObjectKey(ctx, image.Id, restrictedKey, h.minio.RemoveObject); err != nil {
+			if cleanupErr := h.minio.RemoveObject(ctx, restrictedKey); cleanupErr != nil {
+				log.Printf("CRITICAL: Failed to cleanup MinIO after DB error: %v", cleanupErr)
+			}
+			return err
+		}
+		log.Printf("Raw object of redacted image %s moved to %s", image.Id, restrictedKey)
+	}
+
+	return nil
+}
+
+// dropRaw удаляет прежний оригинал изображения: собственный объект
+// удаляется сразу, общий blob - вместе с последней ссылкой
+func (h *Handler) dropRaw(ctx context.Context, image *domain.Image) error {
+	if image.RawContentHash == "" {
+		return h.minio.RemoveObject(ctx, image.RawImageObjectKey)
+	}
+
+	return h.repo.ReleaseBlob(ctx, image.RawContentHash, h.minio.RemoveObject)
+}
+
+// copyObject копирует объект хранилища через чтение в память
+// и возвращает его содержимое
+func (h *Handler) copyObject(ctx context.Context, srcKey, dstKey string) ([]byte, error) {
+	src, err := h.minio.GetObject(ctx, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			log.Printf("Failed to close object %s: %v", srcKey, err)
+		}
+	}()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", srcKey, err)
+	}
+
+	err = h.minio.PutObject(ctx, dstKey, bytes.NewReader(data), int64(len(data)), processor.ContentType(data))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// findDuplicate ищет ранее загруженное изображение, похожее на текущее
+func (h *Handler) findDuplicate(ctx context.Context, task domain.TaskMessage, hash uint64) (*domain.SimilarImage, error) {
+	distance := task.DuplicateDistance
+	if distance <= 0 {
+		distance = domain.DefaultDuplicateDistance
+	}
+	similar, err := h.repo.FindSimilar(ctx, hash, distance, task.ImageID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(similar) == 0 {
+		return nil, nil
+	}
+	return &similar[0], nil
+}
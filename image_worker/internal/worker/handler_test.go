@@ -0,0 +1,545 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/image_worker/internal/processor"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/memory"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/scanner/noop"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+// failingStorage - хранилище в памяти, у которого первые removeFailures
+// удалений завершаются ошибкой
+type failingStorage struct {
+	*memory.Storage
+	removeFailures int
+}
+
+func (s *failingStorage) RemoveObject(ctx context.Context, objectKey string) error {
+	if s.removeFailures > 0 {
+		s.removeFailures--
+		return errors.New("storage unavailable")
+	}
+	return s.Storage.RemoveObject(ctx, objectKey)
+}
+
+// testConfig - конфигурация воркера по умолчанию с политикой оригинала
+// rawPolicy
+func testConfig(rawPolicy string) *config.Config {
+	return &config.Config{
+		AutoOrient:          true,
+		RedactRawPolicy:     rawPolicy,
+		MetadataPolicy:      config.MetadataPolicyPrivate,
+		ProcessingCache:     true,
+		MaxInputBytes:       config.DefaultMaxInputBytes,
+		MaxInputPixels:      config.DefaultMaxInputPixels,
+		MaxInputDimension:   config.DefaultMaxInputDimension,
+		MaxInputFrames:      config.DefaultMaxInputFrames,
+		AllowedInputFormats: config.DefaultAllowedInputFormats,
+	}
+}
+
+// testPNG создает PNG width x height, залитый цветом c
+func testPNG(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+// uploadImage сохраняет оригинал как API: в общий blob по хешу содержимого
+// и запись изображения в статусе Pending. Возвращает ключ blob
+func uploadImage(t *testing.T, repo *memory.Repository, storage *memory.Storage, id string, data []byte, actions []string) string {
+	t.Helper()
+	ctx := context.Background()
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	key, upload, err := repo.AcquireBlob(ctx, hash, "blobs/sha256/"+hash[:2]+"/"+hash+".png", int64(len(data)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if upload {
+		if err := storage.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.MarkBlobUploaded(ctx, hash); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	image := domain.Image{
+		Id: id, FileName: id + ".png", FileSize: int64(len(data)), RawImageObjectKey: key,
+		Actions: actions, Status: domain.ImageStatusPending, RawContentHash: hash, RawContentType: "image/png",
+	}
+	if err := repo.SaveObject(ctx, image); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return key
+}
+
+// getImage возвращает изображение из репозитория
+func getImage(t *testing.T, repo *memory.Repository, id string) *domain.Image {
+	t.Helper()
+	image, err := repo.GetObjectByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return image
+}
+
+// readObject возвращает содержимое объекта из хранилища
+func readObject(t *testing.T, storage *memory.Storage, key string) []byte {
+	t.Helper()
+	r, err := storage.GetObject(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return data
+}
+
+// objectExists проверяет, есть ли объект в хранилище
+func objectExists(t *testing.T, storage *memory.Storage, key string) bool {
+	t.Helper()
+	r, err := storage.GetObject(context.Background(), key)
+	if errors.Is(err, domain.ErrObjectNotFound) {
+		return false
+	}
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_ = r.Close()
+	return true
+}
+
+// Сбой удаления прежнего оригинала после Done: повтор задачи применяет
+// только политику, снимает ссылку на blob один раз и не помечает
+// обработанное изображение Failed
+func TestHandle_RawPolicyRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		// shared - тот же оригинал загружен вторым изображением
+		shared bool
+	}{
+		{"delete", config.RawPolicyDelete, false},
+		{"delete shared blob", config.RawPolicyDelete, true},
+		{"restrict", config.RawPolicyRestrict, false},
+		{"restrict shared blob", config.RawPolicyRestrict, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := memory.NewRepository()
+			// Удаление вызывается только для последней ссылки на blob
+			storage := &failingStorage{Storage: memory.NewStorage()}
+			if !tt.shared {
+				storage.removeFailures = 1
+			}
+			handler := NewHandler(testConfig(tt.policy), storage, repo, noop.NewScanner())
+
+			data := testPNG(t, 16, 16, color.NRGBA{R: 200, A: 255})
+			actions := []string{"Redact(regions=0:0:8:8,mode=fill)"}
+			blobKey := uploadImage(t, repo, storage.Storage, "a", data, actions)
+			if tt.shared {
+				uploadImage(t, repo, storage.Storage, "b", data, []string{})
+			}
+			task := domain.TaskMessage{ImageID: "a", Actions: actions}
+
+			err := handler.Handle(ctx, task)
+			if tt.shared != (err == nil) {
+				t.Fatalf("Expected error only for the last blob reference, got %v", err)
+			}
+			if err != nil {
+				image := getImage(t, repo, "a")
+				if image.Status != domain.ImageStatusDone || image.RawImageObjectKey != blobKey {
+					t.Fatalf("Expected processed image to keep its raw object, got %s %q", image.Status, image.RawImageObjectKey)
+				}
+			}
+			// Повторы задачи после успеха ничего не меняют
+			for i := 0; i < 2; i++ {
+				if err := handler.Handle(ctx, task); err != nil {
+					t.Fatalf("Expected no error on retry, got %v", err)
+				}
+			}
+
+			image := getImage(t, repo, "a")
+			if image.Status != domain.ImageStatusDone || image.FailureReason != "" || image.RawContentHash != "" {
+				t.Errorf("Expected Done image without blob, got %s %q %q", image.Status, image.FailureReason, image.RawContentHash)
+			}
+			switch tt.policy {
+			case config.RawPolicyDelete:
+				if image.RawImageObjectKey != "" {
+					t.Errorf("Expected raw object key to be cleared, got %q", image.RawImageObjectKey)
+				}
+			case config.RawPolicyRestrict:
+				if !strings.HasPrefix(image.RawImageObjectKey, domain.RestrictedPrefix) || !objectExists(t, storage.Storage, image.RawImageObjectKey) {
+					t.Errorf("Expected raw object under %s, got %q", domain.RestrictedPrefix, image.RawImageObjectKey)
+				}
+			}
+			if objectExists(t, storage.Storage, blobKey) != tt.shared {
+				t.Errorf("Expected blob object to exist only while shared, got exists=%t", !tt.shared)
+			}
+
+			// Ссылка второго изображения осталась последней
+			if tt.shared {
+				if err := repo.ReleaseBlob(ctx, getImage(t, repo, "b").RawContentHash, storage.RemoveObject); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if objectExists(t, storage.Storage, blobKey) {
+					t.Error("Expected blob object to be removed with the last reference")
+				}
+			}
+		})
+	}
+}
+
+func TestHandle_SkipsImageWithoutRawObject(t *testing.T) {
+	repo := memory.NewRepository()
+	storage := memory.NewStorage()
+	handler := NewHandler(testConfig(config.RawPolicyKeep), storage, repo, noop.NewScanner())
+
+	image := domain.Image{Id: "a", FileName: "a.png", FileSize: 10, Actions: []string{}, Status: domain.ImageStatusPending}
+	if err := repo.SaveObject(context.Background(), image); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := handler.Handle(context.Background(), domain.TaskMessage{ImageID: "a", Actions: []string{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := getImage(t, repo, "a"); got.Status != domain.ImageStatusPending {
+		t.Errorf("Expected image to stay Pending, got %s", got.Status)
+	}
+}
+
+// infectedScanner находит угрозу в любом оригинале и считает проверки
+type infectedScanner struct {
+	scans int
+}
+
+func (s *infectedScanner) Scan(ctx context.Context, r io.Reader) (*domain.ScanResult, error) {
+	s.scans++
+	return &domain.ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+}
+
+// handlerEnv - обработчик с репозиторием и хранилищем в памяти
+type handlerEnv struct {
+	repo    *memory.Repository
+	storage *memory.Storage
+	handler *Handler
+	scanner *infectedScanner
+}
+
+// seedCachedResult сохраняет обработанное изображение id с результатом
+// data и запись кеша для оригинала rawData, действий actions и версии
+// обработчика version
+func seedCachedResult(t *testing.T, env *handlerEnv, id string, data, rawData []byte, actions []string, version string) {
+	t.Helper()
+	ctx := context.Background()
+	uploadImage(t, env.repo, env.storage, id, rawData, actions)
+	key := "processed/" + id + "/result.png"
+	if err := env.storage.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := env.repo.UpdateProcessedImage(ctx, id, key); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pipeline, err := processor.Pipeline(actions, env.handler.pipeline)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := env.repo.SaveCachedResult(ctx, getImage(t, env.repo, id).RawContentHash, processor.PipelineSpec(pipeline), version, id); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	red := color.NRGBA{R: 200, A: 255}
+	blue := color.NRGBA{B: 200, A: 255}
+	grayscale := []string{"Grayscale"}
+	redact := []string{"Redact(regions=0:0:8:8,mode=fill)"}
+
+	tests := []struct {
+		name      string
+		rawPolicy string
+		noCache   bool
+		infected  bool
+		// setup готовит изображение "a" и возвращает его задачу
+		setup func(t *testing.T, env *handlerEnv) domain.TaskMessage
+		// hits и misses - ожидаемый прирост счетчиков кеша в expvar
+		hits, misses int64
+		check        func(t *testing.T, env *handlerEnv)
+	}{
+		{
+			name: "cache hit skips processing",
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				raw := testPNG(t, 16, 16, red)
+				seedCachedResult(t, env, "src", testPNG(t, 4, 4, blue), raw, grayscale, processor.Version)
+				uploadImage(t, env.repo, env.storage, "a", raw, grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			hits: 1,
+			check: func(t *testing.T, env *handlerEnv) {
+				// Результат скопирован из кеша, а не получен из красного оригинала
+				image := getImage(t, env.repo, "a")
+				if !bytes.Equal(readObject(t, env.storage, image.ProcessedImageObjectKey), testPNG(t, 4, 4, blue)) {
+					t.Error("Expected processed object to be copied from the cached result")
+				}
+				if !strings.HasPrefix(image.ProcessedImageObjectKey, "processed/a/") {
+					t.Errorf("Expected processed object of image a, got %q", image.ProcessedImageObjectKey)
+				}
+			},
+		},
+		{
+			name: "cache key includes pipeline",
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				raw := testPNG(t, 16, 16, red)
+				seedCachedResult(t, env, "src", testPNG(t, 4, 4, blue), raw, []string{"Flip"}, processor.Version)
+				uploadImage(t, env.repo, env.storage, "a", raw, grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			misses: 1,
+			check:  expectProcessed,
+		},
+		{
+			name: "cache key includes processor version",
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				raw := testPNG(t, 16, 16, red)
+				seedCachedResult(t, env, "src", testPNG(t, 4, 4, blue), raw, grayscale, processor.Version+"-old")
+				uploadImage(t, env.repo, env.storage, "a", raw, grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			misses: 1,
+			check:  expectProcessed,
+		},
+		{
+			name: "cache miss saves result",
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				uploadImage(t, env.repo, env.storage, "a", testPNG(t, 16, 16, red), grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			misses: 1,
+			check: func(t *testing.T, env *handlerEnv) {
+				expectProcessed(t, env)
+				image := getImage(t, env.repo, "a")
+				pipeline, err := processor.Pipeline(grayscale, env.handler.pipeline)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				cached, err := env.repo.FindCachedResult(context.Background(), image.RawContentHash, processor.PipelineSpec(pipeline), processor.Version)
+				if err != nil {
+					t.Fatalf("Expected cached result, got %v", err)
+				}
+				if cached.Id != "a" {
+					t.Errorf("Expected cached result of image a, got %s", cached.Id)
+				}
+			},
+		},
+		{
+			name:    "cache disabled",
+			noCache: true,
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				raw := testPNG(t, 16, 16, red)
+				seedCachedResult(t, env, "src", testPNG(t, 4, 4, blue), raw, grayscale, processor.Version)
+				uploadImage(t, env.repo, env.storage, "a", raw, grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			check: expectProcessed,
+		},
+		{
+			name:     "infected image is quarantined",
+			infected: true,
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				uploadImage(t, env.repo, env.storage, "a", testPNG(t, 16, 16, red), grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			check: func(t *testing.T, env *handlerEnv) {
+				image := getImage(t, env.repo, "a")
+				if image.Status != domain.ImageStatusQuarantined || image.FailureReason != "infected: Eicar-Test-Signature" {
+					t.Errorf("Expected Quarantined image with signature, got %s %q", image.Status, image.FailureReason)
+				}
+				if !strings.HasPrefix(image.RawImageObjectKey, quarantinePrefix+"a/") || !objectExists(t, env.storage, image.RawImageObjectKey) {
+					t.Errorf("Expected raw object under %sa/, got %q", quarantinePrefix, image.RawImageObjectKey)
+				}
+				if image.RawContentHash != "" || image.ProcessedImageObjectKey != "" {
+					t.Errorf("Expected quarantined image without blob and result, got %q %q", image.RawContentHash, image.ProcessedImageObjectKey)
+				}
+				if n := env.storage.Len(); n != 1 {
+					t.Errorf("Expected only the quarantined object to remain, got %d objects", n)
+				}
+
+				// Повтор задачи не проверяет и не обрабатывает оригинал снова
+				if err := env.handler.Handle(context.Background(), domain.TaskMessage{ImageID: "a", Actions: grayscale}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if env.scanner.scans != 1 {
+					t.Errorf("Expected 1 scan, got %d", env.scanner.scans)
+				}
+				if got := getImage(t, env.repo, "a"); got.Status != domain.ImageStatusQuarantined {
+					t.Errorf("Expected image to stay Quarantined, got %s", got.Status)
+				}
+			},
+		},
+		{
+			name: "duplicate is rejected",
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				raw := testPNG(t, 16, 16, red)
+				uploadImage(t, env.repo, env.storage, "earlier", raw, grayscale)
+				if err := env.handler.Handle(context.Background(), domain.TaskMessage{ImageID: "earlier", Actions: grayscale}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				uploadImage(t, env.repo, env.storage, "a", raw, grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale, TaskOptions: domain.TaskOptions{RejectDuplicates: true}}
+			},
+			// Дубликат отклоняется до обращения к кешу
+			check: func(t *testing.T, env *handlerEnv) {
+				image := getImage(t, env.repo, "a")
+				if image.Status != domain.ImageStatusFailed || !strings.HasPrefix(image.FailureReason, "duplicate of image earlier") {
+					t.Errorf("Expected Failed duplicate of image earlier, got %s %q", image.Status, image.FailureReason)
+				}
+				if image.ProcessedImageObjectKey != "" {
+					t.Errorf("Expected no processed object, got %q", image.ProcessedImageObjectKey)
+				}
+			},
+		},
+		{
+			name: "duplicate is processed without rejection",
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				raw := testPNG(t, 16, 16, red)
+				uploadImage(t, env.repo, env.storage, "earlier", raw, []string{"Flip"})
+				if err := env.handler.Handle(context.Background(), domain.TaskMessage{ImageID: "earlier", Actions: []string{"Flip"}}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				uploadImage(t, env.repo, env.storage, "a", raw, grayscale)
+				return domain.TaskMessage{ImageID: "a", Actions: grayscale}
+			},
+			misses: 1,
+			check:  expectProcessed,
+		},
+		{
+			name:      "raw policy keep",
+			rawPolicy: config.RawPolicyKeep,
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				uploadImage(t, env.repo, env.storage, "a", testPNG(t, 16, 16, red), redact)
+				return domain.TaskMessage{ImageID: "a", Actions: redact}
+			},
+			misses: 1,
+			check: func(t *testing.T, env *handlerEnv) {
+				expectProcessed(t, env)
+				image := getImage(t, env.repo, "a")
+				if !strings.HasPrefix(image.RawImageObjectKey, "blobs/") || !objectExists(t, env.storage, image.RawImageObjectKey) {
+					t.Errorf("Expected raw blob to be kept, got %q", image.RawImageObjectKey)
+				}
+			},
+		},
+		{
+			name:      "raw policy delete",
+			rawPolicy: config.RawPolicyDelete,
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				uploadImage(t, env.repo, env.storage, "a", testPNG(t, 16, 16, red), redact)
+				return domain.TaskMessage{ImageID: "a", Actions: redact}
+			},
+			misses: 1,
+			check: func(t *testing.T, env *handlerEnv) {
+				expectProcessed(t, env)
+				image := getImage(t, env.repo, "a")
+				if image.RawImageObjectKey != "" || image.RawContentHash != "" {
+					t.Errorf("Expected raw object to be deleted, got %q %q", image.RawImageObjectKey, image.RawContentHash)
+				}
+				if n := env.storage.Len(); n != 1 {
+					t.Errorf("Expected only the processed object to remain, got %d objects", n)
+				}
+			},
+		},
+		{
+			name:      "raw policy restrict",
+			rawPolicy: config.RawPolicyRestrict,
+			setup: func(t *testing.T, env *handlerEnv) domain.TaskMessage {
+				uploadImage(t, env.repo, env.storage, "a", testPNG(t, 16, 16, red), redact)
+				return domain.TaskMessage{ImageID: "a", Actions: redact}
+			},
+			misses: 1,
+			check: func(t *testing.T, env *handlerEnv) {
+				expectProcessed(t, env)
+				image := getImage(t, env.repo, "a")
+				if !strings.HasPrefix(image.RawImageObjectKey, domain.RestrictedPrefix) || !bytes.Equal(readObject(t, env.storage, image.RawImageObjectKey), testPNG(t, 16, 16, red)) {
+					t.Errorf("Expected raw object under %s, got %q", domain.RestrictedPrefix, image.RawImageObjectKey)
+				}
+				if n := env.storage.Len(); n != 2 {
+					t.Errorf("Expected restricted and processed objects only, got %d objects", n)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawPolicy := tt.rawPolicy
+			if rawPolicy == "" {
+				rawPolicy = config.RawPolicyKeep
+			}
+			cfg := testConfig(rawPolicy)
+			cfg.ProcessingCache = !tt.noCache
+
+			env := &handlerEnv{repo: memory.NewRepository(), storage: memory.NewStorage()}
+			var scanner port.Scanner = noop.NewScanner()
+			if tt.infected {
+				env.scanner = &infectedScanner{}
+				scanner = env.scanner
+			}
+			env.handler = NewHandler(cfg, env.storage, env.repo, scanner)
+
+			task := tt.setup(t, env)
+			hits, misses := cacheHits.Value(), cacheMisses.Value()
+			if err := env.handler.Handle(context.Background(), task); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := cacheHits.Value() - hits; got != tt.hits {
+				t.Errorf("Expected %d cache hits, got %d", tt.hits, got)
+			}
+			if got := cacheMisses.Value() - misses; got != tt.misses {
+				t.Errorf("Expected %d cache misses, got %d", tt.misses, got)
+			}
+			tt.check(t, env)
+		})
+	}
+}
+
+// expectProcessed проверяет, что изображение "a" обработано из своего
+// оригинала, а не скопировано из кеша
+func expectProcessed(t *testing.T, env *handlerEnv) {
+	t.Helper()
+	image := getImage(t, env.repo, "a")
+	if image.Status != domain.ImageStatusDone {
+		t.Fatalf("Expected Done image, got %s %q", image.Status, image.FailureReason)
+	}
+	if bytes.Equal(readObject(t, env.storage, image.ProcessedImageObjectKey), testPNG(t, 4, 4, color.NRGBA{B: 200, A: 255})) {
+		t.Error("Expected image to be processed instead of copied from the cache")
+	}
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.Producer = (*Queue)(nil)
+
+// ErrQueueClosed - очередь закрыта, задачи больше не принимаются
+var ErrQueueClosed = errors.New("queue is closed")
+
+// Queue - очередь задач на канале, связывающая API и воркер в одном процессе
+type Queue struct {
+	tasks     chan domain.TaskMessage
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+}
+
+// NewQueue создает очередь с буфером на size задач. SendMessage
+// блокируется, пока буфер заполнен
+func NewQueue(size int) *Queue {
+	return &Queue{tasks: make(chan domain.TaskMessage, size)}
+}
+
+func (q *Queue) SendMessage(ctx context.Context, task domain.TaskMessage) error {
+	if task.Timestamp == 0 {
+		task.Timestamp = time.Now().Unix()
+	}
+	task.Actions = append([]string(nil), task.Actions...)
+
+	// Блокировка на чтение не дает Close закрыть канал во время отправки
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	// select выбирает случайную готовую ветку: без проверки задача
+	// могла бы попасть в свободный буфер при отмененном контексте
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to enqueue task for image %s: %w", task.ImageID, err)
+	}
+
+	select {
+	case q.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to enqueue task for image %s: %w", task.ImageID, ctx.Err())
+	}
+}
+
+// Tasks возвращает канал задач. Канал закрывается вызовом Close
+func (q *Queue) Tasks() <-chan domain.TaskMessage {
+	return q.tasks
+}
+
+// Close перестает принимать задачи. Задачи из буфера остаются в канале
+func (q *Queue) Close() error {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.closed = true
+		close(q.tasks)
+	})
+	return nil
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+)
+
+func TestQueue_SendAndClose(t *testing.T) {
+	queue := NewQueue(1)
+	ctx := context.Background()
+
+	actions := []string{domain.ResizeAction}
+	if err := queue.SendMessage(ctx, domain.TaskMessage{ImageID: "a", Actions: actions}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	actions[0] = "Mutated"
+
+	// Буфер заполнен: отправка ждет, пока не истечет контекст
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := queue.SendMessage(canceled, domain.TaskMessage{ImageID: "b"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if err := queue.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := queue.Close(); err != nil {
+		t.Errorf("Expected repeated Close to succeed, got %v", err)
+	}
+	if err := queue.SendMessage(ctx, domain.TaskMessage{ImageID: "c"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+
+	// Задача из буфера остается доступной после закрытия
+	task, ok := <-queue.Tasks()
+	if !ok {
+		t.Fatal("Expected buffered task, got closed channel")
+	}
+	if task.ImageID != "a" || task.Actions[0] != domain.ResizeAction || task.Timestamp == 0 {
+		t.Errorf("Expected copied task with timestamp, got %+v", task)
+	}
+	if _, ok := <-queue.Tasks(); ok {
+		t.Error("Expected closed channel after draining")
+	}
+}
+
+func TestQueue_Contract(t *testing.T) {
+	porttest.RunProducer(t, func(t *testing.T) (port.Producer, <-chan domain.TaskMessage) {
+		queue := NewQueue(4)
+		t.Cleanup(func() { _ = queue.Close() })
+		return queue, queue.Tasks()
+	})
+}
@@ -0,0 +1,126 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Потоки JetStream. Задачи хранятся, пока их не подтвердит воркер,
+// события о результатах - EventMaxAge независимо от подписчиков
+const (
+	TaskStream    = "IMAGE_TASKS"
+	TaskSubject   = "images.tasks"
+	EventStream   = "IMAGE_EVENTS"
+	EventSubjects = "images.events.>"
+
+	// EventMaxAge - сколько хранятся события о результатах
+	EventMaxAge = 24 * time.Hour
+)
+
+// serverReadyTimeout ограничивает запуск встроенного сервера
+const serverReadyTimeout = 10 * time.Second
+
+// EventSubject возвращает тему события для итогового статуса изображения,
+// например images.events.Failed
+func EventSubject(status string) string {
+	return "images.events." + status
+}
+
+// StartServer запускает встроенный сервер NATS с JetStream, который
+// принимает клиентов на listen (host:port, порт -1 - любой свободный) и
+// хранит потоки в storeDir. Сервер останавливается вызовом Shutdown
+func StartServer(listen, storeDir string) (*server.Server, error) {
+	host, portStr, err := net.SplitHostPort(listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS listen address %q: %w", listen, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS listen port %q: %w", portStr, err)
+	}
+
+	ns, err := server.NewServer(&server.Options{
+		Host:                   host,
+		Port:                   port,
+		JetStream:              true,
+		StoreDir:               storeDir,
+		NoSigs:                 true,
+		DisableJetStreamBanner: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NATS server: %w", err)
+	}
+
+	ns.Start()
+	if !ns.ReadyForConnections(serverReadyTimeout) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("NATS server on %s is not ready after %s", listen, serverReadyTimeout)
+	}
+	return ns, nil
+}
+
+// Connect подключается к NATS и объявляет потоки задач и событий.
+// Объявление идемпотентно, его выполняют и API, и воркер. После
+// разрыва клиент переподключается сам
+func Connect(ctx context.Context, url string) (*natsgo.Conn, jetstream.JetStream, error) {
+	nc, err := natsgo.Connect(url, natsgo.Name("image-processor"), natsgo.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	streams := []jetstream.StreamConfig{
+		{
+			Name:      TaskStream,
+			Subjects:  []string{TaskSubject},
+			Retention: jetstream.WorkQueuePolicy,
+			Storage:   jetstream.FileStorage,
+		},
+		{
+			Name:      EventStream,
+			Subjects:  []string{EventSubjects},
+			Retention: jetstream.LimitsPolicy,
+			Storage:   jetstream.FileStorage,
+			MaxAge:    EventMaxAge,
+		},
+	}
+	for _, cfg := range streams {
+		if _, err := js.CreateOrUpdateStream(ctx, cfg); err != nil {
+			nc.Close()
+			return nil, nil, fmt.Errorf("failed to declare stream %s: %w", cfg.Name, err)
+		}
+	}
+
+	return nc, js, nil
+}
+
+// PublishEvent сохраняет событие о результате обработки в поток событий
+func PublishEvent(ctx context.Context, js jetstream.JetStream, event domain.ResultEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if _, err := js.Publish(ctx, EventSubject(event.Status), body); err != nil {
+		return fmt.Errorf("failed to publish %s event for image %s: %w", event.Status, event.ImageID, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var _ port.Producer = (*Producer)(nil)
+
+// Producer публикует задачи в поток JetStream TaskStream. SendMessage
+// возвращается, только когда сервер сохранил задачу
+type Producer struct {
+	js jetstream.JetStream
+}
+
+// NewProducer создает producer поверх соединения из Connect
+func NewProducer(js jetstream.JetStream) *Producer {
+	return &Producer{js: js}
+}
+
+func (p *Producer) SendMessage(ctx context.Context, task domain.TaskMessage) error {
+	if task.Timestamp == 0 {
+		task.Timestamp = time.Now().Unix()
+	}
+
+	body, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	ack, err := p.js.Publish(ctx, TaskSubject, body)
+	if err != nil {
+		return fmt.Errorf("failed to publish task for image %s: %w", task.ImageID, err)
+	}
+
+	log.Printf("Published task for image %s to stream %s, seq=%d", task.ImageID, ack.Stream, ack.Sequence)
+	return nil
+}
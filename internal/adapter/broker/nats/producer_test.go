@@ -0,0 +1,101 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// startTestServer запускает встроенный сервер на свободном порту и
+// подключается к нему
+func startTestServer(t *testing.T) jetstream.JetStream {
+	t.Helper()
+	ns, err := StartServer("127.0.0.1:-1", t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+
+	nc, js, err := Connect(context.Background(), ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return js
+}
+
+func TestProducer_Contract(t *testing.T) {
+	porttest.RunProducer(t, func(t *testing.T) (port.Producer, <-chan domain.TaskMessage) {
+		js := startTestServer(t)
+
+		// Получатель забирает задачи, как воркер, но без обработки
+		consumer, err := js.CreateOrUpdateConsumer(context.Background(), TaskStream, jetstream.ConsumerConfig{
+			Durable:   "porttest",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		tasks := make(chan domain.TaskMessage, 64)
+		consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+			var task domain.TaskMessage
+			if err := json.Unmarshal(msg.Data(), &task); err == nil {
+				tasks <- task
+			}
+			_ = msg.Ack()
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		t.Cleanup(consumeCtx.Stop)
+
+		return NewProducer(js), tasks
+	})
+}
+
+func TestPublishEvent(t *testing.T) {
+	js := startTestServer(t)
+	ctx := context.Background()
+
+	event := domain.ResultEvent{ImageID: "image-1", Status: domain.ImageStatusFailed, Error: "broken"}
+	if err := PublishEvent(ctx, js, event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stream, err := js.Stream(ctx, EventStream)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	msg, err := stream.GetLastMsgForSubject(ctx, EventSubject(domain.ImageStatusFailed))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var got domain.ResultEvent
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got.ImageID != "image-1" || got.Status != domain.ImageStatusFailed || got.Error != "broken" {
+		t.Errorf("Expected failed event for image-1, got %+v", got)
+	}
+	if time.Since(time.Unix(got.Timestamp, 0)) > time.Minute {
+		t.Errorf("Expected timestamp to be set, got %d", got.Timestamp)
+	}
+}
+
+func TestStartServer_InvalidListen(t *testing.T) {
+	for _, listen := range []string{"4222", "localhost:port"} {
+		if _, err := StartServer(listen, t.TempDir()); err == nil {
+			t.Errorf("Expected error for listen %q", listen)
+		}
+	}
+}
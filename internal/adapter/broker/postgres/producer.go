@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.Producer = (*Producer)(nil)
+
+// NotifyChannel - канал LISTEN/NOTIFY, в который сообщается о новой задаче.
+// Уведомление только будит обработчиков: задачи без него тоже будут выданы
+const NotifyChannel = "image_jobs"
+
+// Producer ставит задачи в таблицу jobs. Используется вместо Kafka там,
+// где достаточно одной базы PostgreSQL
+type Producer struct {
+	db *sql.DB
+}
+
+func NewProducer(db *sql.DB) *Producer {
+	return &Producer{db: db}
+}
+
+// SendMessage добавляет задачу и уведомляет обработчиков. Уведомление
+// доставляется при фиксации транзакции, поэтому задача уже видна
+func (p *Producer) SendMessage(ctx context.Context, task domain.TaskMessage) error {
+	if task.Timestamp == 0 {
+		task.Timestamp = time.Now().Unix()
+	}
+
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	query := `
+        WITH job AS (
+            INSERT INTO jobs (image_id, payload) VALUES ($1, $2) RETURNING id
+        )
+        SELECT pg_notify($3, id::text) FROM job
+    `
+
+	if _, err := p.db.ExecContext(ctx, query, task.ImageID, payload, NotifyChannel); err != nil {
+		return fmt.Errorf("failed to enqueue task for image %s: %w", task.ImageID, err)
+	}
+
+	log.Printf("Enqueued job for image %s, actions=%v", task.ImageID, task.Actions)
+	return nil
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	"github.com/dontpanicw/ImageProcessor/pkg/migrations"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB создает отдельную схему, чтобы тесты пакетов, которые
+// go test запускает параллельно, не забирали задачи друг друга
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	schema := "porttest_" + hex.EncodeToString(b)
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	// Неизвестные параметры DSN lib/pq передает серверу при подключении
+	param := " search_path=" + schema
+	if strings.Contains(dsn, "://") {
+		param = "?search_path=" + schema
+		if strings.Contains(dsn, "?") {
+			param = "&search_path=" + schema
+		}
+	}
+	dsn += param
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := migrations.Migrate(db, migrations.DialectPostgres); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return db, dsn
+}
+
+func TestProducer_Contract(t *testing.T) {
+	db, _ := openTestDB(t)
+
+	porttest.RunProducer(t, func(t *testing.T) (port.Producer, <-chan domain.TaskMessage) {
+		if _, err := db.Exec(`TRUNCATE jobs`); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Получатель забирает задачи, как воркер, но без обработки
+		ctx, cancel := context.WithCancel(context.Background())
+		tasks := make(chan domain.TaskMessage)
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+		go func() {
+			defer close(done)
+			for ctx.Err() == nil {
+				var payload []byte
+				err := db.QueryRowContext(ctx, `
+                    DELETE FROM jobs WHERE id = (
+                        SELECT id FROM jobs ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+                    ) RETURNING payload`).Scan(&payload)
+				if err != nil {
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+				var task domain.TaskMessage
+				if err := json.Unmarshal(payload, &task); err != nil {
+					continue
+				}
+				select {
+				case tasks <- task:
+				case <-ctx.Done():
+				}
+			}
+		}()
+
+		return NewProducer(db), tasks
+	})
+}
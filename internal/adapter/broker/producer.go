@@ -12,15 +12,25 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// TaskTopic возвращает топик задач приоритета priority. Задачи обычного
+// приоритета и без приоритета идут в топик KafkaTaskTopic, как раньше,
+// остальные - в {KafkaTaskTopic}-{priority}
+func TaskTopic(cfg *config.Config, priority string) string {
+	if priority == "" || priority == domain.PriorityNormal {
+		return cfg.KafkaTaskTopic
+	}
+	return cfg.KafkaTaskTopic + "-" + priority
+}
+
 type Producer struct {
 	writer *kafka.Writer
 	config *config.Config
 }
 
 func NewProducer(cfg *config.Config) *Producer {
+	// Топик задается в каждом сообщении по приоритету задачи
 	writer := &kafka.Writer{
 		Addr:                   kafka.TCP(cfg.KafkaBrokers...),
-		Topic:                  cfg.KafkaTaskTopic,
 		Balancer:               &kafka.LeastBytes{},
 		RequiredAcks:           kafka.RequireOne,
 		Async:                  false,
@@ -62,19 +72,20 @@ func NewProducer(cfg *config.Config) *Producer {
 			}
 		}()
 
-		topicConfigs := []kafka.TopicConfig{
-			{
-				Topic:             cfg.KafkaTaskTopic,
+		var topicConfigs []kafka.TopicConfig
+		for _, priority := range domain.Priorities {
+			topicConfigs = append(topicConfigs, kafka.TopicConfig{
+				Topic:             TaskTopic(cfg, priority),
 				NumPartitions:     3,
 				ReplicationFactor: 1,
-			},
+			})
 		}
 
 		err = controllerConn.CreateTopics(topicConfigs...)
 		if err != nil {
 			log.Printf("Topic creation info: %v (this is OK if topic already exists)", err)
 		} else {
-			log.Printf("Successfully created topic: %s", cfg.KafkaTaskTopic)
+			log.Printf("Successfully created topics for priorities %v", domain.Priorities)
 		}
 	}()
 
@@ -84,21 +95,21 @@ func NewProducer(cfg *config.Config) *Producer {
 	}
 }
 
-func (p *Producer) SendMessage(ctx context.Context, imageId string, actions []string) error {
-	msg := domain.TaskMessage{
-		ImageID:   imageId,
-		Actions:   actions,
-		Timestamp: time.Now().Unix(),
+func (p *Producer) SendMessage(ctx context.Context, task domain.TaskMessage) error {
+	if task.Timestamp == 0 {
+		task.Timestamp = time.Now().Unix()
 	}
+	imageId := task.ImageID
 
-	value, err := json.Marshal(msg)
+	value, err := json.Marshal(task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
 	key := []byte(imageId)
 
-	log.Printf("Attempting to send message to Kafka: imageId=%s, actions=%v", imageId, actions)
+	topic := TaskTopic(p.config, task.Priority)
+	log.Printf("Attempting to send message to Kafka: imageId=%s, actions=%v, topic=%s", imageId, task.Actions, topic)
 
 	// Создаем контекст с таймаутом
 	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -106,6 +117,7 @@ func (p *Producer) SendMessage(ctx context.Context, imageId string, actions []st
 
 	// Отправляем сообщение
 	err = p.writer.WriteMessages(sendCtx, kafka.Message{
+		Topic: topic,
 		Key:   key,
 		Value: value,
 	})
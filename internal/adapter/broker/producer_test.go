@@ -0,0 +1,138 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	"github.com/segmentio/kafka-go"
+)
+
+// openTestTopics возвращает конфигурацию с отдельными топиками задач,
+// чтобы тесты пакетов, которые go test запускает параллельно, не читали
+// задачи друг друга. Топики из одной партиции удаляются после теста
+func openTestTopics(t *testing.T) *config.Config {
+	t.Helper()
+	brokers := os.Getenv("TEST_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("TEST_KAFKA_BROKERS is not set")
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cfg := &config.Config{
+		KafkaBrokers:   strings.Split(brokers, ","),
+		KafkaTaskTopic: "porttest_" + hex.EncodeToString(b),
+	}
+
+	controller := dialController(t, cfg.KafkaBrokers[0])
+	var topics []string
+	var topicConfigs []kafka.TopicConfig
+	for _, priority := range domain.Priorities {
+		topics = append(topics, TaskTopic(cfg, priority))
+		topicConfigs = append(topicConfigs, kafka.TopicConfig{
+			Topic:             TaskTopic(cfg, priority),
+			NumPartitions:     1,
+			ReplicationFactor: 1,
+		})
+	}
+	if err := controller.CreateTopics(topicConfigs...); err != nil {
+		_ = controller.Close()
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = controller.DeleteTopics(topics...)
+		_ = controller.Close()
+	})
+	return cfg
+}
+
+// dialController подключается к контроллеру кластера, который создает и
+// удаляет топики
+func dialController(t *testing.T, addr string) *kafka.Conn {
+	t.Helper()
+	conn, err := kafka.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return controllerConn
+}
+
+func TestProducer_Contract(t *testing.T) {
+	openTestTopics(t)
+
+	porttest.RunProducer(t, func(t *testing.T) (port.Producer, <-chan domain.TaskMessage) {
+		cfg := openTestTopics(t)
+		producer := NewProducer(cfg)
+
+		// Топики из одной партиции читаются с начала без группы
+		ctx, cancel := context.WithCancel(context.Background())
+		tasks := make(chan domain.TaskMessage, 100)
+		var wg sync.WaitGroup
+		var readers []*kafka.Reader
+		for _, priority := range domain.Priorities {
+			reader := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:  cfg.KafkaBrokers,
+				Topic:    TaskTopic(cfg, priority),
+				MinBytes: 1,
+				MaxBytes: 10e6,
+				MaxWait:  100 * time.Millisecond,
+			})
+			readers = append(readers, reader)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					msg, err := reader.ReadMessage(ctx)
+					if err != nil {
+						return
+					}
+					var task domain.TaskMessage
+					if err := json.Unmarshal(msg.Value, &task); err != nil {
+						continue
+					}
+					select {
+					case tasks <- task:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		t.Cleanup(func() {
+			cancel()
+			wg.Wait()
+			for _, reader := range readers {
+				_ = reader.Close()
+			}
+			_ = producer.Close()
+		})
+		return producer, tasks
+	})
+}
@@ -0,0 +1,194 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var _ port.Producer = (*Producer)(nil)
+
+// AttemptsHeader - заголовок с номером попытки. Воркер публикует задачу
+// заново с увеличенным номером, чтобы число попыток не терялось
+const AttemptsHeader = "x-attempts"
+
+// ErrNotConfirmed - брокер отказался принять сообщение (basic.nack)
+var ErrNotConfirmed = errors.New("message was not confirmed by broker")
+
+// DeadLetterExchange возвращает exchange, в который очередь queue
+// отправляет отклоненные задачи
+func DeadLetterExchange(queue string) string {
+	return queue + ".dlx"
+}
+
+// DeadLetterQueue возвращает очередь неисправимых задач для queue
+func DeadLetterQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// RetryQueue возвращает очередь, в которой задача queue ждет повтора
+// delay. Очереди повторов отдельные для каждой паузы: сообщения с общим
+// сроком жизни истекают по порядку, и короткая пауза не ждет длинную
+func RetryQueue(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", queue, delay.Milliseconds())
+}
+
+// DeclareRetryQueue объявляет очередь повторов без потребителей: через
+// delay сообщение истекает и через exchange по умолчанию возвращается в
+// queue. Повторы публикует только воркер, поэтому и объявляет их он
+func DeclareRetryQueue(ch *amqp.Channel, queue string, delay time.Duration) error {
+	retry := RetryQueue(queue, delay)
+	_, err := ch.QueueDeclare(retry, true, false, false, false, amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queue,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", retry, err)
+	}
+	return nil
+}
+
+// DeclareTopology объявляет очередь задач и очередь неисправимых задач.
+// Объявление идемпотентно, его выполняют и API, и воркер: кто бы ни
+// запустился первым, сообщения не теряются. Задача, отклоненная без
+// повтора (basic.nack requeue=false), попадает в {queue}.dead
+func DeclareTopology(ch *amqp.Channel, queue string) error {
+	dlx := DeadLetterExchange(queue)
+	if err := ch.ExchangeDeclare(dlx, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", dlx, err)
+	}
+
+	dead := DeadLetterQueue(queue)
+	if _, err := ch.QueueDeclare(dead, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", dead, err)
+	}
+	if err := ch.QueueBind(dead, queue, dlx, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s: %w", dead, err)
+	}
+
+	_, err := ch.QueueDeclare(queue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": dlx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", queue, err)
+	}
+	return nil
+}
+
+// Producer публикует задачи в очередь RabbitMQ с подтверждениями издателя:
+// SendMessage возвращается, только когда брокер сохранил сообщение
+type Producer struct {
+	url   string
+	queue string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+// NewProducer создает producer. Соединение устанавливается при первой
+// отправке и восстанавливается после разрыва
+func NewProducer(url, queue string) *Producer {
+	return &Producer{url: url, queue: queue}
+}
+
+func (p *Producer) SendMessage(ctx context.Context, task domain.TaskMessage) error {
+	if task.Timestamp == 0 {
+		task.Timestamp = time.Now().Unix()
+	}
+
+	body, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	// Публикация в amqp091 не учитывает контекст
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to publish task for image %s: %w", task.ImageID, err)
+	}
+
+	ch, err := p.channel()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", p.queue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    task.ImageID,
+		Timestamp:    time.Unix(task.Timestamp, 0),
+		Headers:      amqp.Table{AttemptsHeader: int32(1)},
+		Body:         body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish task for image %s: %w", task.ImageID, err)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to confirm task for image %s: %w", task.ImageID, err)
+	}
+	if !acked {
+		return fmt.Errorf("failed to publish task for image %s: %w", task.ImageID, ErrNotConfirmed)
+	}
+
+	log.Printf("Published task for image %s to RabbitMQ queue %s", task.ImageID, p.queue)
+	return nil
+}
+
+// channel возвращает канал в режиме подтверждений, переподключаясь,
+// если соединение или канал закрыты
+func (p *Producer) channel() (*amqp.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ch != nil && !p.ch.IsClosed() {
+		return p.ch, nil
+	}
+	if p.conn == nil || p.conn.IsClosed() {
+		conn, err := amqp.Dial(p.url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		}
+		p.conn = conn
+	}
+
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+	if err := DeclareTopology(ch, p.queue); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	p.ch = ch
+	return ch, nil
+}
+
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.ch = nil, nil
+	if errors.Is(err, amqp.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// openTestQueue возвращает соединение, адрес брокера и имя отдельной
+// очереди, чтобы тесты пакетов, которые go test запускает параллельно,
+// не забирали задачи друг друга. Очередь удаляется после теста
+func openTestQueue(t *testing.T) (*amqp.Connection, string, string) {
+	t.Helper()
+	url := os.Getenv("TEST_AMQP_URL")
+	if url == "" {
+		t.Skip("TEST_AMQP_URL is not set")
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	queue := "porttest_" + hex.EncodeToString(b)
+
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		if ch, err := conn.Channel(); err == nil {
+			_, _ = ch.QueueDelete(queue, false, false, false)
+			_, _ = ch.QueueDelete(DeadLetterQueue(queue), false, false, false)
+			_ = ch.ExchangeDelete(DeadLetterExchange(queue), false, false)
+		}
+		_ = conn.Close()
+	})
+	return conn, url, queue
+}
+
+func TestProducer_Contract(t *testing.T) {
+	conn, url, queue := openTestQueue(t)
+
+	porttest.RunProducer(t, func(t *testing.T) (port.Producer, <-chan domain.TaskMessage) {
+		ch, err := conn.Channel()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := DeclareTopology(ch, queue); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := ch.QueuePurge(queue, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Получатель забирает задачи, как воркер, но без обработки
+		deliveries, err := ch.Consume(queue, "", true, false, false, false, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		tasks := make(chan domain.TaskMessage)
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			cancel()
+			_ = ch.Close()
+			<-done
+		})
+		go func() {
+			defer close(done)
+			for d := range deliveries {
+				var task domain.TaskMessage
+				if err := json.Unmarshal(d.Body, &task); err != nil {
+					continue
+				}
+				select {
+				case tasks <- task:
+				case <-ctx.Done():
+				}
+			}
+		}()
+
+		producer := NewProducer(url, queue)
+		t.Cleanup(func() { _ = producer.Close() })
+		return producer, tasks
+	})
+}
+
+func TestProducer_DeadLetter(t *testing.T) {
+	conn, url, queue := openTestQueue(t)
+	producer := NewProducer(url, queue)
+	defer producer.Close()
+
+	task := domain.TaskMessage{ImageID: "broken", Actions: []string{}}
+	if err := producer.SendMessage(context.Background(), task); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer ch.Close()
+
+	d, ok, err := ch.Get(queue, false)
+	if err != nil || !ok {
+		t.Fatalf("Expected task in %s, got %v %v", queue, ok, err)
+	}
+	if d.Headers[AttemptsHeader] != int32(1) || d.DeliveryMode != amqp.Persistent {
+		t.Errorf("Expected persistent first attempt, got %v %d", d.Headers[AttemptsHeader], d.DeliveryMode)
+	}
+
+	// Отклоненная без повтора задача попадает в очередь неисправимых
+	if err := d.Nack(false, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var dead amqp.Delivery
+	for i := 0; i < 50; i++ {
+		dead, ok, err = ch.Get(DeadLetterQueue(queue), true)
+		if err != nil || ok {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil || !ok {
+		t.Fatalf("Expected task in %s, got %v %v", DeadLetterQueue(queue), ok, err)
+	}
+	if dead.MessageId != "broken" {
+		t.Errorf("Expected dead-lettered task for broken, got %s", dead.MessageId)
+	}
+}
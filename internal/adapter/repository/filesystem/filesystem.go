@@ -0,0 +1,253 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.ObjectStorage = (*FileStorage)(nil)
+
+// Каталоги внутри корня хранилища. Временные файлы лежат на той же
+// файловой системе, что и объекты, чтобы rename был атомарным
+const (
+	objectsDir = "objects"
+	metaDir    = "meta"
+	tmpDir     = "tmp"
+)
+
+// ErrInvalidKey - ключ объекта нельзя безопасно отобразить на путь
+var ErrInvalidKey = errors.New("invalid object key")
+
+// objectMeta - метаданные объекта, хранятся рядом с ним в meta/{key}.json
+type objectMeta struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// FileStorage хранит объекты в локальном каталоге. Подходит для
+// одноузловых развертываний, локальной разработки и тестов
+type FileStorage struct {
+	root string
+}
+
+// NewFileStorage создает хранилище в каталоге cfg.StoragePath
+func NewFileStorage(cfg *config.Config) *FileStorage {
+	return &FileStorage{root: cfg.StoragePath}
+}
+
+// InitMinio создает каталоги хранилища. Имя метода задано port.ObjectStorage
+func (f *FileStorage) InitMinio() error {
+	for _, dir := range []string{objectsDir, metaDir, tmpDir} {
+		if err := os.MkdirAll(filepath.Join(f.root, dir), 0o755); err != nil {
+			return fmt.Errorf("failed to create storage directory %s: %w", dir, err)
+		}
+	}
+	log.Printf("Filesystem storage initialized at %s", f.root)
+	return nil
+}
+
+// PutObject записывает объект во временный файл и переименовывает его
+// на место: читатели видят либо прежнюю, либо новую версию целиком
+func (f *FileStorage) PutObject(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string) error {
+	objectPath, metaPath, err := f.paths(objectKey)
+	if err != nil {
+		return err
+	}
+
+	// Размер проверяется до rename, чтобы неполная запись
+	// не заменила прежнюю версию объекта
+	written, err := f.writeAtomic(objectPath, func(w io.Writer) (int64, error) {
+		n, err := io.Copy(w, &contextReader{ctx: ctx, r: r})
+		if err == nil && size >= 0 && n != size {
+			err = fmt.Errorf("expected %d bytes, got %d", size, n)
+		}
+		return n, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write object %s: %w", objectKey, err)
+	}
+
+	meta, err := json.Marshal(objectMeta{ContentType: contentType, Size: written})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of object %s: %w", objectKey, err)
+	}
+	_, err = f.writeAtomic(metaPath, func(w io.Writer) (int64, error) {
+		n, err := w.Write(meta)
+		return int64(n), err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write metadata of object %s: %w", objectKey, err)
+	}
+	return nil
+}
+
+func (f *FileStorage) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	objectPath, _, err := f.paths(objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", objectKey, err)
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: key=%s", domain.ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to get object %s: %w", objectKey, err)
+	}
+	// Ключ-префикс других объектов соответствует каталогу, а не объекту
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		_ = file.Close()
+		return nil, fmt.Errorf("%w: key=%s", domain.ErrObjectNotFound, objectKey)
+	}
+	return file, nil
+}
+
+func (f *FileStorage) RemoveObject(ctx context.Context, objectKey string) error {
+	if objectKey == "" {
+		return errors.New("object key cannot be empty")
+	}
+	objectPath, metaPath, err := f.paths(objectKey)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to remove object %s: %w", objectKey, err)
+	}
+
+	// Отсутствующий объект не ошибка: метаданные и пустые каталоги
+	// после прерванного удаления все равно нужно убрать
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove object %s: %w", objectKey, err)
+	}
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove metadata of object %s: %v", objectKey, err)
+	}
+
+	f.pruneDirs(filepath.Dir(objectPath), filepath.Join(f.root, objectsDir))
+	f.pruneDirs(filepath.Dir(metaPath), filepath.Join(f.root, metaDir))
+	return nil
+}
+
+// ContentType возвращает Content-Type, с которым был сохранен объект
+func (f *FileStorage) ContentType(objectKey string) (string, error) {
+	_, metaPath, err := f.paths(objectKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read metadata of object %s: %w", objectKey, err)
+	}
+	var meta objectMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", fmt.Errorf("failed to unmarshal metadata of object %s: %w", objectKey, err)
+	}
+	return meta.ContentType, nil
+}
+
+// paths отображает ключ на пути объекта и его метаданных. Ключ должен быть
+// относительным путем через "/" без пустых, "." и ".." сегментов: иначе
+// объект мог бы оказаться вне корня или совпасть с другим ключом
+func (f *FileStorage) paths(objectKey string) (string, string, error) {
+	if err := validateKey(objectKey); err != nil {
+		return "", "", err
+	}
+	rel := filepath.FromSlash(objectKey)
+	return filepath.Join(f.root, objectsDir, rel), filepath.Join(f.root, metaDir, rel+".json"), nil
+}
+
+func validateKey(objectKey string) error {
+	switch {
+	case objectKey == "":
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	case strings.ContainsAny(objectKey, "\\\x00"):
+		return fmt.Errorf("%w: %q contains a backslash or NUL", ErrInvalidKey, objectKey)
+	case path.IsAbs(objectKey) || filepath.IsAbs(objectKey) || filepath.VolumeName(objectKey) != "":
+		return fmt.Errorf("%w: %q is absolute", ErrInvalidKey, objectKey)
+	}
+	for _, segment := range strings.Split(objectKey, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q has an empty, \".\" or \"..\" segment", ErrInvalidKey, objectKey)
+		}
+	}
+	return nil
+}
+
+// writeAtomic пишет файл через временный файл в tmp/ и rename
+func (f *FileStorage) writeAtomic(dst string, write func(io.Writer) (int64, error)) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Join(f.root, tmpDir), "put-*")
+	if err != nil {
+		return 0, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	written, err := write(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	err = os.Rename(tmp.Name(), dst)
+	if errors.Is(err, os.ErrNotExist) {
+		// Каталог мог удалить pruneDirs параллельного RemoveObject
+		if err = os.MkdirAll(filepath.Dir(dst), 0o755); err == nil {
+			err = os.Rename(tmp.Name(), dst)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	committed = true
+	return written, nil
+}
+
+// pruneDirs удаляет опустевшие каталоги от dir вверх до stop, не включая его
+func (f *FileStorage) pruneDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// contextReader прерывает копирование при отмене контекста
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,182 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+)
+
+func newTestStorage(t *testing.T) (*FileStorage, string) {
+	t.Helper()
+	root := t.TempDir()
+	storage := NewFileStorage(&config.Config{StoragePath: root})
+	if err := storage.InitMinio(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return storage, root
+}
+
+func readObject(t *testing.T, storage *FileStorage, key string) string {
+	t.Helper()
+	r, err := storage.GetObject(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return string(data)
+}
+
+func TestPutGetObject(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	ctx := context.Background()
+	key := "blobs/sha256/ab/abcdef.jpg"
+
+	if err := storage.PutObject(ctx, key, strings.NewReader("first"), 5, "image/jpeg"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data := readObject(t, storage, key); data != "first" {
+		t.Errorf("Expected first, got %s", data)
+	}
+	contentType, err := storage.ContentType(key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if contentType != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %s", contentType)
+	}
+
+	// Перезапись заменяет объект и метаданные
+	if err := storage.PutObject(ctx, key, strings.NewReader("second!"), -1, "image/webp"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data := readObject(t, storage, key); data != "second!" {
+		t.Errorf("Expected second!, got %s", data)
+	}
+	if contentType, _ := storage.ContentType(key); contentType != "image/webp" {
+		t.Errorf("Expected image/webp, got %s", contentType)
+	}
+}
+
+func TestPutObject_SizeMismatchKeepsPrevious(t *testing.T) {
+	storage, root := newTestStorage(t)
+	ctx := context.Background()
+	key := "processed/id/result.png"
+
+	if err := storage.PutObject(ctx, key, strings.NewReader("old"), 3, "image/png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := storage.PutObject(ctx, key, strings.NewReader("truncated"), 100, "image/png"); err == nil {
+		t.Fatal("Expected error for size mismatch, got nil")
+	}
+	if data := readObject(t, storage, key); data != "old" {
+		t.Errorf("Expected previous version to survive, got %s", data)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, tmpDir))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected temp files to be cleaned up, got %d", len(entries))
+	}
+}
+
+func TestPutObject_CanceledContext(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := storage.PutObject(ctx, "processed/id/result.png", strings.NewReader("data"), 4, "image/png")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := storage.GetObject(context.Background(), "processed/id/result.png"); err == nil {
+		t.Error("Expected object not to be written")
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	storage, root := newTestStorage(t)
+	ctx := context.Background()
+
+	// Файл вне корня, который не должен быть доступен через ключи
+	outside := filepath.Join(filepath.Dir(root), "outside.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = os.Remove(outside) })
+
+	keys := []string{
+		"",
+		"../outside.txt",
+		"../../outside.txt",
+		"processed/../../../outside.txt",
+		"/etc/passwd",
+		"processed//double",
+		"processed/./dot",
+		"processed/",
+		"..\\outside.txt",
+		"processed/nul\x00byte",
+	}
+	for _, key := range keys {
+		if err := storage.PutObject(ctx, key, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey on put %q, got %v", key, err)
+		}
+		if _, err := storage.GetObject(ctx, key); key != "" && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey on get %q, got %v", key, err)
+		}
+		if err := storage.RemoveObject(ctx, key); err == nil {
+			t.Errorf("Expected error on remove %q, got nil", key)
+		}
+	}
+
+	if data, _ := os.ReadFile(outside); string(data) != "secret" {
+		t.Error("Expected file outside the root to stay intact")
+	}
+}
+
+func TestRemoveObject(t *testing.T) {
+	storage, root := newTestStorage(t)
+	ctx := context.Background()
+	key := "responsive/id/w320.webp"
+
+	if err := storage.PutObject(ctx, key, strings.NewReader("data"), 4, "image/webp"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := storage.RemoveObject(ctx, key); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := storage.GetObject(ctx, key); !errors.Is(err, domain.ErrObjectNotFound) {
+		t.Errorf("Expected removed object to be missing, got %v", err)
+	}
+	if _, err := storage.ContentType(key); err == nil {
+		t.Error("Expected metadata to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(root, objectsDir, "responsive")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected empty directories to be pruned, got %v", err)
+	}
+
+	if err := storage.RemoveObject(ctx, key); err != nil {
+		t.Errorf("Expected repeated remove to succeed, got %v", err)
+	}
+}
+
+func TestFileStorage_Contract(t *testing.T) {
+	porttest.RunObjectStorage(t, func(t *testing.T) port.ObjectStorage {
+		storage, _ := newTestStorage(t)
+		return storage
+	})
+}
@@ -0,0 +1,574 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.RepositoryDB = (*Repository)(nil)
+
+// record - строка images вместе с данными, которые в Postgres лежат
+// в отдельных колонках и таблицах
+type record struct {
+	image    domain.Image
+	seq      int64
+	metadata *domain.ImageMetadata
+	profile  *domain.ColorProfile
+	manifest *domain.ResponsiveManifest
+}
+
+type blob struct {
+	objectKey string
+	size      int64
+	refCount  int
+	uploaded  bool
+}
+
+type cacheKey struct {
+	contentHash, pipeline, version string
+}
+
+// Repository хранит изображения в памяти процесса с той же семантикой,
+// что и postgres.ImageRepository: ошибки domain.ErrImageNotFound,
+// ErrNotProcessed и ErrCacheMiss, счетчик ссылок blob и каскадное
+// удаление записей кеша вместе с изображением
+type Repository struct {
+	mu     sync.RWMutex
+	seq    int64
+	images map[string]*record
+	blobs  map[string]*blob
+	cache  map[cacheKey]string
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		images: make(map[string]*record),
+		blobs:  make(map[string]*blob),
+		cache:  make(map[cacheKey]string),
+	}
+}
+
+func (r *Repository) SaveObject(ctx context.Context, image domain.Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.images[image.Id]
+	if !ok {
+		r.seq++
+		rec = &record{seq: r.seq}
+		r.images[image.Id] = rec
+	}
+	// Как ON CONFLICT DO UPDATE: остальные поля сохраняются
+	rec.image.Id = image.Id
+	rec.image.FileName = image.FileName
+	rec.image.FileSize = image.FileSize
+	rec.image.RawImageObjectKey = image.RawImageObjectKey
+	rec.image.ProcessedImageObjectKey = image.ProcessedImageObjectKey
+	rec.image.Actions = slices.Clone(image.Actions)
+	rec.image.Status = image.Status
+	rec.image.RawContentHash = image.RawContentHash
+	rec.image.RawContentType = image.RawContentType
+	return nil
+}
+
+func (r *Repository) GetObjectByID(ctx context.Context, id string) (*domain.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.images[id]
+	if !ok {
+		return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+	}
+	image := cloneImage(rec.image)
+	return &image, nil
+}
+
+func (r *Repository) DeleteObjectByID(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.images[id]; !ok {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+	delete(r.images, id)
+	for key, imageID := range r.cache {
+		if imageID == id {
+			delete(r.cache, key)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) UpdateProcessedImage(ctx context.Context, id string, processedObjectKey string) error {
+	return r.update(ctx, id, func(rec *record) {
+		rec.image.Status = domain.ImageStatusDone
+		rec.image.ProcessedImageObjectKey = processedObjectKey
+	})
+}
+
+func (r *Repository) UpdateRawObjectKey(ctx context.Context, id string, rawObjectKey string, remove func(ctx context.Context, key string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.images[id]
+	if !ok {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+	var err error
+	switch oldKey := rec.image.RawImageObjectKey; {
+	case rec.image.RawContentHash != "":
+		err = r.releaseBlob(ctx, rec.image.RawContentHash, remove)
+	case oldKey != "" && oldKey != rawObjectKey:
+		err = remove(ctx, oldKey)
+	}
+	if err != nil {
+		return err
+	}
+	rec.image.RawImageObjectKey = rawObjectKey
+	rec.image.RawContentHash = ""
+	return nil
+}
+
+func (r *Repository) SaveMetadata(ctx context.Context, id string, metadata domain.ImageMetadata) error {
+	stored, err := clone(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return r.update(ctx, id, func(rec *record) { rec.metadata = &stored })
+}
+
+func (r *Repository) GetMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.images[id]
+	if !ok {
+		return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+	}
+	if rec.metadata == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+	metadata, err := clone(*rec.metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata for image %s: %w", id, err)
+	}
+	return &metadata, nil
+}
+
+func (r *Repository) SavePerceptualHash(ctx context.Context, id string, hash uint64) error {
+	return r.update(ctx, id, func(rec *record) { rec.image.PerceptualHash = &hash })
+}
+
+func (r *Repository) FindSimilar(ctx context.Context, hash uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Необработанные изображения, загруженные позже excludeID, не подходят
+	self := r.images[excludeID]
+	var similar []domain.SimilarImage
+	for id, rec := range r.images {
+		if rec.image.PerceptualHash == nil || id == excludeID || rec.image.Status == domain.ImageStatusFailed {
+			continue
+		}
+		if rec.image.Status != domain.ImageStatusDone && (self == nil || rec.seq > self.seq) {
+			continue
+		}
+		distance := bits.OnesCount64(*rec.image.PerceptualHash ^ hash)
+		if distance > maxDistance {
+			continue
+		}
+		similar = append(similar, domain.SimilarImage{
+			Id:       id,
+			FileName: rec.image.FileName,
+			Status:   rec.image.Status,
+			Distance: distance,
+		})
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Distance != similar[j].Distance {
+			return similar[i].Distance < similar[j].Distance
+		}
+		return similar[i].Id < similar[j].Id
+	})
+	if limit >= 0 && len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
+
+func (r *Repository) MarkFailed(ctx context.Context, id string, reason string) error {
+	return r.update(ctx, id, func(rec *record) {
+		rec.image.Status = domain.ImageStatusFailed
+		rec.image.FailureReason = reason
+	})
+}
+
+func (r *Repository) MarkQuarantined(ctx context.Context, id string, rawObjectKey string, reason string) error {
+	return r.update(ctx, id, func(rec *record) {
+		rec.image.Status = domain.ImageStatusQuarantined
+		rec.image.FailureReason = reason
+		rec.image.RawImageObjectKey = rawObjectKey
+		rec.image.RawContentHash = ""
+	})
+}
+
+func (r *Repository) SaveResultFormat(ctx context.Context, id string, contentType string, encoding *domain.Encoding) error {
+	var stored *domain.Encoding
+	if encoding != nil {
+		copied := *encoding
+		stored = &copied
+	}
+	return r.update(ctx, id, func(rec *record) {
+		rec.image.ContentType = contentType
+		rec.image.Encoding = stored
+	})
+}
+
+func (r *Repository) SavePlaceholder(ctx context.Context, id string, placeholder domain.Placeholder) error {
+	return r.update(ctx, id, func(rec *record) { rec.image.Placeholder = placeholder })
+}
+
+func (r *Repository) SaveColorProfile(ctx context.Context, id string, profile domain.ColorProfile) error {
+	for _, color := range profile.Palette {
+		if _, err := domain.ParseRGB(color.Color); err != nil {
+			return fmt.Errorf("failed to save color profile for image %s: %w", id, err)
+		}
+	}
+	stored, err := clone(profile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal color histogram: %w", err)
+	}
+	if stored.Palette == nil {
+		stored.Palette = []domain.PaletteColor{}
+	}
+	return r.update(ctx, id, func(rec *record) { rec.profile = &stored })
+}
+
+func (r *Repository) GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.images[id]
+	if !ok {
+		return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+	}
+	if rec.profile == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+	profile, err := clone(*rec.profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal color histogram for image %s: %w", id, err)
+	}
+	return &profile, nil
+}
+
+func (r *Repository) SaveResponsiveManifest(ctx context.Context, id string, manifest domain.ResponsiveManifest) error {
+	stored, err := clone(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal responsive manifest: %w", err)
+	}
+	return r.update(ctx, id, func(rec *record) { rec.manifest = &stored })
+}
+
+func (r *Repository) GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.images[id]
+	if !ok {
+		return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+	}
+	if rec.manifest == nil {
+		// Манифест сохраняется до смены статуса на Done:
+		// у обработанного изображения без манифеста Responsive не было
+		if rec.image.Status != domain.ImageStatusDone {
+			return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+		}
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrVariantNotFound)
+	}
+	manifest, err := clone(*rec.manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal responsive manifest for image %s: %w", id, err)
+	}
+	return &manifest, nil
+}
+
+func (r *Repository) ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	byColor := filter.Color != ""
+	var target [3]float64
+	if byColor {
+		rgb, err := domain.ParseRGB(filter.Color)
+		if err != nil {
+			return nil, err
+		}
+		target[0], target[1], target[2] = rgb.Lab()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type candidate struct {
+		rec      *record
+		distance float64
+	}
+	var candidates []candidate
+	for _, rec := range r.images {
+		if filter.Status != "" && rec.image.Status != filter.Status {
+			continue
+		}
+		if !byColor {
+			candidates = append(candidates, candidate{rec: rec})
+			continue
+		}
+		// Для каждого изображения берется ближайший подходящий цвет палитры
+		distance, ok := nearestColor(rec.profile, target, filter.MinShare)
+		if ok && distance <= filter.ColorDistance {
+			candidates = append(candidates, candidate{rec: rec, distance: distance})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if byColor && a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if !byColor && a.rec.seq != b.rec.seq {
+			return a.rec.seq > b.rec.seq
+		}
+		return a.rec.image.Id < b.rec.image.Id
+	})
+
+	images := []domain.Image{}
+	for i := filter.Offset; i < len(candidates) && (filter.Limit <= 0 || len(images) < filter.Limit); i++ {
+		rec := candidates[i].rec
+		// В списке только поля, которые возвращает postgres.ListImages
+		images = append(images, domain.Image{
+			Id:            rec.image.Id,
+			FileName:      rec.image.FileName,
+			FileSize:      rec.image.FileSize,
+			Actions:       slices.Clone(rec.image.Actions),
+			Status:        rec.image.Status,
+			FailureReason: rec.image.FailureReason,
+			Placeholder:   rec.image.Placeholder,
+		})
+	}
+	return images, nil
+}
+
+// nearestColor возвращает ΔE (CIE76) ближайшего к target цвета палитры
+// с долей не меньше minShare. ok = false, если такого цвета нет
+func nearestColor(profile *domain.ColorProfile, target [3]float64, minShare float64) (float64, bool) {
+	if profile == nil {
+		return 0, false
+	}
+	nearest, ok := math.Inf(1), false
+	for _, color := range profile.Palette {
+		if color.Share < minShare {
+			continue
+		}
+		rgb, err := domain.ParseRGB(color.Color)
+		if err != nil {
+			continue
+		}
+		l, a, b := rgb.Lab()
+		distance := math.Sqrt(math.Pow(l-target[0], 2) + math.Pow(a-target[1], 2) + math.Pow(b-target[2], 2))
+		if distance < nearest {
+			nearest, ok = distance, true
+		}
+	}
+	return nearest, ok
+}
+
+func (r *Repository) AcquireBlob(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.blobs[hash]; ok {
+		b.refCount++
+		return b.objectKey, !b.uploaded, nil
+	}
+	r.blobs[hash] = &blob{objectKey: objectKey, size: size, refCount: 1}
+	return objectKey, true, nil
+}
+
+func (r *Repository) MarkBlobUploaded(ctx context.Context, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.blobs[hash]
+	if !ok {
+		return fmt.Errorf("%w: hash=%s", domain.ErrBlobNotFound, hash)
+	}
+	b.uploaded = true
+	return nil
+}
+
+// ReleaseBlob вызывает remove под блокировкой репозитория, как Postgres
+// под блокировкой записи
+func (r *Repository) ReleaseBlob(ctx context.Context, hash string, remove func(ctx context.Context, key string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.releaseBlob(ctx, hash, remove)
+}
+
+// releaseBlob снимает ссылку на blob, вызывается под блокировкой
+func (r *Repository) releaseBlob(ctx context.Context, hash string, remove func(ctx context.Context, key string) error) error {
+	b, ok := r.blobs[hash]
+	if !ok || b.refCount <= 0 {
+		return fmt.Errorf("%w: hash=%s", domain.ErrBlobNotFound, hash)
+	}
+	if b.refCount > 1 {
+		b.refCount--
+		return nil
+	}
+	if err := remove(ctx, b.objectKey); err != nil {
+		return err
+	}
+	delete(r.blobs, hash)
+	return nil
+}
+
+func (r *Repository) FindCachedResult(ctx context.Context, contentHash, pipeline, version string) (*domain.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	imageID, ok := r.cache[cacheKey{contentHash, pipeline, version}]
+	if !ok {
+		return nil, domain.ErrCacheMiss
+	}
+	rec, ok := r.images[imageID]
+	if !ok || rec.image.Status != domain.ImageStatusDone || rec.image.ProcessedImageObjectKey == "" {
+		return nil, domain.ErrCacheMiss
+	}
+
+	image := cloneImage(rec.image)
+	return &domain.Image{
+		Id:                      image.Id,
+		ProcessedImageObjectKey: image.ProcessedImageObjectKey,
+		ContentType:             image.ContentType,
+		Encoding:                image.Encoding,
+	}, nil
+}
+
+func (r *Repository) SaveCachedResult(ctx context.Context, contentHash, pipeline, version, imageID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Как внешний ключ processing_cache.image_id
+	if _, ok := r.images[imageID]; !ok {
+		return fmt.Errorf("failed to save processing cache entry for image %s: %w", imageID, domain.ErrImageNotFound)
+	}
+	r.cache[cacheKey{contentHash, pipeline, version}] = imageID
+	return nil
+}
+
+func (r *Repository) PurgeProcessingCache(ctx context.Context, version string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for key := range r.cache {
+		if key.version != version {
+			delete(r.cache, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// update изменяет запись изображения id
+func (r *Repository) update(ctx context.Context, id string, apply func(rec *record)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.images[id]
+	if !ok {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+	apply(rec)
+	return nil
+}
+
+// cloneImage копирует изображение вместе со срезами и указателями,
+// чтобы вызывающий не мог изменить хранимую запись
+func cloneImage(image domain.Image) domain.Image {
+	image.Actions = slices.Clone(image.Actions)
+	if image.PerceptualHash != nil {
+		hash := *image.PerceptualHash
+		image.PerceptualHash = &hash
+	}
+	if image.Encoding != nil {
+		encoding := *image.Encoding
+		image.Encoding = &encoding
+	}
+	return image
+}
+
+// clone копирует значение через JSON, как при сохранении в JSONB
+func clone[T any](value T) (T, error) {
+	var copied T
+	data, err := json.Marshal(value)
+	if err != nil {
+		return copied, err
+	}
+	err = json.Unmarshal(data, &copied)
+	return copied, err
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+)
+
+func saveImage(t *testing.T, repo *Repository, id, status string) {
+	t.Helper()
+	image := domain.Image{Id: id, FileName: id + ".jpg", FileSize: 10, Actions: []string{domain.ResizeAction}, Status: status}
+	if err := repo.SaveObject(context.Background(), image); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestRepository_SaveAndUpdate(t *testing.T) {
+	repo := NewRepository()
+	ctx := context.Background()
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+
+	if err := repo.SaveResultFormat(ctx, "a", "image/webp", &domain.Encoding{Format: "webp", Quality: 80}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.UpdateProcessedImage(ctx, "a", "processed/a/x.webp"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	image, err := repo.GetObjectByID(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.Status != domain.ImageStatusDone || image.ProcessedImageObjectKey != "processed/a/x.webp" {
+		t.Errorf("Expected Done with processed key, got %s %s", image.Status, image.ProcessedImageObjectKey)
+	}
+	if image.ContentType != "image/webp" || image.Encoding == nil || image.Encoding.Quality != 80 {
+		t.Errorf("Expected stored result format, got %s %+v", image.ContentType, image.Encoding)
+	}
+
+	// Возвращается копия: изменения вызывающего не попадают в хранилище
+	image.Actions[0] = "Mutated"
+	image.Encoding.Quality = 1
+	stored, _ := repo.GetObjectByID(ctx, "a")
+	if stored.Actions[0] != domain.ResizeAction || stored.Encoding.Quality != 80 {
+		t.Errorf("Expected stored image to be isolated from callers, got %v %+v", stored.Actions, stored.Encoding)
+	}
+
+	// Повторное сохранение, как ON CONFLICT, не сбрасывает результат
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+	stored, _ = repo.GetObjectByID(ctx, "a")
+	if stored.ContentType != "image/webp" {
+		t.Errorf("Expected upsert to keep content type, got %q", stored.ContentType)
+	}
+
+	if _, err := repo.GetObjectByID(ctx, "missing"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, got %v", err)
+	}
+	if err := repo.MarkFailed(ctx, "missing", "reason"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, got %v", err)
+	}
+}
+
+func TestRepository_Contract(t *testing.T) {
+	porttest.RunRepositoryDB(t, func(t *testing.T) port.RepositoryDB {
+		return NewRepository()
+	})
+}
+
+func TestStorage(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+
+	if err := storage.PutObject(ctx, "processed/a/x.png", strings.NewReader("data"), 4, "image/png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := storage.PutObject(ctx, "processed/a/y.png", strings.NewReader("data"), 10, "image/png"); err == nil {
+		t.Error("Expected error for size mismatch, got nil")
+	}
+	if contentType, _ := storage.ContentType("processed/a/x.png"); contentType != "image/png" {
+		t.Errorf("Expected image/png, got %s", contentType)
+	}
+	if storage.Len() != 1 {
+		t.Errorf("Expected 1 object, got %d", storage.Len())
+	}
+
+	if err := storage.RemoveObject(ctx, "processed/a/x.png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := storage.GetObject(ctx, "processed/a/x.png"); !errors.Is(err, domain.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound for removed object, got %v", err)
+	}
+	if err := storage.RemoveObject(ctx, "processed/a/x.png"); err != nil {
+		t.Errorf("Expected repeated remove to succeed, got %v", err)
+	}
+}
+
+func TestStorage_Contract(t *testing.T) {
+	porttest.RunObjectStorage(t, func(t *testing.T) port.ObjectStorage {
+		return NewStorage()
+	})
+}
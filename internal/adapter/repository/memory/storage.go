@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.ObjectStorage = (*Storage)(nil)
+
+type object struct {
+	data        []byte
+	contentType string
+}
+
+// Storage хранит объекты в памяти процесса. Содержимое теряется
+// при остановке, поэтому подходит только для демо, тестов и встраивания
+type Storage struct {
+	mu      sync.RWMutex
+	objects map[string]object
+}
+
+func NewStorage() *Storage {
+	return &Storage{objects: make(map[string]object)}
+}
+
+// InitMinio ничего не делает. Имя метода задано port.ObjectStorage
+func (s *Storage) InitMinio() error {
+	return nil
+}
+
+func (s *Storage) PutObject(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string) error {
+	if objectKey == "" {
+		return errors.New("object key cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", objectKey, err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", objectKey, err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("failed to write object %s: expected %d bytes, got %d", objectKey, size, len(data))
+	}
+	// Контекст мог быть отменен во время чтения
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", objectKey, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[objectKey] = object{data: data, contentType: contentType}
+	return nil
+}
+
+func (s *Storage) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	if objectKey == "" {
+		return nil, errors.New("object key cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", objectKey, err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[objectKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: key=%s", domain.ErrObjectNotFound, objectKey)
+	}
+	// Содержимое не меняется после записи, копировать его не нужно
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *Storage) RemoveObject(ctx context.Context, objectKey string) error {
+	if objectKey == "" {
+		return errors.New("object key cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to remove object %s: %w", objectKey, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectKey)
+	return nil
+}
+
+// ContentType возвращает Content-Type, с которым был сохранен объект
+func (s *Storage) ContentType(objectKey string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[objectKey]
+	if !ok {
+		return "", fmt.Errorf("%w: key=%s", domain.ErrObjectNotFound, objectKey)
+	}
+	return obj.contentType, nil
+}
+
+// Len возвращает число хранимых объектов
+func (s *Storage) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.objects)
+}
@@ -2,9 +2,11 @@ package minio
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
 	"github.com/dontpanicw/ImageProcessor/internal/port"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -55,7 +57,7 @@ func (i *ImageMinioStorage) InitMinio() error {
 				} else {
 					log.Printf("Бакет %s уже существует", i.config.BucketName)
 				}
-				return nil // всё успешно
+				return i.restrictPrefix(ctx)
 			}
 		}
 
@@ -66,6 +68,77 @@ func (i *ImageMinioStorage) InitMinio() error {
 	return fmt.Errorf("не удалось подключиться к MinIO после 10 попыток: %w", err)
 }
 
+// restrictedStatementID - идентификатор правила политики бакета,
+// запрещающего доступ к domain.RestrictedPrefix
+const restrictedStatementID = "DenyRestrictedObjects"
+
+// restrictPrefix добавляет в политику бакета запрет доступа к объектам под
+// domain.RestrictedPrefix. Остальные правила политики сохраняются. Запрет
+// действует на анонимный доступ и пользователей MinIO; root-пользователь,
+// под которым работают API и воркер, политикам бакета не подчиняется
+func (i *ImageMinioStorage) restrictPrefix(ctx context.Context) error {
+	current, err := i.mc.GetBucketPolicy(ctx, i.config.BucketName)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении политики бакета %s: %w", i.config.BucketName, err)
+	}
+	policy, err := restrictedPolicy(current, i.config.BucketName)
+	if err != nil {
+		return err
+	}
+	if err := i.mc.SetBucketPolicy(ctx, i.config.BucketName, policy); err != nil {
+		return fmt.Errorf("ошибка при установке политики бакета %s: %w", i.config.BucketName, err)
+	}
+	return nil
+}
+
+// restrictedPolicy возвращает политику current с правилом
+// restrictedStatementID. Прежнее правило с тем же идентификатором заменяется
+func restrictedPolicy(current, bucket string) (string, error) {
+	var policy struct {
+		Version   string            `json:"Version"`
+		Statement []json.RawMessage `json:"Statement"`
+	}
+	if current != "" {
+		if err := json.Unmarshal([]byte(current), &policy); err != nil {
+			return "", fmt.Errorf("invalid bucket policy: %w", err)
+		}
+	}
+	if policy.Version == "" {
+		policy.Version = "2012-10-17"
+	}
+
+	statements := policy.Statement[:0]
+	for _, raw := range policy.Statement {
+		var statement struct {
+			Sid string `json:"Sid"`
+		}
+		if err := json.Unmarshal(raw, &statement); err != nil {
+			return "", fmt.Errorf("invalid bucket policy statement: %w", err)
+		}
+		if statement.Sid != restrictedStatementID {
+			statements = append(statements, raw)
+		}
+	}
+
+	deny, err := json.Marshal(map[string]any{
+		"Sid":       restrictedStatementID,
+		"Effect":    "Deny",
+		"Principal": map[string]any{"AWS": []string{"*"}},
+		"Action":    []string{"s3:GetObject", "s3:PutObject", "s3:DeleteObject"},
+		"Resource":  []string{fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, domain.RestrictedPrefix)},
+	})
+	if err != nil {
+		return "", err
+	}
+	policy.Statement = append(statements, deny)
+
+	out, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
 func (i *ImageMinioStorage) PutObject(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string) error {
 	opts := minio.PutObjectOptions{
 		ContentType: contentType,
@@ -97,7 +170,16 @@ func (i *ImageMinioStorage) GetObject(ctx context.Context, objectKey string) (io
 	)
 	if err != nil {
 		log.Printf("ошибка при получении файла")
-		return nil, fmt.Errorf("ошибка при получении объекта %s: %v", objectKey, err)
+		return nil, fmt.Errorf("ошибка при получении объекта %s: %w", objectKey, err)
+	}
+	// GetObject ленивый: без Stat отсутствие объекта обнаружится
+	// только при первом чтении
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: key=%s", domain.ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("ошибка при получении объекта %s: %w", objectKey, err)
 	}
 	log.Println("файл получен из minio")
 	return object, nil
@@ -110,10 +192,9 @@ func (i *ImageMinioStorage) RemoveObject(ctx context.Context, objectKey string)
 
 	err := i.mc.RemoveObject(ctx, i.config.BucketName, objectKey, minio.RemoveObjectOptions{})
 	if err != nil {
-		// Проверяем, существует ли объект
-		var minioErr minio.ErrorResponse
-		if errors.As(err, &minioErr) && minioErr.Code == "NoSuchKey" {
-			return fmt.Errorf("object %s not found: %w", objectKey, err)
+		// Отсутствующий объект уже удален: повторное удаление не ошибка
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil
 		}
 		return fmt.Errorf("failed to remove object %s: %w", objectKey, err)
 	}
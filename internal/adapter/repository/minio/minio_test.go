@@ -0,0 +1,142 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// Объекты теста получают случайный префикс, бакет можно использовать повторно
+func TestImageMinioStorage_Contract(t *testing.T) {
+	endpoint := os.Getenv("TEST_MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_MINIO_ENDPOINT is not set")
+	}
+
+	bucket := os.Getenv("TEST_MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "porttest"
+	}
+	storage := NewMinioClient(&config.Config{
+		MinioEndpoint:     endpoint,
+		MinioRootUser:     os.Getenv("TEST_MINIO_USER"),
+		MinioRootPassword: os.Getenv("TEST_MINIO_PASSWORD"),
+		BucketName:        bucket,
+	})
+	if err := storage.InitMinio(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	porttest.RunObjectStorage(t, func(t *testing.T) port.ObjectStorage {
+		return storage
+	})
+}
+
+func TestRestrictedPolicy(t *testing.T) {
+	public := `{"Version":"2012-10-17","Statement":[{"Sid":"PublicRead","Effect":"Allow",` +
+		`"Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::images/*"]}]}`
+
+	policy, err := restrictedPolicy(public, "images")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Повторная инициализация не дублирует правило
+	policy, err = restrictedPolicy(policy, "images")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var parsed struct {
+		Statement []struct {
+			Sid      string   `json:"Sid"`
+			Effect   string   `json:"Effect"`
+			Resource []string `json:"Resource"`
+		} `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(policy), &parsed); err != nil {
+		t.Fatalf("Expected valid policy, got %v", err)
+	}
+	if len(parsed.Statement) != 2 || parsed.Statement[0].Sid != "PublicRead" {
+		t.Fatalf("Expected existing statement and one deny statement, got %s", policy)
+	}
+	deny := parsed.Statement[1]
+	if deny.Sid != restrictedStatementID || deny.Effect != "Deny" ||
+		len(deny.Resource) != 1 || deny.Resource[0] != "arn:aws:s3:::images/restricted/*" {
+		t.Errorf("Expected deny for restricted prefix, got %s", policy)
+	}
+
+	if _, err := restrictedPolicy("{", "images"); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+}
+
+// Бакет с публичным чтением: объекты под restricted/ все равно недоступны
+// без учетных данных
+func TestImageMinioStorage_RestrictedPrefix(t *testing.T) {
+	endpoint := os.Getenv("TEST_MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_MINIO_ENDPOINT is not set")
+	}
+
+	bucket := os.Getenv("TEST_MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "porttest"
+	}
+	bucket += "-restricted"
+	storage := NewMinioClient(&config.Config{
+		MinioEndpoint:     endpoint,
+		MinioRootUser:     os.Getenv("TEST_MINIO_USER"),
+		MinioRootPassword: os.Getenv("TEST_MINIO_PASSWORD"),
+		BucketName:        bucket,
+	}).(*ImageMinioStorage)
+	if err := storage.InitMinio(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx := context.Background()
+	public := fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Sid":"PublicRead","Effect":"Allow",`+
+		`"Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::%s/*"]}]}`, bucket)
+	if err := storage.mc.SetBucketPolicy(ctx, bucket, public); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Запрет добавляется к уже настроенной политике
+	if err := storage.InitMinio(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	id := uuid.NewString()
+	keys := map[string]bool{
+		"public/" + id + ".txt":                        true,
+		domain.RestrictedPrefix + "raw/" + id + ".txt": false,
+	}
+	for key := range keys {
+		if err := storage.PutObject(ctx, key, strings.NewReader("data"), 4, "text/plain"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer storage.RemoveObject(ctx, key)
+	}
+
+	anonymous, err := minio.New(endpoint, &minio.Options{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for key, readable := range keys {
+		_, err := anonymous.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+		if readable && err != nil {
+			t.Errorf("Expected anonymous access to %s, got %v", key, err)
+		}
+		if !readable && err == nil {
+			t.Errorf("Expected anonymous access to %s to be denied", key)
+		}
+	}
+}
@@ -34,15 +34,18 @@ func (i *ImageRepository) SaveObject(ctx context.Context, image domain.Image) er
 	query := `
         INSERT INTO images (
             id, filename, file_size, raw_image_object_key, 
-            processed_image_object_key, actions, status
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7)
+            processed_image_object_key, actions, status, raw_content_hash,
+            raw_content_type
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''))
         ON CONFLICT (id) DO UPDATE SET
             filename = EXCLUDED.filename,
             file_size = EXCLUDED.file_size,
             raw_image_object_key = EXCLUDED.raw_image_object_key,
             processed_image_object_key = EXCLUDED.processed_image_object_key,
             actions = EXCLUDED.actions,
-            status = EXCLUDED.status
+            status = EXCLUDED.status,
+            raw_content_hash = EXCLUDED.raw_content_hash,
+            raw_content_type = EXCLUDED.raw_content_type
     `
 
 	// Сериализуем actions в JSON (теперь это просто массив строк)
@@ -51,7 +54,7 @@ func (i *ImageRepository) SaveObject(ctx context.Context, image domain.Image) er
 		return fmt.Errorf("failed to marshal actions: %w", err)
 	}
 
-	_, err = i.PostgresDB.ExecWithRetry(ctx, createRetryStrategy(), query,
+	_, err = i.execWithRetry(ctx, query,
 		image.Id,
 		image.FileName,
 		image.FileSize,
@@ -59,6 +62,8 @@ func (i *ImageRepository) SaveObject(ctx context.Context, image domain.Image) er
 		image.ProcessedImageObjectKey,
 		actionsJSON,
 		image.Status,
+		image.RawContentHash,
+		image.RawContentType,
 	)
 
 	if err != nil {
@@ -77,13 +82,28 @@ func (i *ImageRepository) GetObjectByID(ctx context.Context, id string) (*domain
             raw_image_object_key, 
             processed_image_object_key, 
             actions, 
-            status 
+            status,
+            failure_reason,
+            phash,
+            raw_content_hash,
+            blurhash,
+            thumbhash,
+            dominant_color,
+            content_type,
+            encoding,
+            raw_content_type
         FROM images 
         WHERE id = $1
     `
 
 	var image domain.Image
 	var actionsJSON []byte
+	var failureReason sql.NullString
+	var phash sql.NullInt64
+	var contentHash sql.NullString
+	var blurHash, thumbHash, dominantColor sql.NullString
+	var contentType, rawContentType sql.NullString
+	var encodingJSON []byte
 
 	err := i.PostgresDB.QueryRowContext(ctx, query, id).Scan(
 		&image.Id,
@@ -93,6 +113,15 @@ func (i *ImageRepository) GetObjectByID(ctx context.Context, id string) (*domain
 		&image.ProcessedImageObjectKey,
 		&actionsJSON,
 		&image.Status,
+		&failureReason,
+		&phash,
+		&contentHash,
+		&blurHash,
+		&thumbHash,
+		&dominantColor,
+		&contentType,
+		&encodingJSON,
+		&rawContentType,
 	)
 
 	if err != nil {
@@ -107,13 +136,34 @@ func (i *ImageRepository) GetObjectByID(ctx context.Context, id string) (*domain
 		return nil, fmt.Errorf("failed to unmarshal actions for image %s: %w", id, err)
 	}
 
+	image.FailureReason = failureReason.String
+	image.RawContentHash = contentHash.String
+	image.ContentType = contentType.String
+	image.RawContentType = rawContentType.String
+	if encodingJSON != nil {
+		image.Encoding = &domain.Encoding{}
+		if err := json.Unmarshal(encodingJSON, image.Encoding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal encoding for image %s: %w", id, err)
+		}
+	}
+	image.Placeholder = domain.Placeholder{
+		BlurHash:      blurHash.String,
+		ThumbHash:     thumbHash.String,
+		DominantColor: dominantColor.String,
+	}
+	if phash.Valid {
+		// pHash хранится в BIGINT как знаковое число с тем же набором битов
+		hash := uint64(phash.Int64)
+		image.PerceptualHash = &hash
+	}
+
 	return &image, nil
 }
 
 func (i *ImageRepository) DeleteObjectByID(ctx context.Context, id string) error {
 	query := `DELETE FROM images WHERE id = $1`
 
-	result, err := i.PostgresDB.ExecWithRetry(ctx, createRetryStrategy(), query, id)
+	result, err := i.execWithRetry(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete image %s: %w", id, err)
 	}
@@ -137,9 +187,645 @@ func (i *ImageRepository) UpdateProcessedImage(ctx context.Context, id string, p
                   processed_image_object_key = $2
               WHERE id = $3`
 
-	_, err := i.PostgresDB.ExecContext(ctx, query, domain.ImageStatusDone, processedObjectKey, id)
+	result, err := i.execWithRetry(ctx, query, domain.ImageStatusDone, processedObjectKey, id)
+	if err != nil {
+		return fmt.Errorf("failed to update processed image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) UpdateRawObjectKey(ctx context.Context, id string, rawObjectKey string, remove func(ctx context.Context, key string) error) error {
+	err := i.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		var oldKey string
+		var hash sql.NullString
+		err := tx.QueryRowContext(ctx,
+			`SELECT raw_image_object_key, raw_content_hash FROM images WHERE id = $1 FOR UPDATE`,
+			id).Scan(&oldKey, &hash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+			}
+			return err
+		}
+
+		// Хеш сбрасывается вместе с ключом, поэтому повтор не снимет
+		// ссылку на blob второй раз
+		switch {
+		case hash.String != "":
+			err = releaseBlob(ctx, tx, hash.String, remove)
+		case oldKey != "" && oldKey != rawObjectKey:
+			err = remove(ctx, oldKey)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE images SET raw_image_object_key = $1, raw_content_hash = NULL WHERE id = $2`,
+			rawObjectKey, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrImageNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update raw object key for image %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) SaveMetadata(ctx context.Context, id string, metadata domain.ImageMetadata) error {
+	query := `UPDATE images SET metadata = $1 WHERE id = $2`
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	result, err := i.execWithRetry(ctx, query, metadataJSON, id)
+	if err != nil {
+		return fmt.Errorf("failed to save metadata for image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) GetMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+	query := `SELECT metadata FROM images WHERE id = $1`
+
+	var metadataJSON []byte
+	err := i.PostgresDB.QueryRowContext(ctx, query, id).Scan(&metadataJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get metadata for image %s: %w", id, err)
+	}
+
+	// NULL - воркер еще не обработал изображение
+	if metadataJSON == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+
+	var metadata domain.ImageMetadata
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata for image %s: %w", id, err)
+	}
+
+	return &metadata, nil
+}
+
+func (i *ImageRepository) SavePerceptualHash(ctx context.Context, id string, hash uint64) error {
+	query := `UPDATE images SET phash = $1 WHERE id = $2`
+
+	result, err := i.execWithRetry(ctx, query, int64(hash), id)
+	if err != nil {
+		return fmt.Errorf("failed to save perceptual hash for image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) FindSimilar(ctx context.Context, hash uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error) {
+	// Расстояние Хэмминга: число единиц в XOR хешей. Необработанные
+	// изображения, загруженные позже excludeID, не подходят: иначе две
+	// одновременные загрузки похожих изображений отклонили бы друг друга
+	query := `
+        SELECT id, filename, status, distance FROM (
+            SELECT id, filename, status,
+                   length(replace(((phash # $1)::bit(64))::text, '0', '')) AS distance
+            FROM images
+            WHERE phash IS NOT NULL AND id <> $2 AND status <> $3
+              AND (status = $6 OR (created_at, id) < (SELECT created_at, id FROM images WHERE id = $2))
+        ) AS candidates
+        WHERE distance <= $4
+        ORDER BY distance, id
+        LIMIT $5
+    `
+
+	rows, err := i.PostgresDB.QueryContext(ctx, query, int64(hash), excludeID, domain.ImageStatusFailed,
+		maxDistance, limit, domain.ImageStatusDone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar images: %w", err)
+	}
+	defer rows.Close()
+
+	var similar []domain.SimilarImage
+	for rows.Next() {
+		var image domain.SimilarImage
+		if err := rows.Scan(&image.Id, &image.FileName, &image.Status, &image.Distance); err != nil {
+			return nil, fmt.Errorf("failed to scan similar image: %w", err)
+		}
+		similar = append(similar, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate similar images: %w", err)
+	}
+
+	return similar, nil
+}
+
+func (i *ImageRepository) MarkFailed(ctx context.Context, id string, reason string) error {
+	query := `UPDATE images SET status = $1, failure_reason = $2 WHERE id = $3`
+
+	result, err := i.execWithRetry(ctx, query, domain.ImageStatusFailed, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark image %s as failed: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) MarkQuarantined(ctx context.Context, id string, rawObjectKey string, reason string) error {
+	query := `UPDATE images
+              SET status = $1, failure_reason = $2, raw_image_object_key = $3, raw_content_hash = NULL
+              WHERE id = $4`
+
+	result, err := i.execWithRetry(ctx, query,
+		domain.ImageStatusQuarantined, reason, rawObjectKey, id)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) SaveResultFormat(ctx context.Context, id string, contentType string, encoding *domain.Encoding) error {
+	var encodingJSON []byte
+	if encoding != nil {
+		var err error
+		if encodingJSON, err = json.Marshal(encoding); err != nil {
+			return fmt.Errorf("failed to marshal encoding: %w", err)
+		}
+	}
+
+	query := `UPDATE images SET content_type = $1, encoding = $2 WHERE id = $3`
+
+	result, err := i.execWithRetry(ctx, query, contentType, encodingJSON, id)
+	if err != nil {
+		return fmt.Errorf("failed to save result format for image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) SavePlaceholder(ctx context.Context, id string, placeholder domain.Placeholder) error {
+	query := `UPDATE images SET blurhash = $1, thumbhash = $2, dominant_color = $3 WHERE id = $4`
+
+	result, err := i.execWithRetry(ctx, query,
+		placeholder.BlurHash, placeholder.ThumbHash, placeholder.DominantColor, id)
+	if err != nil {
+		return fmt.Errorf("failed to save placeholder for image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) SaveColorProfile(ctx context.Context, id string, profile domain.ColorProfile) error {
+	histogramJSON, err := json.Marshal(profile.Histogram)
+	if err != nil {
+		return fmt.Errorf("failed to marshal color histogram: %w", err)
+	}
+
+	// Палитра заменяется целиком: повторная обработка не оставляет старых цветов
+	err = i.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE images SET color_histogram = $1 WHERE id = $2`, histogramJSON, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM image_palette WHERE image_id = $1`, id); err != nil {
+			return err
+		}
+
+		query := `
+            INSERT INTO image_palette (image_id, rank, color, share, lab_l, lab_a, lab_b)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+        `
+		for rank, color := range profile.Palette {
+			rgb, err := domain.ParseRGB(color.Color)
+			if err != nil {
+				return err
+			}
+			l, a, b := rgb.Lab()
+			if _, err := tx.ExecContext(ctx, query, id, rank, color.Color, color.Share, l, a, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save color profile for image %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error) {
+	var histogramJSON []byte
+	err := i.PostgresDB.QueryRowContext(ctx, `SELECT color_histogram FROM images WHERE id = $1`, id).Scan(&histogramJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get color profile for image %s: %w", id, err)
+	}
+
+	// NULL - воркер еще не обработал изображение
+	if histogramJSON == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+
+	profile := domain.ColorProfile{Palette: []domain.PaletteColor{}}
+	if err := json.Unmarshal(histogramJSON, &profile.Histogram); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal color histogram for image %s: %w", id, err)
+	}
+
+	rows, err := i.PostgresDB.QueryContext(ctx,
+		`SELECT color, share FROM image_palette WHERE image_id = $1 ORDER BY rank`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get palette for image %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var color domain.PaletteColor
+		if err := rows.Scan(&color.Color, &color.Share); err != nil {
+			return nil, fmt.Errorf("failed to scan palette color: %w", err)
+		}
+		profile.Palette = append(profile.Palette, color)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate palette: %w", err)
+	}
+
+	return &profile, nil
+}
+
+func (i *ImageRepository) SaveResponsiveManifest(ctx context.Context, id string, manifest domain.ResponsiveManifest) error {
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal responsive manifest: %w", err)
+	}
+
+	query := `UPDATE images SET responsive_manifest = $1 WHERE id = $2`
+
+	result, err := i.execWithRetry(ctx, query, manifestJSON, id)
+	if err != nil {
+		return fmt.Errorf("failed to save responsive manifest for image %s: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+	var (
+		status       string
+		manifestJSON []byte
+	)
+	err := i.PostgresDB.QueryRowContext(ctx,
+		`SELECT status, responsive_manifest FROM images WHERE id = $1`, id).Scan(&status, &manifestJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get responsive manifest for image %s: %w", id, err)
+	}
+
+	if manifestJSON == nil {
+		// Манифест сохраняется до смены статуса на Done:
+		// у обработанного изображения без манифеста Responsive не было
+		if status != domain.ImageStatusDone {
+			return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+		}
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrVariantNotFound)
+	}
+
+	var manifest domain.ResponsiveManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal responsive manifest for image %s: %w", id, err)
+	}
+
+	return &manifest, nil
+}
+
+func (i *ImageRepository) ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+	query := `
+        SELECT id, filename, file_size, actions, status, failure_reason,
+               blurhash, thumbhash, dominant_color
+        FROM images
+        WHERE ($1 = '' OR status = $1)
+        ORDER BY created_at DESC, id
+        LIMIT $2 OFFSET $3
+    `
+	args := []interface{}{filter.Status, filter.Limit, filter.Offset}
+
+	if filter.Color != "" {
+		rgb, err := domain.ParseRGB(filter.Color)
+		if err != nil {
+			return nil, err
+		}
+		l, a, b := rgb.Lab()
+
+		// Для каждого изображения берется ближайший подходящий цвет палитры
+		query = `
+            SELECT id, filename, file_size, actions, status, failure_reason,
+                   blurhash, thumbhash, dominant_color
+            FROM images
+            JOIN LATERAL (
+                SELECT min(sqrt(power(lab_l - $4, 2) + power(lab_a - $5, 2) + power(lab_b - $6, 2))) AS distance
+                FROM image_palette
+                WHERE image_palette.image_id = images.id AND share >= $7
+            ) AS nearest ON true
+            WHERE ($1 = '' OR status = $1) AND nearest.distance <= $8
+            ORDER BY nearest.distance, id
+            LIMIT $2 OFFSET $3
+        `
+		args = append(args, l, a, b, filter.MinShare, filter.ColorDistance)
+	}
+
+	rows, err := i.PostgresDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []domain.Image{}
+	for rows.Next() {
+		var image domain.Image
+		var actionsJSON []byte
+		var failureReason, blurHash, thumbHash, dominantColor sql.NullString
+		err := rows.Scan(&image.Id, &image.FileName, &image.FileSize, &actionsJSON, &image.Status,
+			&failureReason, &blurHash, &thumbHash, &dominantColor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan image: %w", err)
+		}
+		if err := json.Unmarshal(actionsJSON, &image.Actions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal actions for image %s: %w", image.Id, err)
+		}
+		image.FailureReason = failureReason.String
+		image.Placeholder = domain.Placeholder{
+			BlurHash:      blurHash.String,
+			ThumbHash:     thumbHash.String,
+			DominantColor: dominantColor.String,
+		}
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate images: %w", err)
+	}
+
+	return images, nil
+}
+
+func (i *ImageRepository) AcquireBlob(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error) {
+	// Вставка ждет, пока ReleaseBlob держит блокировку записи, и после ее
+	// удаления создает новую
+	query := `
+        INSERT INTO raw_blobs (hash, object_key, size, ref_count, uploaded)
+        VALUES ($1, $2, $3, 1, FALSE)
+        ON CONFLICT (hash) DO UPDATE SET ref_count = raw_blobs.ref_count + 1
+        RETURNING object_key, NOT uploaded
+    `
+
+	var key string
+	var upload bool
+	err := i.PostgresDB.Master.QueryRowContext(ctx, query, hash, objectKey, size).Scan(&key, &upload)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to acquire blob %s: %w", hash, err)
+	}
+
+	return key, upload, nil
+}
+
+func (i *ImageRepository) MarkBlobUploaded(ctx context.Context, hash string) error {
+	result, err := i.execWithRetry(ctx, `UPDATE raw_blobs SET uploaded = TRUE WHERE hash = $1`, hash)
+	if err != nil {
+		return fmt.Errorf("failed to mark blob %s uploaded: %w", hash, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for blob %s: %w", hash, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: hash=%s", domain.ErrBlobNotFound, hash)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) ReleaseBlob(ctx context.Context, hash string, remove func(ctx context.Context, key string) error) error {
+	err := i.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		return releaseBlob(ctx, tx, hash, remove)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrBlobNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to release blob %s: %w", hash, err)
+	}
+
+	return nil
+}
+
+// releaseBlob снимает ссылку на blob в транзакции tx
+func releaseBlob(ctx context.Context, tx *sql.Tx, hash string, remove func(ctx context.Context, key string) error) error {
+	var key string
+	var refCount int
+	err := tx.QueryRowContext(ctx,
+		`SELECT object_key, ref_count FROM raw_blobs WHERE hash = $1 AND ref_count > 0 FOR UPDATE`,
+		hash).Scan(&key, &refCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: hash=%s", domain.ErrBlobNotFound, hash)
+		}
+		return err
+	}
+	if refCount > 1 {
+		_, err := tx.ExecContext(ctx, `UPDATE raw_blobs SET ref_count = ref_count - 1 WHERE hash = $1`, hash)
+		return err
+	}
+
+	// Последняя ссылка: объект удаляется под блокировкой записи, чтобы
+	// новая загрузка того же содержимого не потеряла свой объект
+	if err := remove(ctx, key); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM raw_blobs WHERE hash = $1`, hash)
 	return err
+}
+
+func (i *ImageRepository) FindCachedResult(ctx context.Context, contentHash, pipeline, version string) (*domain.Image, error) {
+	query := `
+        SELECT images.id, images.processed_image_object_key, images.content_type, images.encoding
+        FROM processing_cache
+        JOIN images ON images.id = processing_cache.image_id
+        WHERE processing_cache.content_hash = $1
+          AND processing_cache.pipeline = $2
+          AND processing_cache.processor_version = $3
+          AND images.status = $4
+          AND images.processed_image_object_key IS NOT NULL
+    `
+
+	var image domain.Image
+	var contentType sql.NullString
+	var encodingJSON []byte
+	err := i.PostgresDB.QueryRowContext(ctx, query, contentHash, pipeline, version, domain.ImageStatusDone).Scan(
+		&image.Id, &image.ProcessedImageObjectKey, &contentType, &encodingJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrCacheMiss
+		}
+		return nil, fmt.Errorf("failed to look up processing cache: %w", err)
+	}
 
+	image.ContentType = contentType.String
+	if encodingJSON != nil {
+		image.Encoding = &domain.Encoding{}
+		if err := json.Unmarshal(encodingJSON, image.Encoding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal encoding for image %s: %w", image.Id, err)
+		}
+	}
+
+	return &image, nil
+}
+
+func (i *ImageRepository) SaveCachedResult(ctx context.Context, contentHash, pipeline, version, imageID string) error {
+	// Запись могла появиться параллельно или ссылаться на удаленный результат:
+	// в обоих случаях достаточно указать на свежий. Для удаленного
+	// изображения ничего не вставляется, вместо ошибки внешнего ключа
+	query := `
+        INSERT INTO processing_cache (content_hash, pipeline, processor_version, image_id)
+        SELECT $1, $2, $3, $4
+        WHERE EXISTS (SELECT 1 FROM images WHERE id = $4)
+        ON CONFLICT (content_hash, pipeline, processor_version) DO UPDATE SET
+            image_id = EXCLUDED.image_id,
+            created_at = CURRENT_TIMESTAMP
+    `
+
+	result, err := i.execWithRetry(ctx, query, contentHash, pipeline, version, imageID)
+	if err != nil {
+		return fmt.Errorf("failed to save processing cache entry for image %s: %w", imageID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", imageID, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, imageID)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) PurgeProcessingCache(ctx context.Context, version string) (int64, error) {
+	query := `DELETE FROM processing_cache WHERE processor_version <> $1`
+
+	result, err := i.execWithRetry(ctx, query, version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge processing cache: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// execWithRetry повторяет запрос, как dbpg.DB.ExecWithRetry, но прекращает
+// ожидание при отмене контекста: иначе отмененный запрос держал бы
+// вызывающего все паузы между попытками
+func (i *ImageRepository) execWithRetry(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := retry.DoContext(ctx, createRetryStrategy(), func() error {
+		r, err := i.PostgresDB.ExecContext(ctx, query, args...)
+		if err == nil {
+			result = r
+		}
+		return err
+	})
+	return result, err
 }
 
 func createRetryStrategy() retry.Strategy {
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	"github.com/dontpanicw/ImageProcessor/pkg/migrations"
+)
+
+// Тест выполняется на отдельной базе: каждый подтест очищает таблицы
+func TestImageRepository_Contract(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	repo := NewImageRepository(&config.Config{MasterDSN: dsn}).(*ImageRepository)
+	t.Cleanup(func() { _ = repo.PostgresDB.Master.Close() })
+	if err := migrations.Migrate(repo.PostgresDB.Master, migrations.DialectPostgres); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	porttest.RunRepositoryDB(t, func(t *testing.T) port.RepositoryDB {
+		_, err := repo.PostgresDB.Master.Exec(`TRUNCATE images, raw_blobs CASCADE`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return repo
+	})
+}
@@ -0,0 +1,795 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"modernc.org/sqlite"
+)
+
+var _ port.RepositoryDB = (*ImageRepository)(nil)
+
+func init() {
+	// В SQLite нет popcount: расстояние Хэмминга между pHash считается в Go
+	sqlite.MustRegisterDeterministicScalarFunction("hamming_distance", 2,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			a, ok := args[0].(int64)
+			if !ok {
+				return nil, nil
+			}
+			b, ok := args[1].(int64)
+			if !ok {
+				return nil, nil
+			}
+			return int64(bits.OnesCount64(uint64(a ^ b))), nil
+		})
+}
+
+type ImageRepository struct {
+	DB *sql.DB
+}
+
+// Open открывает базу cfg.SQLitePath, создавая каталог при необходимости.
+// WAL позволяет API и воркеру читать параллельно с записью, busy_timeout
+// ждет освобождения блокировки вместо немедленной ошибки SQLITE_BUSY, а
+// транзакции сразу берут блокировку на запись
+func Open(cfg *config.Config) (*sql.DB, error) {
+	if dir := filepath.Dir(cfg.SQLitePath); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory %s: %w", dir, err)
+		}
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.SQLitePath+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", cfg.SQLitePath, err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", cfg.SQLitePath, err)
+	}
+
+	return db, nil
+}
+
+// NewImageRepository создает репозиторий поверх базы, открытой Open
+// и подготовленной миграциями диалекта sqlite
+func NewImageRepository(db *sql.DB) *ImageRepository {
+	return &ImageRepository{DB: db}
+}
+
+func (i *ImageRepository) SaveObject(ctx context.Context, image domain.Image) error {
+	query := `
+        INSERT INTO images (
+            id, filename, file_size, raw_image_object_key,
+            processed_image_object_key, actions, status, raw_content_hash,
+            raw_content_type
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))
+        ON CONFLICT (id) DO UPDATE SET
+            filename = excluded.filename,
+            file_size = excluded.file_size,
+            raw_image_object_key = excluded.raw_image_object_key,
+            processed_image_object_key = excluded.processed_image_object_key,
+            actions = excluded.actions,
+            status = excluded.status,
+            raw_content_hash = excluded.raw_content_hash,
+            raw_content_type = excluded.raw_content_type
+    `
+
+	actionsJSON, err := json.Marshal(image.Actions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal actions: %w", err)
+	}
+
+	_, err = i.DB.ExecContext(ctx, query,
+		image.Id,
+		image.FileName,
+		image.FileSize,
+		image.RawImageObjectKey,
+		image.ProcessedImageObjectKey,
+		string(actionsJSON),
+		image.Status,
+		image.RawContentHash,
+		image.RawContentType,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) GetObjectByID(ctx context.Context, id string) (*domain.Image, error) {
+	query := `
+        SELECT
+            id,
+            filename,
+            file_size,
+            raw_image_object_key,
+            processed_image_object_key,
+            actions,
+            status,
+            failure_reason,
+            phash,
+            raw_content_hash,
+            blurhash,
+            thumbhash,
+            dominant_color,
+            content_type,
+            encoding,
+            raw_content_type
+        FROM images
+        WHERE id = ?
+    `
+
+	var image domain.Image
+	var actionsJSON []byte
+	var processedKey, failureReason sql.NullString
+	var phash sql.NullInt64
+	var contentHash sql.NullString
+	var blurHash, thumbHash, dominantColor sql.NullString
+	var contentType, rawContentType sql.NullString
+	var encodingJSON []byte
+
+	err := i.DB.QueryRowContext(ctx, query, id).Scan(
+		&image.Id,
+		&image.FileName,
+		&image.FileSize,
+		&image.RawImageObjectKey,
+		&processedKey,
+		&actionsJSON,
+		&image.Status,
+		&failureReason,
+		&phash,
+		&contentHash,
+		&blurHash,
+		&thumbHash,
+		&dominantColor,
+		&contentType,
+		&encodingJSON,
+		&rawContentType,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get image by id %s: %w", id, err)
+	}
+
+	if err := json.Unmarshal(actionsJSON, &image.Actions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal actions for image %s: %w", id, err)
+	}
+
+	image.ProcessedImageObjectKey = processedKey.String
+	image.FailureReason = failureReason.String
+	image.RawContentHash = contentHash.String
+	image.ContentType = contentType.String
+	image.RawContentType = rawContentType.String
+	if encodingJSON != nil {
+		image.Encoding = &domain.Encoding{}
+		if err := json.Unmarshal(encodingJSON, image.Encoding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal encoding for image %s: %w", id, err)
+		}
+	}
+	image.Placeholder = domain.Placeholder{
+		BlurHash:      blurHash.String,
+		ThumbHash:     thumbHash.String,
+		DominantColor: dominantColor.String,
+	}
+	if phash.Valid {
+		// pHash хранится в INTEGER как знаковое число с тем же набором битов
+		hash := uint64(phash.Int64)
+		image.PerceptualHash = &hash
+	}
+
+	return &image, nil
+}
+
+func (i *ImageRepository) DeleteObjectByID(ctx context.Context, id string) error {
+	result, err := i.DB.ExecContext(ctx, `DELETE FROM images WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) UpdateProcessedImage(ctx context.Context, id string, processedObjectKey string) error {
+	query := `UPDATE images SET status = ?, processed_image_object_key = ? WHERE id = ?`
+
+	result, err := i.DB.ExecContext(ctx, query, domain.ImageStatusDone, processedObjectKey, id)
+	if err != nil {
+		return fmt.Errorf("failed to update processed image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) UpdateRawObjectKey(ctx context.Context, id string, rawObjectKey string, remove func(ctx context.Context, key string) error) error {
+	// Пустой UPDATE берет блокировку записи базы и возвращает текущий
+	// оригинал изображения
+	err := i.withTx(ctx, func(tx *sql.Tx) error {
+		var oldKey string
+		var hash sql.NullString
+		err := tx.QueryRowContext(ctx, `
+            UPDATE images SET raw_content_hash = raw_content_hash WHERE id = ?
+            RETURNING raw_image_object_key, raw_content_hash
+        `, id).Scan(&oldKey, &hash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+			}
+			return err
+		}
+
+		// Хеш сбрасывается вместе с ключом, поэтому повтор не снимет
+		// ссылку на blob второй раз
+		switch {
+		case hash.String != "":
+			err = releaseBlob(ctx, tx, hash.String, remove)
+		case oldKey != "" && oldKey != rawObjectKey:
+			err = remove(ctx, oldKey)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE images SET raw_image_object_key = ?, raw_content_hash = NULL WHERE id = ?`,
+			rawObjectKey, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrImageNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update raw object key for image %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) SaveMetadata(ctx context.Context, id string, metadata domain.ImageMetadata) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	result, err := i.DB.ExecContext(ctx, `UPDATE images SET metadata = ? WHERE id = ?`, string(metadataJSON), id)
+	if err != nil {
+		return fmt.Errorf("failed to save metadata for image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) GetMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+	var metadataJSON []byte
+	err := i.DB.QueryRowContext(ctx, `SELECT metadata FROM images WHERE id = ?`, id).Scan(&metadataJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get metadata for image %s: %w", id, err)
+	}
+
+	// NULL - воркер еще не обработал изображение
+	if metadataJSON == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+
+	var metadata domain.ImageMetadata
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata for image %s: %w", id, err)
+	}
+
+	return &metadata, nil
+}
+
+func (i *ImageRepository) SavePerceptualHash(ctx context.Context, id string, hash uint64) error {
+	result, err := i.DB.ExecContext(ctx, `UPDATE images SET phash = ? WHERE id = ?`, int64(hash), id)
+	if err != nil {
+		return fmt.Errorf("failed to save perceptual hash for image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) FindSimilar(ctx context.Context, hash uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error) {
+	// Необработанные изображения, загруженные позже excludeID, не подходят,
+	// как в Postgres
+	query := `
+        SELECT id, filename, status, distance FROM (
+            SELECT id, filename, status, hamming_distance(phash, ?) AS distance
+            FROM images
+            WHERE phash IS NOT NULL AND id <> ? AND status <> ?
+              AND (status = ? OR (created_at, id) < (SELECT created_at, id FROM images WHERE id = ?))
+        )
+        WHERE distance <= ?
+        ORDER BY distance, id
+        LIMIT ?
+    `
+
+	rows, err := i.DB.QueryContext(ctx, query, int64(hash), excludeID, domain.ImageStatusFailed,
+		domain.ImageStatusDone, excludeID, maxDistance, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar images: %w", err)
+	}
+	defer rows.Close()
+
+	var similar []domain.SimilarImage
+	for rows.Next() {
+		var image domain.SimilarImage
+		if err := rows.Scan(&image.Id, &image.FileName, &image.Status, &image.Distance); err != nil {
+			return nil, fmt.Errorf("failed to scan similar image: %w", err)
+		}
+		similar = append(similar, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate similar images: %w", err)
+	}
+
+	return similar, nil
+}
+
+func (i *ImageRepository) MarkFailed(ctx context.Context, id string, reason string) error {
+	query := `UPDATE images SET status = ?, failure_reason = ? WHERE id = ?`
+
+	result, err := i.DB.ExecContext(ctx, query, domain.ImageStatusFailed, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark image %s as failed: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) MarkQuarantined(ctx context.Context, id string, rawObjectKey string, reason string) error {
+	query := `UPDATE images
+              SET status = ?, failure_reason = ?, raw_image_object_key = ?, raw_content_hash = NULL
+              WHERE id = ?`
+
+	result, err := i.DB.ExecContext(ctx, query, domain.ImageStatusQuarantined, reason, rawObjectKey, id)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) SaveResultFormat(ctx context.Context, id string, contentType string, encoding *domain.Encoding) error {
+	var encodingJSON sql.NullString
+	if encoding != nil {
+		data, err := json.Marshal(encoding)
+		if err != nil {
+			return fmt.Errorf("failed to marshal encoding: %w", err)
+		}
+		encodingJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	query := `UPDATE images SET content_type = ?, encoding = ? WHERE id = ?`
+
+	result, err := i.DB.ExecContext(ctx, query, contentType, encodingJSON, id)
+	if err != nil {
+		return fmt.Errorf("failed to save result format for image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) SavePlaceholder(ctx context.Context, id string, placeholder domain.Placeholder) error {
+	query := `UPDATE images SET blurhash = ?, thumbhash = ?, dominant_color = ? WHERE id = ?`
+
+	result, err := i.DB.ExecContext(ctx, query,
+		placeholder.BlurHash, placeholder.ThumbHash, placeholder.DominantColor, id)
+	if err != nil {
+		return fmt.Errorf("failed to save placeholder for image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) SaveColorProfile(ctx context.Context, id string, profile domain.ColorProfile) error {
+	histogramJSON, err := json.Marshal(profile.Histogram)
+	if err != nil {
+		return fmt.Errorf("failed to marshal color histogram: %w", err)
+	}
+
+	// Палитра заменяется целиком: повторная обработка не оставляет старых цветов
+	err = i.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE images SET color_histogram = ? WHERE id = ?`, string(histogramJSON), id)
+		if err != nil {
+			return err
+		}
+		if err := checkAffected(result, id); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM image_palette WHERE image_id = ?`, id); err != nil {
+			return err
+		}
+
+		query := `
+            INSERT INTO image_palette (image_id, rank, color, share, lab_l, lab_a, lab_b)
+            VALUES (?, ?, ?, ?, ?, ?, ?)
+        `
+		for rank, color := range profile.Palette {
+			rgb, err := domain.ParseRGB(color.Color)
+			if err != nil {
+				return err
+			}
+			l, a, b := rgb.Lab()
+			if _, err := tx.ExecContext(ctx, query, id, rank, color.Color, color.Share, l, a, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save color profile for image %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error) {
+	var histogramJSON []byte
+	err := i.DB.QueryRowContext(ctx, `SELECT color_histogram FROM images WHERE id = ?`, id).Scan(&histogramJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get color profile for image %s: %w", id, err)
+	}
+
+	// NULL - воркер еще не обработал изображение
+	if histogramJSON == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+
+	profile := domain.ColorProfile{Palette: []domain.PaletteColor{}}
+	if err := json.Unmarshal(histogramJSON, &profile.Histogram); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal color histogram for image %s: %w", id, err)
+	}
+
+	rows, err := i.DB.QueryContext(ctx,
+		`SELECT color, share FROM image_palette WHERE image_id = ? ORDER BY rank`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get palette for image %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var color domain.PaletteColor
+		if err := rows.Scan(&color.Color, &color.Share); err != nil {
+			return nil, fmt.Errorf("failed to scan palette color: %w", err)
+		}
+		profile.Palette = append(profile.Palette, color)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate palette: %w", err)
+	}
+
+	return &profile, nil
+}
+
+func (i *ImageRepository) SaveResponsiveManifest(ctx context.Context, id string, manifest domain.ResponsiveManifest) error {
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal responsive manifest: %w", err)
+	}
+
+	result, err := i.DB.ExecContext(ctx, `UPDATE images SET responsive_manifest = ? WHERE id = ?`, string(manifestJSON), id)
+	if err != nil {
+		return fmt.Errorf("failed to save responsive manifest for image %s: %w", id, err)
+	}
+
+	return checkAffected(result, id)
+}
+
+func (i *ImageRepository) GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+	var (
+		status       string
+		manifestJSON []byte
+	)
+	err := i.DB.QueryRowContext(ctx,
+		`SELECT status, responsive_manifest FROM images WHERE id = ?`, id).Scan(&status, &manifestJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("image with id %s not found: %w", id, domain.ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("failed to get responsive manifest for image %s: %w", id, err)
+	}
+
+	if manifestJSON == nil {
+		// Манифест сохраняется до смены статуса на Done:
+		// у обработанного изображения без манифеста Responsive не было
+		if status != domain.ImageStatusDone {
+			return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+		}
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrVariantNotFound)
+	}
+
+	var manifest domain.ResponsiveManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal responsive manifest for image %s: %w", id, err)
+	}
+
+	return &manifest, nil
+}
+
+func (i *ImageRepository) ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+	// rowid сохраняется при upsert и упорядочивает изображения,
+	// созданные в одну миллисекунду
+	query := `
+        SELECT id, filename, file_size, actions, status, failure_reason,
+               blurhash, thumbhash, dominant_color
+        FROM images
+        WHERE (?1 = '' OR status = ?1)
+        ORDER BY created_at DESC, rowid DESC
+        LIMIT ?2 OFFSET ?3
+    `
+	args := []interface{}{filter.Status, filter.Limit, filter.Offset}
+
+	if filter.Color != "" {
+		rgb, err := domain.ParseRGB(filter.Color)
+		if err != nil {
+			return nil, err
+		}
+		l, a, b := rgb.Lab()
+
+		// Для каждого изображения берется ближайший подходящий цвет палитры.
+		// Сравниваются квадраты расстояний: sqrt в SQLite может отсутствовать
+		query = `
+            SELECT id, filename, file_size, actions, status, failure_reason,
+                   blurhash, thumbhash, dominant_color
+            FROM (
+                SELECT images.*, (
+                    SELECT min((lab_l - ?4) * (lab_l - ?4) + (lab_a - ?5) * (lab_a - ?5) + (lab_b - ?6) * (lab_b - ?6))
+                    FROM image_palette
+                    WHERE image_palette.image_id = images.id AND share >= ?7
+                ) AS distance
+                FROM images
+                WHERE (?1 = '' OR status = ?1)
+            )
+            WHERE distance <= ?8
+            ORDER BY distance, id
+            LIMIT ?2 OFFSET ?3
+        `
+		args = append(args, l, a, b, filter.MinShare, filter.ColorDistance*filter.ColorDistance)
+	}
+
+	rows, err := i.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []domain.Image{}
+	for rows.Next() {
+		var image domain.Image
+		var actionsJSON []byte
+		var failureReason, blurHash, thumbHash, dominantColor sql.NullString
+		err := rows.Scan(&image.Id, &image.FileName, &image.FileSize, &actionsJSON, &image.Status,
+			&failureReason, &blurHash, &thumbHash, &dominantColor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan image: %w", err)
+		}
+		if err := json.Unmarshal(actionsJSON, &image.Actions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal actions for image %s: %w", image.Id, err)
+		}
+		image.FailureReason = failureReason.String
+		image.Placeholder = domain.Placeholder{
+			BlurHash:      blurHash.String,
+			ThumbHash:     thumbHash.String,
+			DominantColor: dominantColor.String,
+		}
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate images: %w", err)
+	}
+
+	return images, nil
+}
+
+func (i *ImageRepository) AcquireBlob(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error) {
+	var key string
+	var upload bool
+
+	// Вставка и увеличение счетчика в одной транзакции: признак xmax,
+	// как в Postgres, недоступен
+	err := i.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+            INSERT INTO raw_blobs (hash, object_key, size, ref_count, uploaded)
+            VALUES (?, ?, ?, 1, 0)
+            ON CONFLICT (hash) DO NOTHING
+        `, hash, objectKey, size)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 1 {
+			key, upload = objectKey, true
+			return nil
+		}
+
+		return tx.QueryRowContext(ctx,
+			`UPDATE raw_blobs SET ref_count = ref_count + 1 WHERE hash = ? RETURNING object_key, NOT uploaded`,
+			hash).Scan(&key, &upload)
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to acquire blob %s: %w", hash, err)
+	}
+
+	return key, upload, nil
+}
+
+func (i *ImageRepository) MarkBlobUploaded(ctx context.Context, hash string) error {
+	result, err := i.DB.ExecContext(ctx, `UPDATE raw_blobs SET uploaded = 1 WHERE hash = ?`, hash)
+	if err != nil {
+		return fmt.Errorf("failed to mark blob %s uploaded: %w", hash, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for blob %s: %w", hash, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: hash=%s", domain.ErrBlobNotFound, hash)
+	}
+
+	return nil
+}
+
+func (i *ImageRepository) ReleaseBlob(ctx context.Context, hash string, remove func(ctx context.Context, key string) error) error {
+	err := i.withTx(ctx, func(tx *sql.Tx) error {
+		return releaseBlob(ctx, tx, hash, remove)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrBlobNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to release blob %s: %w", hash, err)
+	}
+
+	return nil
+}
+
+// releaseBlob снимает ссылку на blob в транзакции tx. Первый UPDATE
+// берет блокировку записи базы: до конца транзакции AcquireBlob того же
+// содержимого ждет
+func releaseBlob(ctx context.Context, tx *sql.Tx, hash string, remove func(ctx context.Context, key string) error) error {
+	var key string
+	var refCount int
+	err := tx.QueryRowContext(ctx, `
+        UPDATE raw_blobs SET ref_count = ref_count - 1
+        WHERE hash = ? AND ref_count > 0
+        RETURNING object_key, ref_count
+    `, hash).Scan(&key, &refCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: hash=%s", domain.ErrBlobNotFound, hash)
+		}
+		return err
+	}
+	if refCount > 0 {
+		return nil
+	}
+
+	if err := remove(ctx, key); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM raw_blobs WHERE hash = ?`, hash)
+	return err
+}
+
+func (i *ImageRepository) FindCachedResult(ctx context.Context, contentHash, pipeline, version string) (*domain.Image, error) {
+	query := `
+        SELECT images.id, images.processed_image_object_key, images.content_type, images.encoding
+        FROM processing_cache
+        JOIN images ON images.id = processing_cache.image_id
+        WHERE processing_cache.content_hash = ?
+          AND processing_cache.pipeline = ?
+          AND processing_cache.processor_version = ?
+          AND images.status = ?
+          AND images.processed_image_object_key IS NOT NULL
+    `
+
+	var image domain.Image
+	var contentType sql.NullString
+	var encodingJSON []byte
+	err := i.DB.QueryRowContext(ctx, query, contentHash, pipeline, version, domain.ImageStatusDone).Scan(
+		&image.Id, &image.ProcessedImageObjectKey, &contentType, &encodingJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrCacheMiss
+		}
+		return nil, fmt.Errorf("failed to look up processing cache: %w", err)
+	}
+
+	image.ContentType = contentType.String
+	if encodingJSON != nil {
+		image.Encoding = &domain.Encoding{}
+		if err := json.Unmarshal(encodingJSON, image.Encoding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal encoding for image %s: %w", image.Id, err)
+		}
+	}
+
+	return &image, nil
+}
+
+func (i *ImageRepository) SaveCachedResult(ctx context.Context, contentHash, pipeline, version, imageID string) error {
+	// Запись могла появиться параллельно или ссылаться на удаленный результат:
+	// в обоих случаях достаточно указать на свежий. Для удаленного
+	// изображения ничего не вставляется, вместо ошибки внешнего ключа
+	query := `
+        INSERT INTO processing_cache (content_hash, pipeline, processor_version, image_id)
+        SELECT ?, ?, ?, ?
+        WHERE EXISTS (SELECT 1 FROM images WHERE id = ?4)
+        ON CONFLICT (content_hash, pipeline, processor_version) DO UPDATE SET
+            image_id = excluded.image_id,
+            created_at = CURRENT_TIMESTAMP
+    `
+
+	result, err := i.DB.ExecContext(ctx, query, contentHash, pipeline, version, imageID)
+	if err != nil {
+		return fmt.Errorf("failed to save processing cache entry for image %s: %w", imageID, err)
+	}
+
+	return checkAffected(result, imageID)
+}
+
+func (i *ImageRepository) PurgeProcessingCache(ctx context.Context, version string) (int64, error) {
+	result, err := i.DB.ExecContext(ctx, `DELETE FROM processing_cache WHERE processor_version <> ?`, version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge processing cache: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (i *ImageRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkAffected возвращает ErrImageNotFound, если запрос не изменил ни одной строки
+func checkAffected(result sql.Result, id string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected for image %s: %w", id, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id=%s", domain.ErrImageNotFound, id)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/internal/port/porttest"
+	"github.com/dontpanicw/ImageProcessor/pkg/migrations"
+)
+
+func newTestRepository(t *testing.T) *ImageRepository {
+	t.Helper()
+	db, err := Open(&config.Config{SQLitePath: filepath.Join(t.TempDir(), "db", "images.db")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := migrations.Migrate(db, migrations.DialectSQLite); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return NewImageRepository(db)
+}
+
+func saveImage(t *testing.T, repo *ImageRepository, id, status string) {
+	t.Helper()
+	image := domain.Image{Id: id, FileName: id + ".jpg", FileSize: 10, Actions: []string{domain.ResizeAction}, Status: status}
+	if err := repo.SaveObject(context.Background(), image); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestImageRepository_Contract(t *testing.T) {
+	porttest.RunRepositoryDB(t, func(t *testing.T) port.RepositoryDB {
+		return newTestRepository(t)
+	})
+}
+
+func TestMigrate_Idempotent(t *testing.T) {
+	repo := newTestRepository(t)
+
+	if err := migrations.Migrate(repo.DB, migrations.DialectSQLite); err != nil {
+		t.Fatalf("Expected repeated migration to succeed, got %v", err)
+	}
+
+	// Статус проверяется ограничением схемы
+	err := repo.SaveObject(context.Background(), domain.Image{
+		Id: "a", FileName: "a.jpg", FileSize: 10, Actions: []string{}, Status: "Unknown",
+	})
+	if err == nil {
+		t.Error("Expected check constraint error for unknown status, got nil")
+	}
+	saveImage(t, repo, "b", domain.ImageStatusQuarantined)
+}
@@ -0,0 +1,115 @@
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.Scanner = (*Scanner)(nil)
+
+// chunkSize - размер блока INSTREAM. clamd отклоняет поток целиком,
+// если он больше StreamMaxLength, размер блока на это не влияет
+const chunkSize = 64 << 10
+
+// ErrScanFailed - clamd вернул ошибку вместо результата проверки
+var ErrScanFailed = errors.New("clamd scan failed")
+
+// Scanner проверяет файлы через clamd по TCP командой INSTREAM
+type Scanner struct {
+	addr    string
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+func NewScanner(cfg *config.Config) *Scanner {
+	return &Scanner{
+		addr:    cfg.ClamAVAddr,
+		timeout: cfg.ClamAVTimeout,
+	}
+}
+
+// Scan передает содержимое в clamd блоками вида
+// <длина uint32 big-endian><данные> и завершает поток блоком нулевой длины.
+// Ответ: "stream: OK", "stream: <сигнатура> FOUND" или "<причина> ERROR"
+func (s *Scanner) Scan(ctx context.Context, r io.Reader) (*domain.ScanResult, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd at %s: %w", s.addr, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set clamd deadline: %w", err)
+		}
+	}
+
+	// Префикс z - команда и ответ завершаются нулевым байтом
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return nil, fmt.Errorf("failed to send INSTREAM: %w", err)
+	}
+
+	chunk := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				// clamd закрывает соединение при превышении StreamMaxLength,
+				// причина будет в ответе
+				break
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read file for scan: %w", readErr)
+		}
+	}
+	// Ошибку записи завершающего блока игнорируем по той же причине
+	_, _ = conn.Write([]byte{0, 0, 0, 0})
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// parseReply разбирает ответ clamd на INSTREAM
+func parseReply(reply string) (*domain.ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+
+	switch {
+	case result == "OK":
+		return &domain.ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &domain.ScanResult{
+			Infected:  true,
+			Signature: strings.TrimSuffix(result, " FOUND"),
+		}, nil
+	case reply == "":
+		return nil, fmt.Errorf("%w: empty reply", ErrScanFailed)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
@@ -0,0 +1,177 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/config"
+)
+
+// clamdStub - сервер с протоколом INSTREAM clamd. Находит "сигнатуру"
+// EICAR в содержимом и отклоняет потоки длиннее maxStream
+type clamdStub struct {
+	listener  net.Listener
+	maxStream int
+	received  chan []byte
+}
+
+func newClamdStub(t *testing.T, maxStream int) *clamdStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	stub := &clamdStub{listener: listener, maxStream: maxStream, received: make(chan []byte, 1)}
+	t.Cleanup(func() { _ = listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (s *clamdStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *clamdStub) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		_, _ = io.WriteString(conn, "UNKNOWN COMMAND\x00")
+		return
+	}
+
+	var stream []byte
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		stream = append(stream, chunk...)
+		if s.maxStream > 0 && len(stream) > s.maxStream {
+			_, _ = io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+			// Дочитываем остаток, чтобы закрытие не сбросило ответ
+			_ = conn.(*net.TCPConn).CloseWrite()
+			_, _ = io.Copy(io.Discard, r)
+			return
+		}
+	}
+	s.received <- stream
+
+	if bytes.Contains(stream, []byte("EICAR")) {
+		_, _ = io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+		return
+	}
+	_, _ = io.WriteString(conn, "stream: OK\x00")
+}
+
+func newTestScanner(addr string) *Scanner {
+	return NewScanner(&config.Config{ClamAVAddr: addr, ClamAVTimeout: 5 * time.Second})
+}
+
+func TestScan(t *testing.T) {
+	stub := newClamdStub(t, 0)
+	scanner := newTestScanner(stub.listener.Addr().String())
+
+	// Больше одного блока INSTREAM
+	clean := bytes.Repeat([]byte{0xAB}, chunkSize*2+100)
+	result, err := scanner.Scan(context.Background(), bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Infected {
+		t.Errorf("Expected clean result, got %+v", result)
+	}
+	if received := <-stub.received; !bytes.Equal(received, clean) {
+		t.Errorf("Expected clamd to receive %d bytes, got %d", len(clean), len(received))
+	}
+
+	result, err = scanner.Scan(context.Background(), strings.NewReader("X5O!P%@AP EICAR test"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	<-stub.received
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("Expected Eicar-Test-Signature, got %+v", result)
+	}
+}
+
+func TestScan_StreamLimit(t *testing.T) {
+	stub := newClamdStub(t, 10)
+	scanner := newTestScanner(stub.listener.Addr().String())
+
+	_, err := scanner.Scan(context.Background(), bytes.NewReader(bytes.Repeat([]byte{1}, chunkSize)))
+	if !errors.Is(err, ErrScanFailed) {
+		t.Fatalf("Expected ErrScanFailed, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("Expected clamd reason in error, got %v", err)
+	}
+}
+
+func TestScan_Unavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	if _, err := newTestScanner(addr).Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("Expected error for unavailable clamd, got nil")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		{reply: "stream: OK\x00"},
+		{reply: "stream: OK\n"},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND\x00", infected: true, signature: "Win.Test.EICAR_HDB-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR\x00", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := parseReply(tt.reply)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for reply %q, got %+v", tt.reply, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected no error for reply %q, got %v", tt.reply, err)
+			continue
+		}
+		if result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("Expected infected=%t signature=%q for reply %q, got %+v",
+				tt.infected, tt.signature, tt.reply, result)
+		}
+	}
+}
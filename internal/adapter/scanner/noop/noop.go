@@ -0,0 +1,22 @@
+package noop
+
+import (
+	"context"
+	"io"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+var _ port.Scanner = (*Scanner)(nil)
+
+// Scanner считает чистым любой файл. Используется, когда проверка выключена
+type Scanner struct{}
+
+func NewScanner() *Scanner {
+	return &Scanner{}
+}
+
+func (s *Scanner) Scan(ctx context.Context, r io.Reader) (*domain.ScanResult, error) {
+	return &domain.ScanResult{}, nil
+}
@@ -1,13 +1,20 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/dontpanicw/ImageProcessor/config"
 	"github.com/dontpanicw/ImageProcessor/internal/adapter/broker"
+	brokernats "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/nats"
+	brokerpostgres "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/postgres"
+	brokerrabbitmq "github.com/dontpanicw/ImageProcessor/internal/adapter/broker/rabbitmq"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/filesystem"
 	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/minio"
 	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/postgres"
+	"github.com/dontpanicw/ImageProcessor/internal/adapter/repository/sqlite"
 	"github.com/dontpanicw/ImageProcessor/internal/input/http"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
 	"github.com/dontpanicw/ImageProcessor/internal/usecases"
 	"github.com/dontpanicw/ImageProcessor/pkg/migrations"
 	"log"
@@ -17,24 +24,25 @@ import (
 )
 
 func Start(cfg *config.Config) error {
-	// Retry подключения к PostgreSQL
 	var db *sql.DB
+	var imageRepo port.RepositoryDB
 	var err error
 
-	for i := 0; i < 10; i++ {
-		db, err = sql.Open("postgres", cfg.MasterDSN)
-		if err == nil {
-			err = db.Ping()
-			if err == nil {
-				break
-			}
+	switch cfg.DBDriver {
+	case config.DBDriverSQLite:
+		db, err = sqlite.Open(cfg)
+		if err != nil {
+			return err
 		}
-		log.Printf("Waiting for PostgreSQL... (attempt %d/10): %v", i+1, err)
-		time.Sleep(3 * time.Second)
-	}
-
-	if err != nil {
-		return fmt.Errorf("failed to connect to database after 10 attempts: %w", err)
+		log.Printf("Opened SQLite database %s", cfg.SQLitePath)
+		imageRepo = sqlite.NewImageRepository(db)
+	default:
+		db, err = connectPostgres(cfg)
+		if err != nil {
+			return err
+		}
+		log.Print("Connected to PostgreSQL")
+		imageRepo = postgres.NewImageRepository(cfg)
 	}
 	defer func() {
 		err = db.Close()
@@ -42,34 +50,104 @@ func Start(cfg *config.Config) error {
 			log.Printf("Failed to close database: %v", err)
 		}
 	}()
-	log.Print("Connected to PostgreSQL")
 
-	if err := migrations.Migrate(db); err != nil {
+	if err := migrations.Migrate(db, cfg.DBDriver); err != nil {
 		fmt.Println(err)
 		return err
 	}
 	log.Print("Migrations applied successfully")
 
-	imageRepo := postgres.NewImageRepository(cfg)
-	minioRepo := minio.NewMinioClient(cfg)
+	var minioRepo port.ObjectStorage
+	switch cfg.StorageDriver {
+	case config.StorageDriverFilesystem:
+		minioRepo = filesystem.NewFileStorage(cfg)
+	default:
+		minioRepo = minio.NewMinioClient(cfg)
+	}
 
-	// Инициализируем MinIO
+	// Инициализируем хранилище объектов
 	if err := minioRepo.InitMinio(); err != nil {
-		return fmt.Errorf("failed to initialize MinIO: %w", err)
+		return fmt.Errorf("failed to initialize %s storage: %w", cfg.StorageDriver, err)
 	}
-	log.Print("MinIO initialized successfully")
+	log.Printf("Object storage %s initialized successfully", cfg.StorageDriver)
 
-	// Инициализируем Kafka producer
-	kafkaProducer := broker.NewProducer(cfg)
-	log.Print("Kafka producer initialized")
+	var producer port.Producer
+	switch cfg.QueueDriver {
+	case config.QueueDriverPostgres:
+		producer = brokerpostgres.NewProducer(db)
+		log.Print("Postgres job producer initialized")
+	case config.QueueDriverRabbitMQ:
+		rabbitProducer := brokerrabbitmq.NewProducer(cfg.AMQPURL, cfg.AMQPQueue)
+		defer rabbitProducer.Close()
+		producer = rabbitProducer
+		log.Printf("RabbitMQ producer initialized for queue %s", cfg.AMQPQueue)
+	case config.QueueDriverNATS:
+		natsURL := cfg.NATSURL
+		if cfg.NATSEmbedded {
+			// Встроенный сервер живет, пока работает API. Воркер
+			// подключается к нему по NATS_URL
+			ns, err := brokernats.StartServer(cfg.NATSListen, cfg.NATSStoreDir)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				ns.Shutdown()
+				ns.WaitForShutdown()
+			}()
+			natsURL = ns.ClientURL()
+			log.Printf("Embedded NATS server listening on %s", cfg.NATSListen)
+		}
 
-	// Даем Kafka время на инициализацию
-	log.Print("Waiting for Kafka to be ready...")
-	time.Sleep(5 * time.Second)
+		nc, js, err := brokernats.Connect(context.Background(), natsURL)
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+		producer = brokernats.NewProducer(js)
+		log.Printf("NATS JetStream producer initialized for stream %s", brokernats.TaskStream)
+	default:
+		// Инициализируем Kafka producer
+		producer = broker.NewProducer(cfg)
+		log.Print("Kafka producer initialized")
 
-	imageUsecase := usecases.NewImageUsecases(imageRepo, minioRepo, kafkaProducer)
+		// Даем Kafka время на инициализацию
+		log.Print("Waiting for Kafka to be ready...")
+		time.Sleep(5 * time.Second)
+	}
 
-	srv := http.NewServer(cfg.HTTPPort, imageUsecase)
+	return NewServer(cfg, imageRepo, minioRepo, producer).Start()
+}
+
+// NewServer собирает HTTP API поверх готовых адаптеров. Используется
+// и обычным запуском, и режимом all-in-one с адаптерами в памяти
+func NewServer(cfg *config.Config, repo port.RepositoryDB, storage port.ObjectStorage, producer port.Producer) *http.Server {
+	imageUsecase := usecases.NewImageUsecases(repo, storage, producer).
+		WithUploadLimits(cfg.InputLimits(), cfg.UploadValidateHeader)
+
+	return http.NewServer(cfg.HTTPPort, imageUsecase)
+}
+
+// connectPostgres подключается к PostgreSQL с повторами: при запуске
+// через docker-compose база может быть еще не готова
+func connectPostgres(cfg *config.Config) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+
+	for i := 0; i < 10; i++ {
+		db, err = sql.Open("postgres", cfg.MasterDSN)
+		if err == nil {
+			err = db.Ping()
+			if err == nil {
+				break
+			}
+		}
+		log.Printf("Waiting for PostgreSQL... (attempt %d/10): %v", i+1, err)
+		time.Sleep(3 * time.Second)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database after 10 attempts: %w", err)
+	}
 
-	return srv.Start()
+	return db, nil
 }
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Action - одно действие пайплайна обработки с параметрами.
+// Строковая форма: "Name" или "Name(key=value,key=value)", например
+// "Rotate(angle=90)" или "Resize(width=800,height=600)".
+type Action struct {
+	Name   string
+	Params map[string]string
+}
+
+// ParseAction разбирает строковую форму действия.
+func ParseAction(s string) (Action, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Action{}, fmt.Errorf("%w: empty action", ErrInvalidAction)
+	}
+
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		if strings.ContainsAny(s, ")=,") {
+			return Action{}, fmt.Errorf("%w: %q", ErrInvalidAction, s)
+		}
+		return Action{Name: s}, nil
+	}
+	if !strings.HasSuffix(s, ")") {
+		return Action{}, fmt.Errorf("%w: missing closing parenthesis in %q", ErrInvalidAction, s)
+	}
+
+	action := Action{
+		Name:   strings.TrimSpace(s[:open]),
+		Params: map[string]string{},
+	}
+	if action.Name == "" {
+		return Action{}, fmt.Errorf("%w: missing name in %q", ErrInvalidAction, s)
+	}
+
+	body := s[open+1 : len(s)-1]
+	if strings.TrimSpace(body) == "" {
+		return action, nil
+	}
+	for _, pair := range strings.Split(body, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return Action{}, fmt.Errorf("%w: malformed parameter %q in %q", ErrInvalidAction, pair, s)
+		}
+		action.Params[key] = strings.TrimSpace(value)
+	}
+	return action, nil
+}
+
+// ParseActions разбирает список действий задачи.
+func ParseActions(raw []string) ([]Action, error) {
+	actions := make([]Action, 0, len(raw))
+	for _, s := range raw {
+		action, err := ParseAction(s)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// String возвращает каноническую форму действия: параметры отсортированы по ключу.
+func (a Action) String() string {
+	if len(a.Params) == 0 {
+		return a.Name
+	}
+	keys := make([]string, 0, len(a.Params))
+	for key := range a.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(a.Name)
+	b.WriteByte('(')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(a.Params[key])
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// Param возвращает строковый параметр или значение по умолчанию.
+func (a Action) Param(key, def string) string {
+	if v, ok := a.Params[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// IntParam возвращает целочисленный параметр или значение по умолчанию.
+func (a Action) IntParam(key string, def int) (int, error) {
+	v, ok := a.Params[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s.%s must be an integer, got %q", ErrInvalidAction, a.Name, key, v)
+	}
+	return n, nil
+}
+
+// FloatParam возвращает вещественный параметр или значение по умолчанию.
+func (a Action) FloatParam(key string, def float64) (float64, error) {
+	v, ok := a.Params[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s.%s must be a number, got %q", ErrInvalidAction, a.Name, key, v)
+	}
+	return f, nil
+}
+
+// BoolParam возвращает логический параметр или значение по умолчанию.
+func (a Action) BoolParam(key string, def bool) (bool, error) {
+	v, ok := a.Params[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s.%s must be true or false, got %q", ErrInvalidAction, a.Name, key, v)
+	}
+	return b, nil
+}
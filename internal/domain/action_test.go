@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		input  string
+		name   string
+		params map[string]string
+	}{
+		{"Resize", "Resize", nil},
+		{" Grayscale ", "Grayscale", nil},
+		{"Rotate(angle=90)", "Rotate", map[string]string{"angle": "90"}},
+		{"Resize(width=800, height=600)", "Resize", map[string]string{"width": "800", "height": "600"}},
+		{"Flip()", "Flip", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			action, err := ParseAction(tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if action.Name != tt.name {
+				t.Errorf("Expected name %s, got %s", tt.name, action.Name)
+			}
+			if len(action.Params) != len(tt.params) {
+				t.Fatalf("Expected %d params, got %d", len(tt.params), len(action.Params))
+			}
+			for key, value := range tt.params {
+				if action.Params[key] != value {
+					t.Errorf("Expected %s=%s, got %s", key, value, action.Params[key])
+				}
+			}
+		})
+	}
+}
+
+func TestParseAction_Invalid(t *testing.T) {
+	inputs := []string{"", "Rotate(angle=90", "Rotate(90)", "(angle=90)", "Rotate=90"}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseAction(input)
+			if !errors.Is(err, ErrInvalidAction) {
+				t.Errorf("Expected ErrInvalidAction, got %v", err)
+			}
+		})
+	}
+}
+
+func TestActionString_Canonical(t *testing.T) {
+	action, err := ParseAction("Resize(height=600,width=800)")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if action.String() != "Resize(height=600,width=800)" {
+		t.Errorf("Expected canonical form, got %s", action.String())
+	}
+
+	other, _ := ParseAction("Resize( width=800 , height=600 )")
+	if other.String() != action.String() {
+		t.Errorf("Expected equal canonical forms, got %s and %s", other.String(), action.String())
+	}
+}
+
+func TestActionParams(t *testing.T) {
+	action, _ := ParseAction("Rotate(angle=45.5,background=ffffff,steps=3)")
+
+	angle, err := action.FloatParam("angle", 90)
+	if err != nil || angle != 45.5 {
+		t.Errorf("Expected angle 45.5, got %v (%v)", angle, err)
+	}
+
+	steps, err := action.IntParam("steps", 1)
+	if err != nil || steps != 3 {
+		t.Errorf("Expected steps 3, got %v (%v)", steps, err)
+	}
+
+	missing, err := action.IntParam("missing", 7)
+	if err != nil || missing != 7 {
+		t.Errorf("Expected default 7, got %v (%v)", missing, err)
+	}
+
+	if action.Param("background", "000000") != "ffffff" {
+		t.Errorf("Expected background ffffff, got %s", action.Param("background", "000000"))
+	}
+
+	if _, err := action.IntParam("background", 0); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("Expected ErrInvalidAction for non-integer param, got %v", err)
+	}
+}
+
+func TestActionBoolParam(t *testing.T) {
+	action, _ := ParseAction("StripMetadata(keep_icc=false,keep_copyright=yes)")
+
+	keepICC, err := action.BoolParam("keep_icc", true)
+	if err != nil || keepICC {
+		t.Errorf("Expected keep_icc false, got %v (%v)", keepICC, err)
+	}
+
+	missing, err := action.BoolParam("missing", true)
+	if err != nil || !missing {
+		t.Errorf("Expected default true, got %v (%v)", missing, err)
+	}
+
+	if _, err := action.BoolParam("keep_copyright", true); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("Expected ErrInvalidAction for non-bool param, got %v", err)
+	}
+}
+
+func TestValidateAction(t *testing.T) {
+	valid := []string{
+		"Resize", "Resize(width=800,height=600)", "Miniature_generate(width=200)", "Watermark(text=hi)",
+		"Rotate(angle=-12.5,background=#ffffff)", "Flip", "Brightness(value=-100)", "Gamma(value=0.8)",
+		"Sepia(amount=100)", "Tint(color=ff0000,amount=30)", "Sharpen(radius=2,amount=1.5)", "Blur(sigma=2)",
+		"Redact(regions=0:0:0.5:0.5,units=relative,mode=fill,color=000000)", "StripMetadata(level=gps)",
+		"Encode(format=webp,quality=80,max_bytes=100000)", "Responsive(widths=320|640,formats=avif|jpg)",
+	}
+	for _, s := range valid {
+		action, err := ParseAction(s)
+		if err != nil {
+			t.Fatalf("Expected no error parsing %s, got %v", s, err)
+		}
+		if err := ValidateAction(action); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"Unknown", "Resize(width=-1)", "Resize(depth=3)", "Rotate(angle=abc)", "Rotate(background=red)",
+		"Brightness(value=500)", "Gamma(value=0)", "Sepia(amount=-1)", "Tint(color=xyz)", "Sharpen(radius=0)",
+		"Blur(sigma=-1)", "Redact", "Redact(region=0:0:10:10)", "Redact(regions=0:0:10)", "Redact(regions=0:0:0:10)",
+		"Redact(regions=0.5:0:0.6:0.5,units=relative)", "Redact(regions=0:0:10:10,mode=erase)",
+		"StripMetadata(level=exif)", "StripMetadata(keep_icc=maybe)", "Encode(format=gif)", "Encode(quality=101)",
+		"Encode(min_ssim=1)", "Responsive(widths=0)", "Responsive(widths=1|2|3|4|5|6|7|8|9|10|11)",
+		"Responsive(formats=bmp)",
+	}
+	for _, s := range invalid {
+		action, err := ParseAction(s)
+		if err != nil {
+			t.Fatalf("Expected no error parsing %s, got %v", s, err)
+		}
+		if err := ValidateAction(action); !errors.Is(err, ErrInvalidAction) {
+			t.Errorf("Expected ErrInvalidAction for %s, got %v", s, err)
+		}
+	}
+}
+
+func TestValidateActions(t *testing.T) {
+	actions, err := ValidateActions([]string{"Rotate( angle=90 )", "Encode(format=webp)"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(actions) != 2 || actions[0].String() != "Rotate(angle=90)" {
+		t.Errorf("Expected parsed actions, got %v", actions)
+	}
+
+	for _, raw := range [][]string{{"Rotate(angle=90"}, {"Encode", "Encode(format=avif)"}, {"Resize", "Bogus"}} {
+		if _, err := ValidateActions(raw); !errors.Is(err, ErrInvalidAction) {
+			t.Errorf("Expected ErrInvalidAction for %v, got %v", raw, err)
+		}
+	}
+}
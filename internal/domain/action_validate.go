@@ -0,0 +1,279 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// actionParams - известные действия и их параметры
+var actionParams = map[string][]string{
+	ResizeAction:            {"width", "height"},
+	MiniatureGenerateAction: {"width", "height"},
+	WatermarkAction:         {"text"},
+	GrayscaleAction:         nil,
+	AutoOrientAction:        nil,
+	RotateAction:            {"angle", "background"},
+	FlipAction:              nil,
+	FlopAction:              nil,
+	BrightnessAction:        {"value"},
+	ContrastAction:          {"value"},
+	SaturationAction:        {"value"},
+	GammaAction:             {"value"},
+	SepiaAction:             {"amount"},
+	TintAction:              {"color", "amount"},
+	InvertAction:            nil,
+	SharpenAction:           {"radius", "amount"},
+	BlurAction:              {"sigma"},
+	RedactAction:            {"mode", "units", "regions", "color", "strength"},
+	StripMetadataAction:     {"level", "keep_icc", "keep_copyright"},
+	ResponsiveAction:        {"widths", "formats"},
+	EncodeAction:            {"format", "quality", "min_quality", "max_bytes", "min_ssim"},
+}
+
+// Ограничения параметров Encode и Responsive
+const (
+	MaxEncodeQuality    = 100
+	MaxResponsiveWidth  = 8192
+	MaxResponsiveWidths = 10
+)
+
+// ValidateActions разбирает действия задачи и проверяет их так же, как
+// воркер перед обработкой: имя, параметры и их значения. Encode можно
+// указать только один раз
+func ValidateActions(raw []string) ([]Action, error) {
+	actions, err := ParseActions(raw)
+	if err != nil {
+		return nil, err
+	}
+	encode := 0
+	for _, action := range actions {
+		if err := ValidateAction(action); err != nil {
+			return nil, err
+		}
+		if action.Name == EncodeAction {
+			encode++
+		}
+	}
+	if encode > 1 {
+		return nil, fmt.Errorf("%w: Encode may be used only once", ErrInvalidAction)
+	}
+	return actions, nil
+}
+
+// ValidateAction проверяет имя и параметры действия. Ошибка оборачивает
+// ErrInvalidAction: такое действие не выполнится и при повторной обработке
+func ValidateAction(a Action) error {
+	known, ok := actionParams[a.Name]
+	if !ok {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidAction, a.Name)
+	}
+	for key := range a.Params {
+		if !slices.Contains(known, key) {
+			return fmt.Errorf("%w: unknown parameter %s.%s", ErrInvalidAction, a.Name, key)
+		}
+	}
+
+	switch a.Name {
+	case ResizeAction, MiniatureGenerateAction:
+		for _, key := range []string{"width", "height"} {
+			if err := intRange(a, key, 0, -1); err != nil {
+				return err
+			}
+		}
+	case RotateAction:
+		if _, err := a.FloatParam("angle", 0); err != nil {
+			return err
+		}
+		return colorParam(a, "background")
+	case BrightnessAction, ContrastAction, SaturationAction:
+		return floatRange(a, "value", -100, 100)
+	case GammaAction:
+		return positive(a, "value")
+	case SepiaAction:
+		return floatRange(a, "amount", 0, 100)
+	case TintAction:
+		if err := colorParam(a, "color"); err != nil {
+			return err
+		}
+		return floatRange(a, "amount", 0, 100)
+	case SharpenAction:
+		if err := intRange(a, "radius", 1, -1); err != nil {
+			return err
+		}
+		return positive(a, "amount")
+	case BlurAction:
+		return positive(a, "sigma")
+	case RedactAction:
+		return validateRedact(a)
+	case StripMetadataAction:
+		switch a.Param("level", "all") {
+		case "none", "gps", "private", "all":
+		default:
+			return fmt.Errorf("%w: StripMetadata.level must be none, gps, private or all", ErrInvalidAction)
+		}
+		for _, key := range []string{"keep_icc", "keep_copyright"} {
+			if _, err := a.BoolParam(key, true); err != nil {
+				return err
+			}
+		}
+	case EncodeAction:
+		return validateEncode(a)
+	case ResponsiveAction:
+		return validateResponsive(a)
+	}
+	return nil
+}
+
+func validateRedact(a Action) error {
+	switch a.Param("mode", "blur") {
+	case "blur", "pixelate", "fill":
+	default:
+		return fmt.Errorf("%w: Redact.mode must be blur, pixelate or fill", ErrInvalidAction)
+	}
+	units := a.Param("units", "px")
+	if units != "px" && units != "relative" {
+		return fmt.Errorf("%w: Redact.units must be px or relative", ErrInvalidAction)
+	}
+
+	regions := 0
+	for _, part := range strings.Split(a.Param("regions", ""), "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		coords := strings.Split(part, ":")
+		if len(coords) != 4 {
+			return fmt.Errorf("%w: Redact region %q must be x:y:w:h", ErrInvalidAction, part)
+		}
+		var values [4]float64
+		for i, c := range coords {
+			v, err := strconv.ParseFloat(strings.TrimSpace(c), 64)
+			if err != nil || v < 0 {
+				return fmt.Errorf("%w: invalid coordinate %q in Redact region %q", ErrInvalidAction, c, part)
+			}
+			values[i] = v
+		}
+		if values[2] == 0 || values[3] == 0 {
+			return fmt.Errorf("%w: Redact region %q has zero size", ErrInvalidAction, part)
+		}
+		if units == "relative" && (values[0]+values[2] > 1 || values[1]+values[3] > 1) {
+			return fmt.Errorf("%w: relative Redact region %q is outside the image", ErrInvalidAction, part)
+		}
+		regions++
+	}
+	if regions == 0 {
+		return fmt.Errorf("%w: Redact.regions must list at least one region", ErrInvalidAction)
+	}
+
+	if err := colorParam(a, "color"); err != nil {
+		return err
+	}
+	return intRange(a, "strength", 0, -1)
+}
+
+func validateEncode(a Action) error {
+	switch strings.ToLower(a.Param("format", "jpeg")) {
+	case "jpeg", "jpg", "webp", "avif":
+	default:
+		return fmt.Errorf("%w: Encode.format must be jpeg, webp or avif, got %q", ErrInvalidAction, a.Param("format", ""))
+	}
+	for _, key := range []string{"quality", "min_quality"} {
+		if err := intRange(a, key, 1, MaxEncodeQuality); err != nil {
+			return err
+		}
+	}
+	if err := intRange(a, "max_bytes", 0, -1); err != nil {
+		return err
+	}
+	ssim, err := a.FloatParam("min_ssim", 0)
+	if err != nil {
+		return err
+	}
+	if ssim < 0 || ssim >= 1 {
+		return fmt.Errorf("%w: Encode.min_ssim must be in [0, 1)", ErrInvalidAction)
+	}
+	return nil
+}
+
+func validateResponsive(a Action) error {
+	widths := make(map[int]bool)
+	if value := a.Param("widths", ""); value != "" {
+		for _, part := range strings.Split(value, "|") {
+			width, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || width <= 0 || width > MaxResponsiveWidth {
+				return fmt.Errorf("%w: Responsive.widths must be between 1 and %d, got %q",
+					ErrInvalidAction, MaxResponsiveWidth, part)
+			}
+			widths[width] = true
+		}
+	}
+	if len(widths) > MaxResponsiveWidths {
+		return fmt.Errorf("%w: Responsive accepts at most %d widths", ErrInvalidAction, MaxResponsiveWidths)
+	}
+	if value := a.Param("formats", ""); value != "" {
+		for _, part := range strings.Split(value, "|") {
+			switch strings.ToLower(strings.TrimSpace(part)) {
+			case "avif", "webp", "jpeg", "jpg", "png":
+			default:
+				return fmt.Errorf("%w: Responsive.formats must be avif, webp, jpeg or png, got %q", ErrInvalidAction, part)
+			}
+		}
+	}
+	return nil
+}
+
+// intRange проверяет целый параметр: lo <= value, value <= hi при hi >= 0
+func intRange(a Action, key string, lo, hi int) error {
+	if v, ok := a.Params[key]; !ok || v == "" {
+		return nil
+	}
+	value, err := a.IntParam(key, 0)
+	if err != nil {
+		return err
+	}
+	if value < lo || (hi >= 0 && value > hi) {
+		if hi < 0 {
+			return fmt.Errorf("%w: %s.%s must be at least %d, got %d", ErrInvalidAction, a.Name, key, lo, value)
+		}
+		return fmt.Errorf("%w: %s.%s must be between %d and %d, got %d", ErrInvalidAction, a.Name, key, lo, hi, value)
+	}
+	return nil
+}
+
+// floatRange проверяет вещественный параметр в диапазоне [lo, hi]
+func floatRange(a Action, key string, lo, hi float64) error {
+	value, err := a.FloatParam(key, lo)
+	if err != nil {
+		return err
+	}
+	if value < lo || value > hi {
+		return fmt.Errorf("%w: %s.%s must be between %v and %v, got %v", ErrInvalidAction, a.Name, key, lo, hi, value)
+	}
+	return nil
+}
+
+// positive проверяет, что вещественный параметр, если задан, больше нуля
+func positive(a Action, key string) error {
+	value, err := a.FloatParam(key, 1)
+	if err != nil {
+		return err
+	}
+	if value <= 0 {
+		return fmt.Errorf("%w: %s.%s must be greater than zero, got %v", ErrInvalidAction, a.Name, key, value)
+	}
+	return nil
+}
+
+// colorParam проверяет цвет rrggbb, если он задан
+func colorParam(a Action, key string) error {
+	value, ok := a.Params[key]
+	if !ok || value == "" {
+		return nil
+	}
+	if _, err := ParseRGB(value); err != nil {
+		return fmt.Errorf("%w: %s.%s: %v", ErrInvalidAction, a.Name, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PaletteSize - число цветов палитры изображения
+	PaletteSize = 5
+	// HistogramBins - число интервалов гистограммы на канал RGB,
+	// всего HistogramBins^3 интервалов
+	HistogramBins = 4
+	// DefaultColorDistance - допустимое отклонение ΔE (CIE76) цвета палитры
+	// от искомого при поиске по цвету
+	DefaultColorDistance = 20
+)
+
+// PaletteColor - цвет палитры и его доля в изображении
+type PaletteColor struct {
+	Color string  `json:"color"`
+	Share float64 `json:"share"`
+}
+
+// ColorProfile - палитра и грубая гистограмма цветов изображения
+type ColorProfile struct {
+	// Palette отсортирована по убыванию доли
+	Palette []PaletteColor `json:"palette"`
+	// Histogram - доли пикселей в интервалах RGB, индекс r*B*B + g*B + b,
+	// где B = HistogramBins
+	Histogram []float64 `json:"histogram"`
+}
+
+// RGB - цвет в sRGB
+type RGB struct {
+	R, G, B uint8
+}
+
+// ParseRGB разбирает цвет в форме "rrggbb" или "#rrggbb".
+func ParseRGB(s string) (RGB, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return RGB{}, fmt.Errorf("invalid color %q: expected rrggbb", s)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return RGB{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return RGB{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value)}, nil
+}
+
+// Hex возвращает цвет в форме "#rrggbb".
+func (c RGB) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Lab переводит цвет в CIE L*a*b* (D65). Расстояние между цветами в Lab
+// ближе к воспринимаемому, чем в RGB.
+func (c RGB) Lab() (l, a, b float64) {
+	r := linearChannel(c.R)
+	g := linearChannel(c.G)
+	bl := linearChannel(c.B)
+
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*bl) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*bl
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*bl) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func linearChannel(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	const delta = 6.0 / 29
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseRGB(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected RGB
+		wantErr  bool
+	}{
+		{"ff8000", RGB{255, 128, 0}, false},
+		{"#00FF7f", RGB{0, 255, 127}, false},
+		{"fff", RGB{}, true},
+		{"gg0000", RGB{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRGB(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRGB(%q): expected error %v, got %v", tt.input, tt.wantErr, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseRGB(%q): expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+
+	if hex := (RGB{255, 128, 0}).Hex(); hex != "#ff8000" {
+		t.Errorf("Expected #ff8000, got %s", hex)
+	}
+}
+
+func TestRGBLab(t *testing.T) {
+	tests := []struct {
+		color   RGB
+		l, a, b float64
+	}{
+		{RGB{0, 0, 0}, 0, 0, 0},
+		{RGB{255, 255, 255}, 100, 0, 0},
+		{RGB{255, 0, 0}, 53.24, 80.09, 67.20},
+		{RGB{0, 0, 255}, 32.30, 79.19, -107.86},
+	}
+
+	for _, tt := range tests {
+		l, a, b := tt.color.Lab()
+		if math.Abs(l-tt.l) > 0.05 || math.Abs(a-tt.a) > 0.05 || math.Abs(b-tt.b) > 0.05 {
+			t.Errorf("Lab(%v): expected (%.2f, %.2f, %.2f), got (%.2f, %.2f, %.2f)", tt.color, tt.l, tt.a, tt.b, l, a, b)
+		}
+	}
+}
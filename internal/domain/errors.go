@@ -4,4 +4,23 @@ import "errors"
 
 var (
 	ErrImageNotFound = errors.New("image not found")
+	ErrInvalidAction = errors.New("invalid action")
+	// ErrNotProcessed - воркер еще не обработал изображение
+	ErrNotProcessed = errors.New("image is not processed yet")
+	// ErrBlobNotFound - для хеша содержимого нет записи о blob
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrCacheMiss - в кеше нет результата для входа и пайплайна
+	ErrCacheMiss = errors.New("processing cache miss")
+	// ErrInvalidFilter - некорректные параметры списка изображений
+	ErrInvalidFilter = errors.New("invalid filter")
+	// ErrVariantNotFound - у изображения нет адаптивного варианта
+	// с таким именем или пайплайн не содержал Responsive
+	ErrVariantNotFound = errors.New("responsive variant not found")
+	// ErrUnsupportedFormat - содержимое не является изображением
+	// поддерживаемого формата или не совпадает с заявленным типом
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrImageTooLarge - изображение превышает ограничения на загрузку
+	ErrImageTooLarge = errors.New("image is too large")
+	// ErrObjectNotFound - в хранилище нет объекта с таким ключом
+	ErrObjectNotFound = errors.New("object not found")
 )
@@ -1,16 +1,49 @@
 package domain
 
+import "slices"
+
 const (
 	ResizeAction            = "Resize"
 	MiniatureGenerateAction = "Miniature_generate"
 	WatermarkAction         = "Watermark"
 	GrayscaleAction         = "Grayscale"
+	AutoOrientAction        = "AutoOrient"
+	RotateAction            = "Rotate"
+	FlipAction              = "Flip"
+	FlopAction              = "Flop"
+	BrightnessAction        = "Brightness"
+	ContrastAction          = "Contrast"
+	SaturationAction        = "Saturation"
+	GammaAction             = "Gamma"
+	SepiaAction             = "Sepia"
+	TintAction              = "Tint"
+	InvertAction            = "Invert"
+	SharpenAction           = "Sharpen"
+	BlurAction              = "Blur"
+	RedactAction            = "Redact"
+	StripMetadataAction     = "StripMetadata"
+	ResponsiveAction        = "Responsive"
+	EncodeAction            = "Encode"
 
 	ImageStatusPending = "Pending"
 	ImageStatusDone    = "Done"
 	ImageStatusFailed  = "Failed"
+	// ImageStatusQuarantined - в оригинале найдено вредоносное содержимое,
+	// он перенесен под префикс quarantine/ и не обрабатывается
+	ImageStatusQuarantined = "Quarantined"
+
+	// DefaultDuplicateDistance - максимальное расстояние Хэмминга между
+	// перцептивными хешами, при котором изображения считаются дубликатами
+	DefaultDuplicateDistance = 6
+	// MaxDuplicateDistance - длина хеша в битах
+	MaxDuplicateDistance = 64
 )
 
+// RestrictedPrefix - префикс хранилища для оригиналов с ограниченным
+// доступом (REDACT_RAW_POLICY=restrict). Хранилище запрещает чтение
+// объектов под ним всем, кроме владельца
+const RestrictedPrefix = "restricted/"
+
 type Image struct {
 	Id                      string   `json:"id"`
 	FileName                string   `json:"filename"`
@@ -19,11 +52,134 @@ type Image struct {
 	ProcessedImageObjectKey string   `json:"processed_image_id,omitempty"`
 	Actions                 []string `json:"action"`
 	Status                  string   `json:"status,omitempty"`
+	FailureReason           string   `json:"failure_reason,omitempty"`
+	// RawContentHash - SHA-256 оригинала (hex). Пустой у изображений,
+	// загруженных до дедупликации, и после переноса оригинала политикой Redact.
+	// Наружу не отдается: по хешу можно проверить, загружал ли кто-то те же байты
+	RawContentHash string `json:"-"`
+	// RawContentType - тип оригинала, определенный по сигнатуре при загрузке.
+	// Пустой у изображений, загруженных до проверки сигнатуры
+	RawContentType string `json:"raw_content_type,omitempty"`
+	// PerceptualHash - pHash оригинала, nil пока воркер его не вычислил
+	PerceptualHash *uint64 `json:"-"`
+	// ContentType - тип обработанного изображения, пустой у изображений,
+	// обработанных до его сохранения
+	ContentType string `json:"content_type,omitempty"`
+	// Encoding - параметры, выбранные действием Encode
+	Encoding *Encoding `json:"encoding,omitempty"`
+	// Options - параметры задачи обработки, в БД не сохраняются
+	Options TaskOptions `json:"-"`
+	Placeholder
+}
+
+// Placeholder - данные для заглушки, которую клиент показывает,
+// пока загружается обработанное изображение
+type Placeholder struct {
+	BlurHash string `json:"blurhash,omitempty"`
+	// ThumbHash в base64
+	ThumbHash     string `json:"thumbhash,omitempty"`
+	DominantColor string `json:"dominant_color,omitempty"`
+}
+
+// Encoding - параметры кодирования результата действием Encode
+type Encoding struct {
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+	Size    int64  `json:"size"`
+	// SSIM - сходство с изображением до кодирования, если задан min_ssim
+	SSIM float64 `json:"ssim,omitempty"`
+}
+
+// TaskOptions - параметры обработки, задаваемые при загрузке
+type TaskOptions struct {
+	// RejectDuplicates - отклонить изображение, если уже есть похожее
+	RejectDuplicates  bool `json:"reject_duplicates,omitempty"`
+	DuplicateDistance int  `json:"duplicate_distance,omitempty"`
+	// Priority - очередность обработки, пусто - PriorityNormal
+	Priority string `json:"priority,omitempty"`
+	// Tenant - владелец загрузки, воркер Kafka делит между владельцами
+	// воркеры поровну. Пусто - DefaultTenant
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Приоритеты задач обработки
+const (
+	PriorityHigh   = "high"   // интерактивные загрузки, например из редактора
+	PriorityNormal = "normal" // по умолчанию
+	PriorityLow    = "low"    // массовый импорт
+)
+
+// Priorities - приоритеты от высокого к низкому
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ValidPriority проверяет, что priority - известный приоритет
+func ValidPriority(priority string) bool {
+	return slices.Contains(Priorities, priority)
+}
+
+// DefaultTenant - владелец задач, загруженных без tenant
+const DefaultTenant = "default"
+
+// MaxTenantLength - максимальная длина имени владельца
+const MaxTenantLength = 64
+
+// ValidTenant проверяет имя владельца: латинские буквы, цифры, '.', '_'
+// и '-', не длиннее MaxTenantLength
+func ValidTenant(tenant string) bool {
+	if tenant == "" || len(tenant) > MaxTenantLength {
+		return false
+	}
+	for _, char := range tenant {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case char == '.', char == '_', char == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SimilarImage - изображение, похожее на исходное
+type SimilarImage struct {
+	Id       string `json:"id"`
+	FileName string `json:"filename"`
+	Status   string `json:"status"`
+	Distance int    `json:"distance"`
 }
 
+// ImageFilter - параметры списка изображений
+type ImageFilter struct {
+	// Status - только изображения в этом статусе, пусто - любые
+	Status string
+	// Color - искомый цвет палитры (#rrggbb), пусто - без фильтра по цвету
+	Color string
+	// ColorDistance - максимальное ΔE между Color и цветом палитры
+	ColorDistance float64
+	// MinShare - минимальная доля подходящего цвета в изображении
+	MinShare float64
+	Limit    int
+	Offset   int
+}
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
 // TaskMessage - структура сообщения для Kafka
 type TaskMessage struct {
-	ImageID   string   `json:"image_id"`
-	Actions   []string `json:"actions"`
-	Timestamp int64    `json:"timestamp"`
+	ImageID string   `json:"image_id"`
+	Actions []string `json:"actions"`
+	TaskOptions
+	Timestamp int64 `json:"timestamp"`
+}
+
+// ResultEvent - событие о завершении обработки изображения. Status -
+// итоговый статус изображения, Error - причина статуса Failed
+type ResultEvent struct {
+	ImageID   string `json:"image_id"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Timestamp int64  `json:"timestamp"`
 }
@@ -1,6 +1,9 @@
 package domain
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestImageConstants(t *testing.T) {
 	tests := []struct {
@@ -11,6 +14,10 @@ func TestImageConstants(t *testing.T) {
 		{"ResizeAction", ResizeAction, "Resize"},
 		{"MiniatureGenerateAction", MiniatureGenerateAction, "Miniature_generate"},
 		{"WatermarkAction", WatermarkAction, "Watermark"},
+		{"AutoOrientAction", AutoOrientAction, "AutoOrient"},
+		{"RotateAction", RotateAction, "Rotate"},
+		{"FlipAction", FlipAction, "Flip"},
+		{"FlopAction", FlopAction, "Flop"},
 		{"ImageStatusPending", ImageStatusPending, "Pending"},
 		{"ImageStatusDone", ImageStatusDone, "Done"},
 		{"ImageStatusFailed", ImageStatusFailed, "Failed"},
@@ -68,3 +75,29 @@ func TestTaskMessage(t *testing.T) {
 		t.Errorf("Expected timestamp to be 1234567890, got %d", task.Timestamp)
 	}
 }
+
+func TestValidTenant(t *testing.T) {
+	for _, tenant := range []string{"acme", "team-42", "bulk_import.v2", strings.Repeat("a", MaxTenantLength)} {
+		if !ValidTenant(tenant) {
+			t.Errorf("Expected %q to be valid", tenant)
+		}
+	}
+	for _, tenant := range []string{"", "a b", "acme/prod", "тенант", strings.Repeat("a", MaxTenantLength+1)} {
+		if ValidTenant(tenant) {
+			t.Errorf("Expected %q to be invalid", tenant)
+		}
+	}
+}
+
+func TestValidPriority(t *testing.T) {
+	for _, priority := range []string{PriorityHigh, PriorityNormal, PriorityLow} {
+		if !ValidPriority(priority) {
+			t.Errorf("Expected %q to be valid", priority)
+		}
+	}
+	for _, priority := range []string{"", "urgent", "HIGH"} {
+		if ValidPriority(priority) {
+			t.Errorf("Expected %q to be invalid", priority)
+		}
+	}
+}
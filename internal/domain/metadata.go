@@ -0,0 +1,48 @@
+package domain
+
+import "time"
+
+// ImageMetadata - метаданные оригинала, извлекаемые воркером
+type ImageMetadata struct {
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	Format      string  `json:"format"`
+	Orientation int     `json:"orientation,omitempty"`
+	ColorSpace  string  `json:"color_space,omitempty"`
+	HasAlpha    bool    `json:"has_alpha"`
+	ICCProfile  string  `json:"icc_profile,omitempty"`
+	DPIX        float64 `json:"dpi_x,omitempty"`
+	DPIY        float64 `json:"dpi_y,omitempty"`
+
+	Camera     *CameraInfo `json:"camera,omitempty"`
+	CapturedAt *time.Time  `json:"captured_at,omitempty"`
+	GPS        *GPSInfo    `json:"gps,omitempty"`
+
+	Artist      string   `json:"artist,omitempty"`
+	Copyright   string   `json:"copyright,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+
+	// IPTC и XMP - прочие текстовые поля в виде "имя: значение"
+	IPTC map[string]string `json:"iptc,omitempty"`
+	XMP  map[string]string `json:"xmp,omitempty"`
+}
+
+// CameraInfo - сведения о камере и параметрах съемки
+type CameraInfo struct {
+	Make         string  `json:"make,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Lens         string  `json:"lens,omitempty"`
+	Software     string  `json:"software,omitempty"`
+	ExposureTime string  `json:"exposure_time,omitempty"`
+	FNumber      float64 `json:"f_number,omitempty"`
+	ISO          int     `json:"iso,omitempty"`
+	FocalLength  float64 `json:"focal_length,omitempty"`
+}
+
+// GPSInfo - координаты съемки в десятичных градусах
+type GPSInfo struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
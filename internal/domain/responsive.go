@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ResponsiveManifest - набор адаптивных вариантов изображения и готовые
+// данные для атрибутов srcset и разметки <picture>
+type ResponsiveManifest struct {
+	// Width и Height - размеры изображения, из которого строились варианты
+	Width    int                 `json:"width"`
+	Height   int                 `json:"height"`
+	Variants []ResponsiveVariant `json:"variants"`
+	// Sizes - значение атрибута sizes
+	Sizes string `json:"sizes"`
+	// Sources - элементы <source> в порядке предпочтения форматов
+	Sources []PictureSource `json:"sources"`
+	// Img - запасной <img> внутри <picture>
+	Img PictureImg `json:"img"`
+}
+
+// ResponsiveVariant - один вариант изображения заданной ширины и формата
+type ResponsiveVariant struct {
+	// Name - имя варианта, например "640.webp"
+	Name        string `json:"name"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// PictureSource - данные элемента <source>
+type PictureSource struct {
+	Type   string `json:"type"`
+	SrcSet string `json:"srcset"`
+}
+
+// PictureImg - данные элемента <img>
+type PictureImg struct {
+	Src    string `json:"src"`
+	SrcSet string `json:"srcset"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ResponsiveObjectKey - ключ варианта в объектном хранилище
+func ResponsiveObjectKey(imageID, name string) string {
+	return fmt.Sprintf("responsive/%s/%s", imageID, name)
+}
+
+// ResponsiveURL - адрес, по которому API отдает вариант
+func ResponsiveURL(imageID, name string) string {
+	return fmt.Sprintf("/image/%s/responsive/%s", imageID, name)
+}
+
+// NewResponsiveManifest собирает манифест из вариантов. formats задает
+// порядок предпочтения: последний формат используется в запасном <img>,
+// остальные - в элементах <source>.
+func NewResponsiveManifest(imageID string, width, height int, formats []string, variants []ResponsiveVariant) ResponsiveManifest {
+	manifest := ResponsiveManifest{
+		Width:    width,
+		Height:   height,
+		Variants: variants,
+		Sizes:    "100vw",
+		Sources:  []PictureSource{},
+	}
+
+	byFormat := make(map[string][]ResponsiveVariant)
+	for _, v := range variants {
+		byFormat[v.Format] = append(byFormat[v.Format], v)
+	}
+
+	for i, format := range formats {
+		group := byFormat[format]
+		if len(group) == 0 {
+			continue
+		}
+		sort.Slice(group, func(a, b int) bool { return group[a].Width < group[b].Width })
+
+		entries := make([]string, len(group))
+		for j, v := range group {
+			entries[j] = fmt.Sprintf("%s %dw", v.URL, v.Width)
+		}
+		srcSet := strings.Join(entries, ", ")
+
+		if i == len(formats)-1 {
+			largest := group[len(group)-1]
+			manifest.Img = PictureImg{Src: largest.URL, SrcSet: srcSet, Width: largest.Width, Height: largest.Height}
+			continue
+		}
+		manifest.Sources = append(manifest.Sources, PictureSource{Type: group[0].ContentType, SrcSet: srcSet})
+	}
+
+	return manifest
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewResponsiveManifest(t *testing.T) {
+	variant := func(width int, format, contentType string) ResponsiveVariant {
+		name := fmt.Sprintf("%d.%s", width, format)
+		return ResponsiveVariant{
+			Name: name, Width: width, Height: width / 2, Format: format,
+			ContentType: contentType, URL: ResponsiveURL("img", name),
+		}
+	}
+	variants := []ResponsiveVariant{
+		variant(640, "jpeg", "image/jpeg"),
+		variant(320, "jpeg", "image/jpeg"),
+		variant(320, "webp", "image/webp"),
+		variant(640, "webp", "image/webp"),
+	}
+
+	manifest := NewResponsiveManifest("img", 800, 400, []string{"webp", "jpeg"}, variants)
+
+	if len(manifest.Sources) != 1 {
+		t.Fatalf("Expected 1 source, got %v", manifest.Sources)
+	}
+	expectedSource := PictureSource{
+		Type:   "image/webp",
+		SrcSet: "/image/img/responsive/320.webp 320w, /image/img/responsive/640.webp 640w",
+	}
+	if manifest.Sources[0] != expectedSource {
+		t.Errorf("Expected source %+v, got %+v", expectedSource, manifest.Sources[0])
+	}
+
+	expectedImg := PictureImg{
+		Src:    "/image/img/responsive/640.jpeg",
+		SrcSet: "/image/img/responsive/320.jpeg 320w, /image/img/responsive/640.jpeg 640w",
+		Width:  640,
+		Height: 320,
+	}
+	if manifest.Img != expectedImg {
+		t.Errorf("Expected img %+v, got %+v", expectedImg, manifest.Img)
+	}
+	if manifest.Sizes != "100vw" {
+		t.Errorf("Expected sizes 100vw, got %s", manifest.Sizes)
+	}
+}
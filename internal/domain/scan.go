@@ -0,0 +1,8 @@
+package domain
+
+// ScanResult - результат проверки оригинала антивирусом
+type ScanResult struct {
+	Infected bool `json:"infected"`
+	// Signature - имя найденной сигнатуры, пустое для чистого файла
+	Signature string `json:"signature,omitempty"`
+}
@@ -1,10 +1,15 @@
 package http
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/dontpanicw/ImageProcessor/internal/domain"
 	"github.com/dontpanicw/ImageProcessor/internal/port"
@@ -40,17 +45,20 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	// Получаем действия из формы (например: "resize,watermark")
+	// Получаем действия из формы (например: "Resize,Rotate(angle=90),Watermark")
 	actionsStr := r.FormValue("actions")
 	var actions []string
 
 	if actionsStr != "" {
-		// Парсим действия из строки, разделенной запятыми
-		for _, action := range splitAndTrim(actionsStr, ",") {
-			// Валидируем действие
-			if isValidAction(action) {
-				actions = append(actions, action)
-			}
+		// Проверяем действия так же, как воркер: некорректная задача
+		// иначе ушла бы в очередь и завершилась ошибкой при обработке
+		parsed, err := domain.ValidateActions(splitAndTrim(actionsStr, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, action := range parsed {
+			actions = append(actions, action.String())
 		}
 	}
 
@@ -59,16 +67,31 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		actions = []string{domain.ResizeAction}
 	}
 
+	options, err := parseTaskOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	image := domain.Image{
 		FileName: header.Filename,
 		FileSize: header.Size,
 		Actions:  actions,
 		Status:   domain.ImageStatusPending,
+		Options:  options,
 	}
 
 	imageID, err := h.usecases.CreateObject(r.Context(), image, file, header.Size, header.Header.Get("Content-Type"))
 	if err != nil {
-		http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, domain.ErrUnsupportedFormat):
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		case errors.Is(err, domain.ErrImageTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		default:
+			log.Printf("Failed to upload image %s: %v", header.Filename, err)
+			http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -84,6 +107,52 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// parseTaskOptions читает параметры обработки из формы загрузки
+func parseTaskOptions(r *http.Request) (domain.TaskOptions, error) {
+	var options domain.TaskOptions
+
+	if value := r.FormValue("reject_duplicates"); value != "" {
+		reject, err := strconv.ParseBool(value)
+		if err != nil {
+			return options, fmt.Errorf("invalid reject_duplicates value %q", value)
+		}
+		options.RejectDuplicates = reject
+	}
+
+	if value := r.FormValue("duplicate_distance"); value != "" {
+		distance, err := parseDistance(value)
+		if err != nil {
+			return options, err
+		}
+		options.DuplicateDistance = distance
+	}
+
+	if value := r.FormValue("priority"); value != "" {
+		if !domain.ValidPriority(value) {
+			return options, fmt.Errorf("invalid priority %q: must be one of %s", value, strings.Join(domain.Priorities, ", "))
+		}
+		options.Priority = value
+	}
+
+	if value := r.FormValue("tenant"); value != "" {
+		if !domain.ValidTenant(value) {
+			return options, fmt.Errorf("invalid tenant %q: expected up to %d latin letters, digits, '.', '_' or '-'", value, domain.MaxTenantLength)
+		}
+		options.Tenant = value
+	}
+
+	return options, nil
+}
+
+// parseDistance разбирает порог расстояния Хэмминга (0..64)
+func parseDistance(value string) (int, error) {
+	distance, err := strconv.Atoi(value)
+	if err != nil || distance < 0 || distance > domain.MaxDuplicateDistance {
+		return 0, fmt.Errorf("invalid distance %q: must be between 0 and %d", value, domain.MaxDuplicateDistance)
+	}
+	return distance, nil
+}
+
 // splitAndTrim разбивает строку по разделителю и убирает пробелы
 func splitAndTrim(s, sep string) []string {
 	if s == "" {
@@ -99,11 +168,22 @@ func splitAndTrim(s, sep string) []string {
 	return parts
 }
 
+// splitString разбивает строку по разделителю, не разрезая параметры
+// действий в скобках: "Resize(width=800,height=600),Grayscale"
 func splitString(s, sep string) []string {
 	var result []string
 	var current string
+	depth := 0
 	for _, char := range s {
-		if string(char) == sep {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+		if string(char) == sep && depth == 0 {
 			result = append(result, current)
 			current = ""
 		} else {
@@ -126,22 +206,6 @@ func trimSpace(s string) string {
 	return s[start:end]
 }
 
-// isValidAction проверяет, является ли действие валидным
-func isValidAction(action string) bool {
-	validActions := []string{
-		domain.ResizeAction,
-		domain.MiniatureGenerateAction,
-		domain.WatermarkAction,
-		domain.GrayscaleAction,
-	}
-	for _, valid := range validActions {
-		if action == valid {
-			return true
-		}
-	}
-	return false
-}
-
 func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	imageID := vars["id"]
@@ -150,7 +214,7 @@ func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	reader, err := h.usecases.GetObjectByID(r.Context(), imageID)
+	reader, contentType, err := h.usecases.GetObjectByID(r.Context(), imageID)
 	if err != nil {
 		http.Error(w, "Image not found", http.StatusNotFound)
 		return
@@ -162,10 +226,19 @@ func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
 		}
 	}(reader)
 
-	w.Header().Set("Content-Type", "image/jpeg")
+	// У изображений, обработанных до сохранения типа, он определяется по содержимому
+	var body io.Reader = reader
+	if contentType == "" {
+		buffered := bufio.NewReader(reader)
+		head, _ := buffered.Peek(512)
+		contentType = http.DetectContentType(head)
+		body = buffered
+	}
+
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
 
-	_, err = io.Copy(w, reader)
+	_, err = io.Copy(w, body)
 	if err != nil {
 		http.Error(w, "Failed to serve image", http.StatusInternalServerError)
 		return
@@ -194,6 +267,234 @@ func (h *Handler) GetImageStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) GetImageMetadata(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	if imageID == "" {
+		http.Error(w, "Image ID is required", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := h.usecases.GetImageMetadata(r.Context(), imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, domain.ErrNotProcessed):
+			http.Error(w, "Image is not processed yet", http.StatusNotFound)
+		default:
+			log.Printf("Failed to get metadata for image %s: %v", imageID, err)
+			http.Error(w, "Failed to get metadata", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(metadata)
+	if err != nil {
+		http.Error(w, "Failed to serve metadata", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) GetSimilarImages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	if imageID == "" {
+		http.Error(w, "Image ID is required", http.StatusBadRequest)
+		return
+	}
+
+	distance := domain.DefaultDuplicateDistance
+	if value := r.URL.Query().Get("distance"); value != "" {
+		var err error
+		distance, err = parseDistance(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	similar, err := h.usecases.FindSimilarImages(r.Context(), imageID, distance)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, domain.ErrNotProcessed):
+			http.Error(w, "Image is not processed yet", http.StatusNotFound)
+		default:
+			log.Printf("Failed to find images similar to %s: %v", imageID, err)
+			http.Error(w, "Failed to find similar images", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(similar)
+	if err != nil {
+		http.Error(w, "Failed to serve similar images", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) GetColorProfile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	if imageID == "" {
+		http.Error(w, "Image ID is required", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.usecases.GetColorProfile(r.Context(), imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, domain.ErrNotProcessed):
+			http.Error(w, "Image is not processed yet", http.StatusNotFound)
+		default:
+			log.Printf("Failed to get color profile for image %s: %v", imageID, err)
+			http.Error(w, "Failed to get color profile", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(profile)
+	if err != nil {
+		http.Error(w, "Failed to serve color profile", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) GetResponsiveManifest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	if imageID == "" {
+		http.Error(w, "Image ID is required", http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := h.usecases.GetResponsiveManifest(r.Context(), imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, domain.ErrNotProcessed):
+			http.Error(w, "Image is not processed yet", http.StatusNotFound)
+		case errors.Is(err, domain.ErrVariantNotFound):
+			http.Error(w, "Image has no responsive variants", http.StatusNotFound)
+		default:
+			log.Printf("Failed to get responsive manifest for image %s: %v", imageID, err)
+			http.Error(w, "Failed to get responsive manifest", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(manifest)
+	if err != nil {
+		http.Error(w, "Failed to serve responsive manifest", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) GetResponsiveVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	name := vars["name"]
+	if imageID == "" || name == "" {
+		http.Error(w, "Image ID and variant name are required", http.StatusBadRequest)
+		return
+	}
+
+	reader, variant, err := h.usecases.GetResponsiveVariant(r.Context(), imageID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, domain.ErrNotProcessed):
+			http.Error(w, "Image is not processed yet", http.StatusNotFound)
+		case errors.Is(err, domain.ErrVariantNotFound):
+			http.Error(w, "Variant not found", http.StatusNotFound)
+		default:
+			log.Printf("Failed to get variant %s of image %s: %v", name, imageID, err)
+			http.Error(w, "Failed to get variant", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer func(reader io.ReadCloser) {
+		if err := reader.Close(); err != nil {
+			log.Printf("Failed to close variant reader: %v", err)
+		}
+	}(reader)
+
+	w.Header().Set("Content-Type", variant.ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Failed to serve variant %s of image %s: %v", name, imageID, err)
+	}
+}
+
+// ListImages возвращает список изображений. Параметры: status, color
+// (rrggbb), distance (ΔE), min_share (0..1), limit, offset.
+func (h *Handler) ListImages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := domain.ImageFilter{
+		Status: query.Get("status"),
+		Color:  query.Get("color"),
+	}
+
+	var err error
+	for _, param := range []struct {
+		name   string
+		target *float64
+	}{
+		{"distance", &filter.ColorDistance},
+		{"min_share", &filter.MinShare},
+	} {
+		if value := query.Get(param.name); value != "" {
+			if *param.target, err = strconv.ParseFloat(value, 64); err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s value %q", param.name, value), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{
+		{"limit", &filter.Limit},
+		{"offset", &filter.Offset},
+	} {
+		if value := query.Get(param.name); value != "" {
+			if *param.target, err = strconv.Atoi(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s value %q", param.name, value), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	images, err := h.usecases.ListImages(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to list images: %v", err)
+		http.Error(w, "Failed to list images", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(images)
+	if err != nil {
+		http.Error(w, "Failed to serve images", http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	imageID := vars["id"]
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"strings"
 	"testing"
 
@@ -17,8 +20,14 @@ import (
 
 type mockUsecases struct {
 	createObjectFunc   func(ctx context.Context, image domain.Image, r io.Reader, size int64, contentType string) (string, error)
-	getObjectByIDFunc  func(ctx context.Context, id string) (io.ReadCloser, error)
+	getObjectByIDFunc  func(ctx context.Context, id string) (io.ReadCloser, string, error)
 	getImageStatusFunc func(ctx context.Context, id string) (*domain.Image, error)
+	getMetadataFunc    func(ctx context.Context, id string) (*domain.ImageMetadata, error)
+	findSimilarFunc    func(ctx context.Context, id string, maxDistance int) ([]domain.SimilarImage, error)
+	getColorsFunc      func(ctx context.Context, id string) (*domain.ColorProfile, error)
+	listImagesFunc     func(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error)
+	getResponsiveFunc  func(ctx context.Context, id string) (*domain.ResponsiveManifest, error)
+	getVariantFunc     func(ctx context.Context, id string, name string) (io.ReadCloser, *domain.ResponsiveVariant, error)
 	removeObjectFunc   func(ctx context.Context, id string) error
 }
 
@@ -33,11 +42,11 @@ func (m *mockUsecases) CreateObject(ctx context.Context, image domain.Image, r i
 	return "test-id", nil
 }
 
-func (m *mockUsecases) GetObjectByID(ctx context.Context, id string) (io.ReadCloser, error) {
+func (m *mockUsecases) GetObjectByID(ctx context.Context, id string) (io.ReadCloser, string, error) {
 	if m.getObjectByIDFunc != nil {
 		return m.getObjectByIDFunc(ctx, id)
 	}
-	return io.NopCloser(strings.NewReader("test image")), nil
+	return io.NopCloser(strings.NewReader("test image")), "image/jpeg", nil
 }
 
 func (m *mockUsecases) GetImageStatus(ctx context.Context, id string) (*domain.Image, error) {
@@ -47,6 +56,48 @@ func (m *mockUsecases) GetImageStatus(ctx context.Context, id string) (*domain.I
 	return &domain.Image{Id: id, Status: domain.ImageStatusDone}, nil
 }
 
+func (m *mockUsecases) GetImageMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+	if m.getMetadataFunc != nil {
+		return m.getMetadataFunc(ctx, id)
+	}
+	return &domain.ImageMetadata{Width: 800, Height: 600, Format: "jpeg"}, nil
+}
+
+func (m *mockUsecases) FindSimilarImages(ctx context.Context, id string, maxDistance int) ([]domain.SimilarImage, error) {
+	if m.findSimilarFunc != nil {
+		return m.findSimilarFunc(ctx, id, maxDistance)
+	}
+	return []domain.SimilarImage{}, nil
+}
+
+func (m *mockUsecases) GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error) {
+	if m.getColorsFunc != nil {
+		return m.getColorsFunc(ctx, id)
+	}
+	return &domain.ColorProfile{}, nil
+}
+
+func (m *mockUsecases) GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+	if m.getResponsiveFunc != nil {
+		return m.getResponsiveFunc(ctx, id)
+	}
+	return &domain.ResponsiveManifest{}, nil
+}
+
+func (m *mockUsecases) GetResponsiveVariant(ctx context.Context, id string, name string) (io.ReadCloser, *domain.ResponsiveVariant, error) {
+	if m.getVariantFunc != nil {
+		return m.getVariantFunc(ctx, id, name)
+	}
+	return io.NopCloser(strings.NewReader("variant")), &domain.ResponsiveVariant{Name: name, ContentType: "image/webp"}, nil
+}
+
+func (m *mockUsecases) ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+	if m.listImagesFunc != nil {
+		return m.listImagesFunc(ctx, filter)
+	}
+	return []domain.Image{}, nil
+}
+
 func (m *mockUsecases) RemoveObject(ctx context.Context, id string) error {
 	if m.removeObjectFunc != nil {
 		return m.removeObjectFunc(ctx, id)
@@ -100,6 +151,160 @@ func TestUploadImage_Success(t *testing.T) {
 	}
 }
 
+func TestUploadImage_ParameterizedActions(t *testing.T) {
+	var gotActions []string
+	usecases := &mockUsecases{
+		createObjectFunc: func(ctx context.Context, image domain.Image, r io.Reader, size int64, contentType string) (string, error) {
+			gotActions = image.Actions
+			return "test-id", nil
+		},
+	}
+	handler := NewHandler(usecases)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, _ := writer.CreateFormFile("image", "test.jpg")
+	_, err := part.Write([]byte("fake image data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteField("actions", "Rotate( angle=90 ),Resize(height=600,width=800)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	handler.UploadImage(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+
+	expected := []string{"Rotate(angle=90)", "Resize(height=600,width=800)"}
+	if len(gotActions) != len(expected) {
+		t.Fatalf("Expected actions %v, got %v", expected, gotActions)
+	}
+	for i := range expected {
+		if gotActions[i] != expected[i] {
+			t.Errorf("Expected action %s at index %d, got %s", expected[i], i, gotActions[i])
+		}
+	}
+}
+
+func TestUploadImage_DuplicateOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		fields         map[string]string
+		expectedStatus int
+		expected       domain.TaskOptions
+	}{
+		{"no options", nil, http.StatusCreated, domain.TaskOptions{}},
+		{"reject duplicates", map[string]string{"reject_duplicates": "true", "duplicate_distance": "4"}, http.StatusCreated, domain.TaskOptions{RejectDuplicates: true, DuplicateDistance: 4}},
+		{"invalid flag", map[string]string{"reject_duplicates": "maybe"}, http.StatusBadRequest, domain.TaskOptions{}},
+		{"invalid distance", map[string]string{"duplicate_distance": "-1"}, http.StatusBadRequest, domain.TaskOptions{}},
+		{"high priority", map[string]string{"priority": "high"}, http.StatusCreated, domain.TaskOptions{Priority: domain.PriorityHigh}},
+		{"invalid priority", map[string]string{"priority": "urgent"}, http.StatusBadRequest, domain.TaskOptions{}},
+		{"tenant", map[string]string{"tenant": "acme"}, http.StatusCreated, domain.TaskOptions{Tenant: "acme"}},
+		{"invalid tenant", map[string]string{"tenant": "acme/prod"}, http.StatusBadRequest, domain.TaskOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOptions domain.TaskOptions
+			usecases := &mockUsecases{
+				createObjectFunc: func(ctx context.Context, image domain.Image, r io.Reader, size int64, contentType string) (string, error) {
+					gotOptions = image.Options
+					return "test-id", nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("image", "test.jpg")
+			if _, err := part.Write([]byte("fake image data")); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.fields {
+				if err := writer.WriteField(key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			handler.UploadImage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotOptions != tt.expected {
+				t.Errorf("Expected options %+v, got %+v", tt.expected, gotOptions)
+			}
+		})
+	}
+}
+
+func TestUploadImage_RejectedContent(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{"unsupported format", fmt.Errorf("%w: declared image/png, detected jpeg", domain.ErrUnsupportedFormat), http.StatusUnsupportedMediaType},
+		{"too large", fmt.Errorf("%w: 50000x50000", domain.ErrImageTooLarge), http.StatusRequestEntityTooLarge},
+		{"internal", errors.New("db error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var declared string
+			usecases := &mockUsecases{
+				createObjectFunc: func(ctx context.Context, image domain.Image, r io.Reader, size int64, contentType string) (string, error) {
+					declared = contentType
+					return "", tt.err
+				},
+			}
+			handler := NewHandler(usecases)
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", `form-data; name="image"; filename="test.png"`)
+			header.Set("Content-Type", "image/png")
+			part, _ := writer.CreatePart(header)
+			_, _ = part.Write([]byte("\xff\xd8\xff\xe0"))
+			_ = writer.Close()
+
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			handler.UploadImage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if declared != "image/png" {
+				t.Errorf("Expected declared content type image/png, got %s", declared)
+			}
+		})
+	}
+}
+
 func TestUploadImage_NoFile(t *testing.T) {
 	usecases := &mockUsecases{}
 	handler := NewHandler(usecases)
@@ -141,10 +346,48 @@ func TestGetImage_Success(t *testing.T) {
 	}
 }
 
+func TestGetImage_ContentType(t *testing.T) {
+	pngHeader := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"stored type", "image/avif", "avif data", "image/avif"},
+		{"legacy image is sniffed", "", pngHeader, "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usecases := &mockUsecases{
+				getObjectByIDFunc: func(ctx context.Context, id string) (io.ReadCloser, string, error) {
+					return io.NopCloser(strings.NewReader(tt.body)), tt.contentType, nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			req := httptest.NewRequest("GET", "/image/test-id", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "test-id"})
+			w := httptest.NewRecorder()
+
+			handler.GetImage(w, req)
+
+			if ct := w.Header().Get("Content-Type"); ct != tt.expected {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expected, ct)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("Expected full body to be served, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
 func TestGetImage_NotFound(t *testing.T) {
 	usecases := &mockUsecases{
-		getObjectByIDFunc: func(ctx context.Context, id string) (io.ReadCloser, error) {
-			return nil, domain.ErrImageNotFound
+		getObjectByIDFunc: func(ctx context.Context, id string) (io.ReadCloser, string, error) {
+			return nil, "", domain.ErrImageNotFound
 		},
 	}
 	handler := NewHandler(usecases)
@@ -185,6 +428,232 @@ func TestGetImageStatus_Success(t *testing.T) {
 	}
 }
 
+func TestGetImageMetadata(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"image not found", domain.ErrImageNotFound, http.StatusNotFound},
+		{"not ready", domain.ErrNotProcessed, http.StatusNotFound},
+		{"repository error", errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usecases := &mockUsecases{
+				getMetadataFunc: func(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+					if tt.err != nil {
+						return nil, fmt.Errorf("image %s: %w", id, tt.err)
+					}
+					return &domain.ImageMetadata{Width: 800, Height: 600, Format: "jpeg"}, nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			req := httptest.NewRequest("GET", "/image/test-id/metadata", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "test-id"})
+			w := httptest.NewRecorder()
+
+			handler.GetImageMetadata(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			var metadata domain.ImageMetadata
+			if err := json.NewDecoder(w.Body).Decode(&metadata); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if metadata.Width != 800 || metadata.Height != 600 {
+				t.Errorf("Expected 800x600, got %dx%d", metadata.Width, metadata.Height)
+			}
+		})
+	}
+}
+
+func TestGetSimilarImages(t *testing.T) {
+	tests := []struct {
+		name             string
+		query            string
+		err              error
+		expectedStatus   int
+		expectedDistance int
+	}{
+		{"default distance", "", nil, http.StatusOK, domain.DefaultDuplicateDistance},
+		{"custom distance", "?distance=10", nil, http.StatusOK, 10},
+		{"invalid distance", "?distance=65", nil, http.StatusBadRequest, 0},
+		{"not processed", "", domain.ErrNotProcessed, http.StatusNotFound, domain.DefaultDuplicateDistance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotDistance int
+			usecases := &mockUsecases{
+				findSimilarFunc: func(ctx context.Context, id string, maxDistance int) ([]domain.SimilarImage, error) {
+					gotDistance = maxDistance
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []domain.SimilarImage{{Id: "other-id", Distance: 3}}, nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			req := httptest.NewRequest("GET", "/image/test-id/similar"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "test-id"})
+			w := httptest.NewRecorder()
+
+			handler.GetSimilarImages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotDistance != tt.expectedDistance {
+				t.Errorf("Expected distance %d, got %d", tt.expectedDistance, gotDistance)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var similar []domain.SimilarImage
+			if err := json.NewDecoder(w.Body).Decode(&similar); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(similar) != 1 || similar[0].Id != "other-id" {
+				t.Errorf("Expected other-id, got %v", similar)
+			}
+		})
+	}
+}
+
+func TestListImages(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expected       domain.ImageFilter
+	}{
+		{"no filter", "", nil, http.StatusOK, domain.ImageFilter{}},
+		{
+			"color filter", "?color=ff0000&distance=12.5&min_share=0.2&limit=10&offset=20&status=Done", nil, http.StatusOK,
+			domain.ImageFilter{Status: "Done", Color: "ff0000", ColorDistance: 12.5, MinShare: 0.2, Limit: 10, Offset: 20},
+		},
+		{"invalid number", "?limit=ten", nil, http.StatusBadRequest, domain.ImageFilter{}},
+		{"invalid filter", "?color=red", domain.ErrInvalidFilter, http.StatusBadRequest, domain.ImageFilter{Color: "red"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got domain.ImageFilter
+			usecases := &mockUsecases{
+				listImagesFunc: func(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+					got = filter
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []domain.Image{{Id: "test-id"}}, nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			req := httptest.NewRequest("GET", "/images"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.ListImages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected filter %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetColorProfile_NotProcessed(t *testing.T) {
+	usecases := &mockUsecases{
+		getColorsFunc: func(ctx context.Context, id string) (*domain.ColorProfile, error) {
+			return nil, domain.ErrNotProcessed
+		},
+	}
+	handler := NewHandler(usecases)
+
+	req := httptest.NewRequest("GET", "/image/test-id/colors", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "test-id"})
+	w := httptest.NewRecorder()
+
+	handler.GetColorProfile(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestGetResponsiveManifest(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{"ok", nil, http.StatusOK},
+		{"not processed", domain.ErrNotProcessed, http.StatusNotFound},
+		{"no variants", domain.ErrVariantNotFound, http.StatusNotFound},
+		{"repository error", errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usecases := &mockUsecases{
+				getResponsiveFunc: func(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &domain.ResponsiveManifest{Width: 640, Sizes: "100vw"}, nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			req := httptest.NewRequest("GET", "/image/test-id/responsive", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "test-id"})
+			w := httptest.NewRecorder()
+
+			handler.GetResponsiveManifest(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestGetResponsiveVariant(t *testing.T) {
+	usecases := &mockUsecases{}
+	handler := NewHandler(usecases)
+
+	req := httptest.NewRequest("GET", "/image/test-id/responsive/640.webp", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "test-id", "name": "640.webp"})
+	w := httptest.NewRecorder()
+
+	handler.GetResponsiveVariant(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/webp" {
+		t.Errorf("Expected Content-Type image/webp, got %s", ct)
+	}
+	if w.Body.String() != "variant" {
+		t.Errorf("Expected body variant, got %s", w.Body.String())
+	}
+}
+
 func TestDeleteImage_Success(t *testing.T) {
 	usecases := &mockUsecases{}
 	handler := NewHandler(usecases)
@@ -200,23 +669,55 @@ func TestDeleteImage_Success(t *testing.T) {
 	}
 }
 
-func TestIsValidAction(t *testing.T) {
+func TestUploadImage_InvalidActions(t *testing.T) {
 	tests := []struct {
-		action string
-		valid  bool
+		name    string
+		actions string
 	}{
-		{domain.ResizeAction, true},
-		{domain.WatermarkAction, true},
-		{domain.MiniatureGenerateAction, true},
-		{"InvalidAction", false},
-		{"", false},
+		{"unknown action", "Resize,Unknown"},
+		{"malformed", "Rotate(angle=90"},
+		{"bad parameter", "Rotate(angle=abc)"},
+		{"out of range", "Brightness(value=500)"},
+		{"unknown parameter", "Redact(region=0:0:10:10)"},
+		{"redact without regions", "Redact(mode=fill)"},
+		{"repeated encode", "Encode,Encode(format=webp)"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.action, func(t *testing.T) {
-			result := isValidAction(tt.action)
-			if result != tt.valid {
-				t.Errorf("isValidAction(%s) = %v, want %v", tt.action, result, tt.valid)
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			usecases := &mockUsecases{
+				createObjectFunc: func(ctx context.Context, image domain.Image, r io.Reader, size int64, contentType string) (string, error) {
+					called = true
+					return "test-id", nil
+				},
+			}
+			handler := NewHandler(usecases)
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("image", "test.jpg")
+			if _, err := part.Write([]byte("fake image data")); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteField("actions", tt.actions); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			handler.UploadImage(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+			if called {
+				t.Error("Expected image not to be created")
 			}
 		})
 	}
@@ -232,6 +733,7 @@ func TestSplitAndTrim(t *testing.T) {
 		{" a , b , c ", ",", []string{"a", "b", "c"}},
 		{"", ",", nil},
 		{"single", ",", []string{"single"}},
+		{"Resize(width=800,height=600),Flip", ",", []string{"Resize(width=800,height=600)", "Flip"}},
 	}
 
 	for _, tt := range tests {
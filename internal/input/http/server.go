@@ -32,8 +32,14 @@ func NewServer(port string, usecases port.ImageUsecases) *Server {
 
 	// API маршруты
 	router.HandleFunc("/upload", handler.UploadImage).Methods("POST", "OPTIONS")
+	router.HandleFunc("/images", handler.ListImages).Methods("GET", "OPTIONS")
 	router.HandleFunc("/image/{id}", handler.GetImage).Methods("GET", "OPTIONS")
 	router.HandleFunc("/image/{id}/status", handler.GetImageStatus).Methods("GET", "OPTIONS")
+	router.HandleFunc("/image/{id}/metadata", handler.GetImageMetadata).Methods("GET", "OPTIONS")
+	router.HandleFunc("/image/{id}/similar", handler.GetSimilarImages).Methods("GET", "OPTIONS")
+	router.HandleFunc("/image/{id}/colors", handler.GetColorProfile).Methods("GET", "OPTIONS")
+	router.HandleFunc("/image/{id}/responsive", handler.GetResponsiveManifest).Methods("GET", "OPTIONS")
+	router.HandleFunc("/image/{id}/responsive/{name}", handler.GetResponsiveVariant).Methods("GET", "OPTIONS")
 	router.HandleFunc("/image/{id}", handler.DeleteImage).Methods("DELETE", "OPTIONS")
 
 	server := &http.Server{
@@ -2,8 +2,10 @@ package port
 
 import (
 	"context"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
 )
 
 type Producer interface {
-	SendMessage(ctx context.Context, imageId string, actions []string) error
+	SendMessage(ctx context.Context, task domain.TaskMessage) error
 }
@@ -0,0 +1,138 @@
+package porttest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+// deliveryTimeout ограничивает ожидание задачи на стороне получателя
+const deliveryTimeout = 10 * time.Second
+
+// RunProducer проверяет реализацию port.Producer. newProducer возвращает
+// пустую очередь и канал, в который попадают отправленные в нее задачи.
+// Задачи получают идентификаторы со случайным префиксом, посторонние
+// задачи в канале пропускаются
+func RunProducer(t *testing.T, newProducer func(t *testing.T) (port.Producer, <-chan domain.TaskMessage)) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, producer port.Producer, tasks <-chan domain.TaskMessage, prefix string)
+	}{
+		{"SendAndReceive", testProducerSendAndReceive},
+		{"ConcurrentSend", testProducerConcurrentSend},
+		{"ContextCanceled", testProducerContextCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer, tasks := newProducer(t)
+			tt.run(t, producer, tasks, randomPrefix(t))
+		})
+	}
+}
+
+// receive ждет n задач с префиксом prefix
+func receive(t *testing.T, tasks <-chan domain.TaskMessage, prefix string, n int) []domain.TaskMessage {
+	t.Helper()
+	timeout := time.After(deliveryTimeout)
+	var received []domain.TaskMessage
+	for len(received) < n {
+		select {
+		case task, ok := <-tasks:
+			if !ok {
+				t.Fatalf("Expected %d tasks, channel closed after %d", n, len(received))
+			}
+			if strings.HasPrefix(task.ImageID, prefix) {
+				received = append(received, task)
+			}
+		case <-timeout:
+			t.Fatalf("Expected %d tasks, got %d before timeout", n, len(received))
+		}
+	}
+	return received
+}
+
+func testProducerSendAndReceive(t *testing.T, producer port.Producer, tasks <-chan domain.TaskMessage, prefix string) {
+	sent := domain.TaskMessage{
+		ImageID:     prefix + "a",
+		Actions:     []string{domain.ResizeAction, domain.WatermarkAction},
+		TaskOptions: domain.TaskOptions{RejectDuplicates: true, DuplicateDistance: 5, Priority: domain.PriorityHigh, Tenant: "acme"},
+		Timestamp:   1234567890,
+	}
+	if err := producer.SendMessage(context.Background(), sent); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := receive(t, tasks, prefix, 1)[0]
+	if got.ImageID != sent.ImageID || got.Timestamp != sent.Timestamp {
+		t.Errorf("Expected %+v, got %+v", sent, got)
+	}
+	if fmt.Sprint(got.Actions) != fmt.Sprint(sent.Actions) {
+		t.Errorf("Expected actions %v, got %v", sent.Actions, got.Actions)
+	}
+	if !got.RejectDuplicates || got.DuplicateDistance != 5 {
+		t.Errorf("Expected task options %+v, got %+v", sent.TaskOptions, got.TaskOptions)
+	}
+}
+
+func testProducerConcurrentSend(t *testing.T, producer port.Producer, tasks <-chan domain.TaskMessage, prefix string) {
+	const n = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			task := domain.TaskMessage{ImageID: fmt.Sprintf("%s%02d", prefix, i), Actions: []string{domain.ResizeAction}}
+			if err := producer.SendMessage(context.Background(), task); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+
+	// Получатель читает параллельно с отправкой: очередь может быть
+	// меньше числа задач
+	received := receive(t, tasks, prefix, n)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, task := range received {
+		if seen[task.ImageID] {
+			t.Errorf("Expected task %s to be delivered once", task.ImageID)
+		}
+		seen[task.ImageID] = true
+	}
+	if len(seen) != n {
+		t.Errorf("Expected %d distinct tasks, got %d", n, len(seen))
+	}
+}
+
+func testProducerContextCanceled(t *testing.T, producer port.Producer, tasks <-chan domain.TaskMessage, prefix string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	canceled := domain.TaskMessage{ImageID: prefix + "canceled", Actions: []string{domain.ResizeAction}}
+	if err := producer.SendMessage(ctx, canceled); err == nil {
+		t.Error("Expected error from SendMessage with canceled context, got nil")
+	}
+
+	// Отмененная задача не должна появиться раньше следующей
+	marker := domain.TaskMessage{ImageID: prefix + "marker", Actions: []string{domain.ResizeAction}}
+	if err := producer.SendMessage(context.Background(), marker); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := receive(t, tasks, prefix, 1)[0]; got.ImageID != marker.ImageID {
+		t.Errorf("Expected canceled task not to be sent, got %s", got.ImageID)
+	}
+}
@@ -0,0 +1,825 @@
+// Package porttest содержит общие тесты соответствия для реализаций портов.
+// Адаптер вызывает Run* из своего _test.go с фабрикой, создающей пустой
+// экземпляр, и получает одинаковую проверку поведения на граничных случаях:
+// ненайденные записи, повторное удаление, большие объекты, параллельный
+// доступ и отмена контекста.
+package porttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+// RunRepositoryDB проверяет реализацию port.RepositoryDB. newRepo
+// вызывается для каждого подтеста и должен возвращать пустой репозиторий
+func RunRepositoryDB(t *testing.T, newRepo func(t *testing.T) port.RepositoryDB) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo port.RepositoryDB)
+	}{
+		{"SaveAndGet", testRepositorySaveAndGet},
+		{"NotFound", testRepositoryNotFound},
+		{"Delete", testRepositoryDelete},
+		{"StatusChanges", testRepositoryStatusChanges},
+		{"ProcessingResults", testRepositoryProcessingResults},
+		{"FindSimilar", testRepositoryFindSimilar},
+		{"FindSimilarConcurrentUploads", testRepositoryFindSimilarConcurrentUploads},
+		{"ListImages", testRepositoryListImages},
+		{"Blobs", testRepositoryBlobs},
+		{"BlobReleaseRace", testRepositoryBlobReleaseRace},
+		{"RawObjectKey", testRepositoryRawObjectKey},
+		{"ProcessingCache", testRepositoryProcessingCache},
+		{"ConcurrentAccess", testRepositoryConcurrentAccess},
+		{"ContextCanceled", testRepositoryContextCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+func saveImage(t *testing.T, repo port.RepositoryDB, id, status string) {
+	t.Helper()
+	image := domain.Image{
+		Id:                id,
+		FileName:          id + ".jpg",
+		FileSize:          10,
+		RawImageObjectKey: "raw/" + id + ".jpg",
+		Actions:           []string{domain.ResizeAction},
+		Status:            status,
+	}
+	if err := repo.SaveObject(context.Background(), image); err != nil {
+		t.Fatalf("Expected no error saving %s, got %v", id, err)
+	}
+}
+
+func testRepositorySaveAndGet(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	image := domain.Image{
+		Id:                "a",
+		FileName:          "a.png",
+		FileSize:          42,
+		RawImageObjectKey: "blobs/sha256/ab/abc.png",
+		Actions:           []string{domain.ResizeAction, domain.WatermarkAction},
+		Status:            domain.ImageStatusPending,
+		RawContentHash:    "abc",
+		RawContentType:    "image/png",
+	}
+	if err := repo.SaveObject(ctx, image); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stored, err := repo.GetObjectByID(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.FileName != "a.png" || stored.FileSize != 42 || stored.RawImageObjectKey != image.RawImageObjectKey {
+		t.Errorf("Expected saved file fields, got %+v", stored)
+	}
+	if len(stored.Actions) != 2 || stored.Actions[1] != domain.WatermarkAction {
+		t.Errorf("Expected saved actions, got %v", stored.Actions)
+	}
+	if stored.Status != domain.ImageStatusPending || stored.RawContentHash != "abc" || stored.RawContentType != "image/png" {
+		t.Errorf("Expected saved status and content fields, got %+v", stored)
+	}
+	if stored.PerceptualHash != nil || stored.Encoding != nil {
+		t.Errorf("Expected no hash and encoding before processing, got %v %v", stored.PerceptualHash, stored.Encoding)
+	}
+
+	// Повторное сохранение обновляет поля загрузки, но не результат обработки
+	if err := repo.SaveResultFormat(ctx, "a", "image/webp", &domain.Encoding{Format: "webp", Quality: 80}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	image.FileName = "renamed.png"
+	if err := repo.SaveObject(ctx, image); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored, err = repo.GetObjectByID(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.FileName != "renamed.png" {
+		t.Errorf("Expected upsert to update filename, got %q", stored.FileName)
+	}
+	if stored.ContentType != "image/webp" || stored.Encoding == nil || stored.Encoding.Quality != 80 {
+		t.Errorf("Expected upsert to keep result format, got %q %+v", stored.ContentType, stored.Encoding)
+	}
+}
+
+func testRepositoryNotFound(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	saveImage(t, repo, "existing", domain.ImageStatusPending)
+
+	calls := []struct {
+		name string
+		call func(id string) error
+	}{
+		{"GetObjectByID", func(id string) error { _, err := repo.GetObjectByID(ctx, id); return err }},
+		{"DeleteObjectByID", func(id string) error { return repo.DeleteObjectByID(ctx, id) }},
+		{"UpdateProcessedImage", func(id string) error { return repo.UpdateProcessedImage(ctx, id, "processed/x.jpg") }},
+		{"UpdateRawObjectKey", func(id string) error { return repo.UpdateRawObjectKey(ctx, id, "raw/x.jpg", removeNothing) }},
+		{"SaveMetadata", func(id string) error { return repo.SaveMetadata(ctx, id, domain.ImageMetadata{Width: 1}) }},
+		{"GetMetadata", func(id string) error { _, err := repo.GetMetadata(ctx, id); return err }},
+		{"SavePerceptualHash", func(id string) error { return repo.SavePerceptualHash(ctx, id, 1) }},
+		{"MarkFailed", func(id string) error { return repo.MarkFailed(ctx, id, "reason") }},
+		{"MarkQuarantined", func(id string) error { return repo.MarkQuarantined(ctx, id, "quarantine/x", "reason") }},
+		{"SaveResultFormat", func(id string) error { return repo.SaveResultFormat(ctx, id, "image/png", nil) }},
+		{"SavePlaceholder", func(id string) error { return repo.SavePlaceholder(ctx, id, domain.Placeholder{BlurHash: "x"}) }},
+		{"SaveColorProfile", func(id string) error { return repo.SaveColorProfile(ctx, id, domain.ColorProfile{}) }},
+		{"GetColorProfile", func(id string) error { _, err := repo.GetColorProfile(ctx, id); return err }},
+		{"SaveResponsiveManifest", func(id string) error {
+			return repo.SaveResponsiveManifest(ctx, id, domain.ResponsiveManifest{Width: 1})
+		}},
+		{"GetResponsiveManifest", func(id string) error { _, err := repo.GetResponsiveManifest(ctx, id); return err }},
+		{"SaveCachedResult", func(id string) error { return repo.SaveCachedResult(ctx, "hash", "Resize", "v1", id) }},
+	}
+
+	for _, call := range calls {
+		for _, id := range []string{"missing", ""} {
+			if err := call.call(id); !errors.Is(err, domain.ErrImageNotFound) {
+				t.Errorf("%s(%q): expected ErrImageNotFound, got %v", call.name, id, err)
+			}
+		}
+	}
+
+	// Ошибки для отсутствующих записей не затрагивают существующие
+	stored, err := repo.GetObjectByID(ctx, "existing")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Status != domain.ImageStatusPending {
+		t.Errorf("Expected existing image to stay Pending, got %s", stored.Status)
+	}
+}
+
+func testRepositoryDelete(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+	saveImage(t, repo, "b", domain.ImageStatusPending)
+
+	if err := repo.DeleteObjectByID(ctx, "a"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.GetObjectByID(ctx, "a"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound after delete, got %v", err)
+	}
+	// Повторное удаление сообщает, что записи уже нет: так API отвечает 404
+	if err := repo.DeleteObjectByID(ctx, "a"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound for repeated delete, got %v", err)
+	}
+	if _, err := repo.GetObjectByID(ctx, "b"); err != nil {
+		t.Errorf("Expected other image to remain, got %v", err)
+	}
+
+	// Идентификатор можно использовать снова
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+	if _, err := repo.GetObjectByID(ctx, "a"); err != nil {
+		t.Errorf("Expected recreated image, got %v", err)
+	}
+}
+
+func testRepositoryStatusChanges(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	for _, id := range []string{"done", "failed", "quarantined", "moved"} {
+		image := domain.Image{
+			Id: id, FileName: id + ".jpg", FileSize: 10, RawImageObjectKey: "blobs/sha256/ha/hash.jpg",
+			Actions: []string{}, Status: domain.ImageStatusPending, RawContentHash: "hash",
+		}
+		if err := repo.SaveObject(ctx, image); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if err := repo.UpdateProcessedImage(ctx, "done", "processed/done/x.jpg"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.MarkFailed(ctx, "failed", "input rejected: too large"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.MarkQuarantined(ctx, "quarantined", "quarantine/quarantined/x.jpg", "infected: Eicar"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Перенос снимает ссылку изображения на blob
+	if _, _, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.jpg", 10); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.UpdateRawObjectKey(ctx, "moved", "restricted/moved/x.jpg", removeNothing); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]domain.Image{
+		"done": {Status: domain.ImageStatusDone, ProcessedImageObjectKey: "processed/done/x.jpg",
+			RawImageObjectKey: "blobs/sha256/ha/hash.jpg", RawContentHash: "hash"},
+		"failed": {Status: domain.ImageStatusFailed, FailureReason: "input rejected: too large",
+			RawImageObjectKey: "blobs/sha256/ha/hash.jpg", RawContentHash: "hash"},
+		"quarantined": {Status: domain.ImageStatusQuarantined, FailureReason: "infected: Eicar",
+			RawImageObjectKey: "quarantine/quarantined/x.jpg"},
+		"moved": {Status: domain.ImageStatusPending, RawImageObjectKey: "restricted/moved/x.jpg"},
+	}
+	for id, want := range expected {
+		got, err := repo.GetObjectByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got.Status != want.Status || got.FailureReason != want.FailureReason ||
+			got.ProcessedImageObjectKey != want.ProcessedImageObjectKey ||
+			got.RawImageObjectKey != want.RawImageObjectKey || got.RawContentHash != want.RawContentHash {
+			t.Errorf("%s: expected %+v, got %+v", id, want, got)
+		}
+	}
+}
+
+func testRepositoryProcessingResults(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+
+	if _, err := repo.GetMetadata(ctx, "a"); !errors.Is(err, domain.ErrNotProcessed) {
+		t.Errorf("Expected ErrNotProcessed for metadata, got %v", err)
+	}
+	if _, err := repo.GetColorProfile(ctx, "a"); !errors.Is(err, domain.ErrNotProcessed) {
+		t.Errorf("Expected ErrNotProcessed for colors, got %v", err)
+	}
+	if _, err := repo.GetResponsiveManifest(ctx, "a"); !errors.Is(err, domain.ErrNotProcessed) {
+		t.Errorf("Expected ErrNotProcessed for manifest, got %v", err)
+	}
+
+	metadata := domain.ImageMetadata{Width: 10, Height: 20, Format: "jpeg", Keywords: []string{"sea"}}
+	if err := repo.SaveMetadata(ctx, "a", metadata); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.SavePerceptualHash(ctx, "a", 1<<63|5); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	placeholder := domain.Placeholder{BlurHash: "LKO2?U%2Tw=w", ThumbHash: "1QcSHQ==", DominantColor: "#aabbcc"}
+	if err := repo.SavePlaceholder(ctx, "a", placeholder); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	first := domain.ColorProfile{
+		Palette:   []domain.PaletteColor{{Color: "#ff0000", Share: 0.5}, {Color: "#00ff00", Share: 0.3}, {Color: "#0000ff", Share: 0.2}},
+		Histogram: []float64{0.5, 0.5},
+	}
+	second := domain.ColorProfile{Palette: []domain.PaletteColor{{Color: "#ffffff", Share: 1}}, Histogram: []float64{1}}
+	for _, profile := range []domain.ColorProfile{first, second} {
+		if err := repo.SaveColorProfile(ctx, "a", profile); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// Без манифеста обработанное изображение не имеет вариантов
+	if err := repo.UpdateProcessedImage(ctx, "a", "processed/a/x.jpg"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.GetResponsiveManifest(ctx, "a"); !errors.Is(err, domain.ErrVariantNotFound) {
+		t.Errorf("Expected ErrVariantNotFound after processing, got %v", err)
+	}
+	manifest := domain.ResponsiveManifest{Width: 1280, Height: 720, Sizes: "100vw",
+		Variants: []domain.ResponsiveVariant{{Name: "640.webp", Width: 640, Height: 360, Format: "webp"}}}
+	if err := repo.SaveResponsiveManifest(ctx, "a", manifest); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	storedMetadata, err := repo.GetMetadata(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if storedMetadata.Width != 10 || storedMetadata.Format != "jpeg" || len(storedMetadata.Keywords) != 1 {
+		t.Errorf("Expected stored metadata, got %+v", storedMetadata)
+	}
+
+	image, err := repo.GetObjectByID(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if image.PerceptualHash == nil || *image.PerceptualHash != 1<<63|5 {
+		t.Errorf("Expected full 64-bit perceptual hash, got %v", image.PerceptualHash)
+	}
+	if image.Placeholder != placeholder {
+		t.Errorf("Expected placeholder %+v, got %+v", placeholder, image.Placeholder)
+	}
+
+	profile, err := repo.GetColorProfile(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(profile.Palette) != 1 || profile.Palette[0].Color != "#ffffff" || len(profile.Histogram) != 1 {
+		t.Errorf("Expected palette to be replaced, got %+v", profile)
+	}
+
+	storedManifest, err := repo.GetResponsiveManifest(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if storedManifest.Width != 1280 || len(storedManifest.Variants) != 1 || storedManifest.Variants[0].Name != "640.webp" {
+		t.Errorf("Expected stored manifest, got %+v", storedManifest)
+	}
+}
+
+func testRepositoryFindSimilar(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	// Изображения сохраняются по порядку: earlier-pending загружено раньше
+	// self, upload-pending - позже
+	hashes := []struct {
+		id     string
+		hash   uint64
+		status string
+	}{
+		{"earlier-pending", 0xFB, domain.ImageStatusPending},
+		{"self", 0xFF, domain.ImageStatusDone},
+		{"near", 0xFE, domain.ImageStatusDone},
+		{"upload-pending", 0xFF, domain.ImageStatusPending},
+		{"far", 0xFF00, domain.ImageStatusDone},
+		{"failed", 0xFF, domain.ImageStatusFailed},
+		{"high-bit", 1<<63 | 0xFF, domain.ImageStatusDone},
+	}
+	for _, h := range hashes {
+		saveImage(t, repo, h.id, h.status)
+		if err := repo.SavePerceptualHash(ctx, h.id, h.hash); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	saveImage(t, repo, "nohash", domain.ImageStatusDone)
+
+	similar, err := repo.FindSimilar(ctx, 0xFF, 6, "self", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []struct {
+		id       string
+		distance int
+	}{{"earlier-pending", 1}, {"high-bit", 1}, {"near", 1}}
+	if len(similar) != len(expected) {
+		t.Fatalf("Expected %v, got %+v", expected, similar)
+	}
+	for i, want := range expected {
+		if similar[i].Id != want.id || similar[i].Distance != want.distance {
+			t.Errorf("Expected %v at %d, got %+v", want, i, similar[i])
+		}
+	}
+
+	limited, err := repo.FindSimilar(ctx, 0xFF, 6, "self", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(limited) != 1 || limited[0].Id != "earlier-pending" {
+		t.Errorf("Expected limit to keep the closest image, got %+v", limited)
+	}
+}
+
+// Две одновременные загрузки похожих изображений: пока обе не обработаны,
+// дубликатом считается только поздняя
+func testRepositoryFindSimilarConcurrentUploads(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	for _, id := range []string{"first", "second"} {
+		saveImage(t, repo, id, domain.ImageStatusPending)
+		if err := repo.SavePerceptualHash(ctx, id, 0xFF); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	similar, err := repo.FindSimilar(ctx, 0xFF, 6, "first", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(similar) != 0 {
+		t.Errorf("Expected earlier upload to have no duplicates, got %+v", similar)
+	}
+	similar, err = repo.FindSimilar(ctx, 0xFF, 6, "second", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(similar) != 1 || similar[0].Id != "first" {
+		t.Errorf("Expected later upload to match the earlier one, got %+v", similar)
+	}
+
+	// Обработанное изображение подходит независимо от времени загрузки
+	if err := repo.UpdateProcessedImage(ctx, "second", "processed/second.jpg"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	similar, err = repo.FindSimilar(ctx, 0xFF, 6, "first", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(similar) != 1 || similar[0].Id != "second" {
+		t.Errorf("Expected processed image to match, got %+v", similar)
+	}
+}
+
+func testRepositoryListImages(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	saveImage(t, repo, "first", domain.ImageStatusDone)
+	saveImage(t, repo, "second", domain.ImageStatusPending)
+	saveImage(t, repo, "third", domain.ImageStatusDone)
+
+	profiles := map[string]domain.ColorProfile{
+		"first": {Palette: []domain.PaletteColor{{Color: "#ff0000", Share: 0.6}, {Color: "#0000ff", Share: 0.4}}},
+		"third": {Palette: []domain.PaletteColor{{Color: "#fa0505", Share: 0.05}, {Color: "#00ff00", Share: 0.95}}},
+	}
+	for id, profile := range profiles {
+		if err := repo.SaveColorProfile(ctx, id, profile); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   domain.ImageFilter
+		expected []string
+	}{
+		{"newest first", domain.ImageFilter{Limit: 10}, []string{"third", "second", "first"}},
+		{"status", domain.ImageFilter{Status: domain.ImageStatusDone, Limit: 10}, []string{"third", "first"}},
+		{"offset and limit", domain.ImageFilter{Limit: 1, Offset: 1}, []string{"second"}},
+		{"offset past end", domain.ImageFilter{Limit: 10, Offset: 5}, []string{}},
+		{"nearest color first", domain.ImageFilter{Color: "#fa0505", ColorDistance: 20, Limit: 10}, []string{"third", "first"}},
+		{"min share", domain.ImageFilter{Color: "#fa0505", ColorDistance: 20, MinShare: 0.1, Limit: 10}, []string{"first"}},
+		{"no match", domain.ImageFilter{Color: "#ffff00", ColorDistance: 5, Limit: 10}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := repo.ListImages(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if images == nil {
+				t.Fatal("Expected empty slice, got nil")
+			}
+			ids := []string{}
+			for _, image := range images {
+				ids = append(ids, image.Id)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func testRepositoryBlobs(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+
+	key, upload, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.jpg", 10)
+	if err != nil || !upload || key != "blobs/sha256/ha/hash.jpg" {
+		t.Fatalf("Expected new blob, got %s %t %v", key, upload, err)
+	}
+	// Пока загрузка не подтверждена, содержимое загружает каждый
+	key, upload, err = repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/other.jpg", 10)
+	if err != nil || !upload || key != "blobs/sha256/ha/hash.jpg" {
+		t.Errorf("Expected existing blob key to be uploaded again, got %s %t %v", key, upload, err)
+	}
+	if err := repo.MarkBlobUploaded(ctx, "hash"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	key, upload, err = repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/other.jpg", 10)
+	if err != nil || upload || key != "blobs/sha256/ha/hash.jpg" {
+		t.Errorf("Expected uploaded blob to be reused, got %s %t %v", key, upload, err)
+	}
+	if err := repo.MarkBlobUploaded(ctx, "missing"); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound for unknown blob, got %v", err)
+	}
+
+	var removed []string
+	remove := func(ctx context.Context, key string) error {
+		removed = append(removed, key)
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.ReleaseBlob(ctx, "hash", remove); err != nil || len(removed) != 0 {
+			t.Errorf("Expected blob to stay referenced, got %v %v", removed, err)
+		}
+	}
+
+	// Ошибка удаления объекта оставляет последнюю ссылку
+	failed := errors.New("storage unavailable")
+	if err := repo.ReleaseBlob(ctx, "hash", func(ctx context.Context, key string) error {
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Errorf("Expected remove error, got %v", err)
+	}
+	if err := repo.ReleaseBlob(ctx, "hash", remove); err != nil || fmt.Sprint(removed) != "[blobs/sha256/ha/hash.jpg]" {
+		t.Errorf("Expected last release to remove the object, got %v %v", removed, err)
+	}
+	if err := repo.ReleaseBlob(ctx, "hash", remove); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound for released blob, got %v", err)
+	}
+	if err := repo.ReleaseBlob(ctx, "missing", remove); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound for unknown blob, got %v", err)
+	}
+
+	// После удаления записи тот же хеш регистрируется заново
+	if _, upload, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.png", 10); err != nil || !upload {
+		t.Errorf("Expected blob to be registered again, got %t %v", upload, err)
+	}
+}
+
+// removeNothing - remove для изображений, у которых нечего удалять
+func removeNothing(ctx context.Context, key string) error {
+	return nil
+}
+
+// Перенос оригинала снимает ссылку на blob вместе со сменой ключа, поэтому
+// повтор после ошибки не снимает ее второй раз
+func testRepositoryRawObjectKey(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		key, _, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.jpg", 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		image := domain.Image{
+			Id: id, FileName: id + ".jpg", FileSize: 10, RawImageObjectKey: key,
+			Actions: []string{}, Status: domain.ImageStatusDone, RawContentHash: "hash",
+		}
+		if err := repo.SaveObject(ctx, image); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := repo.MarkBlobUploaded(ctx, "hash"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var removed []string
+	remove := func(ctx context.Context, key string) error {
+		removed = append(removed, key)
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.UpdateRawObjectKey(ctx, "a", "restricted/raw/a/hash.jpg", remove); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected blob of b to stay, got removed %v", removed)
+	}
+
+	// Ошибка удаления оставляет изображение на blob
+	failed := errors.New("storage unavailable")
+	if err := repo.UpdateRawObjectKey(ctx, "b", "", func(ctx context.Context, key string) error {
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Errorf("Expected remove error, got %v", err)
+	}
+	stored, err := repo.GetObjectByID(ctx, "b")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.RawImageObjectKey != "blobs/sha256/ha/hash.jpg" || stored.RawContentHash != "hash" {
+		t.Errorf("Expected b to keep its blob, got %q %q", stored.RawImageObjectKey, stored.RawContentHash)
+	}
+
+	// Последняя ссылка удаляет blob, собственный объект удаляется сам
+	if err := repo.UpdateRawObjectKey(ctx, "b", "", remove); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.UpdateRawObjectKey(ctx, "a", "", remove); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fmt.Sprint(removed) != "[blobs/sha256/ha/hash.jpg restricted/raw/a/hash.jpg]" {
+		t.Errorf("Expected blob and restricted copy to be removed, got %v", removed)
+	}
+	if err := repo.ReleaseBlob(ctx, "hash", remove); !errors.Is(err, domain.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound for released blob, got %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		stored, err := repo.GetObjectByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stored.RawImageObjectKey != "" || stored.RawContentHash != "" {
+			t.Errorf("%s: expected no raw object, got %q %q", id, stored.RawImageObjectKey, stored.RawContentHash)
+		}
+	}
+}
+
+// Новая ссылка ждет, пока объект последней ссылки удаляется, и загружает
+// содержимое заново: удаление не может стереть новый объект
+func testRepositoryBlobReleaseRace(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	if _, _, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.jpg", 10); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.MarkBlobUploaded(ctx, "hash"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	removing := make(chan struct{})
+	proceed := make(chan struct{})
+	released := make(chan error, 1)
+	go func() {
+		released <- repo.ReleaseBlob(ctx, "hash", func(ctx context.Context, key string) error {
+			close(removing)
+			<-proceed
+			return nil
+		})
+	}()
+	<-removing
+
+	type acquired struct {
+		upload bool
+		err    error
+	}
+	acquire := make(chan acquired, 1)
+	go func() {
+		_, upload, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.jpg", 10)
+		acquire <- acquired{upload, err}
+	}()
+	select {
+	case got := <-acquire:
+		t.Fatalf("Expected AcquireBlob to wait for the object removal, got %t %v", got.upload, got.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(proceed)
+	if err := <-released; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := <-acquire; got.err != nil || !got.upload {
+		t.Errorf("Expected blob to be uploaded again after removal, got %t %v", got.upload, got.err)
+	}
+}
+
+func testRepositoryProcessingCache(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+	saveImage(t, repo, "b", domain.ImageStatusPending)
+
+	if _, err := repo.FindCachedResult(ctx, "hash", "Resize", "v1"); !errors.Is(err, domain.ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss for empty cache, got %v", err)
+	}
+	if err := repo.SaveCachedResult(ctx, "hash", "Resize", "v1", "a"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Пока изображение не обработано, результата нет
+	if _, err := repo.FindCachedResult(ctx, "hash", "Resize", "v1"); !errors.Is(err, domain.ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss for pending image, got %v", err)
+	}
+
+	if err := repo.SaveResultFormat(ctx, "a", "image/webp", &domain.Encoding{Format: "webp", Quality: 75}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.UpdateProcessedImage(ctx, "a", "processed/a/x.webp"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cached, err := repo.FindCachedResult(ctx, "hash", "Resize", "v1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cached.Id != "a" || cached.ProcessedImageObjectKey != "processed/a/x.webp" ||
+		cached.ContentType != "image/webp" || cached.Encoding == nil || cached.Encoding.Quality != 75 {
+		t.Errorf("Expected cached result of a, got %+v", cached)
+	}
+	if _, err := repo.FindCachedResult(ctx, "hash", "Resize", "v2"); !errors.Is(err, domain.ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss for another version, got %v", err)
+	}
+
+	// Запись указывает на последний сохраненный результат
+	if err := repo.SaveCachedResult(ctx, "hash", "Resize", "v1", "b"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.UpdateProcessedImage(ctx, "b", "processed/b/x.webp"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cached, err := repo.FindCachedResult(ctx, "hash", "Resize", "v1"); err != nil || cached.Id != "b" {
+		t.Errorf("Expected cached result of b, got %+v %v", cached, err)
+	}
+
+	if err := repo.SaveCachedResult(ctx, "hash", "Resize", "v2", "a"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if purged, err := repo.PurgeProcessingCache(ctx, "v2"); err != nil || purged != 1 {
+		t.Errorf("Expected 1 purged entry, got %d %v", purged, err)
+	}
+	if _, err := repo.FindCachedResult(ctx, "hash", "Resize", "v1"); !errors.Is(err, domain.ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss after purge, got %v", err)
+	}
+
+	// Записи кеша удаляются вместе с изображением
+	if err := repo.DeleteObjectByID(ctx, "a"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.FindCachedResult(ctx, "hash", "Resize", "v2"); !errors.Is(err, domain.ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss after delete, got %v", err)
+	}
+}
+
+func testRepositoryConcurrentAccess(t *testing.T, repo port.RepositoryDB) {
+	ctx := context.Background()
+	const n = 16
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	var uploadCount int
+	var mu sync.Mutex
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("image-%02d", i)
+			image := domain.Image{Id: id, FileName: id + ".jpg", FileSize: 10, Actions: []string{}, Status: domain.ImageStatusPending}
+			if err := repo.SaveObject(ctx, image); err != nil {
+				errs <- err
+				return
+			}
+			if err := repo.SavePerceptualHash(ctx, id, uint64(i)); err != nil {
+				errs <- err
+			}
+			_, upload, err := repo.AcquireBlob(ctx, "shared", "blobs/sha256/sh/shared.jpg", 10)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if upload {
+				mu.Lock()
+				uploadCount++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if uploadCount == 0 {
+		t.Error("Expected the blob to be uploaded")
+	}
+	images, err := repo.ListImages(ctx, domain.ImageFilter{Limit: 2 * n})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(images) != n {
+		t.Errorf("Expected %d images, got %d", n, len(images))
+	}
+
+	// Ровно одно снятие ссылки удаляет объект
+	removedCount := 0
+	remove := func(ctx context.Context, key string) error {
+		mu.Lock()
+		removedCount++
+		mu.Unlock()
+		return nil
+	}
+	errs = make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := repo.ReleaseBlob(ctx, "shared", remove); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if removedCount != 1 {
+		t.Errorf("Expected exactly one release to remove the object, got %d", removedCount)
+	}
+}
+
+func testRepositoryContextCanceled(t *testing.T, repo port.RepositoryDB) {
+	saveImage(t, repo, "a", domain.ImageStatusPending)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	image := domain.Image{Id: "b", FileName: "b.jpg", FileSize: 10, Actions: []string{}, Status: domain.ImageStatusPending}
+	if err := repo.SaveObject(ctx, image); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from SaveObject, got %v", err)
+	}
+	if _, err := repo.GetObjectByID(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from GetObjectByID, got %v", err)
+	}
+	if err := repo.MarkFailed(ctx, "a", "reason"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from MarkFailed, got %v", err)
+	}
+	if _, err := repo.ListImages(ctx, domain.ImageFilter{Limit: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from ListImages, got %v", err)
+	}
+	if _, _, err := repo.AcquireBlob(ctx, "hash", "blobs/sha256/ha/hash.jpg", 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from AcquireBlob, got %v", err)
+	}
+
+	// Отмененные вызовы ничего не изменили
+	if _, err := repo.GetObjectByID(context.Background(), "b"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Errorf("Expected canceled save to have no effect, got %v", err)
+	}
+	stored, err := repo.GetObjectByID(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Status != domain.ImageStatusPending {
+		t.Errorf("Expected canceled update to have no effect, got %s", stored.Status)
+	}
+}
@@ -0,0 +1,242 @@
+package porttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/internal/port"
+)
+
+// largeObjectSize больше типичного размера части multipart-загрузки
+// и буфера io.Copy, чтобы объект не помещался в одну запись
+const largeObjectSize = 9 << 20
+
+// RunObjectStorage проверяет реализацию port.ObjectStorage. newStorage
+// вызывается для каждого подтеста и должен возвращать инициализированное
+// хранилище. Ключи получают случайный префикс, поэтому хранилище может
+// быть общим (например, бакет MinIO)
+func RunObjectStorage(t *testing.T, newStorage func(t *testing.T) port.ObjectStorage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, storage port.ObjectStorage, prefix string)
+	}{
+		{"PutAndGet", testStoragePutAndGet},
+		{"EmptyKey", testStorageEmptyKey},
+		{"NotFound", testStorageNotFound},
+		{"RemoveIdempotent", testStorageRemoveIdempotent},
+		{"Overwrite", testStorageOverwrite},
+		{"LargeObject", testStorageLargeObject},
+		{"SizeMismatch", testStorageSizeMismatch},
+		{"ConcurrentAccess", testStorageConcurrentAccess},
+		{"ContextCanceled", testStorageContextCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t), randomPrefix(t))
+		})
+	}
+}
+
+func randomPrefix(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return "porttest/" + hex.EncodeToString(b) + "/"
+}
+
+func putBytes(t *testing.T, storage port.ObjectStorage, key string, data []byte) {
+	t.Helper()
+	err := storage.PutObject(context.Background(), key, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+	if err != nil {
+		t.Fatalf("Expected no error putting %s, got %v", key, err)
+	}
+}
+
+func getBytes(t *testing.T, storage port.ObjectStorage, key string) []byte {
+	t.Helper()
+	rc, err := storage.GetObject(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected no error getting %s, got %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Expected no error reading %s, got %v", key, err)
+	}
+	return data
+}
+
+func testStoragePutAndGet(t *testing.T, storage port.ObjectStorage, prefix string) {
+	key := prefix + "images/a.jpg"
+	putBytes(t, storage, key, []byte("jpeg data"))
+	if data := getBytes(t, storage, key); string(data) != "jpeg data" {
+		t.Errorf("Expected %q, got %q", "jpeg data", data)
+	}
+
+	// Пустой объект допустим
+	putBytes(t, storage, prefix+"empty", nil)
+	if data := getBytes(t, storage, prefix+"empty"); len(data) != 0 {
+		t.Errorf("Expected empty object, got %d bytes", len(data))
+	}
+}
+
+func testStorageEmptyKey(t *testing.T, storage port.ObjectStorage, _ string) {
+	ctx := context.Background()
+	if err := storage.PutObject(ctx, "", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Error("Expected error for empty key in PutObject, got nil")
+	}
+	if _, err := storage.GetObject(ctx, ""); err == nil {
+		t.Error("Expected error for empty key in GetObject, got nil")
+	}
+	if err := storage.RemoveObject(ctx, ""); err == nil {
+		t.Error("Expected error for empty key in RemoveObject, got nil")
+	}
+}
+
+func testStorageNotFound(t *testing.T, storage port.ObjectStorage, prefix string) {
+	if _, err := storage.GetObject(context.Background(), prefix+"missing.jpg"); !errors.Is(err, domain.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func testStorageRemoveIdempotent(t *testing.T, storage port.ObjectStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "a.jpg"
+	putBytes(t, storage, key, []byte("data"))
+	putBytes(t, storage, prefix+"b.jpg", []byte("other"))
+
+	if err := storage.RemoveObject(ctx, key); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := storage.GetObject(ctx, key); !errors.Is(err, domain.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound after remove, got %v", err)
+	}
+	// Повторное удаление и удаление несуществующего ключа не ошибка:
+	// очистка после сбоя может выполняться несколько раз
+	if err := storage.RemoveObject(ctx, key); err != nil {
+		t.Errorf("Expected repeated remove to succeed, got %v", err)
+	}
+	if err := storage.RemoveObject(ctx, prefix+"never-existed.jpg"); err != nil {
+		t.Errorf("Expected remove of missing object to succeed, got %v", err)
+	}
+	if data := getBytes(t, storage, prefix+"b.jpg"); string(data) != "other" {
+		t.Errorf("Expected other object to remain, got %q", data)
+	}
+}
+
+func testStorageOverwrite(t *testing.T, storage port.ObjectStorage, prefix string) {
+	key := prefix + "a.jpg"
+	putBytes(t, storage, key, []byte("first version"))
+	putBytes(t, storage, key, []byte("second"))
+	if data := getBytes(t, storage, key); string(data) != "second" {
+		t.Errorf("Expected %q, got %q", "second", data)
+	}
+}
+
+func testStorageLargeObject(t *testing.T, storage port.ObjectStorage, prefix string) {
+	data := make([]byte, largeObjectSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	key := prefix + "large.bin"
+	putBytes(t, storage, key, data)
+	if got := getBytes(t, storage, key); !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes back unchanged, got %d bytes", len(data), len(got))
+	}
+}
+
+func testStorageSizeMismatch(t *testing.T, storage port.ObjectStorage, prefix string) {
+	key := prefix + "a.jpg"
+	err := storage.PutObject(context.Background(), key, strings.NewReader("short"), 100, "image/jpeg")
+	if err == nil {
+		t.Fatal("Expected error for size mismatch, got nil")
+	}
+	if _, err := storage.GetObject(context.Background(), key); !errors.Is(err, domain.ErrObjectNotFound) {
+		t.Errorf("Expected incomplete object not to be stored, got %v", err)
+	}
+}
+
+func testStorageConcurrentAccess(t *testing.T, storage port.ObjectStorage, prefix string) {
+	const n = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			key := fmt.Sprintf("%sobject-%02d", prefix, i)
+			data := bytes.Repeat([]byte{byte(i)}, 64<<10)
+			if err := storage.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+				errs <- err
+				return
+			}
+			// Одновременная перезапись общего ключа: итог - одна из версий целиком
+			if err := storage.PutObject(ctx, prefix+"shared", bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+				errs <- err
+				return
+			}
+			rc, err := storage.GetObject(ctx, key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, data) {
+				errs <- fmt.Errorf("object %s: content mismatch", key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	shared := getBytes(t, storage, prefix+"shared")
+	if len(shared) != 64<<10 || !bytes.Equal(shared, bytes.Repeat(shared[:1], len(shared))) {
+		t.Errorf("Expected shared object to hold a single complete version")
+	}
+}
+
+func testStorageContextCanceled(t *testing.T, storage port.ObjectStorage, prefix string) {
+	key := prefix + "a.jpg"
+	putBytes(t, storage, key, []byte("data"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := storage.PutObject(ctx, prefix+"b.jpg", strings.NewReader("data"), 4, "image/jpeg"); err == nil {
+		t.Error("Expected error from PutObject with canceled context, got nil")
+	}
+	if _, err := storage.GetObject(ctx, key); err == nil {
+		t.Error("Expected error from GetObject with canceled context, got nil")
+	}
+	if err := storage.RemoveObject(ctx, key); err == nil {
+		t.Error("Expected error from RemoveObject with canceled context, got nil")
+	}
+
+	if _, err := storage.GetObject(context.Background(), prefix+"b.jpg"); !errors.Is(err, domain.ErrObjectNotFound) {
+		t.Errorf("Expected canceled put to have no effect, got %v", err)
+	}
+	if data := getBytes(t, storage, key); string(data) != "data" {
+		t.Errorf("Expected canceled remove to have no effect, got %q", data)
+	}
+}
@@ -11,12 +11,65 @@ type RepositoryDB interface {
 	GetObjectByID(ctx context.Context, id string) (*domain.Image, error)
 	DeleteObjectByID(ctx context.Context, id string) error
 	UpdateProcessedImage(ctx context.Context, id string, processedObjectKey string) error
+	// UpdateRawObjectKey переносит оригинал на собственный ключ изображения.
+	// В той же транзакции снимается ссылка изображения на общий blob, как в
+	// ReleaseBlob, а у изображения без blob remove удаляет прежний
+	// собственный объект. Если remove вернул ошибку, ключ не меняется.
+	// Повторный вызов с тем же ключом ничего не удаляет
+	UpdateRawObjectKey(ctx context.Context, id string, rawObjectKey string, remove func(ctx context.Context, key string) error) error
+	SaveMetadata(ctx context.Context, id string, metadata domain.ImageMetadata) error
+	GetMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error)
+	SavePerceptualHash(ctx context.Context, id string, hash uint64) error
+	// FindSimilar ищет изображения (кроме Failed), чей хеш отличается
+	// от hash не более чем на maxDistance бит, исключая excludeID. Кроме
+	// Done подходят только изображения, загруженные раньше excludeID: из
+	// двух одновременных похожих загрузок дубликатом считается только поздняя
+	FindSimilar(ctx context.Context, hash uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error)
+	MarkFailed(ctx context.Context, id string, reason string) error
+	// MarkQuarantined переводит изображение в статус Quarantined, переносит
+	// оригинал на ключ rawObjectKey и отвязывает его от общего blob
+	MarkQuarantined(ctx context.Context, id string, rawObjectKey string, reason string) error
+	// SaveResultFormat сохраняет тип обработанного изображения и параметры
+	// Encode (encoding может быть nil)
+	SaveResultFormat(ctx context.Context, id string, contentType string, encoding *domain.Encoding) error
+	SavePlaceholder(ctx context.Context, id string, placeholder domain.Placeholder) error
+	SaveColorProfile(ctx context.Context, id string, profile domain.ColorProfile) error
+	GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error)
+	SaveResponsiveManifest(ctx context.Context, id string, manifest domain.ResponsiveManifest) error
+	// GetResponsiveManifest возвращает domain.ErrNotProcessed, пока изображение
+	// не обработано, и domain.ErrVariantNotFound, если вариантов нет
+	GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error)
+	// ListImages возвращает изображения по фильтру. При фильтре по цвету
+	// ближайшие к искомому цвету изображения идут первыми
+	ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error)
+	// AcquireBlob добавляет ссылку на blob с содержимым hash. Новый blob
+	// регистрируется под objectKey. upload = true, пока загрузка blob не
+	// подтверждена MarkBlobUploaded: вызывающий должен сам загрузить
+	// содержимое, даже если blob уже загружает другой. Возвращает ключ, под
+	// которым хранится blob
+	AcquireBlob(ctx context.Context, hash string, objectKey string, size int64) (key string, upload bool, err error)
+	// MarkBlobUploaded подтверждает, что объект blob загружен в хранилище
+	MarkBlobUploaded(ctx context.Context, hash string) error
+	// ReleaseBlob снимает ссылку на blob. Если ссылка последняя, remove
+	// удаляет объект из хранилища до удаления записи, и запись blob на это
+	// время заблокирована: новая ссылка на то же содержимое ждет и получает
+	// upload = true. Если remove вернул ошибку, ссылка не снимается
+	ReleaseBlob(ctx context.Context, hash string, remove func(ctx context.Context, key string) error) error
+	// FindCachedResult возвращает обработанное изображение с тем же
+	// содержимым, пайплайном и версией обработчика или domain.ErrCacheMiss
+	FindCachedResult(ctx context.Context, contentHash, pipeline, version string) (*domain.Image, error)
+	// SaveCachedResult запоминает результат изображения imageID
+	SaveCachedResult(ctx context.Context, contentHash, pipeline, version, imageID string) error
+	// PurgeProcessingCache удаляет записи кеша всех версий, кроме version
+	PurgeProcessingCache(ctx context.Context, version string) (int64, error)
 }
 
 type ObjectStorage interface {
 	InitMinio() error
 	PutObject(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string) error
+	// GetObject возвращает domain.ErrObjectNotFound, если объекта нет
 	GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error)
+	// RemoveObject идемпотентен: удаление отсутствующего объекта не ошибка
 	RemoveObject(ctx context.Context, objectKey string) error
 }
 
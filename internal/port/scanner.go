@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+	"io"
+
+	"github.com/dontpanicw/ImageProcessor/internal/domain"
+)
+
+// Scanner проверяет оригинал на вредоносное содержимое до обработки
+type Scanner interface {
+	// Scan возвращает ошибку, только если проверку не удалось выполнить.
+	// Найденная угроза возвращается в domain.ScanResult
+	Scan(ctx context.Context, r io.Reader) (*domain.ScanResult, error)
+}
@@ -9,7 +9,13 @@ import (
 type ImageUsecases interface {
 	InitMinio() error
 	CreateObject(ctx context.Context, image domain.Image, r io.Reader, size int64, contentType string) (string, error)
-	GetObjectByID(ctx context.Context, id string) (io.ReadCloser, error)
+	GetObjectByID(ctx context.Context, id string) (io.ReadCloser, string, error)
 	GetImageStatus(ctx context.Context, id string) (*domain.Image, error)
+	GetImageMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error)
+	FindSimilarImages(ctx context.Context, id string, maxDistance int) ([]domain.SimilarImage, error)
+	GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error)
+	GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error)
+	GetResponsiveVariant(ctx context.Context, id string, name string) (io.ReadCloser, *domain.ResponsiveVariant, error)
+	ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error)
 	RemoveObject(ctx context.Context, id string) error
 }
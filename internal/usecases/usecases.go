@@ -1,22 +1,35 @@
 package usecases
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/dontpanicw/ImageProcessor/internal/domain"
 	"github.com/dontpanicw/ImageProcessor/internal/port"
+	"github.com/dontpanicw/ImageProcessor/pkg/imageinfo"
 	"github.com/google/uuid"
 	"io"
 	"log"
+	"strings"
 )
 
 var _ port.ImageUsecases = (*ImageUsecases)(nil)
 
+// similarLimit - максимальное число похожих изображений в ответе
+const similarLimit = 50
+
 type ImageUsecases struct {
 	repo           port.RepositoryDB
 	minio          port.ObjectStorage
 	brokerProducer port.Producer
+	// uploadLimits - ограничения на загружаемые оригиналы
+	uploadLimits imageinfo.Limits
+	// validateHeader - разбирать заголовок при загрузке и проверять
+	// размеры по uploadLimits, не дожидаясь воркера
+	validateHeader bool
 }
 
 func NewImageUsecases(repo port.RepositoryDB, minio port.ObjectStorage, brokerProducer port.Producer) *ImageUsecases {
@@ -27,6 +40,15 @@ func NewImageUsecases(repo port.RepositoryDB, minio port.ObjectStorage, brokerPr
 	}
 }
 
+// WithUploadLimits задает ограничения на загружаемые оригиналы.
+// Размер файла и формат проверяются всегда, размеры из заголовка -
+// только при validateHeader
+func (i *ImageUsecases) WithUploadLimits(limits imageinfo.Limits, validateHeader bool) *ImageUsecases {
+	i.uploadLimits = limits
+	i.validateHeader = validateHeader
+	return i
+}
+
 func (i *ImageUsecases) InitMinio() error {
 	return i.minio.InitMinio()
 }
@@ -40,79 +62,284 @@ func (i *ImageUsecases) CreateObject(ctx context.Context, image domain.Image, r
 	id := uuid.New().String()
 	image.Id = id
 
-	// Генерируем ключ для сырого изображения
-	rawObjectKey := fmt.Sprintf("raw/%s/%s", image.Id, uuid.New().String())
-	image.RawImageObjectKey = rawObjectKey
+	if err := i.uploadLimits.CheckSize(size); err != nil {
+		return "", fmt.Errorf("%w: %v", domain.ErrImageTooLarge, err)
+	}
+	if i.uploadLimits.MaxBytes > 0 {
+		// Заявленный размер может не совпадать с телом запроса
+		r = io.LimitReader(r, i.uploadLimits.MaxBytes+1)
+	}
+
+	// Оригинал читается целиком: ключ объекта зависит от хеша содержимого
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if err := i.uploadLimits.CheckSize(int64(len(data))); err != nil {
+		return "", fmt.Errorf("%w: %v", domain.ErrImageTooLarge, err)
+	}
+
+	format, err := i.detectFormat(data, contentType)
+	if err != nil {
+		return "", err
+	}
+	image.RawContentType = imageinfo.ContentType(format)
+
+	sum := sha256.Sum256(data)
+	image.RawContentHash = hex.EncodeToString(sum[:])
 	image.Status = domain.ImageStatusPending
 
-	log.Printf("Uploading image to MinIO: %s", rawObjectKey)
-	err := i.minio.PutObject(ctx, rawObjectKey, r, size, contentType)
+	rawObjectKey, upload, err := i.repo.AcquireBlob(ctx, image.RawContentHash,
+		blobObjectKey(image.RawContentHash, imageinfo.Extension(format)), int64(len(data)))
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to MinIO: %w", err)
+		return "", fmt.Errorf("failed to register raw blob: %w", err)
+	}
+	image.RawImageObjectKey = rawObjectKey
+
+	// Пока загрузка blob не подтверждена, объекта может еще не быть или
+	// первая загрузка могла не удаться: содержимое загружается повторно
+	// под тем же ключом, задача уходит только после загрузки
+	if upload {
+		log.Printf("Uploading image to MinIO: %s", rawObjectKey)
+		err = i.minio.PutObject(ctx, rawObjectKey, bytes.NewReader(data), int64(len(data)), image.RawContentType)
+		if err != nil {
+			i.releaseBlob(ctx, image.RawContentHash)
+			return "", fmt.Errorf("failed to upload to MinIO: %w", err)
+		}
+		if err := i.repo.MarkBlobUploaded(ctx, image.RawContentHash); err != nil {
+			i.releaseBlob(ctx, image.RawContentHash)
+			return "", fmt.Errorf("failed to mark raw blob uploaded: %w", err)
+		}
+	} else {
+		log.Printf("Image %s reuses stored blob %s", image.Id, rawObjectKey)
 	}
 
 	log.Printf("Saving image metadata to DB: %s", image.Id)
 	err = i.repo.SaveObject(ctx, image)
 	if err != nil {
-		if cleanupErr := i.minio.RemoveObject(ctx, rawObjectKey); cleanupErr != nil {
-			log.Printf("CRITICAL: Failed to cleanup minio object %s after DB error: %v", rawObjectKey, cleanupErr)
-		}
+		i.releaseBlob(ctx, image.RawContentHash)
 		return "", fmt.Errorf("failed to save to database: %w", err)
 	}
 
 	log.Printf("Sending task to Kafka for image: %s", image.Id)
-	err = i.brokerProducer.SendMessage(ctx, image.Id, image.Actions)
+	err = i.brokerProducer.SendMessage(ctx, domain.TaskMessage{
+		ImageID:     image.Id,
+		Actions:     image.Actions,
+		TaskOptions: image.Options,
+	})
 	if err != nil {
 		log.Printf("ERROR: Failed to send message to Kafka: %v", err)
 		return "", fmt.Errorf("failed to send task to Kafka: %w", err)
 	}
-	
+
 	log.Printf("Image %s successfully queued for processing", image.Id)
 	return image.Id, nil
 }
 
-func (i *ImageUsecases) GetObjectByID(ctx context.Context, id string) (io.ReadCloser, error) {
+// GetObjectByID возвращает обработанное изображение и его Content-Type.
+// Content-Type пустой у изображений, обработанных до его сохранения
+func (i *ImageUsecases) GetObjectByID(ctx context.Context, id string) (io.ReadCloser, string, error) {
 
 	imageData, err := i.repo.GetObjectByID(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if imageData.Status == domain.ImageStatusPending {
-		return nil, errors.New("image is pending")
+		return nil, "", errors.New("image is pending")
 	}
 	if imageData.Status == domain.ImageStatusFailed {
-		return nil, errors.New("image processing is failed")
+		return nil, "", errors.New("image processing is failed")
+	}
+	if imageData.Status == domain.ImageStatusQuarantined {
+		return nil, "", errors.New("image is quarantined")
 	}
 
 	image, err := i.minio.GetObject(ctx, imageData.ProcessedImageObjectKey)
 	if err != nil {
-		return nil, errors.New("error get object from minio")
+		return nil, "", errors.New("error get object from minio")
 	}
 
-	return image, err
+	return image, imageData.ContentType, err
 }
 
 func (i *ImageUsecases) GetImageStatus(ctx context.Context, id string) (*domain.Image, error) {
 	return i.repo.GetObjectByID(ctx, id)
 }
 
+func (i *ImageUsecases) GetImageMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+	return i.repo.GetMetadata(ctx, id)
+}
+
+func (i *ImageUsecases) FindSimilarImages(ctx context.Context, id string, maxDistance int) ([]domain.SimilarImage, error) {
+	image, err := i.repo.GetObjectByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if image.PerceptualHash == nil {
+		return nil, fmt.Errorf("image %s: %w", id, domain.ErrNotProcessed)
+	}
+
+	similar, err := i.repo.FindSimilar(ctx, *image.PerceptualHash, maxDistance, id, similarLimit)
+	if err != nil {
+		return nil, err
+	}
+	if similar == nil {
+		similar = []domain.SimilarImage{}
+	}
+	return similar, nil
+}
+
+func (i *ImageUsecases) GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error) {
+	return i.repo.GetColorProfile(ctx, id)
+}
+
+func (i *ImageUsecases) GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+	return i.repo.GetResponsiveManifest(ctx, id)
+}
+
+// GetResponsiveVariant возвращает содержимое адаптивного варианта name
+// и его описание из манифеста
+func (i *ImageUsecases) GetResponsiveVariant(ctx context.Context, id string, name string) (io.ReadCloser, *domain.ResponsiveVariant, error) {
+	manifest, err := i.repo.GetResponsiveManifest(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, variant := range manifest.Variants {
+		if variant.Name != name {
+			continue
+		}
+		reader, err := i.minio.GetObject(ctx, domain.ResponsiveObjectKey(id, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, &variant, nil
+	}
+	return nil, nil, fmt.Errorf("%w: id=%s, name=%s", domain.ErrVariantNotFound, id, name)
+}
+
+func (i *ImageUsecases) ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+	if err := validateFilter(&filter); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidFilter, err)
+	}
+	return i.repo.ListImages(ctx, filter)
+}
+
 func (i *ImageUsecases) RemoveObject(ctx context.Context, id string) error {
 	imageData, err := i.repo.GetObjectByID(ctx, id)
 	if err != nil {
 		return err
 	}
-	err = i.repo.DeleteObjectByID(ctx, id)
-	if err != nil {
+	// Манифест удаляется вместе с записью, ключи вариантов нужны заранее
+	manifest, err := i.repo.GetResponsiveManifest(ctx, id)
+	if err != nil && !errors.Is(err, domain.ErrNotProcessed) && !errors.Is(err, domain.ErrVariantNotFound) {
 		return err
 	}
-	err = i.minio.RemoveObject(ctx, imageData.ProcessedImageObjectKey)
+	err = i.repo.DeleteObjectByID(ctx, id)
 	if err != nil {
 		return err
 	}
-	err = i.minio.RemoveObject(ctx, imageData.RawImageObjectKey)
-	if err != nil {
-		return err
+	// Ключи могут быть пустыми: изображение еще не обработано
+	// или оригинал удален после скрытия областей (Redact)
+	if imageData.ProcessedImageObjectKey != "" {
+		err = i.minio.RemoveObject(ctx, imageData.ProcessedImageObjectKey)
+		if err != nil {
+			return err
+		}
+	}
+	if manifest != nil {
+		for _, variant := range manifest.Variants {
+			if err := i.minio.RemoveObject(ctx, domain.ResponsiveObjectKey(id, variant.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch {
+	case imageData.RawContentHash != "":
+		// Общий blob удаляется вместе с последней ссылкой
+		return i.repo.ReleaseBlob(ctx, imageData.RawContentHash, i.minio.RemoveObject)
+	case imageData.RawImageObjectKey != "":
+		return i.minio.RemoveObject(ctx, imageData.RawImageObjectKey)
+	}
+	return nil
+}
+
+// releaseBlob снимает ссылку на blob после неудачной загрузки
+func (i *ImageUsecases) releaseBlob(ctx context.Context, hash string) {
+	if err := i.repo.ReleaseBlob(ctx, hash, i.minio.RemoveObject); err != nil {
+		log.Printf("CRITICAL: Failed to release blob %s: %v", hash, err)
+	}
+}
+
+// blobObjectKey - ключ оригинала в хранилище, адресуемом по содержимому.
+// Расширение соответствует формату, определенному по сигнатуре
+func blobObjectKey(hash, ext string) string {
+	return fmt.Sprintf("blobs/sha256/%s/%s.%s", hash[:2], hash, ext)
+}
+
+// detectFormat определяет формат оригинала по сигнатуре и сверяет его
+// с заявленным клиентом Content-Type. Тип, не указывающий формат
+// изображения (пустой, application/octet-stream), не сверяется.
+func (i *ImageUsecases) detectFormat(data []byte, contentType string) (string, error) {
+	format := imageinfo.Format(data)
+	if format == "" {
+		return "", fmt.Errorf("%w: unrecognized file signature", domain.ErrUnsupportedFormat)
+	}
+
+	declared, ok := imageinfo.FormatOf(contentType)
+	if ok && declared != format || !ok && strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		return "", fmt.Errorf("%w: declared %s, detected %s", domain.ErrUnsupportedFormat, contentType, format)
+	}
+
+	if !i.validateHeader {
+		// Без разбора заголовка размеры неизвестны, проверяется только формат
+		if err := i.uploadLimits.Check(imageinfo.Info{Format: format}); err != nil {
+			return "", fmt.Errorf("%w: %v", domain.ErrUnsupportedFormat, err)
+		}
+		return format, nil
+	}
+
+	if _, err := i.uploadLimits.Validate(data); err != nil {
+		if errors.Is(err, imageinfo.ErrLimitExceeded) {
+			return "", fmt.Errorf("%w: %v", domain.ErrImageTooLarge, err)
+		}
+		return "", fmt.Errorf("%w: %v", domain.ErrUnsupportedFormat, err)
+	}
+	return format, nil
+}
+
+// validateFilter проверяет фильтр и подставляет значения по умолчанию
+func validateFilter(filter *domain.ImageFilter) error {
+	switch filter.Status {
+	case "", domain.ImageStatusPending, domain.ImageStatusDone, domain.ImageStatusFailed, domain.ImageStatusQuarantined:
+	default:
+		return fmt.Errorf("unknown status %q", filter.Status)
+	}
+	if filter.Color != "" {
+		rgb, err := domain.ParseRGB(filter.Color)
+		if err != nil {
+			return err
+		}
+		filter.Color = rgb.Hex()
+	}
+	if filter.ColorDistance < 0 {
+		return errors.New("color distance must not be negative")
+	}
+	if filter.ColorDistance == 0 {
+		filter.ColorDistance = domain.DefaultColorDistance
+	}
+	if filter.MinShare < 0 || filter.MinShare > 1 {
+		return errors.New("min share must be between 0 and 1")
+	}
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return errors.New("limit and offset must not be negative")
+	}
+	if filter.Limit == 0 {
+		filter.Limit = domain.DefaultListLimit
+	}
+	if filter.Limit > domain.MaxListLimit {
+		filter.Limit = domain.MaxListLimit
 	}
 	return nil
 }
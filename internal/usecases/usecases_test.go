@@ -1,13 +1,18 @@
 package usecases
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"io"
 	"strings"
 	"testing"
 
 	"github.com/dontpanicw/ImageProcessor/internal/domain"
+	"github.com/dontpanicw/ImageProcessor/pkg/imageinfo"
 )
 
 // Mock implementations
@@ -16,6 +21,18 @@ type mockRepositoryDB struct {
 	getObjectByIDFunc    func(ctx context.Context, id string) (*domain.Image, error)
 	deleteObjectByIDFunc func(ctx context.Context, id string) error
 	updateProcessedFunc  func(ctx context.Context, id string, key string) error
+	updateRawKeyFunc     func(ctx context.Context, id string, key string) error
+	saveMetadataFunc     func(ctx context.Context, id string, metadata domain.ImageMetadata) error
+	getMetadataFunc      func(ctx context.Context, id string) (*domain.ImageMetadata, error)
+	savePHashFunc        func(ctx context.Context, id string, hash uint64) error
+	findSimilarFunc      func(ctx context.Context, hash uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error)
+	markFailedFunc       func(ctx context.Context, id string, reason string) error
+	acquireBlobFunc      func(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error)
+	markBlobUploadedFunc func(ctx context.Context, hash string) error
+	// releaseBlobFunc снимает ссылку и сообщает, была ли она последней
+	releaseBlobFunc   func(ctx context.Context, hash string) (string, bool, error)
+	listImagesFunc    func(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error)
+	getResponsiveFunc func(ctx context.Context, id string) (*domain.ResponsiveManifest, error)
 }
 
 func (m *mockRepositoryDB) SaveObject(ctx context.Context, image domain.Image) error {
@@ -46,6 +63,126 @@ func (m *mockRepositoryDB) UpdateProcessedImage(ctx context.Context, id string,
 	return nil
 }
 
+func (m *mockRepositoryDB) UpdateRawObjectKey(ctx context.Context, id string, key string, remove func(ctx context.Context, key string) error) error {
+	if m.updateRawKeyFunc != nil {
+		return m.updateRawKeyFunc(ctx, id, key)
+	}
+	return nil
+}
+
+func (m *mockRepositoryDB) SaveMetadata(ctx context.Context, id string, metadata domain.ImageMetadata) error {
+	if m.saveMetadataFunc != nil {
+		return m.saveMetadataFunc(ctx, id, metadata)
+	}
+	return nil
+}
+
+func (m *mockRepositoryDB) GetMetadata(ctx context.Context, id string) (*domain.ImageMetadata, error) {
+	if m.getMetadataFunc != nil {
+		return m.getMetadataFunc(ctx, id)
+	}
+	return &domain.ImageMetadata{}, nil
+}
+
+func (m *mockRepositoryDB) SavePerceptualHash(ctx context.Context, id string, hash uint64) error {
+	if m.savePHashFunc != nil {
+		return m.savePHashFunc(ctx, id, hash)
+	}
+	return nil
+}
+
+func (m *mockRepositoryDB) FindSimilar(ctx context.Context, hash uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error) {
+	if m.findSimilarFunc != nil {
+		return m.findSimilarFunc(ctx, hash, maxDistance, excludeID, limit)
+	}
+	return nil, nil
+}
+
+func (m *mockRepositoryDB) MarkFailed(ctx context.Context, id string, reason string) error {
+	if m.markFailedFunc != nil {
+		return m.markFailedFunc(ctx, id, reason)
+	}
+	return nil
+}
+
+func (m *mockRepositoryDB) MarkQuarantined(ctx context.Context, id string, rawObjectKey string, reason string) error {
+	return nil
+}
+
+func (m *mockRepositoryDB) AcquireBlob(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error) {
+	if m.acquireBlobFunc != nil {
+		return m.acquireBlobFunc(ctx, hash, objectKey, size)
+	}
+	return objectKey, true, nil
+}
+
+func (m *mockRepositoryDB) MarkBlobUploaded(ctx context.Context, hash string) error {
+	if m.markBlobUploadedFunc != nil {
+		return m.markBlobUploadedFunc(ctx, hash)
+	}
+	return nil
+}
+
+func (m *mockRepositoryDB) ReleaseBlob(ctx context.Context, hash string, remove func(ctx context.Context, key string) error) error {
+	key, orphaned := blobObjectKey(hash, "jpg"), true
+	if m.releaseBlobFunc != nil {
+		var err error
+		if key, orphaned, err = m.releaseBlobFunc(ctx, hash); err != nil {
+			return err
+		}
+	}
+	if !orphaned {
+		return nil
+	}
+	return remove(ctx, key)
+}
+
+func (m *mockRepositoryDB) SavePlaceholder(ctx context.Context, id string, placeholder domain.Placeholder) error {
+	return nil
+}
+
+func (m *mockRepositoryDB) SaveColorProfile(ctx context.Context, id string, profile domain.ColorProfile) error {
+	return nil
+}
+
+func (m *mockRepositoryDB) GetColorProfile(ctx context.Context, id string) (*domain.ColorProfile, error) {
+	return &domain.ColorProfile{}, nil
+}
+
+func (m *mockRepositoryDB) SaveResponsiveManifest(ctx context.Context, id string, manifest domain.ResponsiveManifest) error {
+	return nil
+}
+
+func (m *mockRepositoryDB) GetResponsiveManifest(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+	if m.getResponsiveFunc != nil {
+		return m.getResponsiveFunc(ctx, id)
+	}
+	return nil, domain.ErrVariantNotFound
+}
+
+func (m *mockRepositoryDB) ListImages(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+	if m.listImagesFunc != nil {
+		return m.listImagesFunc(ctx, filter)
+	}
+	return []domain.Image{}, nil
+}
+
+func (m *mockRepositoryDB) FindCachedResult(ctx context.Context, contentHash, pipeline, version string) (*domain.Image, error) {
+	return nil, domain.ErrCacheMiss
+}
+
+func (m *mockRepositoryDB) SaveResultFormat(ctx context.Context, id string, contentType string, encoding *domain.Encoding) error {
+	return nil
+}
+
+func (m *mockRepositoryDB) SaveCachedResult(ctx context.Context, contentHash, pipeline, version, imageID string) error {
+	return nil
+}
+
+func (m *mockRepositoryDB) PurgeProcessingCache(ctx context.Context, version string) (int64, error) {
+	return 0, nil
+}
+
 type mockObjectStorage struct {
 	initMinioFunc    func() error
 	putObjectFunc    func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
@@ -71,7 +208,7 @@ func (m *mockObjectStorage) GetObject(ctx context.Context, key string) (io.ReadC
 	if m.getObjectFunc != nil {
 		return m.getObjectFunc(ctx, key)
 	}
-	return io.NopCloser(strings.NewReader("test")), nil
+	return io.NopCloser(strings.NewReader(jpegData("test"))), nil
 }
 
 func (m *mockObjectStorage) RemoveObject(ctx context.Context, key string) error {
@@ -82,12 +219,12 @@ func (m *mockObjectStorage) RemoveObject(ctx context.Context, key string) error
 }
 
 type mockProducer struct {
-	sendMessageFunc func(ctx context.Context, imageId string, actions []string) error
+	sendMessageFunc func(ctx context.Context, task domain.TaskMessage) error
 }
 
-func (m *mockProducer) SendMessage(ctx context.Context, imageId string, actions []string) error {
+func (m *mockProducer) SendMessage(ctx context.Context, task domain.TaskMessage) error {
 	if m.sendMessageFunc != nil {
-		return m.sendMessageFunc(ctx, imageId, actions)
+		return m.sendMessageFunc(ctx, task)
 	}
 	return nil
 }
@@ -105,7 +242,7 @@ func TestCreateObject_Success(t *testing.T) {
 		Actions:  []string{domain.ResizeAction},
 	}
 
-	reader := strings.NewReader("test image data")
+	reader := strings.NewReader(jpegData("test image data"))
 	ctx := context.Background()
 
 	id, err := usecase.CreateObject(ctx, image, reader, 1024, "image/jpeg")
@@ -119,6 +256,239 @@ func TestCreateObject_Success(t *testing.T) {
 	}
 }
 
+func TestCreateObject_SendsTaskOptions(t *testing.T) {
+	var sent domain.TaskMessage
+	producer := &mockProducer{
+		sendMessageFunc: func(ctx context.Context, task domain.TaskMessage) error {
+			sent = task
+			return nil
+		},
+	}
+	usecase := NewImageUsecases(&mockRepositoryDB{}, &mockObjectStorage{}, producer)
+
+	image := domain.Image{
+		FileName: "test.jpg",
+		FileSize: 1024,
+		Actions:  []string{domain.ResizeAction},
+		Options:  domain.TaskOptions{RejectDuplicates: true, DuplicateDistance: 3},
+	}
+	id, err := usecase.CreateObject(context.Background(), image, strings.NewReader(jpegData("data")), 4, "image/jpeg")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if sent.ImageID != id {
+		t.Errorf("Expected task for image %s, got %s", id, sent.ImageID)
+	}
+	if !sent.RejectDuplicates || sent.DuplicateDistance != 3 {
+		t.Errorf("Expected duplicate options to be sent, got %+v", sent.TaskOptions)
+	}
+}
+
+func TestCreateObject_DeduplicatesContent(t *testing.T) {
+	// Счетчик ссылок как в raw_blobs
+	refs := map[string]int{}
+	uploadedBlobs := map[string]bool{}
+	repo := &mockRepositoryDB{
+		acquireBlobFunc: func(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error) {
+			refs[hash]++
+			return objectKey, !uploadedBlobs[hash], nil
+		},
+		markBlobUploadedFunc: func(ctx context.Context, hash string) error {
+			uploadedBlobs[hash] = true
+			return nil
+		},
+	}
+	var uploaded []string
+	storage := &mockObjectStorage{
+		putObjectFunc: func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+			uploaded = append(uploaded, key)
+			return nil
+		},
+	}
+	var saved []domain.Image
+	repo.saveObjectFunc = func(ctx context.Context, image domain.Image) error {
+		saved = append(saved, image)
+		return nil
+	}
+	usecase := NewImageUsecases(repo, storage, &mockProducer{})
+
+	image := domain.Image{FileName: "test.jpg", FileSize: 4}
+	for _, content := range []string{"same", "same", "diff"} {
+		if _, err := usecase.CreateObject(context.Background(), image, strings.NewReader(jpegData(content)), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if len(uploaded) != 2 {
+		t.Fatalf("Expected 2 uploads for 2 distinct contents, got %v", uploaded)
+	}
+	if saved[0].RawImageObjectKey != saved[1].RawImageObjectKey {
+		t.Errorf("Expected identical content to share a key, got %s and %s", saved[0].RawImageObjectKey, saved[1].RawImageObjectKey)
+	}
+	if saved[0].Id == saved[1].Id {
+		t.Error("Expected distinct image ids")
+	}
+	sum := sha256.Sum256([]byte(jpegData("same")))
+	expectedHash := hex.EncodeToString(sum[:])
+	if saved[0].RawContentHash != expectedHash {
+		t.Errorf("Expected hash %s, got %s", expectedHash, saved[0].RawContentHash)
+	}
+	if saved[0].RawImageObjectKey != "blobs/sha256/"+expectedHash[:2]+"/"+expectedHash+".jpg" {
+		t.Errorf("Expected content-addressed key, got %s", saved[0].RawImageObjectKey)
+	}
+	if saved[0].RawContentType != "image/jpeg" {
+		t.Errorf("Expected detected content type image/jpeg, got %s", saved[0].RawContentType)
+	}
+}
+
+func TestCreateObject_UploadsUnconfirmedBlob(t *testing.T) {
+	// Счетчик ссылок и признак загрузки как в raw_blobs
+	refs := 0
+	uploadedBlob := false
+	repo := &mockRepositoryDB{
+		acquireBlobFunc: func(ctx context.Context, hash string, objectKey string, size int64) (string, bool, error) {
+			refs++
+			return objectKey, !uploadedBlob, nil
+		},
+		markBlobUploadedFunc: func(ctx context.Context, hash string) error {
+			uploadedBlob = true
+			return nil
+		},
+		releaseBlobFunc: func(ctx context.Context, hash string) (string, bool, error) {
+			refs--
+			return blobObjectKey(hash, "jpg"), refs == 0, nil
+		},
+	}
+	puts := 0
+	var removed []string
+	storage := &mockObjectStorage{
+		putObjectFunc: func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+			puts++
+			if puts == 1 {
+				return errors.New("storage unavailable")
+			}
+			return nil
+		},
+		removeObjectFunc: func(ctx context.Context, key string) error {
+			removed = append(removed, key)
+			return nil
+		},
+	}
+	sent := 0
+	producer := &mockProducer{
+		sendMessageFunc: func(ctx context.Context, task domain.TaskMessage) error {
+			if !uploadedBlob {
+				t.Error("Expected task to be sent only after the blob upload is confirmed")
+			}
+			sent++
+			return nil
+		},
+	}
+	usecase := NewImageUsecases(repo, storage, producer)
+	image := domain.Image{FileName: "test.jpg", FileSize: 4}
+
+	// Неудачная загрузка снимает свою ссылку и удаляет объект
+	if _, err := usecase.CreateObject(context.Background(), image, strings.NewReader(jpegData("same")), 4, "image/jpeg"); err == nil {
+		t.Fatal("Expected upload error")
+	}
+	if refs != 0 || len(removed) != 1 {
+		t.Fatalf("Expected failed upload to release the blob, got refs %d, removed %v", refs, removed)
+	}
+
+	// Следующая загрузка того же содержимого загружает его заново,
+	// а после подтверждения blob используется без загрузки
+	for i := 0; i < 2; i++ {
+		if _, err := usecase.CreateObject(context.Background(), image, strings.NewReader(jpegData("same")), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if puts != 2 || sent != 2 || refs != 2 {
+		t.Errorf("Expected 2 uploads, 2 tasks and 2 references, got %d, %d and %d", puts, sent, refs)
+	}
+}
+
+// jpegData - тело с сигнатурой JPEG
+func jpegData(body string) string {
+	return "\xff\xd8\xff\xe0" + body
+}
+
+// pngHeader - PNG из сигнатуры и IHDR с заданными размерами
+func pngHeader(width, height uint32) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	data = binary.BigEndian.AppendUint32(data, width)
+	data = binary.BigEndian.AppendUint32(data, height)
+	return append(data, 8, 6, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func TestCreateObject_ContentValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           []byte
+		contentType    string
+		limits         imageinfo.Limits
+		validateHeader bool
+		expectedErr    error
+		expectedType   string
+	}{
+		{name: "jpeg", data: []byte(jpegData("x")), contentType: "image/jpeg", expectedType: "image/jpeg"},
+		{name: "jpg alias", data: []byte(jpegData("x")), contentType: "image/jpg", expectedType: "image/jpeg"},
+		{name: "octet-stream", data: pngHeader(10, 10), contentType: "application/octet-stream", expectedType: "image/png"},
+		{name: "no content type", data: pngHeader(10, 10), expectedType: "image/png"},
+		{name: "mismatch", data: pngHeader(10, 10), contentType: "image/jpeg", expectedErr: domain.ErrUnsupportedFormat},
+		{name: "unknown image type", data: pngHeader(10, 10), contentType: "image/bmp", expectedErr: domain.ErrUnsupportedFormat},
+		{name: "not an image", data: []byte("<svg></svg>"), contentType: "image/svg+xml", expectedErr: domain.ErrUnsupportedFormat},
+		{name: "text", data: []byte("hello"), contentType: "application/octet-stream", expectedErr: domain.ErrUnsupportedFormat},
+		{name: "format not allowed", data: pngHeader(10, 10), limits: imageinfo.Limits{Formats: []string{imageinfo.JPEG}}, expectedErr: domain.ErrUnsupportedFormat},
+		{name: "too many bytes", data: pngHeader(10, 10), limits: imageinfo.Limits{MaxBytes: 16}, expectedErr: domain.ErrImageTooLarge},
+		{name: "too many pixels", data: pngHeader(50000, 50000), limits: imageinfo.Limits{MaxPixels: 1000}, validateHeader: true, expectedErr: domain.ErrImageTooLarge},
+		{name: "pixels without header check", data: pngHeader(50000, 50000), limits: imageinfo.Limits{MaxPixels: 1000}, expectedType: "image/png"},
+		{name: "malformed header", data: []byte(jpegData("x")), validateHeader: true, expectedErr: domain.ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved domain.Image
+			var storedType string
+			repo := &mockRepositoryDB{
+				saveObjectFunc: func(ctx context.Context, image domain.Image) error {
+					saved = image
+					return nil
+				},
+			}
+			storage := &mockObjectStorage{
+				putObjectFunc: func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+					storedType = contentType
+					return nil
+				},
+			}
+			usecase := NewImageUsecases(repo, storage, &mockProducer{}).WithUploadLimits(tt.limits, tt.validateHeader)
+
+			image := domain.Image{FileName: "upload", FileSize: int64(len(tt.data)), Actions: []string{domain.ResizeAction}}
+			_, err := usecase.CreateObject(context.Background(), image, bytes.NewReader(tt.data), int64(len(tt.data)), tt.contentType)
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected %v, got %v", tt.expectedErr, err)
+				}
+				if saved.Id != "" {
+					t.Error("Expected rejected image not to be saved")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if saved.RawContentType != tt.expectedType {
+				t.Errorf("Expected raw content type %s, got %s", tt.expectedType, saved.RawContentType)
+			}
+			if storedType != tt.expectedType {
+				t.Errorf("Expected object content type %s, got %s", tt.expectedType, storedType)
+			}
+		})
+	}
+}
+
 func TestCreateObject_ValidationError(t *testing.T) {
 	repo := &mockRepositoryDB{}
 	storage := &mockObjectStorage{}
@@ -131,7 +501,7 @@ func TestCreateObject_ValidationError(t *testing.T) {
 		FileSize: 1024,
 	}
 
-	reader := strings.NewReader("test")
+	reader := strings.NewReader(jpegData("test"))
 	ctx := context.Background()
 
 	_, err := usecase.CreateObject(ctx, image, reader, 1024, "image/jpeg")
@@ -158,7 +528,7 @@ func TestCreateObject_MinioError(t *testing.T) {
 		Actions:  []string{domain.ResizeAction},
 	}
 
-	reader := strings.NewReader("test")
+	reader := strings.NewReader(jpegData("test"))
 	ctx := context.Background()
 
 	_, err := usecase.CreateObject(ctx, image, reader, 1024, "image/jpeg")
@@ -192,7 +562,7 @@ func TestCreateObject_DBError_WithCleanup(t *testing.T) {
 		Actions:  []string{domain.ResizeAction},
 	}
 
-	reader := strings.NewReader("test")
+	reader := strings.NewReader(jpegData("test"))
 	ctx := context.Background()
 
 	_, err := usecase.CreateObject(ctx, image, reader, 1024, "image/jpeg")
@@ -212,7 +582,8 @@ func TestGetObjectByID_Success(t *testing.T) {
 			return &domain.Image{
 				Id:                      id,
 				Status:                  domain.ImageStatusDone,
-				ProcessedImageObjectKey: "processed/test.jpg",
+				ProcessedImageObjectKey: "processed/test.webp",
+				ContentType:             "image/webp",
 			}, nil
 		},
 	}
@@ -222,7 +593,7 @@ func TestGetObjectByID_Success(t *testing.T) {
 	usecase := NewImageUsecases(repo, storage, producer)
 	ctx := context.Background()
 
-	reader, err := usecase.GetObjectByID(ctx, "test-id")
+	reader, contentType, err := usecase.GetObjectByID(ctx, "test-id")
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -231,6 +602,9 @@ func TestGetObjectByID_Success(t *testing.T) {
 	if reader == nil {
 		t.Fatal("Expected reader, got nil")
 	}
+	if contentType != "image/webp" {
+		t.Errorf("Expected content type image/webp, got %s", contentType)
+	}
 	defer func(reader io.ReadCloser) {
 		err := reader.Close()
 		if err != nil {
@@ -254,7 +628,7 @@ func TestGetObjectByID_PendingStatus(t *testing.T) {
 	usecase := NewImageUsecases(repo, storage, producer)
 	ctx := context.Background()
 
-	_, err := usecase.GetObjectByID(ctx, "test-id")
+	_, _, err := usecase.GetObjectByID(ctx, "test-id")
 
 	if err == nil {
 		t.Fatal("Expected error for pending status, got nil")
@@ -276,13 +650,71 @@ func TestGetObjectByID_FailedStatus(t *testing.T) {
 	usecase := NewImageUsecases(repo, storage, producer)
 	ctx := context.Background()
 
-	_, err := usecase.GetObjectByID(ctx, "test-id")
+	_, _, err := usecase.GetObjectByID(ctx, "test-id")
 
 	if err == nil {
 		t.Fatal("Expected error for failed status, got nil")
 	}
 }
 
+func TestGetObjectByID_QuarantinedStatus(t *testing.T) {
+	repo := &mockRepositoryDB{
+		getObjectByIDFunc: func(ctx context.Context, id string) (*domain.Image, error) {
+			return &domain.Image{
+				Id:                id,
+				Status:            domain.ImageStatusQuarantined,
+				RawImageObjectKey: "quarantine/" + id + "/raw",
+			}, nil
+		},
+	}
+	storage := &mockObjectStorage{
+		getObjectFunc: func(ctx context.Context, key string) (io.ReadCloser, error) {
+			t.Errorf("Expected quarantined object not to be read, got request for %s", key)
+			return io.NopCloser(strings.NewReader("")), nil
+		},
+	}
+
+	usecase := NewImageUsecases(repo, storage, &mockProducer{})
+
+	_, _, err := usecase.GetObjectByID(context.Background(), "test-id")
+
+	if err == nil {
+		t.Fatal("Expected error for quarantined status, got nil")
+	}
+}
+
+func TestFindSimilarImages(t *testing.T) {
+	hash := uint64(0xF0F0)
+	repo := &mockRepositoryDB{
+		getObjectByIDFunc: func(ctx context.Context, id string) (*domain.Image, error) {
+			if id == "pending-id" {
+				return &domain.Image{Id: id, Status: domain.ImageStatusPending}, nil
+			}
+			return &domain.Image{Id: id, Status: domain.ImageStatusDone, PerceptualHash: &hash}, nil
+		},
+		findSimilarFunc: func(ctx context.Context, h uint64, maxDistance int, excludeID string, limit int) ([]domain.SimilarImage, error) {
+			if h != hash || maxDistance != 4 || excludeID != "test-id" {
+				t.Errorf("Unexpected query: hash=%x distance=%d exclude=%s", h, maxDistance, excludeID)
+			}
+			return []domain.SimilarImage{{Id: "other-id", Distance: 2}}, nil
+		},
+	}
+	usecase := NewImageUsecases(repo, &mockObjectStorage{}, &mockProducer{})
+
+	similar, err := usecase.FindSimilarImages(context.Background(), "test-id", 4)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(similar) != 1 || similar[0].Id != "other-id" {
+		t.Errorf("Expected other-id, got %v", similar)
+	}
+
+	_, err = usecase.FindSimilarImages(context.Background(), "pending-id", 4)
+	if !errors.Is(err, domain.ErrNotProcessed) {
+		t.Errorf("Expected ErrNotProcessed, got %v", err)
+	}
+}
+
 func TestRemoveObject_Success(t *testing.T) {
 	repo := &mockRepositoryDB{
 		getObjectByIDFunc: func(ctx context.Context, id string) (*domain.Image, error) {
@@ -317,6 +749,88 @@ func TestRemoveObject_Success(t *testing.T) {
 	}
 }
 
+func TestRemoveObject_SkipsEmptyKeys(t *testing.T) {
+	repo := &mockRepositoryDB{
+		getObjectByIDFunc: func(ctx context.Context, id string) (*domain.Image, error) {
+			return &domain.Image{
+				Id:                id,
+				RawImageObjectKey: "raw/test.jpg",
+				Status:            domain.ImageStatusPending,
+			}, nil
+		},
+	}
+
+	var removed []string
+	storage := &mockObjectStorage{
+		removeObjectFunc: func(ctx context.Context, key string) error {
+			removed = append(removed, key)
+			return nil
+		},
+	}
+
+	usecase := NewImageUsecases(repo, storage, &mockProducer{})
+
+	err := usecase.RemoveObject(context.Background(), "test-id")
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(removed) != 1 || removed[0] != "raw/test.jpg" {
+		t.Fatalf("Expected only raw object to be removed, got %v", removed)
+	}
+}
+
+func TestRemoveObject_SharedBlob(t *testing.T) {
+	tests := []struct {
+		name            string
+		orphaned        bool
+		expectedRemoved []string
+	}{
+		{"other references remain", false, []string{"processed/test.jpg"}},
+		{"last reference", true, []string{"processed/test.jpg", "blobs/sha256/ab/abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var released string
+			repo := &mockRepositoryDB{
+				getObjectByIDFunc: func(ctx context.Context, id string) (*domain.Image, error) {
+					return &domain.Image{
+						Id:                      id,
+						RawImageObjectKey:       "blobs/sha256/ab/abc",
+						RawContentHash:          "abc",
+						ProcessedImageObjectKey: "processed/test.jpg",
+					}, nil
+				},
+				releaseBlobFunc: func(ctx context.Context, hash string) (string, bool, error) {
+					released = hash
+					return "blobs/sha256/ab/abc", tt.orphaned, nil
+				},
+			}
+			var removed []string
+			storage := &mockObjectStorage{
+				removeObjectFunc: func(ctx context.Context, key string) error {
+					removed = append(removed, key)
+					return nil
+				},
+			}
+			usecase := NewImageUsecases(repo, storage, &mockProducer{})
+
+			if err := usecase.RemoveObject(context.Background(), "test-id"); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if released != "abc" {
+				t.Errorf("Expected blob abc to be released, got %q", released)
+			}
+			if strings.Join(removed, ",") != strings.Join(tt.expectedRemoved, ",") {
+				t.Errorf("Expected removed %v, got %v", tt.expectedRemoved, removed)
+			}
+		})
+	}
+}
+
 func TestValidateImage(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -366,3 +880,130 @@ func TestValidateImage(t *testing.T) {
 		})
 	}
 }
+
+func TestListImages_Filter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   domain.ImageFilter
+		expected domain.ImageFilter
+		wantErr  bool
+	}{
+		{
+			name:     "defaults",
+			filter:   domain.ImageFilter{},
+			expected: domain.ImageFilter{ColorDistance: domain.DefaultColorDistance, Limit: domain.DefaultListLimit},
+		},
+		{
+			name:     "color is normalized and limit capped",
+			filter:   domain.ImageFilter{Color: "FF8000", ColorDistance: 5, Limit: 1000, Status: domain.ImageStatusDone},
+			expected: domain.ImageFilter{Color: "#ff8000", ColorDistance: 5, Limit: domain.MaxListLimit, Status: domain.ImageStatusDone},
+		},
+		{name: "invalid color", filter: domain.ImageFilter{Color: "red"}, wantErr: true},
+		{name: "invalid status", filter: domain.ImageFilter{Status: "Archived"}, wantErr: true},
+		{
+			name:     "quarantined status",
+			filter:   domain.ImageFilter{Status: domain.ImageStatusQuarantined},
+			expected: domain.ImageFilter{Status: domain.ImageStatusQuarantined, ColorDistance: domain.DefaultColorDistance, Limit: domain.DefaultListLimit},
+		},
+		{name: "invalid share", filter: domain.ImageFilter{MinShare: 1.5}, wantErr: true},
+		{name: "negative offset", filter: domain.ImageFilter{Offset: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got domain.ImageFilter
+			repo := &mockRepositoryDB{
+				listImagesFunc: func(ctx context.Context, filter domain.ImageFilter) ([]domain.Image, error) {
+					got = filter
+					return []domain.Image{}, nil
+				},
+			}
+			usecase := NewImageUsecases(repo, &mockObjectStorage{}, &mockProducer{})
+
+			_, err := usecase.ListImages(context.Background(), tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr && !errors.Is(err, domain.ErrInvalidFilter) {
+				t.Errorf("Expected ErrInvalidFilter, got %v", err)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("Expected filter %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRemoveObject_ResponsiveVariants(t *testing.T) {
+	repo := &mockRepositoryDB{
+		getObjectByIDFunc: func(ctx context.Context, id string) (*domain.Image, error) {
+			return &domain.Image{
+				Id:                      id,
+				RawImageObjectKey:       "raw/test.jpg",
+				ProcessedImageObjectKey: "processed/test.jpg",
+			}, nil
+		},
+		getResponsiveFunc: func(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+			return &domain.ResponsiveManifest{Variants: []domain.ResponsiveVariant{
+				{Name: "320.webp"}, {Name: "320.jpeg"},
+			}}, nil
+		},
+	}
+
+	var removed []string
+	storage := &mockObjectStorage{
+		removeObjectFunc: func(ctx context.Context, key string) error {
+			removed = append(removed, key)
+			return nil
+		},
+	}
+
+	usecase := NewImageUsecases(repo, storage, &mockProducer{})
+
+	if err := usecase.RemoveObject(context.Background(), "test-id"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{"processed/test.jpg", "responsive/test-id/320.webp", "responsive/test-id/320.jpeg", "raw/test.jpg"}
+	if strings.Join(removed, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected removed %v, got %v", expected, removed)
+	}
+}
+
+func TestGetResponsiveVariant(t *testing.T) {
+	repo := &mockRepositoryDB{
+		getResponsiveFunc: func(ctx context.Context, id string) (*domain.ResponsiveManifest, error) {
+			return &domain.ResponsiveManifest{Variants: []domain.ResponsiveVariant{
+				{Name: "640.webp", ContentType: "image/webp"},
+			}}, nil
+		},
+	}
+
+	var requested string
+	storage := &mockObjectStorage{
+		getObjectFunc: func(ctx context.Context, key string) (io.ReadCloser, error) {
+			requested = key
+			return io.NopCloser(strings.NewReader("variant")), nil
+		},
+	}
+
+	usecase := NewImageUsecases(repo, storage, &mockProducer{})
+
+	reader, variant, err := usecase.GetResponsiveVariant(context.Background(), "test-id", "640.webp")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_ = reader.Close()
+
+	if requested != "responsive/test-id/640.webp" {
+		t.Errorf("Expected key responsive/test-id/640.webp, got %s", requested)
+	}
+	if variant.ContentType != "image/webp" {
+		t.Errorf("Expected content type image/webp, got %s", variant.ContentType)
+	}
+
+	_, _, err = usecase.GetResponsiveVariant(context.Background(), "test-id", "../raw")
+	if !errors.Is(err, domain.ErrVariantNotFound) {
+		t.Errorf("Expected ErrVariantNotFound, got %v", err)
+	}
+}
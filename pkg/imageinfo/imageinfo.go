@@ -0,0 +1,431 @@
+// Package imageinfo читает формат, размеры и число кадров изображения
+// из заголовка, не декодируя пиксели. Используется для защиты от
+// декомпрессионных бомб до передачи файла в libvips.
+package imageinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Форматы изображений
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	GIF  = "gif"
+	WEBP = "webp"
+	TIFF = "tiff"
+	AVIF = "avif"
+	HEIF = "heif"
+)
+
+var (
+	// ErrUnknownFormat - сигнатура не совпадает ни с одним известным форматом
+	ErrUnknownFormat = errors.New("unknown image format")
+	// ErrMalformed - заголовок поврежден или обрезан
+	ErrMalformed = errors.New("malformed image header")
+)
+
+// maxTIFFDirectories ограничивает обход цепочки IFD в TIFF
+const maxTIFFDirectories = 10000
+
+// Info - сведения из заголовка изображения
+type Info struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Frames - число кадров анимации или страниц, 1 для статичных изображений
+	Frames int `json:"frames"`
+}
+
+// Pixels - число пикселей одного кадра после декодирования
+func (i Info) Pixels() int64 {
+	return int64(i.Width) * int64(i.Height)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Format определяет формат по первым байтам файла, "" - формат неизвестен
+func Format(head []byte) string {
+	switch {
+	case len(head) >= 3 && head[0] == 0xFF && head[1] == 0xD8 && head[2] == 0xFF:
+		return JPEG
+	case bytes.HasPrefix(head, pngSignature):
+		return PNG
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return GIF
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return WEBP
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return TIFF
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return isobmffFormat(head)
+	}
+	return ""
+}
+
+// isobmffFormat различает AVIF и HEIF по брендам бокса ftyp
+func isobmffFormat(head []byte) string {
+	size := int(binary.BigEndian.Uint32(head[0:4]))
+	if size < 16 || size > len(head) {
+		size = len(head)
+	}
+	brands := []string{string(head[8:12])}
+	for offset := 16; offset+4 <= size; offset += 4 {
+		brands = append(brands, string(head[offset:offset+4]))
+	}
+
+	format := ""
+	for _, brand := range brands {
+		switch brand {
+		case "avif", "avis":
+			return AVIF
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			format = HEIF
+		}
+	}
+	return format
+}
+
+// Decode читает заголовок изображения
+func Decode(data []byte) (Info, error) {
+	format := Format(data)
+
+	var (
+		info Info
+		err  error
+	)
+	switch format {
+	case JPEG:
+		info, err = decodeJPEG(data)
+	case PNG:
+		info, err = decodePNG(data)
+	case GIF:
+		info, err = decodeGIF(data)
+	case WEBP:
+		info, err = decodeWebP(data)
+	case TIFF:
+		info, err = decodeTIFF(data)
+	case AVIF, HEIF:
+		info, err = decodeISOBMFF(data)
+	default:
+		return Info{}, ErrUnknownFormat
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %s: %v", ErrMalformed, format, err)
+	}
+	if info.Frames == 0 {
+		info.Frames = 1
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		return Info{}, fmt.Errorf("%w: %s: invalid dimensions %dx%d", ErrMalformed, format, info.Width, info.Height)
+	}
+	info.Format = format
+	return info, nil
+}
+
+func decodeJPEG(data []byte) (Info, error) {
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return Info{}, fmt.Errorf("expected marker at offset %d", offset)
+		}
+		marker := data[offset+1]
+		switch {
+		case marker == 0xFF:
+			// Заполняющие байты перед маркером
+			offset++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			offset += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			return Info{}, errors.New("no frame header before image data")
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return Info{}, fmt.Errorf("segment 0x%X is truncated", marker)
+		}
+		// SOF0-SOF15, кроме DHT (C4), JPG (C8) и DAC (CC)
+		if marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC {
+			if length < 7 {
+				return Info{}, errors.New("frame header is truncated")
+			}
+			payload := data[offset+4:]
+			return Info{
+				Height: int(binary.BigEndian.Uint16(payload[1:])),
+				Width:  int(binary.BigEndian.Uint16(payload[3:])),
+				Frames: 1,
+			}, nil
+		}
+		offset += 2 + length
+	}
+	return Info{}, errors.New("frame header not found")
+}
+
+func decodePNG(data []byte) (Info, error) {
+	if len(data) < 24 || string(data[12:16]) != "IHDR" {
+		return Info{}, errors.New("IHDR chunk not found")
+	}
+	info := Info{
+		Width:  int(binary.BigEndian.Uint32(data[16:])),
+		Height: int(binary.BigEndian.Uint32(data[20:])),
+		Frames: 1,
+	}
+
+	// Число кадров APNG задается в acTL перед первым IDAT
+	offset := 8
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunk := string(data[offset+4 : offset+8])
+		if chunk == "IDAT" || chunk == "IEND" {
+			break
+		}
+		if chunk == "acTL" && length >= 8 && offset+16 <= len(data) {
+			info.Frames = int(binary.BigEndian.Uint32(data[offset+8:]))
+			break
+		}
+		if offset+12+length > len(data) {
+			break
+		}
+		offset += 12 + length
+	}
+	return info, nil
+}
+
+func decodeGIF(data []byte) (Info, error) {
+	if len(data) < 13 {
+		return Info{}, errors.New("logical screen descriptor is truncated")
+	}
+	info := Info{
+		Width:  int(binary.LittleEndian.Uint16(data[6:])),
+		Height: int(binary.LittleEndian.Uint16(data[8:])),
+	}
+
+	offset := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		offset += 3 << ((flags & 0x07) + 1)
+	}
+
+	// Кадры считаются по дескрипторам изображений, данные кадров пропускаются
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x2C:
+			info.Frames++
+			if offset+10 > len(data) {
+				return info, nil
+			}
+			// Кадр может быть больше логического экрана:
+			// декодер выделит память под больший размер
+			frameWidth := int(binary.LittleEndian.Uint16(data[offset+5:]))
+			frameHeight := int(binary.LittleEndian.Uint16(data[offset+7:]))
+			info.Width, info.Height = max(info.Width, frameWidth), max(info.Height, frameHeight)
+
+			flags := data[offset+9]
+			offset += 10
+			if flags&0x80 != 0 {
+				offset += 3 << ((flags & 0x07) + 1)
+			}
+			// Минимальный размер кода LZW
+			offset++
+			offset = skipGIFSubBlocks(data, offset)
+		case 0x21:
+			offset = skipGIFSubBlocks(data, offset+2)
+		case 0x3B:
+			return info, nil
+		default:
+			return info, fmt.Errorf("unexpected block 0x%X", data[offset])
+		}
+	}
+	return info, nil
+}
+
+func skipGIFSubBlocks(data []byte, offset int) int {
+	for offset < len(data) {
+		size := int(data[offset])
+		offset++
+		if size == 0 {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+func decodeWebP(data []byte) (Info, error) {
+	// Заголовки VP8 и VP8X занимают 10 байт, VP8L - 5
+	if len(data) < 30 && !(len(data) >= 25 && string(data[12:16]) == "VP8L") {
+		return Info{}, errors.New("first chunk is truncated")
+	}
+	info := Info{Frames: 1}
+	payload := data[20:]
+
+	switch string(data[12:16]) {
+	case "VP8 ":
+		if payload[3] != 0x9D || payload[4] != 0x01 || payload[5] != 0x2A {
+			return Info{}, errors.New("invalid VP8 start code")
+		}
+		info.Width = int(binary.LittleEndian.Uint16(payload[6:]) & 0x3FFF)
+		info.Height = int(binary.LittleEndian.Uint16(payload[8:]) & 0x3FFF)
+	case "VP8L":
+		if payload[0] != 0x2F {
+			return Info{}, errors.New("invalid VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(payload[1:])
+		info.Width = int(bits&0x3FFF) + 1
+		info.Height = int((bits>>14)&0x3FFF) + 1
+	case "VP8X":
+		info.Width = int(uint32(payload[4])|uint32(payload[5])<<8|uint32(payload[6])<<16) + 1
+		info.Height = int(uint32(payload[7])|uint32(payload[8])<<8|uint32(payload[9])<<16) + 1
+		if payload[0]&0x02 != 0 {
+			info.Frames = countWebPFrames(data)
+		}
+	default:
+		return Info{}, fmt.Errorf("unexpected chunk %q", data[12:16])
+	}
+	return info, nil
+}
+
+func countWebPFrames(data []byte) int {
+	frames := 0
+	offset := 12
+	for offset+8 <= len(data) {
+		if string(data[offset:offset+4]) == "ANMF" {
+			frames++
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		// Чанки выравниваются по четной границе
+		offset += 8 + size + size&1
+	}
+	return frames
+}
+
+func decodeTIFF(data []byte) (Info, error) {
+	if len(data) < 8 {
+		return Info{}, errors.New("header is truncated")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	info := Info{}
+	visited := make(map[uint32]bool)
+	offset := order.Uint32(data[4:])
+	for offset != 0 && info.Frames < maxTIFFDirectories {
+		if visited[offset] {
+			return Info{}, errors.New("IFD chain has a cycle")
+		}
+		visited[offset] = true
+		if int64(offset)+2 > int64(len(data)) {
+			return Info{}, fmt.Errorf("IFD offset %d is out of range", offset)
+		}
+
+		start := int(offset)
+		count := int(order.Uint16(data[start:]))
+		end := start + 2 + count*12
+		if end+4 > len(data) {
+			return Info{}, errors.New("IFD is truncated")
+		}
+
+		info.Frames++
+		if info.Frames == 1 {
+			for i := 0; i < count; i++ {
+				entry := data[start+2+i*12:]
+				tag, kind := order.Uint16(entry), order.Uint16(entry[2:])
+				var value int
+				switch kind {
+				case 3:
+					value = int(order.Uint16(entry[8:]))
+				case 4:
+					value = int(order.Uint32(entry[8:]))
+				default:
+					continue
+				}
+				switch tag {
+				case 256:
+					info.Width = value
+				case 257:
+					info.Height = value
+				}
+			}
+		}
+		offset = order.Uint32(data[end:])
+	}
+	return info, nil
+}
+
+func decodeISOBMFF(data []byte) (Info, error) {
+	meta, ok := findBox(data, "meta")
+	if !ok || len(meta) < 4 {
+		return Info{}, errors.New("meta box not found")
+	}
+	// meta - полный бокс: версия и флаги перед дочерними боксами
+	iprp, ok := findBox(meta[4:], "iprp")
+	if !ok {
+		return Info{}, errors.New("iprp box not found")
+	}
+	ipco, ok := findBox(iprp, "ipco")
+	if !ok {
+		return Info{}, errors.New("ipco box not found")
+	}
+
+	// Размеры основного изображения - наибольший ispe: у миниатюр и
+	// альфа-каналов свои ispe меньшего размера
+	info := Info{Frames: 1}
+	err := eachBox(ipco, func(kind string, payload []byte) {
+		if kind != "ispe" || len(payload) < 12 {
+			return
+		}
+		width := int(binary.BigEndian.Uint32(payload[4:]))
+		height := int(binary.BigEndian.Uint32(payload[8:]))
+		if int64(width)*int64(height) > info.Pixels() {
+			info.Width, info.Height = width, height
+		}
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// findBox возвращает содержимое первого бокса kind на этом уровне
+func findBox(data []byte, kind string) ([]byte, bool) {
+	var found []byte
+	ok := false
+	_ = eachBox(data, func(boxKind string, payload []byte) {
+		if !ok && boxKind == kind {
+			found, ok = payload, true
+		}
+	})
+	return found, ok
+}
+
+// eachBox обходит боксы ISOBMFF одного уровня
+func eachBox(data []byte, fn func(kind string, payload []byte)) error {
+	offset := 0
+	for offset+8 <= len(data) {
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - offset)
+		case 1:
+			if offset+16 > len(data) {
+				return errors.New("box size is truncated")
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)-offset) {
+			return fmt.Errorf("box %q is truncated", kind)
+		}
+		fn(kind, data[offset+int(header):offset+int(size)])
+		offset += int(size)
+	}
+	return nil
+}
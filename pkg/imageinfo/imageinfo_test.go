@@ -0,0 +1,200 @@
+package imageinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, width, height, frames int) []byte {
+	t.Helper()
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+		frame.Set(i%width, 0, color.White)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// riff собирает WebP из чанков
+func riff(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(body)))
+	return append(out, body...)
+}
+
+func webpChunk(kind string, payload []byte) []byte {
+	out := []byte(kind)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(payload)))
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func uint24(v int) []byte {
+	return []byte{byte(v), byte(v >> 8), byte(v >> 16)}
+}
+
+// box собирает бокс ISOBMFF
+func box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, kind...), body...)
+}
+
+func ispe(width, height int) []byte {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[4:], uint32(width))
+	binary.BigEndian.PutUint32(payload[8:], uint32(height))
+	return box("ispe", payload)
+}
+
+func heifFile(brand string, properties ...[]byte) []byte {
+	ftyp := box("ftyp", []byte(brand), []byte{0, 0, 0, 0}, []byte("mif1"))
+	meta := box("meta", []byte{0, 0, 0, 0}, box("hdlr", make([]byte, 20)), box("iprp", box("ipco", properties...)))
+	return append(ftyp, meta...)
+}
+
+func tiffFile(width, height, pages int) []byte {
+	out := []byte("II*\x00")
+	out = binary.LittleEndian.AppendUint32(out, 8)
+	for page := 0; page < pages; page++ {
+		out = binary.LittleEndian.AppendUint16(out, 2)
+		out = append(out, 0x00, 0x01, 3, 0, 1, 0, 0, 0)
+		out = binary.LittleEndian.AppendUint32(out, uint32(width))
+		out = append(out, 0x01, 0x01, 4, 0, 1, 0, 0, 0)
+		out = binary.LittleEndian.AppendUint32(out, uint32(height))
+		next := uint32(0)
+		if page < pages-1 {
+			next = uint32(len(out) + 4)
+		}
+		out = binary.LittleEndian.AppendUint32(out, next)
+	}
+	return out
+}
+
+func TestDecode(t *testing.T) {
+	vp8 := []byte{0, 0, 0, 0x9D, 0x01, 0x2A, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(vp8[6:], 640)
+	binary.LittleEndian.PutUint16(vp8[8:], 480)
+
+	vp8l := make([]byte, 5)
+	vp8l[0] = 0x2F
+	binary.LittleEndian.PutUint32(vp8l[1:], uint32(299)|uint32(199)<<14)
+
+	vp8x := append([]byte{0x02, 0, 0, 0}, append(uint24(1023), uint24(767)...)...)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Info
+	}{
+		{"jpeg", encodeJPEG(t, 33, 17), Info{JPEG, 33, 17, 1}},
+		{"png", encodePNG(t, 40, 20), Info{PNG, 40, 20, 1}},
+		{"animated gif", encodeGIF(t, 8, 6, 3), Info{GIF, 8, 6, 3}},
+		{"webp lossy", riff(webpChunk("VP8 ", vp8)), Info{WEBP, 640, 480, 1}},
+		{"webp lossless", riff(webpChunk("VP8L", vp8l)), Info{WEBP, 300, 200, 1}},
+		{"animated webp", riff(webpChunk("VP8X", vp8x), webpChunk("ANIM", make([]byte, 6)),
+			webpChunk("ANMF", make([]byte, 17)), webpChunk("ANMF", make([]byte, 16))), Info{WEBP, 1024, 768, 2}},
+		{"multipage tiff", tiffFile(120, 80, 3), Info{TIFF, 120, 80, 3}},
+		{"avif", heifFile("avif", ispe(64, 64), ispe(4000, 3000)), Info{AVIF, 4000, 3000, 1}},
+		{"heic", heifFile("heic", ispe(800, 600)), Info{HEIF, 800, 600, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if info != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, info)
+			}
+		})
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	png := encodePNG(t, 10, 10)
+	jpg := encodeJPEG(t, 10, 10)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"text", []byte("hello, world"), ErrUnknownFormat},
+		{"empty", nil, ErrUnknownFormat},
+		{"truncated png", png[:20], ErrMalformed},
+		{"truncated jpeg", jpg[:4], ErrMalformed},
+		{"tiff cycle", append([]byte("II*\x00\x08\x00\x00\x00"), 0, 0, 8, 0, 0, 0), ErrMalformed},
+		{"heif without meta", box("ftyp", []byte("heic"), []byte{0, 0, 0, 0}), ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    string
+		ok          bool
+	}{
+		{"image/jpeg", JPEG, true},
+		{"image/JPG", JPEG, true},
+		{"image/heic; charset=binary", HEIF, true},
+		{"application/octet-stream", "", false},
+		{"", "", false},
+		{"text/plain", "", false},
+	}
+
+	for _, tt := range tests {
+		format, ok := FormatOf(tt.contentType)
+		if format != tt.expected || ok != tt.ok {
+			t.Errorf("FormatOf(%q): expected %q %t, got %q %t", tt.contentType, tt.expected, tt.ok, format, ok)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package imageinfo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrLimitExceeded - изображение превышает ограничения на входные данные
+	ErrLimitExceeded = errors.New("image exceeds input limits")
+	// ErrFormatNotAllowed - формат изображения не разрешен
+	ErrFormatNotAllowed = errors.New("image format is not allowed")
+)
+
+// Limits - ограничения на входные изображения. Нулевые значения
+// означают отсутствие ограничения.
+type Limits struct {
+	MaxBytes     int64
+	MaxPixels    int64
+	MaxDimension int
+	MaxFrames    int
+	// Formats - разрешенные форматы, пусто - любые известные
+	Formats []string
+}
+
+// CheckSize проверяет размер файла до чтения содержимого
+func (l Limits) CheckSize(size int64) error {
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return fmt.Errorf("%w: %d bytes, max %d", ErrLimitExceeded, size, l.MaxBytes)
+	}
+	return nil
+}
+
+// Check проверяет сведения из заголовка
+func (l Limits) Check(info Info) error {
+	if len(l.Formats) > 0 && !slices.Contains(l.Formats, info.Format) {
+		return fmt.Errorf("%w: %s", ErrFormatNotAllowed, info.Format)
+	}
+	if l.MaxDimension > 0 && (info.Width > l.MaxDimension || info.Height > l.MaxDimension) {
+		return fmt.Errorf("%w: %dx%d, max side %d", ErrLimitExceeded, info.Width, info.Height, l.MaxDimension)
+	}
+	if l.MaxPixels > 0 && info.Pixels() > l.MaxPixels {
+		return fmt.Errorf("%w: %d pixels, max %d", ErrLimitExceeded, info.Pixels(), l.MaxPixels)
+	}
+	if l.MaxFrames > 0 && info.Frames > l.MaxFrames {
+		return fmt.Errorf("%w: %d frames, max %d", ErrLimitExceeded, info.Frames, l.MaxFrames)
+	}
+	return nil
+}
+
+// Validate читает заголовок и проверяет его по ограничениям
+func (l Limits) Validate(data []byte) (Info, error) {
+	if err := l.CheckSize(int64(len(data))); err != nil {
+		return Info{}, err
+	}
+	info, err := Decode(data)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := l.Check(info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
@@ -0,0 +1,62 @@
+package imageinfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// pngBomb - заголовок PNG, заявляющий огромные размеры без данных
+func pngBomb(width, height uint32) []byte {
+	out := append([]byte{}, pngSignature...)
+	out = binary.BigEndian.AppendUint32(out, 13)
+	out = append(out, "IHDR"...)
+	out = binary.BigEndian.AppendUint32(out, width)
+	out = binary.BigEndian.AppendUint32(out, height)
+	return append(out, 8, 6, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func TestLimits_Validate(t *testing.T) {
+	limits := Limits{
+		MaxBytes:     1 << 20,
+		MaxPixels:    50_000_000,
+		MaxDimension: 20000,
+		MaxFrames:    2,
+		Formats:      []string{JPEG, PNG, GIF},
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"ok", encodePNG(t, 100, 100), nil},
+		{"pixel bomb", pngBomb(10000, 10000), ErrLimitExceeded},
+		{"too wide", pngBomb(30000, 10), ErrLimitExceeded},
+		{"too many frames", encodeGIF(t, 4, 4, 3), ErrLimitExceeded},
+		{"format not allowed", tiffFile(10, 10, 1), ErrFormatNotAllowed},
+		{"too large", append(encodePNG(t, 1, 1), make([]byte, 1<<20)...), ErrLimitExceeded},
+		{"unknown", []byte("<svg></svg>"), ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := limits.Validate(tt.data)
+			if tt.expected == nil && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestLimits_ZeroMeansUnlimited(t *testing.T) {
+	if err := (Limits{}).Check(Info{Format: TIFF, Width: 100000, Height: 100000, Frames: 1000}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := (Limits{}).CheckSize(1 << 40); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package imageinfo
+
+import (
+	"mime"
+	"strings"
+)
+
+// contentTypes - Content-Type форматов
+var contentTypes = map[string]string{
+	JPEG: "image/jpeg",
+	PNG:  "image/png",
+	GIF:  "image/gif",
+	WEBP: "image/webp",
+	TIFF: "image/tiff",
+	AVIF: "image/avif",
+	HEIF: "image/heif",
+}
+
+// extensions - расширения файлов форматов
+var extensions = map[string]string{
+	JPEG: "jpg",
+	PNG:  "png",
+	GIF:  "gif",
+	WEBP: "webp",
+	TIFF: "tiff",
+	AVIF: "avif",
+	HEIF: "heic",
+}
+
+// mediaTypes - форматы по Content-Type, включая распространенные синонимы
+var mediaTypes = map[string]string{
+	"image/jpeg":          JPEG,
+	"image/jpg":           JPEG,
+	"image/pjpeg":         JPEG,
+	"image/png":           PNG,
+	"image/x-png":         PNG,
+	"image/apng":          PNG,
+	"image/gif":           GIF,
+	"image/webp":          WEBP,
+	"image/tiff":          TIFF,
+	"image/tiff-fx":       TIFF,
+	"image/avif":          AVIF,
+	"image/avif-sequence": AVIF,
+	"image/heif":          HEIF,
+	"image/heic":          HEIF,
+	"image/heif-sequence": HEIF,
+	"image/heic-sequence": HEIF,
+}
+
+// ContentType возвращает Content-Type формата
+func ContentType(format string) string {
+	if contentType, ok := contentTypes[format]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// Extension возвращает расширение файла формата без точки
+func Extension(format string) string {
+	if ext, ok := extensions[format]; ok {
+		return ext
+	}
+	return "bin"
+}
+
+// FormatOf возвращает формат, заявленный в Content-Type. ok = false,
+// если тип не указывает конкретный формат изображения
+// (пустой, application/octet-stream и т.п.)
+func FormatOf(contentType string) (format string, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	format, ok = mediaTypes[mediaType]
+	return format, ok
+}
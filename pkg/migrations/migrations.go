@@ -4,19 +4,37 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"fmt"
 	"github.com/pressly/goose/v3"
 )
 
-//go:embed *.sql
+// Каждому диалекту соответствует свой каталог миграций с общей нумерацией версий
+//
+//go:embed postgres/*.sql sqlite/*.sql
 var embedMigrations embed.FS
 
-func Migrate(db *sql.DB) error {
+// Поддерживаемые диалекты
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// Migrate применяет миграции диалекта dialect из одноименного каталога
+func Migrate(db *sql.DB, dialect string) error {
+	var gooseDialect goose.Dialect
+	switch dialect {
+	case DialectPostgres:
+		gooseDialect = goose.DialectPostgres
+	case DialectSQLite:
+		gooseDialect = goose.DialectSQLite3
+	default:
+		return fmt.Errorf("unsupported migration dialect %q", dialect)
+	}
+
 	goose.SetBaseFS(embedMigrations)
-	err := goose.SetDialect("postgres")
-	if err != nil {
+	if err := goose.SetDialect(string(gooseDialect)); err != nil {
 		return err
 	}
 
-	// "." означает: использовать файлы .sql из той же директории, что и migrate.go
-	return goose.UpContext(context.Background(), db, ".")
+	return goose.UpContext(context.Background(), db, dialect)
 }
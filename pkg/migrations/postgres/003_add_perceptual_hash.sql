@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS phash BIGINT,
+    ADD COLUMN IF NOT EXISTS failure_reason TEXT;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS raw_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    object_key VARCHAR(512) NOT NULL,
+    size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 1 CHECK (ref_count >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS raw_content_hash CHAR(64);
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS processing_cache (
+    content_hash CHAR(64) NOT NULL,
+    pipeline TEXT NOT NULL,
+    processor_version VARCHAR(32) NOT NULL,
+    -- Изображение, чей результат переиспользуется; запись удаляется вместе с ним
+    image_id VARCHAR(255) NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (content_hash, pipeline, processor_version)
+);
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS thumbhash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS dominant_color CHAR(7);
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS color_histogram JSONB;
+
+CREATE TABLE IF NOT EXISTS image_palette (
+    image_id VARCHAR(255) NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    rank SMALLINT NOT NULL,
+    color CHAR(7) NOT NULL,
+    share REAL NOT NULL,
+    -- Цвет в CIE Lab для поиска по расстоянию ΔE
+    lab_l REAL NOT NULL,
+    lab_a REAL NOT NULL,
+    lab_b REAL NOT NULL,
+    PRIMARY KEY (image_id, rank)
+);
@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS content_type VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS encoding JSONB;
@@ -0,0 +1,3 @@
+-- +goose Up
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS raw_content_type VARCHAR(64);
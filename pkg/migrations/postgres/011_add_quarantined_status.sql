@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE images DROP CONSTRAINT IF EXISTS valid_status;
+ALTER TABLE images
+    ADD CONSTRAINT valid_status CHECK (status IN ('Pending', 'Done', 'Failed', 'Quarantined'));
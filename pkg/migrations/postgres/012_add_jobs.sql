@@ -0,0 +1,18 @@
+-- +goose Up
+-- Очередь задач для QUEUE_DRIVER=postgres
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    image_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    -- Сколько раз задача выдавалась обработчику
+    attempts INTEGER NOT NULL DEFAULT 0,
+    -- Задача доступна обработчикам с этого момента. При выдаче время
+    -- сдвигается на таймаут видимости, после ошибки - на паузу перед повтором
+    visible_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    -- Попытки исчерпаны: задача больше не выдается
+    failed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_visible ON jobs (visible_at, id) WHERE failed_at IS NULL;
@@ -0,0 +1,5 @@
+-- +goose Up
+-- Новый blob не считается загруженным, пока загрузка не подтверждена:
+-- до этого каждый, кто ссылается на него, загружает содержимое сам
+ALTER TABLE raw_blobs
+    ADD COLUMN IF NOT EXISTS uploaded BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS images (
+    id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    file_size INTEGER NOT NULL CHECK (file_size > 0),
+    raw_image_object_key TEXT NOT NULL,
+    processed_image_object_key TEXT,
+    actions TEXT NOT NULL DEFAULT '[]',
+    status TEXT NOT NULL DEFAULT 'Pending',
+    -- Миллисекунды: порядок в списке изображений не зависит от секундных совпадений
+    created_at TEXT DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TEXT DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+    -- SQLite не изменяет CHECK без пересоздания таблицы, поэтому
+    -- статус Quarantined (011) разрешен сразу
+    CONSTRAINT valid_status CHECK (status IN ('Pending', 'Done', 'Failed', 'Quarantined'))
+);
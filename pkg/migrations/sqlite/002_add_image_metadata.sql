@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE images ADD COLUMN metadata TEXT;
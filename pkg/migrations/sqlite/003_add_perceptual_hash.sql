@@ -0,0 +1,3 @@
+-- +goose Up
+ALTER TABLE images ADD COLUMN phash INTEGER;
+ALTER TABLE images ADD COLUMN failure_reason TEXT;
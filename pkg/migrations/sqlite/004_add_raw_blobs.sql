@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS raw_blobs (
+    hash TEXT PRIMARY KEY,
+    object_key TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 1 CHECK (ref_count >= 0),
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE images ADD COLUMN raw_content_hash TEXT;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS processing_cache (
+    content_hash TEXT NOT NULL,
+    pipeline TEXT NOT NULL,
+    processor_version TEXT NOT NULL,
+    -- Изображение, чей результат переиспользуется; запись удаляется вместе с ним
+    image_id TEXT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (content_hash, pipeline, processor_version)
+);
@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE images ADD COLUMN blurhash TEXT;
+ALTER TABLE images ADD COLUMN thumbhash TEXT;
+ALTER TABLE images ADD COLUMN dominant_color TEXT;
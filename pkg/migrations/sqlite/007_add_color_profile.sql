@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE images ADD COLUMN color_histogram TEXT;
+
+CREATE TABLE IF NOT EXISTS image_palette (
+    image_id TEXT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    rank INTEGER NOT NULL,
+    color TEXT NOT NULL,
+    share REAL NOT NULL,
+    -- Цвет в CIE Lab для поиска по расстоянию ΔE
+    lab_l REAL NOT NULL,
+    lab_a REAL NOT NULL,
+    lab_b REAL NOT NULL,
+    PRIMARY KEY (image_id, rank)
+);
@@ -0,0 +1,3 @@
+-- +goose Up
+ALTER TABLE images ADD COLUMN content_type TEXT;
+ALTER TABLE images ADD COLUMN encoding TEXT;
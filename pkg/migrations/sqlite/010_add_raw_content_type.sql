@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE images ADD COLUMN raw_content_type TEXT;
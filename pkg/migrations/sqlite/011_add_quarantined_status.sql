@@ -0,0 +1,4 @@
+-- +goose Up
+-- Статус Quarantined разрешен ограничением valid_status из 001:
+-- миграция сохраняет общую с Postgres нумерацию версий
+SELECT 1;
@@ -0,0 +1,4 @@
+-- +goose Up
+-- Очередь задач в таблице jobs есть только у PostgreSQL:
+-- миграция сохраняет общую с Postgres нумерацию версий
+SELECT 1;
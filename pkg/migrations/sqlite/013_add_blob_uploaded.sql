@@ -0,0 +1,4 @@
+-- +goose Up
+-- Новый blob не считается загруженным, пока загрузка не подтверждена:
+-- до этого каждый, кто ссылается на него, загружает содержимое сам
+ALTER TABLE raw_blobs ADD COLUMN uploaded INTEGER NOT NULL DEFAULT 1;